@@ -0,0 +1,212 @@
+// Package backup copies the SQLite database while the API keeps serving,
+// keeps a rotation of those copies and restores them.
+//
+// The copies are made with VACUUM INTO, so they are consistent snapshots and
+// don't block the writers for longer than a regular read transaction.
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zatarain/note-vook/models"
+)
+
+const (
+	Prefix              string = "notevook-"
+	Extension           string = ".db"
+	CompressedExtension string = ".db.gz"
+
+	// TimeFormat sorts the names of the backups by their creation time
+	TimeFormat string = "20060102T150405.000Z"
+
+	// CreateKind is the job backing up the database and rotating the backups
+	CreateKind string = "backups.create"
+
+	partialSuffix string = ".partial"
+)
+
+// Backup describes a copy of the database within the backups directory.
+type Backup struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Compressed bool      `json:"compressed"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Manager creates the backups of a database within a directory, keeping only
+// the most recent ones.
+type Manager struct {
+	Database  models.DataAccessInterface
+	Directory string
+	Compress  bool
+	Keep      int
+	Logger    *slog.Logger
+	mutex     sync.Mutex
+}
+
+// parse tells whether the filename is one of a backup and when it was created.
+func parse(name string) (Backup, bool) {
+	backup := Backup{Name: name}
+	stamp := strings.TrimPrefix(name, Prefix)
+	switch {
+	case strings.HasSuffix(stamp, CompressedExtension):
+		stamp, backup.Compressed = strings.TrimSuffix(stamp, CompressedExtension), true
+	case strings.HasSuffix(stamp, Extension):
+		stamp = strings.TrimSuffix(stamp, Extension)
+	default:
+		return backup, false
+	}
+
+	created, exception := time.Parse(TimeFormat, stamp)
+	if !strings.HasPrefix(name, Prefix) || exception != nil {
+		return backup, false
+	}
+	backup.CreatedAt = created
+	return backup, true
+}
+
+// Create copies the database into a new backup, compressed with gzip when
+// asked to, and then removes the oldest backups beyond the ones to keep.
+func (manager *Manager) Create(current context.Context, compress bool) (*Backup, error) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	connection, exception := manager.Database.DB()
+	if exception != nil {
+		return nil, fmt.Errorf("failed to get generic SQL connection pointer: %w", exception)
+	}
+	if exception := os.MkdirAll(manager.Directory, 0o750); exception != nil {
+		return nil, fmt.Errorf("failed to create the backups directory: %w", exception)
+	}
+
+	created := time.Now().UTC()
+	name := Prefix + created.Format(TimeFormat) + Extension
+	if compress {
+		name = Prefix + created.Format(TimeFormat) + CompressedExtension
+	}
+	filename := filepath.Join(manager.Directory, name)
+
+	// The snapshot is written aside, so a failure never leaves a truncated backup
+	snapshot := filepath.Join(manager.Directory, Prefix+created.Format(TimeFormat)+Extension+partialSuffix)
+	defer os.Remove(snapshot)
+	if _, exception := connection.ExecContext(current, "VACUUM INTO ?", snapshot); exception != nil {
+		return nil, fmt.Errorf("failed to copy the database: %w", exception)
+	}
+
+	if compress {
+		compressed := filename + partialSuffix
+		defer os.Remove(compressed)
+		if exception := gzipFile(snapshot, compressed); exception != nil {
+			return nil, fmt.Errorf("failed to compress the backup: %w", exception)
+		}
+		snapshot = compressed
+	}
+	if exception := os.Rename(snapshot, filename); exception != nil {
+		return nil, exception
+	}
+
+	info, exception := os.Stat(filename)
+	if exception != nil {
+		return nil, exception
+	}
+	backup := &Backup{Name: name, Size: info.Size(), Compressed: compress, CreatedAt: created}
+	manager.Logger.Info("Database backup created", "name", backup.Name, "size", backup.Size)
+
+	if exception := manager.rotate(); exception != nil {
+		manager.Logger.Warn("Failed to rotate the backups", "error", exception)
+	}
+	return backup, nil
+}
+
+// List returns the backups within the directory, the newest first.
+func (manager *Manager) List() ([]Backup, error) {
+	entries, exception := os.ReadDir(manager.Directory)
+	if errors.Is(exception, os.ErrNotExist) {
+		return []Backup{}, nil
+	}
+	if exception != nil {
+		return nil, exception
+	}
+
+	backups := []Backup{}
+	for _, entry := range entries {
+		backup, ok := parse(entry.Name())
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		if info, exception := entry.Info(); exception == nil {
+			backup.Size = info.Size()
+		}
+		backups = append(backups, backup)
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// Rotate removes the oldest backups beyond the ones to keep.
+func (manager *Manager) Rotate() error {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	return manager.rotate()
+}
+
+func (manager *Manager) rotate() error {
+	if manager.Keep < 1 {
+		return nil
+	}
+
+	backups, exception := manager.List()
+	if exception != nil || len(backups) <= manager.Keep {
+		return exception
+	}
+	for _, backup := range backups[manager.Keep:] {
+		if exception := os.Remove(filepath.Join(manager.Directory, backup.Name)); exception != nil {
+			return exception
+		}
+		manager.Logger.Info("Database backup removed", "name", backup.Name)
+	}
+	return nil
+}
+
+// Handle is the handler of the CreateKind jobs, it creates a backup and
+// rotates the previous ones.
+func (manager *Manager) Handle(current context.Context, _ *models.Job) error {
+	_, exception := manager.Create(current, manager.Compress)
+	return exception
+}
+
+func gzipFile(source string, target string) error {
+	input, exception := os.Open(source)
+	if exception != nil {
+		return exception
+	}
+	defer input.Close()
+
+	output, exception := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if exception != nil {
+		return exception
+	}
+	defer output.Close()
+
+	writer := gzip.NewWriter(output)
+	if _, exception := io.Copy(writer, input); exception != nil {
+		return exception
+	}
+	if exception := writer.Close(); exception != nil {
+		return exception
+	}
+	return output.Close()
+}
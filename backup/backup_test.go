@@ -0,0 +1,185 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var entities = []interface{}{&models.User{}, &models.Video{}, &models.Annotation{}}
+
+// seeded creates a database file with a user and one video.
+func seeded(test *testing.T, filename string) *gorm.DB {
+	database, exception := gorm.Open(sqlite.Open(filename), &gorm.Config{Logger: logger.Discard})
+	require.Nil(test, exception)
+	require.Nil(test, database.AutoMigrate(entities...))
+	user := &models.User{Nickname: "dummy", Password: "hash"}
+	require.Nil(test, database.Create(user).Error)
+	require.Nil(test, database.Create(&models.Video{UserID: user.ID, Title: "Dummy", Link: "https://dummy.io/video"}).Error)
+	test.Cleanup(func() {
+		connection, _ := database.DB()
+		connection.Close()
+	})
+	return database
+}
+
+func count(test *testing.T, filename string) int64 {
+	database, exception := gorm.Open(sqlite.Open(filename), &gorm.Config{Logger: logger.Discard})
+	require.Nil(test, exception)
+	connection, _ := database.DB()
+	defer connection.Close()
+	var videos int64
+	require.Nil(test, database.Model(&models.Video{}).Count(&videos).Error)
+	return videos
+}
+
+func TestCreate(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	directory := test.TempDir()
+	manager := &Manager{
+		Database:  seeded(test, filepath.Join(directory, "live.db")),
+		Directory: filepath.Join(directory, "backups"),
+		Keep:      2,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	test.Run("Should copy the database into the backups directory", func(test *testing.T) {
+		// Act
+		backup, exception := manager.Create(context.Background(), false)
+
+		// Assert
+		require.Nil(exception)
+		assert.False(backup.Compressed)
+		assert.Regexp(`^notevook-\d{8}T\d{6}\.\d{3}Z\.db$`, backup.Name)
+		assert.Positive(backup.Size)
+		assert.Equal(int64(1), count(test, filepath.Join(manager.Directory, backup.Name)))
+	})
+
+	test.Run("Should compress the backup with gzip", func(test *testing.T) {
+		// Act
+		backup, exception := manager.Create(context.Background(), true)
+
+		// Assert
+		require.Nil(exception)
+		assert.True(backup.Compressed)
+		file, exception := os.Open(filepath.Join(manager.Directory, backup.Name))
+		require.Nil(exception)
+		defer file.Close()
+		reader, exception := gzip.NewReader(file)
+		require.Nil(exception)
+		header := make([]byte, 16)
+		io.ReadFull(reader, header)
+		assert.Equal("SQLite format 3\x00", string(header))
+	})
+
+	test.Run("Should keep only the newest backups", func(test *testing.T) {
+		// Arrange
+		before, _ := manager.List()
+		time.Sleep(time.Millisecond)
+
+		// Act
+		backup, exception := manager.Create(context.Background(), false)
+
+		// Assert
+		require.Nil(exception)
+		after, exception := manager.List()
+		require.Nil(exception)
+		assert.Len(after, 2)
+		assert.Equal(backup.Name, after[0].Name)
+		assert.Equal(before[0].Name, after[1].Name)
+		partials, _ := filepath.Glob(filepath.Join(manager.Directory, "*"+partialSuffix))
+		assert.Empty(partials)
+	})
+}
+
+func TestList(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should list nothing when the directory doesn't exist", func(test *testing.T) {
+		// Arrange
+		manager := &Manager{Directory: filepath.Join(test.TempDir(), "missing")}
+
+		// Act
+		backups, exception := manager.List()
+
+		// Assert
+		assert.Nil(exception)
+		assert.Empty(backups)
+	})
+
+	test.Run("Should ignore the files that are not backups", func(test *testing.T) {
+		// Arrange
+		manager := &Manager{Directory: test.TempDir()}
+		for _, name := range []string{
+			"notevook-20261019T101500.000Z.db",
+			"notevook-20261020T101500.000Z.db.gz",
+			"notevook-20261021T101500.000Z.db.partial",
+			"notevook-yesterday.db",
+			"notes.db",
+		} {
+			os.WriteFile(filepath.Join(manager.Directory, name), []byte("dummy"), 0o600)
+		}
+
+		// Act
+		backups, exception := manager.List()
+
+		// Assert
+		assert.Nil(exception)
+		assert.Equal([]Backup{
+			{
+				Name:       "notevook-20261020T101500.000Z.db.gz",
+				Size:       5,
+				Compressed: true,
+				CreatedAt:  time.Date(2026, time.October, 20, 10, 15, 0, 0, time.UTC),
+			},
+			{
+				Name:      "notevook-20261019T101500.000Z.db",
+				Size:      5,
+				CreatedAt: time.Date(2026, time.October, 19, 10, 15, 0, 0, time.UTC),
+			},
+		}, backups)
+	})
+}
+
+func TestHandle(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should back up and rotate on the jobs", func(test *testing.T) {
+		// Arrange
+		directory := test.TempDir()
+		manager := &Manager{
+			Database:  seeded(test, filepath.Join(directory, "live.db")),
+			Directory: filepath.Join(directory, "backups"),
+			Compress:  true,
+			Keep:      1,
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		}
+
+		// Act
+		first := manager.Handle(context.Background(), &models.Job{Kind: CreateKind})
+		second := manager.Handle(context.Background(), &models.Job{Kind: CreateKind})
+
+		// Assert
+		require.Nil(first)
+		require.Nil(second)
+		backups, exception := manager.List()
+		require.Nil(exception)
+		require.Len(backups, 1)
+		assert.True(backups[0].Compressed)
+	})
+}
@@ -0,0 +1,123 @@
+package backup
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const (
+	restoringSuffix string = ".restoring"
+
+	// ReplacedSuffix is added to the files of the database replaced by a
+	// restore, along with the time of the restore
+	ReplacedSuffix string = ".before-restore-"
+)
+
+// sidecars are the files SQLite keeps next to the database while it's in use.
+var sidecars = []string{"", "-wal", "-shm", "-journal"}
+
+// Restore replaces the database file by the given backup. The backup is first
+// copied next to the database, checked for corruption and migrated to the
+// given models, so the database is only replaced when it's usable. The
+// replaced files are kept with ReplacedSuffix and the name of the replaced
+// database is returned, if there was any. The server must be stopped while
+// restoring, as its connections would still see the old file.
+func Restore(source string, target string, entities []interface{}) (string, error) {
+	staging := target + restoringSuffix
+	defer os.Remove(staging)
+	if exception := extract(source, staging); exception != nil {
+		return "", fmt.Errorf("failed to read the backup: %w", exception)
+	}
+	if exception := Validate(staging, entities); exception != nil {
+		return "", fmt.Errorf("incompatible backup: %w", exception)
+	}
+
+	replaced := ""
+	suffix := ReplacedSuffix + time.Now().UTC().Format(TimeFormat)
+	for _, sidecar := range sidecars {
+		exception := os.Rename(target+sidecar, target+sidecar+suffix)
+		if exception != nil && !errors.Is(exception, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to keep the current database: %w", exception)
+		}
+		if exception == nil && sidecar == "" {
+			replaced = target + suffix
+		}
+	}
+	return replaced, os.Rename(staging, target)
+}
+
+// Validate checks the database file is not corrupted and has the tables of
+// the given models. The columns added since the backup are migrated, so older
+// backups are still compatible as long as the migration succeeds.
+func Validate(filename string, entities []interface{}) error {
+	database, exception := gorm.Open(sqlite.Open(filename), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if exception != nil {
+		return exception
+	}
+	connection, exception := database.DB()
+	if exception != nil {
+		return exception
+	}
+	defer connection.Close()
+
+	var results []string
+	if exception := database.Raw("PRAGMA integrity_check").Scan(&results).Error; exception != nil {
+		return exception
+	}
+	if len(results) != 1 || results[0] != "ok" {
+		return fmt.Errorf("corrupted database: %s", strings.Join(results, "; "))
+	}
+
+	migrator := database.Migrator()
+	for _, model := range entities {
+		if !migrator.HasTable(model) {
+			// Report the missing table by its name
+			return models.CheckSchema(migrator, []interface{}{model})
+		}
+	}
+	if exception := database.AutoMigrate(entities...); exception != nil {
+		return fmt.Errorf("failed to migrate: %w", exception)
+	}
+	return models.CheckSchema(migrator, entities)
+}
+
+// extract copies the backup into the target, decompressing it if needed.
+func extract(source string, target string) error {
+	input, exception := os.Open(source)
+	if exception != nil {
+		return exception
+	}
+	defer input.Close()
+
+	var reader io.Reader = input
+	if strings.HasSuffix(source, ".gz") {
+		decompressor, exception := gzip.NewReader(input)
+		if exception != nil {
+			return exception
+		}
+		defer decompressor.Close()
+		reader = decompressor
+	}
+
+	output, exception := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if exception != nil {
+		return exception
+	}
+	defer output.Close()
+	if _, exception := io.Copy(output, reader); exception != nil {
+		return exception
+	}
+	return output.Close()
+}
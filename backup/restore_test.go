@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestRestore(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should replace the database keeping the current one aside", func(test *testing.T) {
+		for _, compress := range []bool{false, true} {
+			// Arrange
+			directory := test.TempDir()
+			live := filepath.Join(directory, "live.db")
+			database := seeded(test, live)
+			manager := &Manager{
+				Database:  database,
+				Directory: filepath.Join(directory, "backups"),
+				Keep:      1,
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			backup, exception := manager.Create(context.Background(), compress)
+			require.Nil(exception)
+			database.Create(&models.Video{UserID: 1, Title: "After", Link: "https://dummy.io/after"})
+
+			// Act
+			replaced, exception := Restore(filepath.Join(manager.Directory, backup.Name), live, entities)
+
+			// Assert
+			assert.Nil(exception)
+			assert.Equal(int64(1), count(test, live))
+			assert.Contains(replaced, live+ReplacedSuffix)
+			assert.Equal(int64(2), count(test, replaced))
+			_, exception = os.Stat(live + restoringSuffix)
+			assert.ErrorIs(exception, os.ErrNotExist)
+		}
+	})
+
+	test.Run("Should migrate the backups made before the latest columns", func(test *testing.T) {
+		// Arrange
+		directory := test.TempDir()
+		source := filepath.Join(directory, "old.db")
+		database, exception := gorm.Open(sqlite.Open(source), &gorm.Config{Logger: logger.Discard})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(entities...))
+		require.Nil(database.Migrator().DropColumn(&models.User{}, "disabled_at"))
+		connection, _ := database.DB()
+		connection.Close()
+
+		// Act
+		exception = Validate(source, entities)
+
+		// Assert
+		assert.Nil(exception)
+	})
+
+	testcases := []struct {
+		Description string
+		Filename    string
+		Content     func(filename string)
+		Expected    string
+	}{
+		{
+			Description: "Should reject a file that is not a database",
+			Filename:    "backup.db",
+			Content: func(filename string) {
+				os.WriteFile(filename, []byte("not a database, just some notes"), 0o600)
+			},
+			Expected: "incompatible backup: file is not a database",
+		},
+		{
+			Description: "Should reject a database without the tables of the models",
+			Filename:    "backup.db",
+			Content: func(filename string) {
+				database, _ := gorm.Open(sqlite.Open(filename), &gorm.Config{Logger: logger.Discard})
+				database.AutoMigrate(&models.User{})
+				connection, _ := database.DB()
+				connection.Close()
+			},
+			Expected: "incompatible backup: missing table",
+		},
+		{
+			Description: "Should reject a compressed file that is not gzip",
+			Filename:    "backup.db.gz",
+			Content: func(filename string) {
+				os.WriteFile(filename, []byte("plain"), 0o600)
+			},
+			Expected: "failed to read the backup",
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			directory := test.TempDir()
+			live := filepath.Join(directory, "live.db")
+			seeded(test, live)
+			source := filepath.Join(directory, testcase.Filename)
+			testcase.Content(source)
+
+			// Act
+			_, exception := Restore(source, live, entities)
+
+			// Assert
+			assert.ErrorContains(exception, testcase.Expected)
+			assert.Equal(int64(1), count(test, live))
+			replaced, _ := filepath.Glob(live + ReplacedSuffix + "*")
+			assert.Empty(replaced)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Backoff tells how many times a request is attempted and how long to wait
+// between the attempts, growing exponentially from Initial up to Maximum.
+type Backoff struct {
+	Attempts   int
+	Initial    time.Duration
+	Maximum    time.Duration
+	Multiplier float64
+}
+
+var DefaultBackoff = Backoff{
+	Attempts:   4,
+	Initial:    200 * time.Millisecond,
+	Maximum:    5 * time.Second,
+	Multiplier: 2,
+}
+
+// Delay is the time to wait after the given failed attempt (starting at 1).
+// It's overridden by the Retry-After header of the response, if any, as long
+// as it's not beyond the maximum.
+func (backoff Backoff) Delay(attempt int, response *http.Response) time.Duration {
+	delay := float64(backoff.Initial)
+	for step := 1; step < attempt; step++ {
+		delay *= backoff.Multiplier
+	}
+	if delay > float64(backoff.Maximum) {
+		delay = float64(backoff.Maximum)
+	}
+
+	if response != nil {
+		if seconds, exception := strconv.Atoi(response.Header.Get("Retry-After")); exception == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, backoff.Maximum)
+		}
+	}
+	return time.Duration(delay)
+}
+
+// retryable tells whether a failed request can be sent again. Only the
+// idempotent methods and the requests with an idempotency key are retried,
+// either when the API couldn't be reached or when it's temporarily unable to
+// serve.
+func retryable(request *http.Request, response *http.Response, exception error) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+	default:
+		if request.Header.Get(IdempotencyKeyHeader) == "" {
+			return false
+		}
+	}
+
+	if exception != nil {
+		return !errors.Is(exception, context.Canceled) && !errors.Is(exception, context.DeadlineExceeded)
+	}
+
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,349 @@
+// Package client is a typed Go client for the NoteVook API. It keeps the
+// authorisation token given on login, retries the idempotent requests (and the
+// POST ones, sending an idempotency key) with exponential backoff and reports
+// the problem details of the API as errors.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+)
+
+const (
+	// Prefix is the version of the API the client talks to.
+	Prefix string = "/v1"
+
+	// AuthorisationCookie is the cookie where the API expects the token.
+	AuthorisationCookie string = "Authorisation"
+
+	// IdempotencyKeyHeader identifies the attempts of the same POST request, so
+	// the API serves it only once.
+	IdempotencyKeyHeader string = "Idempotency-Key"
+)
+
+// Client calls the end-points of a NoteVook API. It's safe to use it from
+// several goroutines as long as its fields are not changed meanwhile.
+type Client struct {
+	// BaseURL is the address of the API, e. g. http://localhost:4000
+	BaseURL    string
+	HTTPClient *http.Client
+	Tokens     TokenStore
+	Backoff    Backoff
+}
+
+// New creates a client for the API on the given address, keeping the token
+// in memory and using the default backoff.
+func New(base string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(base, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Tokens:     &MemoryTokenStore{},
+		Backoff:    DefaultBackoff,
+	}
+}
+
+func (client *Client) Signup(current context.Context, credentials controllers.Credentials) (*models.User, error) {
+	user := &models.User{}
+	if exception := client.do(current, http.MethodPost, "/signup", &credentials, user); exception != nil {
+		return nil, exception
+	}
+	return user, nil
+}
+
+// Login authenticates the user and saves the token on the store, so the
+// following requests are authorised. The users with two-factor authentication
+// get a *TwoFactorRequired error instead, whose challenge is completed with
+// LoginTwoFactor.
+func (client *Client) Login(current context.Context, credentials controllers.Credentials) error {
+	response, exception := client.send(current, http.MethodPost, "/login", &credentials)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusAccepted {
+		challenge := controllers.TwoFactorChallenge{}
+		if exception := json.NewDecoder(response.Body).Decode(&challenge); exception != nil {
+			return fmt.Errorf("failed to decode the two-factor challenge: %w", exception)
+		}
+		return &TwoFactorRequired{Challenge: challenge.Challenge, ExpiresAt: challenge.ExpiresAt}
+	}
+	return client.keep(response)
+}
+
+// LoginTwoFactor completes the login of a user with two-factor authentication
+// sending the challenge along with a code of the authenticator app or a
+// recovery code, and saves the token on the store.
+func (client *Client) LoginTwoFactor(current context.Context, challenge string, code string) error {
+	input := controllers.TwoFactorLoginContract{Challenge: challenge, Code: code}
+	response, exception := client.send(current, http.MethodPost, "/login/two-factor", &input)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+	return client.keep(response)
+}
+
+// keep saves on the store the token sent by the API on the response.
+func (client *Client) keep(response *http.Response) error {
+	for _, cookie := range response.Cookies() {
+		if cookie.Name == AuthorisationCookie {
+			return client.Tokens.SetToken(cookie.Value)
+		}
+	}
+	return errors.New("the API didn't send the authorisation token")
+}
+
+// Logout forgets the token of the user.
+func (client *Client) Logout() error {
+	return client.Tokens.SetToken("")
+}
+
+func (client *Client) Videos(current context.Context) ([]models.Video, error) {
+	var videos []models.Video
+	if exception := client.do(current, http.MethodGet, "/videos", nil, &videos); exception != nil {
+		return nil, exception
+	}
+	return videos, nil
+}
+
+func (client *Client) Video(current context.Context, id uint) (*models.Video, error) {
+	video := &models.Video{}
+	if exception := client.do(current, http.MethodGet, fmt.Sprintf("/videos/%d", id), nil, video); exception != nil {
+		return nil, exception
+	}
+	return video, nil
+}
+
+func (client *Client) AddVideo(current context.Context, input controllers.AddVideoContract) (*models.Video, error) {
+	video := &models.Video{}
+	if exception := client.do(current, http.MethodPost, "/videos", &input, video); exception != nil {
+		return nil, exception
+	}
+	return video, nil
+}
+
+func (client *Client) EditVideo(current context.Context, id uint, input controllers.EditVideoContract) (*models.Video, error) {
+	video := &models.Video{}
+	if exception := client.do(current, http.MethodPatch, fmt.Sprintf("/videos/%d", id), &input, video); exception != nil {
+		return nil, exception
+	}
+	return video, nil
+}
+
+func (client *Client) DeleteVideo(current context.Context, id uint) error {
+	return client.do(current, http.MethodDelete, fmt.Sprintf("/videos/%d", id), nil, nil)
+}
+
+func (client *Client) AddAnnotation(current context.Context, input controllers.AddAnnotationContract) (*models.Annotation, error) {
+	annotation := &models.Annotation{}
+	if exception := client.do(current, http.MethodPost, "/annotations", &input, annotation); exception != nil {
+		return nil, exception
+	}
+	return annotation, nil
+}
+
+func (client *Client) EditAnnotation(current context.Context, id uint, input controllers.EditAnnotationContract) (*models.Annotation, error) {
+	annotation := &models.Annotation{}
+	if exception := client.do(current, http.MethodPatch, fmt.Sprintf("/annotations/%d", id), &input, annotation); exception != nil {
+		return nil, exception
+	}
+	return annotation, nil
+}
+
+func (client *Client) DeleteAnnotation(current context.Context, id uint) error {
+	return client.do(current, http.MethodDelete, fmt.Sprintf("/annotations/%d", id), nil, nil)
+}
+
+// BatchAnnotations applies the operations on the annotations of the video in
+// a single transaction. The report tells the result of each operation, it's
+// also returned along with the problems.BatchRejected error when some of them
+// are not valid, so nothing is saved.
+func (client *Client) BatchAnnotations(current context.Context, video uint, operations []controllers.BatchOperation) (*controllers.BatchReport, error) {
+	report := &controllers.BatchReport{}
+	input := controllers.BatchContract{Operations: operations}
+	path := fmt.Sprintf("/videos/%d/annotations/batch", video)
+	exception := client.do(current, http.MethodPost, path, &input, report)
+	var rejection *Error
+	if errors.As(exception, &rejection) && errors.Is(rejection, problems.BatchRejected) {
+		encoded, _ := json.Marshal(rejection.Report)
+		if json.Unmarshal(encoded, report) == nil {
+			return report, exception
+		}
+	}
+	if exception != nil {
+		return nil, exception
+	}
+	return report, nil
+}
+
+// Export writes the ZIP archive with all the data of the user.
+func (client *Client) Export(current context.Context, output io.Writer) error {
+	response, exception := client.send(current, http.MethodGet, "/me/export", nil)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+
+	_, exception = io.Copy(output, response.Body)
+	return exception
+}
+
+// ChangePassword replaces the password of the user, which logs out all the
+// other sessions, and saves the new token of this one. The code is only needed
+// by the users with two-factor authentication.
+func (client *Client) ChangePassword(current context.Context, password string, code string, replacement string) error {
+	input := controllers.ChangePasswordContract{Password: password, Code: code, NewPassword: replacement}
+	response, exception := client.send(current, http.MethodPost, "/me/password", &input)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+	return client.keep(response)
+}
+
+// EnrolTwoFactor generates a new secret for the authenticator app of the user,
+// which has to be confirmed with ConfirmTwoFactor.
+func (client *Client) EnrolTwoFactor(current context.Context, password string) (*controllers.TwoFactorEnrolment, error) {
+	input := controllers.EnrolTwoFactorContract{Password: password}
+	enrolment := &controllers.TwoFactorEnrolment{}
+	if exception := client.do(current, http.MethodPost, "/me/two-factor", &input, enrolment); exception != nil {
+		return nil, exception
+	}
+	return enrolment, nil
+}
+
+// ConfirmTwoFactor enables the two-factor authentication of the user with a
+// code of the secret enrolled, returning the recovery codes.
+func (client *Client) ConfirmTwoFactor(current context.Context, code string) ([]string, error) {
+	input := controllers.TwoFactorCodeContract{Code: code}
+	recovery := &controllers.TwoFactorRecovery{}
+	if exception := client.do(current, http.MethodPost, "/me/two-factor/confirm", &input, recovery); exception != nil {
+		return nil, exception
+	}
+	return recovery.RecoveryCodes, nil
+}
+
+// RecoveryCodes replaces the recovery codes of the user with new ones.
+func (client *Client) RecoveryCodes(current context.Context, code string) ([]string, error) {
+	input := controllers.TwoFactorCodeContract{Code: code}
+	recovery := &controllers.TwoFactorRecovery{}
+	if exception := client.do(current, http.MethodPost, "/me/two-factor/recovery-codes", &input, recovery); exception != nil {
+		return nil, exception
+	}
+	return recovery.RecoveryCodes, nil
+}
+
+// DisableTwoFactor disables the two-factor authentication of the user.
+func (client *Client) DisableTwoFactor(current context.Context, password string, code string) error {
+	input := controllers.DisableTwoFactorContract{Password: password, Code: code}
+	return client.do(current, http.MethodDelete, "/me/two-factor", &input, nil)
+}
+
+// DeleteAccount deletes the user along with its videos and annotations, then
+// forgets its token. The code is only needed by the users with two-factor
+// authentication.
+func (client *Client) DeleteAccount(current context.Context, password string, code string) error {
+	input := controllers.DeleteAccountContract{Password: password, Code: code}
+	if exception := client.do(current, http.MethodDelete, "/me", &input, nil); exception != nil {
+		return exception
+	}
+	return client.Logout()
+}
+
+// do sends the request and decodes the JSON response into output, unless
+// it's nil.
+func (client *Client) do(current context.Context, method string, path string, input any, output any) error {
+	response, exception := client.send(current, method, path, input)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+
+	if output == nil {
+		_, exception = io.Copy(io.Discard, response.Body)
+		return exception
+	}
+	if exception := json.NewDecoder(response.Body).Decode(output); exception != nil {
+		return fmt.Errorf("failed to decode the response of %s %s: %w", method, path, exception)
+	}
+	return nil
+}
+
+// send makes the request, retrying it while the backoff allows. The response
+// is only returned when it's successful, otherwise its problem is the error.
+func (client *Client) send(current context.Context, method string, path string, input any) (*http.Response, error) {
+	var body []byte
+	if input != nil {
+		encoded, exception := json.Marshal(input)
+		if exception != nil {
+			return nil, fmt.Errorf("failed to encode the request of %s %s: %w", method, path, exception)
+		}
+		body = encoded
+	}
+
+	token, exception := client.Tokens.Token()
+	if exception != nil {
+		return nil, fmt.Errorf("failed to read the authorisation token: %w", exception)
+	}
+
+	// All the attempts of a POST request share the key, so they can be retried
+	key := ""
+	if method == http.MethodPost {
+		identifier := make([]byte, 16)
+		if _, exception := rand.Read(identifier); exception != nil {
+			return nil, fmt.Errorf("failed to generate the idempotency key: %w", exception)
+		}
+		key = hex.EncodeToString(identifier)
+	}
+
+	for attempt := 1; ; attempt++ {
+		request, exception := http.NewRequestWithContext(current, method, client.BaseURL+Prefix+path, bytes.NewReader(body))
+		if exception != nil {
+			return nil, exception
+		}
+		if input != nil {
+			request.Header.Set("Content-Type", "application/json")
+		}
+		if key != "" {
+			request.Header.Set(IdempotencyKeyHeader, key)
+		}
+		request.Header.Set("Accept", "application/json")
+		if token != "" {
+			request.AddCookie(&http.Cookie{Name: AuthorisationCookie, Value: token})
+		}
+
+		response, exception := client.HTTPClient.Do(request)
+		if exception == nil && response.StatusCode < http.StatusBadRequest {
+			return response, nil
+		}
+
+		var failure error = exception
+		if exception == nil {
+			failure = decodeError(response)
+		}
+		if attempt >= client.Backoff.Attempts || !retryable(request, response, exception) {
+			return nil, failure
+		}
+
+		delay := client.Backoff.Delay(attempt, response)
+		select {
+		case <-current.Done():
+			return nil, errors.Join(failure, current.Err())
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/configuration"
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/totp"
+)
+
+// serve runs the whole API on a temporary database.
+func serve(test *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	filename := filepath.Join(test.TempDir(), "client.db")
+	database, connection, exception := configuration.ConnectToDatabase(configuration.DatabaseConfig{Filename: filename}, logger)
+	require.Nil(test, exception)
+	configuration.MigrateDatabase(database)
+
+	engine := gin.New()
+	configuration.SetupProblems(engine)
+	config := &configuration.Config{}
+	config.Security.SecretTokenKey = "client-test-secret-token-key-with-enough-length"
+	configuration.Setup(engine, config, database, logging.New(io.Discard, logging.FormatJSON, slog.LevelInfo, nil))
+
+	server := httptest.NewServer(engine)
+	test.Cleanup(func() {
+		server.Close()
+		connection.Close()
+	})
+	return server
+}
+
+// quick is a backoff that doesn't slow down the tests.
+var quick = Backoff{Attempts: 3, Initial: time.Millisecond, Maximum: 10 * time.Millisecond, Multiplier: 2}
+
+func TestClient(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	background := context.Background()
+	server := serve(test)
+	client := New(server.URL + "/")
+	credentials := controllers.Credentials{Nickname: "dummy", Password: "dummy-password"}
+
+	test.Run("Should sign up and log in storing the token", func(test *testing.T) {
+		// Act
+		user, signup := client.Signup(background, credentials)
+		login := client.Login(background, credentials)
+
+		// Assert
+		require.Nil(signup)
+		require.Nil(login)
+		assert.Equal("dummy", user.Nickname)
+		token, _ := client.Tokens.Token()
+		assert.NotEmpty(token)
+	})
+
+	test.Run("Should manage the videos and their annotations", func(test *testing.T) {
+		// Act
+		video, adding := client.AddVideo(background, controllers.AddVideoContract{
+			Title:    "Dummy video",
+			Link:     "https://www.youtube.com/watch?v=dummy",
+			Duration: models.TimeStamp(300),
+		})
+		require.Nil(adding)
+		annotation, annotating := client.AddAnnotation(background, controllers.AddAnnotationContract{
+			VideoID: video.ID,
+			Title:   "Intro",
+			Start:   models.TimeStamp(10),
+			End:     models.TimeStamp(70),
+		})
+		require.Nil(annotating)
+		edited, editing := client.EditAnnotation(background, annotation.ID, controllers.EditAnnotationContract{
+			Title: "Introduction",
+			Start: models.TimeStamp(5),
+			End:   models.TimeStamp(70),
+		})
+		renamed, renaming := client.EditVideo(background, video.ID, controllers.EditVideoContract{Title: "Renamed video"})
+		viewed, viewing := client.Video(background, video.ID)
+		videos, listing := client.Videos(background)
+
+		// Assert
+		require.Nil(editing)
+		require.Nil(renaming)
+		require.Nil(viewing)
+		require.Nil(listing)
+		assert.Equal(models.TimeStamp(300), video.Duration)
+		assert.Equal("Introduction", edited.Title)
+		assert.Equal(models.TimeStamp(5), edited.Start)
+		assert.Equal("Renamed video", renamed.Title)
+		assert.Len(viewed.Annotations, 1)
+		assert.Len(videos, 1)
+
+		// Act
+		unannotating := client.DeleteAnnotation(background, annotation.ID)
+		deleting := client.DeleteVideo(background, video.ID)
+		_, searching := client.Video(background, video.ID)
+
+		// Assert
+		assert.Nil(unannotating)
+		assert.Nil(deleting)
+		assert.ErrorIs(searching, problems.VideoNotFound)
+	})
+
+	test.Run("Should apply a batch of operations on the annotations", func(test *testing.T) {
+		// Arrange
+		video, adding := client.AddVideo(background, controllers.AddVideoContract{
+			Title:    "Batched video",
+			Link:     "https://www.youtube.com/watch?v=batched",
+			Duration: models.TimeStamp(300),
+		})
+		require.Nil(adding)
+		operation := func(temporary string, title string) controllers.BatchOperation {
+			return controllers.BatchOperation{
+				Operation: controllers.BatchCreate,
+				TempID:    temporary,
+				EditAnnotationContract: controllers.EditAnnotationContract{
+					Title: title, Start: models.TimeStamp(10), End: models.TimeStamp(20),
+				},
+			}
+		}
+
+		// Act
+		report, batching := client.BatchAnnotations(background, video.ID, []controllers.BatchOperation{
+			operation("first", "First"),
+			operation("second", "Second"),
+		})
+		viewed, viewing := client.Video(background, video.ID)
+
+		// Assert
+		require.Nil(batching)
+		require.Nil(viewing)
+		assert.True(report.Committed)
+		assert.Len(report.IDs, 2)
+		require.Len(viewed.Annotations, 2)
+		assert.Equal(report.IDs["second"], viewed.Annotations[1].ID)
+	})
+
+	test.Run("Should report the operations of a rejected batch", func(test *testing.T) {
+		// Arrange
+		video, adding := client.AddVideo(background, controllers.AddVideoContract{
+			Title:    "Rejected batch",
+			Link:     "https://www.youtube.com/watch?v=rejected",
+			Duration: models.TimeStamp(60),
+		})
+		require.Nil(adding)
+
+		// Act
+		report, batching := client.BatchAnnotations(background, video.ID, []controllers.BatchOperation{
+			{Operation: controllers.BatchCreate, TempID: "fine", EditAnnotationContract: controllers.EditAnnotationContract{
+				Title: "Fine", Start: models.TimeStamp(1), End: models.TimeStamp(2),
+			}},
+			{Operation: controllers.BatchCreate, TempID: "late", EditAnnotationContract: controllers.EditAnnotationContract{
+				Title: "Late", Start: models.TimeStamp(50), End: models.TimeStamp(90),
+			}},
+		})
+
+		// Assert
+		assert.ErrorIs(batching, problems.BatchRejected)
+		require.NotNil(report)
+		assert.False(report.Committed)
+		require.Len(report.Results, 2)
+		assert.Equal(controllers.ResultFailed, report.Results[1].Status)
+		assert.Equal("invalid_interval", report.Results[1].Error.Code)
+	})
+
+	test.Run("Should map the problems of the API to errors", func(test *testing.T) {
+		testcases := []struct {
+			Name     string
+			Call     func() error
+			Status   int
+			Expected *problems.Problem
+		}{
+			{
+				Name: "Should report a duplicated nickname",
+				Call: func() error {
+					_, exception := client.Signup(background, credentials)
+					return exception
+				},
+				Status:   http.StatusConflict,
+				Expected: problems.DuplicateNickname,
+			},
+			{
+				Name: "Should report wrong credentials",
+				Call: func() error {
+					return client.Login(background, controllers.Credentials{Nickname: "dummy", Password: "wrong"})
+				},
+				Status:   http.StatusUnauthorized,
+				Expected: problems.InvalidCredentials,
+			},
+			{
+				Name: "Should report the fields failing the validation",
+				Call: func() error {
+					_, exception := client.AddVideo(background, controllers.AddVideoContract{Title: "Dummy", Link: "dummy", Duration: 10})
+					return exception
+				},
+				Status:   http.StatusBadRequest,
+				Expected: problems.ValidationFailed,
+			},
+			{
+				Name: "Should report an annotation out of the video",
+				Call: func() error {
+					video, _ := client.AddVideo(background, controllers.AddVideoContract{
+						Title:    "Short video",
+						Link:     "https://www.youtube.com/watch?v=short",
+						Duration: 60,
+					})
+					_, exception := client.AddAnnotation(background, controllers.AddAnnotationContract{
+						VideoID: video.ID, Title: "Too long", Start: 10, End: 90,
+					})
+					return exception
+				},
+				Status:   http.StatusBadRequest,
+				Expected: problems.InvalidInterval,
+			},
+			{
+				Name:     "Should report a missing annotation",
+				Call:     func() error { return client.DeleteAnnotation(background, 404) },
+				Status:   http.StatusNotFound,
+				Expected: problems.AnnotationNotFound,
+			},
+		}
+
+		for _, testcase := range testcases {
+			test.Run(testcase.Name, func(test *testing.T) {
+				// Act
+				exception := testcase.Call()
+
+				// Assert
+				var failure *Error
+				require.ErrorAs(exception, &failure)
+				assert.Equal(testcase.Status, failure.StatusCode)
+				assert.ErrorIs(exception, testcase.Expected)
+				assert.Equal(testcase.Expected.Title, failure.Title)
+			})
+		}
+	})
+
+	test.Run("Should change the password logging out the other sessions", func(test *testing.T) {
+		// Arrange
+		other := New(server.URL)
+		require.Nil(other.Login(background, credentials))
+
+		// Act
+		changing := client.ChangePassword(background, credentials.Password, "", "Sunset-Drive-1986")
+		_, listing := client.Videos(background)
+		_, revoked := other.Videos(background)
+		restoring := client.ChangePassword(background, "Sunset-Drive-1986", "", credentials.Password)
+
+		// Assert
+		require.Nil(changing)
+		assert.Nil(listing)
+		assert.ErrorIs(revoked, problems.Unauthorised)
+		assert.Nil(restoring)
+	})
+
+	test.Run("Should be unauthorised after logging out", func(test *testing.T) {
+		// Act
+		logout := client.Logout()
+		_, exception := client.Videos(background)
+
+		// Assert
+		assert.Nil(logout)
+		assert.ErrorIs(exception, problems.Unauthorised)
+	})
+
+	test.Run("Should log in with two-factor authentication once enabled", func(test *testing.T) {
+		// Arrange
+		require.Nil(client.Login(background, credentials))
+		enrolment, exception := client.EnrolTwoFactor(background, credentials.Password)
+		require.Nil(exception)
+		code, exception := totp.Code(enrolment.Secret, totp.Step(time.Now()))
+		require.Nil(exception)
+		codes, exception := client.ConfirmTwoFactor(background, code)
+		require.Nil(exception)
+		require.Nil(client.Logout())
+
+		// Act
+		login := client.Login(background, credentials)
+		var required *TwoFactorRequired
+		require.ErrorAs(login, &required)
+		wrong := client.LoginTwoFactor(background, required.Challenge, "000000")
+		completing := client.LoginTwoFactor(background, required.Challenge, codes[0])
+		_, listing := client.Videos(background)
+		missing := client.ChangePassword(background, credentials.Password, "", credentials.Password)
+		changing := client.ChangePassword(background, credentials.Password, codes[1], credentials.Password)
+		disabling := client.DisableTwoFactor(background, credentials.Password, codes[2])
+
+		// Assert
+		assert.ErrorIs(wrong, problems.InvalidCode)
+		assert.Nil(completing)
+		assert.Nil(listing)
+		assert.ErrorIs(missing, problems.ValidationFailed)
+		assert.Nil(changing)
+		assert.Nil(disabling)
+		assert.Nil(client.Login(background, credentials))
+	})
+
+	test.Run("Should export the data and delete the account", func(test *testing.T) {
+		// Arrange
+		require.Nil(client.Login(background, credentials))
+		var archive bytes.Buffer
+
+		// Act
+		exporting := client.Export(background, &archive)
+		mismatch := client.DeleteAccount(background, "wrong-password", "")
+		deleting := client.DeleteAccount(background, credentials.Password, "")
+		login := client.Login(background, credentials)
+
+		// Assert
+		assert.Nil(exporting)
+		assert.Equal("PK", archive.String()[:2])
+		assert.ErrorIs(mismatch, problems.PasswordMismatch)
+		assert.Nil(deleting)
+		token, _ := client.Tokens.Token()
+		assert.Empty(token)
+		assert.ErrorIs(login, problems.InvalidCredentials)
+	})
+}
+
+func TestRetries(test *testing.T) {
+	assert := assert.New(test)
+
+	testcases := []struct {
+		Name     string
+		Method   string
+		Failures int32
+		Attempts int32
+		Success  bool
+	}{
+		{
+			Name:     "Should retry an idempotent request until it succeeds",
+			Method:   http.MethodGet,
+			Failures: 2,
+			Attempts: 3,
+			Success:  true,
+		},
+		{
+			Name:     "Should give up after the attempts of the backoff",
+			Method:   http.MethodDelete,
+			Failures: 5,
+			Attempts: 3,
+		},
+		{
+			Name:     "Should retry a POST request with the same idempotency key",
+			Method:   http.MethodPost,
+			Failures: 1,
+			Attempts: 2,
+			Success:  true,
+		},
+		{
+			Name:     "Should not retry a request that is not idempotent",
+			Method:   http.MethodPatch,
+			Failures: 1,
+			Attempts: 1,
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Name, func(test *testing.T) {
+			// Arrange
+			var attempts atomic.Int32
+			keys := map[string]bool{}
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				keys[request.Header.Get(IdempotencyKeyHeader)] = true
+				if attempts.Add(1) <= testcase.Failures {
+					writer.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				writer.Header().Set("Content-Type", "application/json")
+				io.WriteString(writer, `[]`)
+			}))
+			defer server.Close()
+			client := New(server.URL)
+			client.Backoff = quick
+
+			// Act
+			exception := client.do(context.Background(), testcase.Method, "/videos", nil, nil)
+
+			// Assert
+			assert.Equal(testcase.Attempts, attempts.Load())
+			assert.Len(keys, 1)
+			assert.Equal(testcase.Method == http.MethodPost, !keys[""])
+			if testcase.Success {
+				assert.Nil(exception)
+				return
+			}
+			var failure *Error
+			assert.ErrorAs(exception, &failure)
+			assert.Equal(http.StatusServiceUnavailable, failure.StatusCode)
+			assert.Equal(UnexpectedResponse, failure.Code)
+		})
+	}
+
+	test.Run("Should stop retrying when the context is done", func(test *testing.T) {
+		// Arrange
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Retry-After", "1")
+			writer.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+		client := New(server.URL)
+		client.Backoff = Backoff{Attempts: 3, Initial: time.Millisecond, Maximum: time.Minute, Multiplier: 2}
+		current, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		// Act
+		_, exception := client.Videos(current)
+
+		// Assert
+		assert.ErrorIs(exception, context.DeadlineExceeded)
+		var failure *Error
+		assert.True(errors.As(exception, &failure))
+		assert.Equal(http.StatusTooManyRequests, failure.StatusCode)
+	})
+}
+
+func TestBackoff(test *testing.T) {
+	assert := assert.New(test)
+	backoff := Backoff{Attempts: 5, Initial: 100 * time.Millisecond, Maximum: time.Second, Multiplier: 2}
+
+	testcases := []struct {
+		Name       string
+		Attempt    int
+		RetryAfter string
+		Expected   time.Duration
+	}{
+		{Name: "Should wait the initial delay after the first attempt", Attempt: 1, Expected: 100 * time.Millisecond},
+		{Name: "Should grow the delay exponentially", Attempt: 3, Expected: 400 * time.Millisecond},
+		{Name: "Should not wait more than the maximum", Attempt: 8, Expected: time.Second},
+		{Name: "Should follow the Retry-After header", Attempt: 1, RetryAfter: "0", Expected: 0},
+		{Name: "Should cap the Retry-After header", Attempt: 1, RetryAfter: "120", Expected: time.Second},
+		{Name: "Should ignore an invalid Retry-After header", Attempt: 2, RetryAfter: "soon", Expected: 200 * time.Millisecond},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Name, func(test *testing.T) {
+			// Arrange
+			response := &http.Response{Header: http.Header{}}
+			if testcase.RetryAfter != "" {
+				response.Header.Set("Retry-After", testcase.RetryAfter)
+			}
+
+			// Act
+			delay := backoff.Delay(testcase.Attempt, response)
+
+			// Assert
+			assert.Equal(testcase.Expected, delay)
+		})
+	}
+}
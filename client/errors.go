@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/zatarain/note-vook/problems"
+)
+
+// UnexpectedResponse is the code of the failures that didn't come as problem
+// details, e. g. an error page of a proxy in front of the API.
+const UnexpectedResponse string = "unexpected_response"
+
+// Error is a failure reported by the API. It wraps the problem sent by the
+// API, so errors.Is can tell it apart by code, e. g.
+//
+//	errors.Is(exception, problems.VideoNotFound)
+type Error struct {
+	*problems.Problem
+	StatusCode int
+}
+
+func (exception *Error) Error() string {
+	message := fmt.Sprintf("%d %s", exception.StatusCode, exception.Code)
+	if exception.Detail != "" {
+		message += ": " + exception.Detail
+	}
+	return message
+}
+
+func (exception *Error) Unwrap() error {
+	return exception.Problem
+}
+
+// TwoFactorRequired tells the login of the user is not complete until the
+// challenge is sent along with a code to LoginTwoFactor before it expires.
+type TwoFactorRequired struct {
+	Challenge string
+	ExpiresAt time.Time
+}
+
+func (required *TwoFactorRequired) Error() string {
+	return "the login requires a two-factor authentication code"
+}
+
+// decodeError reads the problem details from a failed response and closes
+// its body.
+func decodeError(response *http.Response) error {
+	defer response.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+
+	problem := &problems.Problem{}
+	media, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+	if media != problems.ContentType || json.Unmarshal(body, problem) != nil || problem.Code == "" {
+		problem = problems.New(response.StatusCode, UnexpectedResponse, http.StatusText(response.StatusCode))
+		problem.Detail = string(body)
+	}
+
+	return &Error{Problem: problem, StatusCode: response.StatusCode}
+}
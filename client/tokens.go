@@ -0,0 +1,65 @@
+package client
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TokenStore keeps the authorisation token between requests. An empty token
+// means the user is not logged in.
+type TokenStore interface {
+	Token() (string, error)
+	SetToken(token string) error
+}
+
+// MemoryTokenStore keeps the token only while the process is running.
+type MemoryTokenStore struct {
+	mutex sync.RWMutex
+	token string
+}
+
+func (store *MemoryTokenStore) Token() (string, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	return store.token, nil
+}
+
+func (store *MemoryTokenStore) SetToken(token string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.token = token
+	return nil
+}
+
+// FileTokenStore keeps the token in a file only readable by its owner, so it
+// survives between runs, e. g. of a command line tool.
+type FileTokenStore struct {
+	Path string
+}
+
+func (store *FileTokenStore) Token() (string, error) {
+	content, exception := os.ReadFile(store.Path)
+	if errors.Is(exception, fs.ErrNotExist) {
+		return "", nil
+	}
+	return strings.TrimSpace(string(content)), exception
+}
+
+func (store *FileTokenStore) SetToken(token string) error {
+	if token == "" {
+		exception := os.Remove(store.Path)
+		if errors.Is(exception, fs.ErrNotExist) {
+			return nil
+		}
+		return exception
+	}
+
+	if exception := os.MkdirAll(filepath.Dir(store.Path), 0o700); exception != nil {
+		return exception
+	}
+	return os.WriteFile(store.Path, []byte(token+"\n"), 0o600)
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTokenStore(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should keep the token in a private file", func(test *testing.T) {
+		// Arrange
+		store := &FileTokenStore{Path: filepath.Join(test.TempDir(), "notevook", "token")}
+
+		// Act
+		missing, reading := store.Token()
+		saving := store.SetToken("dummy-token")
+		token, _ := store.Token()
+		info, _ := os.Stat(store.Path)
+
+		// Assert
+		assert.Nil(reading)
+		assert.Empty(missing)
+		assert.Nil(saving)
+		assert.Equal("dummy-token", token)
+		assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	test.Run("Should remove the file when the token is cleared", func(test *testing.T) {
+		// Arrange
+		store := &FileTokenStore{Path: filepath.Join(test.TempDir(), "token")}
+		store.SetToken("dummy-token")
+
+		// Act
+		clearing := store.SetToken("")
+		again := store.SetToken("")
+		token, _ := store.Token()
+
+		// Assert
+		assert.Nil(clearing)
+		assert.Nil(again)
+		assert.Empty(token)
+		assert.NoFileExists(store.Path)
+	})
+}
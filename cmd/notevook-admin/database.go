@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/configuration"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/gorm"
+)
+
+// Statistics are the counters shown by the stats command.
+type Statistics struct {
+	Users         int64 `json:"users"`
+	DisabledUsers int64 `json:"disabled_users"`
+	ActiveUsers   int64 `json:"active_users"`
+	Videos        int64 `json:"videos"`
+	Annotations   int64 `json:"annotations"`
+	DatabaseBytes int64 `json:"database_bytes"`
+}
+
+func (admin *Admin) Videos(arguments []string) error {
+	name, rest := split(arguments)
+	if name == "reassign" {
+		return admin.ReassignVideos(rest)
+	}
+	return unknown("videos command", name)
+}
+
+// ReassignVideos moves all the videos (with their annotations) of a user to
+// another one. Nothing is moved when the other user already has a video with
+// the same link as one of them.
+func (admin *Admin) ReassignVideos(arguments []string) error {
+	set := admin.flags("videos reassign", nil)
+	from := set.String("from", "", "Nickname or ID of the current owner of the videos")
+	to := set.String("to", "", "Nickname or ID of the new owner of the videos")
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	if *from == "" || *to == "" {
+		return fmt.Errorf("%w: both -from and -to are required", errUsage)
+	}
+
+	source, exception := admin.findUser(*from)
+	if exception != nil {
+		return exception
+	}
+	target, exception := admin.findUser(*to)
+	if exception != nil {
+		return exception
+	}
+	if source.ID == target.ID {
+		return fmt.Errorf("%w: -from and -to are the same user", errUsage)
+	}
+
+	updating := admin.Database.Model(&models.Video{}).Where("user_id = ?", source.ID).Update("user_id", target.ID)
+	if errors.Is(updating.Error, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("%s already has videos with the same link as %s, nothing was reassigned", target.Nickname, source.Nickname)
+	}
+	if updating.Error != nil {
+		return updating.Error
+	}
+
+	fmt.Fprintf(admin.Output, "Reassigned %d videos from %s to %s\n", updating.RowsAffected, source.Nickname, target.Nickname)
+	return nil
+}
+
+func (admin *Admin) DB(arguments []string) error {
+	name, rest := split(arguments)
+	switch name {
+	case "backup":
+		return admin.Backup(rest)
+	case "backups":
+		return admin.ListBackups(rest)
+	case "restore":
+		return admin.Restore(rest)
+	}
+
+	set := admin.flags("db "+name, nil)
+	if exception := parse(set, rest, nil); exception != nil {
+		return exception
+	}
+
+	switch name {
+	case "vacuum":
+		return admin.Vacuum()
+	case "integrity-check":
+		return admin.IntegrityCheck()
+	}
+	return unknown("db command", name)
+}
+
+// Backup copies the database into the backups directory, even while the
+// server is using it, and removes the oldest backups beyond the ones to keep.
+func (admin *Admin) Backup(arguments []string) error {
+	set := admin.flags("db backup", nil)
+	compress := set.Bool("compress", admin.Backups.Compress, "Compress the backup with gzip")
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+
+	created, exception := admin.Backups.Create(context.Background(), *compress)
+	if exception != nil {
+		return exception
+	}
+	fmt.Fprintf(admin.Output, "Backed up %s into %s (%d bytes)\n", admin.Filename, filepath.Join(admin.Backups.Directory, created.Name), created.Size)
+	return nil
+}
+
+func (admin *Admin) ListBackups(arguments []string) error {
+	var format string
+	set := admin.flags("db backups", &format)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	backups, exception := admin.Backups.List()
+	if exception != nil {
+		return exception
+	}
+
+	rows := make([][]string, 0, len(backups))
+	for _, backup := range backups {
+		rows = append(rows, []string{
+			backup.Name,
+			strconv.FormatInt(backup.Size, 10),
+			strconv.FormatBool(backup.Compressed),
+			backup.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return admin.write(format, backups, []string{"name", "size", "compressed", "created at"}, rows)
+}
+
+// Restore replaces the database by a backup once it's checked to be
+// compatible with the current models. The file is looked for within the
+// backups directory when it doesn't exist as given. The server must be
+// stopped meanwhile.
+func (admin *Admin) Restore(arguments []string) error {
+	set := admin.flags("db restore", nil)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	source, exception := single(set, "backup file")
+	if exception != nil {
+		return exception
+	}
+	if _, exception := os.Stat(source); errors.Is(exception, os.ErrNotExist) && filepath.Base(source) == source {
+		source = filepath.Join(admin.Backups.Directory, source)
+	}
+
+	replaced, exception := backup.Restore(source, admin.Filename, configuration.Models())
+	if exception != nil {
+		return exception
+	}
+	fmt.Fprintf(admin.Output, "Restored %s from %s\n", admin.Filename, source)
+	if replaced != "" {
+		fmt.Fprintf(admin.Output, "The replaced database was kept as %s\n", replaced)
+	}
+	return nil
+}
+
+func (admin *Admin) size() int64 {
+	info, exception := os.Stat(admin.Filename)
+	if exception != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Vacuum rebuilds the database file, releasing the space of the deleted
+// records. It needs as much free space as the size of the file.
+func (admin *Admin) Vacuum() error {
+	before := admin.size()
+	if exception := admin.Database.Exec("VACUUM").Error; exception != nil {
+		return exception
+	}
+
+	fmt.Fprintf(admin.Output, "Vacuumed %s from %d to %d bytes\n", admin.Filename, before, admin.size())
+	return nil
+}
+
+// IntegrityCheck fails when SQLite finds any inconsistency on the file, they
+// are all listed.
+func (admin *Admin) IntegrityCheck() error {
+	var results []string
+	if exception := admin.Database.Raw("PRAGMA integrity_check").Scan(&results).Error; exception != nil {
+		return exception
+	}
+	if len(results) == 1 && results[0] == "ok" {
+		fmt.Fprintln(admin.Output, "ok")
+		return nil
+	}
+
+	fmt.Fprintln(admin.Output, strings.Join(results, "\n"))
+	return fmt.Errorf("the integrity check found %d problems", len(results))
+}
+
+func (admin *Admin) Stats(arguments []string) error {
+	var format string
+	set := admin.flags("stats", &format)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	since := time.Now().Add(-configuration.ActivityWindow)
+	statistics := Statistics{DatabaseBytes: admin.size()}
+	counters := []struct {
+		Value     *int64
+		Query     string
+		Arguments []interface{}
+	}{
+		{&statistics.Users, "SELECT COUNT(*) FROM users", nil},
+		{&statistics.DisabledUsers, "SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL", nil},
+		{
+			&statistics.ActiveUsers,
+			`SELECT COUNT(DISTINCT user_id) FROM videos
+			WHERE updated_at >= ? OR id IN (SELECT video_id FROM annotations WHERE updated_at >= ?)`,
+			[]interface{}{since, since},
+		},
+		{&statistics.Videos, "SELECT COUNT(*) FROM videos", nil},
+		{&statistics.Annotations, "SELECT COUNT(*) FROM annotations", nil},
+	}
+	for _, counter := range counters {
+		if exception := admin.Database.Raw(counter.Query, counter.Arguments...).Scan(counter.Value).Error; exception != nil {
+			return exception
+		}
+	}
+
+	rows := [][]string{
+		{"users", strconv.FormatInt(statistics.Users, 10)},
+		{"disabled users", strconv.FormatInt(statistics.DisabledUsers, 10)},
+		{"active users", strconv.FormatInt(statistics.ActiveUsers, 10)},
+		{"videos", strconv.FormatInt(statistics.Videos, 10)},
+		{"annotations", strconv.FormatInt(statistics.Annotations, 10)},
+		{"database bytes", strconv.FormatInt(statistics.DatabaseBytes, 10)},
+	}
+	return admin.write(format, statistics, []string{"counter", "value"}, rows)
+}
@@ -0,0 +1,239 @@
+// Command notevook-admin maintains the users and the database of the API. It
+// reads the same environment file and configuration as the server, so it
+// works on the same database without opening it by hand.
+//
+// Usage:
+//
+//	notevook-admin [-env-file file] <command> [flags] [arguments]
+//
+// The commands are users (list, create, reset-password, disable, enable,
+// delete), videos reassign, db (backup, backups, restore, vacuum,
+// integrity-check) and stats.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/configuration"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/policy"
+	"gorm.io/gorm"
+)
+
+const (
+	ExitSuccess int = 0
+	ExitFailure int = 1
+	ExitUsage   int = 2
+)
+
+const (
+	FormatTable string = "table"
+	FormatJSON  string = "json"
+)
+
+const usage string = `Usage: notevook-admin [-env-file file] <command> [flags] [arguments]
+
+Commands:
+  users list                        List the users
+  users create NICKNAME             Create a user
+  users reset-password NICKNAME     Set a new password to a user
+  users disable NICKNAME            Stop a user from logging in
+  users enable NICKNAME             Allow a disabled user to log in again
+  users unlock NICKNAME             Allow a user locked out by failed logins to log in again
+  users reset-2fa NICKNAME          Disable the two-factor authentication of a user
+  users delete NICKNAME             Delete a user along with its videos and annotations
+  videos reassign -from A -to B     Move all the videos of a user to another one
+  db backup                         Back up the database, even while the server runs
+  db backups                        List the backups, the newest first
+  db restore FILE                   Replace the database by a backup (stop the server first)
+  db vacuum                         Rebuild the database file to reclaim the free space
+  db integrity-check                Check the database file is not corrupted
+  stats                             Count the users, videos and annotations
+
+The users can be given either by nickname or by ID. The configuration is read
+from the environment variables (and the file given by -env-file, by default
+the one of the ENVIRONMENT variable) as the server does.
+`
+
+var (
+	// errUsage marks the failures caused by a wrong invocation
+	errUsage = errors.New("usage")
+
+	// errFlags marks the wrong flags, the flag package already explained them
+	errFlags = errors.New("invalid flags")
+)
+
+// Admin has what the commands need to run, so they can be tested with any
+// database and output.
+type Admin struct {
+	Database  *gorm.DB
+	Filename  string
+	Backups   *backup.Manager
+	Nicknames policy.Nickname
+	Passwords policy.Password
+	Output    io.Writer
+	Errors    io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(arguments []string, output io.Writer, failures io.Writer) int {
+	global := flag.NewFlagSet("notevook-admin", flag.ContinueOnError)
+	global.SetOutput(failures)
+	global.Usage = func() { fmt.Fprint(failures, usage) }
+	filename := global.String("env-file", configuration.EnvironmentFile(), "File with the environment variables of the server")
+	if exception := global.Parse(arguments); exception != nil {
+		return exit(fmt.Errorf("%w: %w", errFlags, exception), failures)
+	}
+
+	// The default file is optional, but not the one given explicitly
+	required := false
+	global.Visit(func(flag *flag.Flag) { required = required || flag.Name == "env-file" })
+	if exception := configuration.LoadEnvironment(*filename, required); exception != nil {
+		return exit(fmt.Errorf("failed to read the environment: %w", exception), failures)
+	}
+
+	config, exception := configuration.Load(nil)
+	if exception != nil {
+		return exit(fmt.Errorf("invalid configuration: %w", exception), failures)
+	}
+
+	// Only the warnings go to the errors, so the output can be parsed
+	loggers := logging.New(failures, logging.FormatText, slog.LevelWarn, nil)
+	database, connection, exception := configuration.ConnectToDatabase(config.Database, loggers.Logger("database"))
+	if exception != nil {
+		return exit(fmt.Errorf("failed to connect to the database: %w", exception), failures)
+	}
+	defer connection.Close()
+	configuration.MigrateDatabase(database)
+
+	// The users created or reset here follow the same policies as the API
+	nicknames, exception := configuration.NewNicknamePolicy(config.Nickname)
+	if exception != nil {
+		return exit(fmt.Errorf("invalid nickname policy: %w", exception), failures)
+	}
+	passwords, exception := configuration.NewPasswordPolicy(config.Password)
+	if exception != nil {
+		return exit(fmt.Errorf("failed to read the breached passwords: %w", exception), failures)
+	}
+
+	admin := &Admin{
+		Database:  database,
+		Filename:  config.Database.Path(),
+		Backups:   configuration.NewBackupManager(config, database, loggers.Logger("backup")),
+		Nicknames: nicknames,
+		Passwords: passwords,
+		Output:    output,
+		Errors:    failures,
+	}
+
+	name, rest := split(global.Args())
+	switch name {
+	case "users":
+		exception = admin.Users(rest)
+	case "videos":
+		exception = admin.Videos(rest)
+	case "db":
+		exception = admin.DB(rest)
+	case "stats":
+		exception = admin.Stats(rest)
+	default:
+		exception = unknown("command", name)
+	}
+	return exit(exception, failures)
+}
+
+func split(arguments []string) (string, []string) {
+	if len(arguments) == 0 {
+		return "", nil
+	}
+	return arguments[0], arguments[1:]
+}
+
+func unknown(kind string, name string) error {
+	if name != "" {
+		return fmt.Errorf("%w: unknown %s %q", errUsage, kind, name)
+	}
+	return fmt.Errorf("%w: missing %s", errUsage, kind)
+}
+
+// exit reports the failure, if any, and tells the exit code for it.
+func exit(exception error, output io.Writer) int {
+	if exception == nil || errors.Is(exception, flag.ErrHelp) {
+		return ExitSuccess
+	}
+
+	if errors.Is(exception, errFlags) {
+		return ExitUsage
+	}
+
+	if errors.Is(exception, errUsage) {
+		fmt.Fprintf(output, "notevook-admin: %s\n\n", strings.TrimPrefix(exception.Error(), errUsage.Error()+": "))
+		fmt.Fprint(output, usage)
+		return ExitUsage
+	}
+
+	fmt.Fprintf(output, "notevook-admin: %v\n", exception)
+	return ExitFailure
+}
+
+// flags creates the flag set of a command, along with the output format if
+// the command writes records.
+func (admin *Admin) flags(name string, format *string) *flag.FlagSet {
+	set := flag.NewFlagSet("notevook-admin "+name, flag.ContinueOnError)
+	set.SetOutput(admin.Errors)
+	if format != nil {
+		set.StringVar(format, "format", FormatTable, "Output format: table or json")
+	}
+	return set
+}
+
+// parse reads the flags of a command, checking the output format if any.
+func parse(set *flag.FlagSet, arguments []string, format *string) error {
+	if exception := set.Parse(arguments); exception != nil {
+		return fmt.Errorf("%w: %w", errFlags, exception)
+	}
+	if format != nil && *format != FormatTable && *format != FormatJSON {
+		return fmt.Errorf("%w: unknown output format %q, expected table or json", errUsage, *format)
+	}
+	return nil
+}
+
+// single reads the only argument of the commands working on one record.
+func single(set *flag.FlagSet, kind string) (string, error) {
+	switch set.NArg() {
+	case 0:
+		return "", unknown(kind, "")
+	case 1:
+		return set.Arg(0), nil
+	}
+	return "", fmt.Errorf("%w: only one %s is expected", errUsage, kind)
+}
+
+// write prints the rows either as a table, with the header in upper case, or
+// as the JSON of the records.
+func (admin *Admin) write(format string, records any, header []string, rows [][]string) error {
+	if format == FormatJSON {
+		encoder := json.NewEncoder(admin.Output)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	}
+
+	writer := tabwriter.NewWriter(admin.Output, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, strings.ToUpper(strings.Join(header, "\t")))
+	for _, row := range rows {
+		fmt.Fprintln(writer, strings.Join(row, "\t"))
+	}
+	return writer.Flush()
+}
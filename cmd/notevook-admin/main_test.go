@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/configuration"
+	"github.com/zatarain/note-vook/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type result struct {
+	Code   int
+	Output string
+	Errors string
+}
+
+func admin(arguments ...string) result {
+	var output, errors bytes.Buffer
+	code := run(arguments, &output, &errors)
+	return result{Code: code, Output: output.String(), Errors: errors.String()}
+}
+
+// database points the configuration to a temporary database and opens it,
+// so the tests can check what the commands did.
+func database(test *testing.T) *gorm.DB {
+	directory := test.TempDir()
+	test.Setenv("GOMOD", filepath.Join(directory, "go.mod"))
+	test.Setenv("DATABASE", "admin.db")
+	test.Setenv("ENVIRONMENT", "missing")
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	connected, connection, exception := configuration.ConnectToDatabase(configuration.DatabaseConfig{Filename: "admin.db"}, logger)
+	require.Nil(test, exception)
+	configuration.MigrateDatabase(connected)
+	test.Cleanup(func() { connection.Close() })
+	return connected
+}
+
+func user(test *testing.T, database *gorm.DB, nickname string) *models.User {
+	record := &models.User{}
+	require.Nil(test, database.First(record, "nickname = ?", nickname).Error)
+	return record
+}
+
+func TestUsers(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	database := database(test)
+
+	test.Run("Should create a user with the given password", func(test *testing.T) {
+		// Act
+		creating := admin("users", "create", "-password", "Dummy-password", "dummy")
+
+		// Assert
+		require.Equal(ExitSuccess, creating.Code, creating.Errors)
+		assert.Contains(creating.Output, "Created user dummy")
+		assert.NotContains(creating.Output, "Password:")
+		record := user(test, database, "dummy")
+		assert.Nil(bcrypt.CompareHashAndPassword([]byte(record.Password), []byte("Dummy-password")))
+	})
+
+	test.Run("Should create a user with a generated password", func(test *testing.T) {
+		// Act
+		creating := admin("users", "create", "other")
+
+		// Assert
+		require.Equal(ExitSuccess, creating.Code, creating.Errors)
+		generated := regexp.MustCompile(`Password: (\S+)`).FindStringSubmatch(creating.Output)
+		require.Len(generated, 2)
+		record := user(test, database, "other")
+		assert.Nil(bcrypt.CompareHashAndPassword([]byte(record.Password), []byte(generated[1])))
+	})
+
+	test.Run("Should NOT create a user with a taken nickname", func(test *testing.T) {
+		// Act
+		creating := admin("users", "create", "dummy")
+
+		// Assert
+		assert.Equal(ExitFailure, creating.Code)
+		assert.Contains(creating.Errors, `nickname "dummy" is already taken`)
+	})
+
+	test.Run("Should reset the password of a user given by ID", func(test *testing.T) {
+		// Arrange
+		record := user(test, database, "dummy")
+
+		// Act
+		resetting := admin("users", "reset-password", "-password", "New-password", "1")
+
+		// Assert
+		require.Equal(ExitSuccess, resetting.Code, resetting.Errors)
+		assert.Contains(resetting.Output, "Password of dummy was reset")
+		updated := user(test, database, "dummy")
+		assert.NotEqual(record.Password, updated.Password)
+		assert.Equal(record.TokenVersion+1, updated.TokenVersion)
+		assert.Nil(bcrypt.CompareHashAndPassword([]byte(updated.Password), []byte("New-password")))
+	})
+
+	policies := []struct {
+		Description string
+		Arguments   []string
+		Expected    string
+	}{
+		{"Should NOT create a user with a reserved nickname", []string{"users", "create", "admin"}, "the nickname is reserved, use -force"},
+		{"Should NOT create a user with a weak password", []string{"users", "create", "-password", "password", "weak"}, "must have characters of at least 3 classes"},
+		{"Should NOT reset the password to a breached one", []string{"users", "reset-password", "-password", "Password123", "dummy"}, "the password is too common"},
+	}
+
+	for _, testcase := range policies {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			refused := admin(testcase.Arguments...)
+
+			// Assert
+			assert.Equal(ExitFailure, refused.Code)
+			assert.Contains(refused.Errors, testcase.Expected)
+		})
+	}
+
+	test.Run("Should disable and enable a user", func(test *testing.T) {
+		// Act
+		disabling := admin("users", "disable", "dummy")
+		disabled := user(test, database, "dummy")
+		enabling := admin("users", "enable", "dummy")
+		enabled := user(test, database, "dummy")
+
+		// Assert
+		require.Equal(ExitSuccess, disabling.Code, disabling.Errors)
+		require.Equal(ExitSuccess, enabling.Code, enabling.Errors)
+		assert.True(disabled.Disabled())
+		assert.False(enabled.Disabled())
+	})
+
+	test.Run("Should unlock a user locked out by failed logins", func(test *testing.T) {
+		// Arrange
+		locked := time.Now().Add(time.Hour)
+		require.Nil(database.Model(&models.User{}).Where("nickname = ?", "dummy").
+			Updates(map[string]interface{}{"failed_logins": 5, "locked_until": locked}).Error)
+
+		// Act
+		unlocking := admin("users", "unlock", "dummy")
+
+		// Assert
+		require.Equal(ExitSuccess, unlocking.Code, unlocking.Errors)
+		assert.Contains(unlocking.Output, "User dummy is unlocked")
+		unlocked := user(test, database, "dummy")
+		assert.Zero(unlocked.FailedLogins)
+		assert.False(unlocked.Locked(time.Now()))
+	})
+
+	test.Run("Should disable the two-factor authentication of a user", func(test *testing.T) {
+		// Arrange
+		record := user(test, database, "dummy")
+		require.Nil(database.Model(&models.User{}).Where("id = ?", record.ID).
+			Updates(map[string]interface{}{"totp_secret": "GEZDGNBVGY3TQOJQ", "two_factor_enabled_at": time.Now()}).Error)
+		require.Nil(database.Create(&models.RecoveryCode{UserID: record.ID, Hash: models.HashRecoveryCode("abcde-fghij")}).Error)
+
+		// Act
+		resetting := admin("users", "reset-2fa", "dummy")
+
+		// Assert
+		require.Equal(ExitSuccess, resetting.Code, resetting.Errors)
+		assert.Contains(resetting.Output, "Two-factor authentication of dummy is disabled")
+		reset := user(test, database, "dummy")
+		assert.False(reset.TwoFactor())
+		assert.Empty(reset.TOTPSecret)
+		var codes int64
+		database.Model(&models.RecoveryCode{}).Where("user_id = ?", record.ID).Count(&codes)
+		assert.Zero(codes)
+	})
+
+	test.Run("Should list the users with their videos", func(test *testing.T) {
+		// Arrange
+		owner := user(test, database, "other")
+		require.Nil(database.Create(&models.Video{UserID: owner.ID, Title: "Dummy", Link: "https://youtube.com/v/dummy"}).Error)
+
+		// Act
+		table := admin("users", "list")
+		listing := admin("users", "list", "-format", "json")
+
+		// Assert
+		require.Equal(ExitSuccess, table.Code, table.Errors)
+		assert.Regexp(`^ID\s+NICKNAME\s+ROLE\s+VIDEOS\s+CREATED AT\s+DISABLED AT\n`, table.Output)
+		require.Equal(ExitSuccess, listing.Code, listing.Errors)
+		var users []UserSummary
+		require.Nil(json.Unmarshal([]byte(listing.Output), &users))
+		require.Len(users, 2)
+		assert.Equal("dummy", users[0].Nickname)
+		assert.Equal(models.RoleUser, users[0].Role)
+		assert.Equal(int64(0), users[0].Videos)
+		assert.Equal(int64(1), users[1].Videos)
+		assert.NotContains(listing.Output, "password")
+	})
+
+	test.Run("Should report a missing user", func(test *testing.T) {
+		// Act
+		disabling := admin("users", "disable", "nobody")
+
+		// Assert
+		assert.Equal(ExitFailure, disabling.Code)
+		assert.Contains(disabling.Errors, `user "nobody" not found`)
+	})
+
+	test.Run("Should delete a user along with its videos and annotations", func(test *testing.T) {
+		// Arrange
+		owner := user(test, database, "other")
+		video := &models.Video{UserID: owner.ID, Title: "Another", Link: "https://youtube.com/v/another"}
+		require.Nil(database.Create(video).Error)
+		require.Nil(database.Create(&models.Annotation{VideoID: video.ID, Title: "Dummy"}).Error)
+
+		// Act
+		deleting := admin("users", "delete", "other")
+
+		// Assert
+		require.Equal(ExitSuccess, deleting.Code, deleting.Errors)
+		assert.Contains(deleting.Output, "Deleted user other with 2 videos and 1 annotations")
+		var videos, annotations, users int64
+		database.Model(&models.Video{}).Count(&videos)
+		database.Model(&models.Annotation{}).Count(&annotations)
+		database.Model(&models.User{}).Count(&users)
+		assert.Equal(int64(0), videos)
+		assert.Equal(int64(0), annotations)
+		assert.Equal(int64(1), users)
+	})
+
+	test.Run("Should skip the policies when forced", func(test *testing.T) {
+		// Act
+		creating := admin("users", "create", "-force", "-password", "weak", "root")
+		resetting := admin("users", "reset-password", "-force", "-password", "password", "root")
+
+		// Assert
+		require.Equal(ExitSuccess, creating.Code, creating.Errors)
+		require.Equal(ExitSuccess, resetting.Code, resetting.Errors)
+		record := user(test, database, "root")
+		assert.Nil(bcrypt.CompareHashAndPassword([]byte(record.Password), []byte("password")))
+	})
+}
+
+func TestReassignVideos(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	database := database(test)
+	source := &models.User{Nickname: "source"}
+	target := &models.User{Nickname: "target"}
+	require.Nil(database.Create(source).Error)
+	require.Nil(database.Create(target).Error)
+	require.Nil(database.Create(&models.Video{UserID: source.ID, Title: "First", Link: "https://youtube.com/v/first"}).Error)
+	require.Nil(database.Create(&models.Video{UserID: source.ID, Title: "Second", Link: "https://youtube.com/v/second"}).Error)
+	require.Nil(database.Create(&models.Video{UserID: target.ID, Title: "Second", Link: "https://youtube.com/v/second"}).Error)
+
+	test.Run("Should NOT reassign any video when the target has one with the same link", func(test *testing.T) {
+		// Act
+		reassigning := admin("videos", "reassign", "-from", "source", "-to", "target")
+
+		// Assert
+		assert.Equal(ExitFailure, reassigning.Code)
+		assert.Contains(reassigning.Errors, "nothing was reassigned")
+		var owned int64
+		database.Model(&models.Video{}).Where("user_id = ?", source.ID).Count(&owned)
+		assert.Equal(int64(2), owned)
+	})
+
+	test.Run("Should reassign all the videos of a user", func(test *testing.T) {
+		// Arrange
+		require.Nil(database.Where("user_id = ?", target.ID).Delete(&models.Video{}).Error)
+
+		// Act
+		reassigning := admin("videos", "reassign", "--from", "source", "--to", "target")
+
+		// Assert
+		require.Equal(ExitSuccess, reassigning.Code, reassigning.Errors)
+		assert.Contains(reassigning.Output, "Reassigned 2 videos from source to target")
+		var owned int64
+		database.Model(&models.Video{}).Where("user_id = ?", target.ID).Count(&owned)
+		assert.Equal(int64(2), owned)
+	})
+
+	test.Run("Should require both users", func(test *testing.T) {
+		// Act
+		reassigning := admin("videos", "reassign", "-from", "source")
+
+		// Assert
+		assert.Equal(ExitUsage, reassigning.Code)
+		assert.Contains(reassigning.Errors, "both -from and -to are required")
+	})
+}
+
+func TestDatabase(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	database := database(test)
+	owner := &models.User{Nickname: "dummy"}
+	require.Nil(database.Create(owner).Error)
+	video := &models.Video{UserID: owner.ID, Title: "Dummy", Link: "https://youtube.com/v/dummy"}
+	require.Nil(database.Create(video).Error)
+	require.Nil(database.Create(&models.Annotation{VideoID: video.ID, Title: "Dummy"}).Error)
+
+	test.Run("Should vacuum the database", func(test *testing.T) {
+		// Act
+		vacuuming := admin("db", "vacuum")
+
+		// Assert
+		require.Equal(ExitSuccess, vacuuming.Code, vacuuming.Errors)
+		assert.Regexp(`Vacuumed .*admin\.db from \d+ to \d+ bytes`, vacuuming.Output)
+	})
+
+	test.Run("Should check the integrity of the database", func(test *testing.T) {
+		// Act
+		checking := admin("db", "integrity-check")
+
+		// Assert
+		require.Equal(ExitSuccess, checking.Code, checking.Errors)
+		assert.Equal("ok\n", checking.Output)
+	})
+
+	test.Run("Should count the records", func(test *testing.T) {
+		// Act
+		counting := admin("stats", "-format", "json")
+
+		// Assert
+		require.Equal(ExitSuccess, counting.Code, counting.Errors)
+		statistics := Statistics{}
+		require.Nil(json.Unmarshal([]byte(counting.Output), &statistics))
+		assert.Equal(int64(1), statistics.Users)
+		assert.Equal(int64(1), statistics.ActiveUsers)
+		assert.Equal(int64(1), statistics.Videos)
+		assert.Equal(int64(1), statistics.Annotations)
+		assert.Positive(statistics.DatabaseBytes)
+	})
+}
+
+func TestBackups(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	database := database(test)
+	owner := &models.User{Nickname: "dummy"}
+	require.Nil(database.Create(owner).Error)
+	require.Nil(database.Create(&models.Video{UserID: owner.ID, Title: "Kept", Link: "https://youtube.com/v/kept"}).Error)
+	directory := filepath.Join(filepath.Dir(os.Getenv("GOMOD")), "data", "backups")
+
+	test.Run("Should back up the database into the backups directory", func(test *testing.T) {
+		// Act
+		backing := admin("db", "backup", "-compress=false")
+
+		// Assert
+		require.Equal(ExitSuccess, backing.Code, backing.Errors)
+		assert.Regexp(`Backed up .*admin\.db into .*notevook-.*\.db \(\d+ bytes\)`, backing.Output)
+	})
+
+	test.Run("Should list the backups", func(test *testing.T) {
+		// Act
+		listing := admin("db", "backups", "-format", "json")
+
+		// Assert
+		require.Equal(ExitSuccess, listing.Code, listing.Errors)
+		backups := []backup.Backup{}
+		require.Nil(json.Unmarshal([]byte(listing.Output), &backups))
+		require.Len(backups, 1)
+		assert.False(backups[0].Compressed)
+		assert.FileExists(filepath.Join(directory, backups[0].Name))
+	})
+
+	test.Run("Should restore a backup given by name", func(test *testing.T) {
+		// Arrange
+		require.Nil(database.Create(&models.Video{UserID: owner.ID, Title: "Lost", Link: "https://youtube.com/v/lost"}).Error)
+		entries, _ := os.ReadDir(directory)
+		require.Len(entries, 1)
+
+		// Act
+		restoring := admin("db", "restore", entries[0].Name())
+
+		// Assert
+		require.Equal(ExitSuccess, restoring.Code, restoring.Errors)
+		assert.Contains(restoring.Output, "The replaced database was kept as ")
+		counting := admin("stats", "-format", "json")
+		statistics := Statistics{}
+		require.Nil(json.Unmarshal([]byte(counting.Output), &statistics))
+		assert.Equal(int64(1), statistics.Videos)
+	})
+
+	test.Run("Should not restore an incompatible file", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "notes.txt")
+		os.WriteFile(filename, []byte("not a database"), 0o600)
+
+		// Act
+		restoring := admin("db", "restore", filename)
+
+		// Assert
+		assert.Equal(ExitFailure, restoring.Code)
+		assert.Contains(restoring.Errors, "incompatible backup")
+	})
+}
+
+func TestEnvironment(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should read the configuration from the environment file", func(test *testing.T) {
+		// Arrange
+		directory := test.TempDir()
+		test.Setenv("GOMOD", filepath.Join(directory, "go.mod"))
+		test.Setenv("DATABASE", "")
+		os.Unsetenv("DATABASE")
+		filename := filepath.Join(directory, "dummy.env")
+		os.WriteFile(filename, []byte("DATABASE=from-file.db\n"), 0o600)
+
+		// Act
+		counting := admin("-env-file", filename, "stats")
+
+		// Assert
+		assert.Equal(ExitSuccess, counting.Code, counting.Errors)
+		assert.FileExists(filepath.Join(directory, "from-file.db"))
+	})
+
+	test.Run("Should fail when the given environment file is missing", func(test *testing.T) {
+		// Act
+		counting := admin("-env-file", filepath.Join(test.TempDir(), "missing.env"), "stats")
+
+		// Assert
+		assert.Equal(ExitFailure, counting.Code)
+		assert.Contains(counting.Errors, "failed to read the environment")
+	})
+
+	test.Run("Should report the wrong invocations", func(test *testing.T) {
+		database(test)
+		testcases := []struct {
+			Name      string
+			Arguments []string
+			Expected  string
+		}{
+			{Name: "Should report a missing command", Expected: "missing command"},
+			{Name: "Should report an unknown command", Arguments: []string{"backup"}, Expected: `unknown command "backup"`},
+			{Name: "Should report an unknown users command", Arguments: []string{"users", "ban"}, Expected: `unknown users command "ban"`},
+			{Name: "Should report an unknown db command", Arguments: []string{"db", "shrink"}, Expected: `unknown db command "shrink"`},
+			{Name: "Should report a missing nickname", Arguments: []string{"users", "create"}, Expected: "missing nickname"},
+			{Name: "Should report too many nicknames", Arguments: []string{"users", "delete", "a", "b"}, Expected: "only one nickname is expected"},
+			{Name: "Should report an unknown format", Arguments: []string{"stats", "-format", "xml"}, Expected: `unknown output format "xml"`},
+		}
+
+		for _, testcase := range testcases {
+			test.Run(testcase.Name, func(test *testing.T) {
+				// Act
+				invocation := admin(testcase.Arguments...)
+
+				// Assert
+				assert.Equal(ExitUsage, invocation.Code)
+				assert.True(strings.Contains(invocation.Errors, testcase.Expected), invocation.Errors)
+			})
+		}
+	})
+}
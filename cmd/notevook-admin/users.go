@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/policy"
+	"gorm.io/gorm"
+)
+
+// generations bounds the passwords generated looking for one which meets the
+// password policy.
+const generations int = 100
+
+// UserSummary is how the users are listed, without their password.
+type UserSummary struct {
+	ID         uint       `json:"id"`
+	Nickname   string     `json:"nickname"`
+	Role       string     `json:"role"`
+	Videos     int64      `json:"videos"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at"`
+}
+
+func (admin *Admin) Users(arguments []string) error {
+	name, rest := split(arguments)
+	switch name {
+	case "list":
+		return admin.ListUsers(rest)
+	case "create":
+		return admin.CreateUser(rest)
+	case "reset-password":
+		return admin.ResetPassword(rest)
+	case "disable":
+		return admin.DisableUser(rest, true)
+	case "enable":
+		return admin.DisableUser(rest, false)
+	case "unlock":
+		return admin.UnlockUser(rest)
+	case "reset-2fa":
+		return admin.ResetTwoFactor(rest)
+	case "delete":
+		return admin.DeleteUser(rest)
+	}
+	return unknown("users command", name)
+}
+
+// findUser looks for the user by nickname or, if there is none and the
+// reference is a number, by ID.
+func (admin *Admin) findUser(reference string) (*models.User, error) {
+	user := &models.User{}
+	searching := admin.Database.First(user, "nickname = ?", reference).Error
+	if errors.Is(searching, gorm.ErrRecordNotFound) {
+		if id, exception := strconv.ParseUint(reference, 10, 0); exception == nil {
+			searching = admin.Database.First(user, id).Error
+		}
+	}
+	if errors.Is(searching, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("user %q not found", reference)
+	}
+	return user, searching
+}
+
+// password hashes the given password or a generated one, which is also
+// returned so it can be told to the user. The given password must meet the
+// policy unless it's forced, the generated ones always meet it.
+func (admin *Admin) password(given string, force bool) (hash string, generated string, exception error) {
+	if given == "" {
+		if given, exception = generate(&admin.Passwords); exception != nil {
+			return "", "", exception
+		}
+		generated = given
+	} else if !force {
+		if exception := admin.Passwords.Check(given); exception != nil {
+			return "", "", fmt.Errorf("the password %w, use -force to skip the policy", exception)
+		}
+	}
+
+	credentials := controllers.Credentials{Password: given}
+	if exception := credentials.HashPassword(); exception != nil {
+		return "", "", fmt.Errorf("failed to create the hash for password: %w", exception)
+	}
+	return credentials.Password, generated, nil
+}
+
+// generate returns a random password meeting the policy, as long as its
+// minimum length.
+func generate(passwords *policy.Password) (string, error) {
+	size := 12
+	if minimum := (passwords.MinLength*3 + 3) / 4; minimum > size {
+		size = minimum
+	}
+	random := make([]byte, size)
+	for attempt := 0; attempt < generations; attempt++ {
+		if _, exception := rand.Read(random); exception != nil {
+			return "", exception
+		}
+		if generated := base64.RawURLEncoding.EncodeToString(random); passwords.Check(generated) == nil {
+			return generated, nil
+		}
+	}
+	return "", errors.New("failed to generate a password meeting the policy, give one with -password")
+}
+
+func (admin *Admin) ListUsers(arguments []string) error {
+	var format string
+	set := admin.flags("users list", &format)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	users := []UserSummary{}
+	listing := admin.Database.Model(&models.User{}).
+		Select("users.id, users.nickname, users.role, users.created_at, users.disabled_at, COUNT(videos.id) AS videos").
+		Joins("LEFT JOIN videos ON videos.user_id = users.id").
+		Group("users.id").
+		Order("users.id").
+		Scan(&users).Error
+	if listing != nil {
+		return listing
+	}
+
+	rows := make([][]string, 0, len(users))
+	for _, user := range users {
+		disabled := ""
+		if user.DisabledAt != nil {
+			disabled = user.DisabledAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(user.ID), 10),
+			user.Nickname,
+			user.Role,
+			strconv.FormatInt(user.Videos, 10),
+			user.CreatedAt.Format(time.RFC3339),
+			disabled,
+		})
+	}
+	return admin.write(format, users, []string{"id", "nickname", "role", "videos", "created at", "disabled at"}, rows)
+}
+
+func (admin *Admin) CreateUser(arguments []string) error {
+	set := admin.flags("users create", nil)
+	given := set.String("password", "", "Password of the user, a random one is generated and shown when it's empty")
+	force := set.Bool("force", false, "Skip the nickname and password policies")
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	nickname, exception := single(set, "nickname")
+	if exception != nil {
+		return exception
+	}
+	if !*force {
+		if exception := admin.Nicknames.Check(nickname); exception != nil {
+			return fmt.Errorf("the nickname %w, use -force to skip the policy", exception)
+		}
+	}
+
+	hash, generated, exception := admin.password(*given, *force)
+	if exception != nil {
+		return exception
+	}
+
+	user := &models.User{Nickname: nickname, Password: hash}
+	inserting := admin.Database.Create(user).Error
+	if errors.Is(inserting, gorm.ErrDuplicatedKey) {
+		return fmt.Errorf("nickname %q is already taken", nickname)
+	}
+	if inserting != nil {
+		return inserting
+	}
+
+	fmt.Fprintf(admin.Output, "Created user %s with ID %d\n", user.Nickname, user.ID)
+	if generated != "" {
+		fmt.Fprintf(admin.Output, "Password: %s\n", generated)
+	}
+	return nil
+}
+
+func (admin *Admin) ResetPassword(arguments []string) error {
+	set := admin.flags("users reset-password", nil)
+	given := set.String("password", "", "New password of the user, a random one is generated and shown when it's empty")
+	force := set.Bool("force", false, "Skip the password policy")
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	reference, exception := single(set, "nickname")
+	if exception != nil {
+		return exception
+	}
+
+	user, exception := admin.findUser(reference)
+	if exception != nil {
+		return exception
+	}
+	hash, generated, exception := admin.password(*given, *force)
+	if exception != nil {
+		return exception
+	}
+	// The tokens issued with the previous password are revoked
+	resetting := admin.Database.Model(user).Updates(map[string]interface{}{
+		"password":      hash,
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error
+	if resetting != nil {
+		return resetting
+	}
+
+	fmt.Fprintf(admin.Output, "Password of %s was reset\n", user.Nickname)
+	if generated != "" {
+		fmt.Fprintf(admin.Output, "Password: %s\n", generated)
+	}
+	return nil
+}
+
+// DisableUser stops the user from logging in or makes it able again. The
+// tokens the user already has are rejected too while it's disabled.
+func (admin *Admin) DisableUser(arguments []string, disable bool) error {
+	name := "users enable"
+	if disable {
+		name = "users disable"
+	}
+	set := admin.flags(name, nil)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	reference, exception := single(set, "nickname")
+	if exception != nil {
+		return exception
+	}
+
+	user, exception := admin.findUser(reference)
+	if exception != nil {
+		return exception
+	}
+
+	var disabledAt *time.Time
+	state := "enabled"
+	if disable {
+		now := time.Now()
+		disabledAt, state = &now, "disabled"
+	}
+	if exception := admin.Database.Model(user).Update("disabled_at", disabledAt).Error; exception != nil {
+		return exception
+	}
+
+	fmt.Fprintf(admin.Output, "User %s is %s\n", user.Nickname, state)
+	return nil
+}
+
+// UnlockUser allows a user locked out by too many failed logins to log in
+// again right away, forgetting the failures.
+func (admin *Admin) UnlockUser(arguments []string) error {
+	set := admin.flags("users unlock", nil)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	reference, exception := single(set, "nickname")
+	if exception != nil {
+		return exception
+	}
+
+	user, exception := admin.findUser(reference)
+	if exception != nil {
+		return exception
+	}
+	unlocking := admin.Database.Model(user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+	if unlocking != nil {
+		return unlocking
+	}
+
+	fmt.Fprintf(admin.Output, "User %s is unlocked\n", user.Nickname)
+	return nil
+}
+
+// ResetTwoFactor disables the two-factor authentication of a user who lost
+// both the authenticator app and the recovery codes, so the user can log in
+// with the password and enrol again.
+func (admin *Admin) ResetTwoFactor(arguments []string) error {
+	set := admin.flags("users reset-2fa", nil)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	reference, exception := single(set, "nickname")
+	if exception != nil {
+		return exception
+	}
+
+	user, exception := admin.findUser(reference)
+	if exception != nil {
+		return exception
+	}
+	exception = admin.Database.Transaction(func(transaction *gorm.DB) error {
+		return user.DisableTwoFactor(transaction)
+	})
+	if exception != nil {
+		return exception
+	}
+
+	fmt.Fprintf(admin.Output, "Two-factor authentication of %s is disabled\n", user.Nickname)
+	return nil
+}
+
+// DeleteUser removes the user along with its videos and their annotations in
+// a single transaction.
+func (admin *Admin) DeleteUser(arguments []string) error {
+	set := admin.flags("users delete", nil)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+	reference, exception := single(set, "nickname")
+	if exception != nil {
+		return exception
+	}
+
+	user, exception := admin.findUser(reference)
+	if exception != nil {
+		return exception
+	}
+
+	var videos, annotations int64
+	exception = admin.Database.Transaction(func(transaction *gorm.DB) (exception error) {
+		videos, annotations, exception = user.Delete(transaction)
+		return exception
+	})
+	if exception != nil {
+		return exception
+	}
+
+	fmt.Fprintf(admin.Output, "Deleted user %s with %d videos and %d annotations\n", user.Nickname, videos, annotations)
+	return nil
+}
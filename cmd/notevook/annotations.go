@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/models"
+)
+
+// AnnotationEdition is the input of the bulk annotation editions, one per
+// line.
+type AnnotationEdition struct {
+	ID uint `json:"id"`
+	controllers.EditAnnotationContract
+}
+
+func (command *Command) Annotations(current context.Context, arguments []string) error {
+	name, rest := split(arguments)
+	switch name {
+	case "add":
+		return command.AddAnnotations(current, rest)
+	case "edit":
+		return command.EditAnnotations(current, rest)
+	case "rm":
+		return command.RemoveAnnotations(current, rest)
+	case "export":
+		return command.ExportAnnotations(current, rest)
+	}
+	return unknown("annotations command", name)
+}
+
+func annotationFlags(set *flag.FlagSet, kind *uint, title *string, notes *string, start *models.TimeStamp, end *models.TimeStamp) {
+	set.UintVar(kind, "type", 0, "Type of the annotation")
+	set.StringVar(title, "title", "", "Title of the annotation")
+	set.StringVar(notes, "notes", "", "Notes of the annotation")
+	set.Var(timestamp{start}, "start", "Start of the annotation, e. g. 90, 01:30, 00:01:30 or 1m30s")
+	set.Var(timestamp{end}, "end", "End of the annotation, in any of the formats of -start")
+}
+
+func (command *Command) AddAnnotations(current context.Context, arguments []string) error {
+	var format string
+	var input controllers.AddAnnotationContract
+	set := command.flags("annotations add", &format)
+	set.UintVar(&input.VideoID, "video", 0, "ID of the video to annotate")
+	annotationFlags(set, &input.Type, &input.Title, &input.Notes, &input.Start, &input.End)
+	many := set.Bool("bulk", false, "Read one annotation per line from the standard input as JSON")
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	if *many {
+		annotations, exception := bulk(command, func(input *controllers.AddAnnotationContract) (*models.Annotation, error) {
+			return command.API.AddAnnotation(current, *input)
+		})
+		return writeAll(command, format, annotations, annotationColumns, exception)
+	}
+
+	annotation, exception := command.API.AddAnnotation(current, input)
+	if exception != nil {
+		return exception
+	}
+	return write(command.Output, format, []models.Annotation{*annotation}, annotationColumns)
+}
+
+func (command *Command) EditAnnotations(current context.Context, arguments []string) error {
+	var format string
+	var input controllers.EditAnnotationContract
+	set := command.flags("annotations edit", &format)
+	annotationFlags(set, &input.Type, &input.Title, &input.Notes, &input.Start, &input.End)
+	many := set.Bool("bulk", false, `Read one edition per line from the standard input as JSON, including the "id"`)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	if *many {
+		annotations, exception := bulk(command, func(edition *AnnotationEdition) (*models.Annotation, error) {
+			return command.API.EditAnnotation(current, edition.ID, edition.EditAnnotationContract)
+		})
+		return writeAll(command, format, annotations, annotationColumns, exception)
+	}
+
+	ids, exception := identifiers(set.Args())
+	if exception != nil {
+		return exception
+	}
+	if len(ids) > 1 {
+		return fmt.Errorf("%w: only one annotation can be edited at once without -bulk", errUsage)
+	}
+
+	annotation, exception := command.API.EditAnnotation(current, ids[0], input)
+	if exception != nil {
+		return exception
+	}
+	return write(command.Output, format, []models.Annotation{*annotation}, annotationColumns)
+}
+
+func (command *Command) RemoveAnnotations(current context.Context, arguments []string) error {
+	set := command.flags("annotations rm", nil)
+	many := set.Bool("bulk", false, `Read one {"id": ...} object per line from the standard input`)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+
+	remove := func(removal *Removal) (*Removal, error) {
+		if exception := command.API.DeleteAnnotation(current, removal.ID); exception != nil {
+			return nil, exception
+		}
+		fmt.Fprintf(command.Output, "Deleted annotation %d\n", removal.ID)
+		return nil, nil
+	}
+
+	if *many {
+		_, exception := bulk(command, remove)
+		return exception
+	}
+
+	ids, exception := identifiers(set.Args())
+	if exception != nil {
+		return exception
+	}
+	for _, id := range ids {
+		if _, exception := remove(&Removal{ID: id}); exception != nil {
+			return exception
+		}
+	}
+	return nil
+}
+
+// ExportAnnotations writes the annotations of a video, as JSON Lines by
+// default so they can be added again with "annotations add -bulk".
+func (command *Command) ExportAnnotations(current context.Context, arguments []string) error {
+	format := FormatJSONL
+	set := command.flags("annotations export", &format)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	ids, exception := identifiers(set.Args())
+	if exception != nil {
+		return exception
+	}
+	if len(ids) > 1 {
+		return fmt.Errorf("%w: the annotations of only one video can be exported at once", errUsage)
+	}
+
+	video, exception := command.API.Video(current, ids[0])
+	if exception != nil {
+		return exception
+	}
+	return write(command.Output, format, video.Annotations, annotationColumns)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// bulk applies the operation to each JSON object read from the input, one
+// per line. The failures are reported with their line and don't stop the
+// following operations, the records of the successful ones are returned.
+func bulk[Input any, Record any](command *Command, operation func(*Input) (*Record, error)) ([]Record, error) {
+	decoder := json.NewDecoder(command.Input)
+	records := []Record{}
+	failed, total := 0, 0
+	for line := 1; ; line++ {
+		var input Input
+		exception := decoder.Decode(&input)
+		if errors.Is(exception, io.EOF) {
+			break
+		}
+
+		total++
+		if exception != nil {
+			// The decoder can't carry on after a syntax error
+			fmt.Fprintf(command.Errors, "line %d: %v\n", line, exception)
+			failed++
+			break
+		}
+
+		record, exception := operation(&input)
+		if exception != nil {
+			fmt.Fprintf(command.Errors, "line %d: ", line)
+			exit(exception, command.Errors)
+			failed++
+			continue
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+
+	if failed > 0 {
+		return records, fmt.Errorf("%d of %d operations failed", failed, total)
+	}
+	return records, nil
+}
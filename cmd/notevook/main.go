@@ -0,0 +1,251 @@
+// Command notevook is a command line client of the NoteVook API meant for
+// scripting: it logs in once, keeps the token on a settings file and writes
+// the videos and annotations as a table, JSON, JSON Lines or CSV.
+//
+// Usage:
+//
+//	notevook [-config file] [-url address] <command> [flags] [arguments]
+//
+// The commands are login, logout, videos (list, add, edit, rm) and
+// annotations (add, edit, rm, export).
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/zatarain/note-vook/client"
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/models"
+)
+
+const (
+	ExitSuccess int = 0
+	ExitFailure int = 1
+	ExitUsage   int = 2
+)
+
+const usage string = `Usage: notevook [-config file] [-url address] <command> [flags] [arguments]
+
+Commands:
+  login                        Log in and save the token on the settings file
+  logout                       Forget the token
+  videos list                  List the videos of the user
+  videos add                   Add a video, or many with -bulk
+  videos edit ID               Edit a video, or many with -bulk
+  videos rm ID...              Remove videos, or many with -bulk
+  annotations add              Add an annotation, or many with -bulk
+  annotations edit ID          Edit an annotation, or many with -bulk
+  annotations rm ID...         Remove annotations, or many with -bulk
+  annotations export VIDEO_ID  Write the annotations of a video
+
+Run "notevook <command> -h" to get the flags of a command.
+`
+
+var (
+	// errUsage marks the failures caused by a wrong invocation
+	errUsage = errors.New("usage")
+
+	// errFlags marks the wrong flags, the flag package already explained them
+	errFlags = errors.New("invalid flags")
+)
+
+// Command has what the commands need to run, so they can be tested with any
+// input and output.
+type Command struct {
+	Settings *Settings
+	API      *client.Client
+	Input    io.Reader
+	Output   io.Writer
+	Errors   io.Writer
+}
+
+func main() {
+	current, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(current, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(current context.Context, arguments []string, input io.Reader, output io.Writer, failures io.Writer) int {
+	global := flag.NewFlagSet("notevook", flag.ContinueOnError)
+	global.SetOutput(failures)
+	global.Usage = func() { fmt.Fprint(failures, usage) }
+	path := global.String("config", SettingsPath(), "Path to the settings file")
+	address := global.String("url", os.Getenv("NOTEVOOK_URL"), "Address of the API, overrides the one on the settings")
+	if exception := global.Parse(arguments); exception != nil {
+		return exit(fmt.Errorf("%w: %w", errFlags, exception), failures)
+	}
+
+	settings, exception := LoadSettings(*path)
+	if exception != nil {
+		fmt.Fprintf(failures, "notevook: failed to read the settings: %v\n", exception)
+		return ExitFailure
+	}
+	if *address != "" {
+		settings.URL = *address
+	}
+
+	api := client.New(settings.URL)
+	api.Tokens = settings
+	command := &Command{Settings: settings, API: api, Input: input, Output: output, Errors: failures}
+
+	name, rest := split(global.Args())
+	switch name {
+	case "login":
+		exception = command.Login(current, rest)
+	case "logout":
+		exception = command.API.Logout()
+	case "videos":
+		exception = command.Videos(current, rest)
+	case "annotations":
+		exception = command.Annotations(current, rest)
+	default:
+		exception = unknown("command", name)
+	}
+	return exit(exception, failures)
+}
+
+func split(arguments []string) (string, []string) {
+	if len(arguments) == 0 {
+		return "", nil
+	}
+	return arguments[0], arguments[1:]
+}
+
+func unknown(kind string, name string) error {
+	if name != "" {
+		return fmt.Errorf("%w: unknown %s %q", errUsage, kind, name)
+	}
+	return fmt.Errorf("%w: missing %s", errUsage, kind)
+}
+
+// exit reports the failure, if any, and tells the exit code for it. The
+// problems sent by the API include the fields that failed the validation.
+func exit(exception error, output io.Writer) int {
+	if exception == nil || errors.Is(exception, flag.ErrHelp) {
+		return ExitSuccess
+	}
+
+	if errors.Is(exception, errFlags) {
+		return ExitUsage
+	}
+
+	if errors.Is(exception, errUsage) {
+		fmt.Fprintf(output, "notevook: %s\n\n", strings.TrimPrefix(exception.Error(), errUsage.Error()+": "))
+		fmt.Fprint(output, usage)
+		return ExitUsage
+	}
+
+	fmt.Fprintf(output, "notevook: %v\n", exception)
+	var failure *client.Error
+	if errors.As(exception, &failure) {
+		for _, field := range failure.Errors {
+			fmt.Fprintf(output, "  %s: %s\n", field.Field, field.Message)
+		}
+	}
+	return ExitFailure
+}
+
+// flags creates the flag set of a command, along with the output format
+// which is a table unless the command gives another default.
+func (command *Command) flags(name string, format *string) *flag.FlagSet {
+	set := flag.NewFlagSet("notevook "+name, flag.ContinueOnError)
+	set.SetOutput(command.Errors)
+	if format != nil {
+		if *format == "" {
+			*format = FormatTable
+		}
+		set.StringVar(format, "format", *format, "Output format: "+strings.Join(formats, ", "))
+	}
+	return set
+}
+
+// parse reads the flags of a command along with the output format, if any.
+func parse(set *flag.FlagSet, arguments []string, format *string) error {
+	if exception := set.Parse(arguments); exception != nil {
+		return fmt.Errorf("%w: %w", errFlags, exception)
+	}
+	if format == nil {
+		return nil
+	}
+	if exception := validFormat(*format); exception != nil {
+		return fmt.Errorf("%w: %w", errUsage, exception)
+	}
+	return nil
+}
+
+func (command *Command) Login(current context.Context, arguments []string) error {
+	set := command.flags("login", nil)
+	nickname := set.String("nickname", command.Settings.Nickname, "Nickname of the user")
+	password := set.String("password", os.Getenv("NOTEVOOK_PASSWORD"), "Password of the user, read from the standard input when it's empty")
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+
+	if *password == "" {
+		line, exception := bufio.NewReader(command.Input).ReadString('\n')
+		if exception != nil && !errors.Is(exception, io.EOF) {
+			return exception
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+
+	credentials := controllers.Credentials{Nickname: *nickname, Password: *password}
+	if exception := command.API.Login(current, credentials); exception != nil {
+		return exception
+	}
+
+	command.Settings.Nickname = *nickname
+	if exception := command.Settings.Save(); exception != nil {
+		return exception
+	}
+	fmt.Fprintf(command.Output, "Logged in as %s on %s\n", *nickname, command.Settings.URL)
+	return nil
+}
+
+// identifiers reads the IDs given as arguments.
+func identifiers(arguments []string) ([]uint, error) {
+	if len(arguments) == 0 {
+		return nil, unknown("ID", "")
+	}
+
+	ids := make([]uint, 0, len(arguments))
+	for _, argument := range arguments {
+		id, exception := strconv.ParseUint(argument, 10, 0)
+		if exception != nil {
+			return nil, fmt.Errorf("%w: invalid ID %q", errUsage, argument)
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
+
+// timestamp is a flag accepting any of the formats of the time stamps.
+type timestamp struct {
+	value *models.TimeStamp
+}
+
+func (flag timestamp) String() string {
+	if flag.value == nil {
+		return ""
+	}
+	return flag.value.Clock()
+}
+
+func (flag timestamp) Set(text string) error {
+	parsed, exception := models.ParseTimeStamp(text)
+	if exception != nil {
+		return fmt.Errorf("invalid time stamp %q, expected seconds, a clock like 01:30:00 or a duration like 1h30m", text)
+	}
+	*flag.value = parsed
+	return nil
+}
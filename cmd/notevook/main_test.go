@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/client"
+	"github.com/zatarain/note-vook/configuration"
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/models"
+)
+
+// serve runs the whole API on a temporary database.
+func serve(test *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	filename := filepath.Join(test.TempDir(), "notevook.db")
+	database, connection, exception := configuration.ConnectToDatabase(configuration.DatabaseConfig{Filename: filename}, logger)
+	require.Nil(test, exception)
+	configuration.MigrateDatabase(database)
+
+	engine := gin.New()
+	configuration.SetupProblems(engine)
+	config := &configuration.Config{}
+	config.Security.SecretTokenKey = "notevook-test-secret-token-key-with-enough-length"
+	configuration.Setup(engine, config, database, logging.New(io.Discard, logging.FormatJSON, slog.LevelInfo, nil))
+
+	server := httptest.NewServer(engine)
+	test.Cleanup(func() {
+		server.Close()
+		connection.Close()
+	})
+	return server
+}
+
+type result struct {
+	Code   int
+	Output string
+	Errors string
+}
+
+func TestNotevook(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	server := serve(test)
+	settings := filepath.Join(test.TempDir(), "notevook.toml")
+	credentials := controllers.Credentials{Nickname: "dummy", Password: "dummy-password"}
+	_, exception := client.New(server.URL).Signup(context.Background(), credentials)
+	require.Nil(exception)
+
+	notevook := func(input string, arguments ...string) result {
+		var output, errors bytes.Buffer
+		arguments = append([]string{"-config", settings, "-url", server.URL}, arguments...)
+		code := run(context.Background(), arguments, strings.NewReader(input), &output, &errors)
+		return result{Code: code, Output: output.String(), Errors: errors.String()}
+	}
+
+	videos := func(output string) []models.Video {
+		var records []models.Video
+		require.Nil(json.Unmarshal([]byte(output), &records), output)
+		return records
+	}
+
+	test.Run("Should log in reading the password from the input and save the token", func(test *testing.T) {
+		// Act
+		login := notevook("dummy-password\n", "login", "-nickname", "dummy")
+
+		// Assert
+		require.Equal(ExitSuccess, login.Code, login.Errors)
+		assert.Contains(login.Output, "Logged in as dummy")
+		saved, _ := LoadSettings(settings)
+		assert.Equal("dummy", saved.Nickname)
+		assert.NotEmpty(saved.AccessToken)
+		info, _ := os.Stat(settings)
+		assert.Equal(os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	test.Run("Should fail to log in with wrong credentials", func(test *testing.T) {
+		// Act
+		login := notevook("", "login", "-nickname", "dummy", "-password", "wrong")
+
+		// Assert
+		assert.Equal(ExitFailure, login.Code)
+		assert.Contains(login.Errors, "401 invalid_credentials")
+	})
+
+	var video models.Video
+	test.Run("Should add a video with the duration as a clock", func(test *testing.T) {
+		// Act
+		adding := notevook("", "videos", "add", "-format", "json",
+			"-title", "Dummy video", "-link", "https://www.youtube.com/watch?v=dummy", "-duration", "1:30:00")
+
+		// Assert
+		require.Equal(ExitSuccess, adding.Code, adding.Errors)
+		added := videos(adding.Output)
+		require.Len(added, 1)
+		video = added[0]
+		assert.Equal(models.TimeStamp(5400), video.Duration)
+	})
+
+	test.Run("Should add videos in bulk reporting the failed lines", func(test *testing.T) {
+		// Arrange
+		input := strings.Join([]string{
+			`{"title": "Seconds", "link": "https://www.youtube.com/watch?v=seconds", "duration": 90}`,
+			`{"title": "Duration", "link": "https://www.youtube.com/watch?v=duration", "duration": "1h2m3s"}`,
+			`{"title": "Invalid", "link": "not a link", "duration": "00:10"}`,
+		}, "\n")
+
+		// Act
+		adding := notevook(input, "videos", "add", "-bulk", "-format", "json")
+
+		// Assert
+		assert.Equal(ExitFailure, adding.Code)
+		assert.Contains(adding.Errors, "line 3: notevook: 400 validation_failed")
+		assert.Contains(adding.Errors, "link: must be a valid URL")
+		assert.Contains(adding.Errors, "1 of 3 operations failed")
+		added := videos(adding.Output)
+		require.Len(added, 2)
+		assert.Equal(models.TimeStamp(90), added[0].Duration)
+		assert.Equal(models.TimeStamp(3723), added[1].Duration)
+	})
+
+	test.Run("Should list the videos as CSV", func(test *testing.T) {
+		// Act
+		listing := notevook("", "videos", "list", "-format", "csv")
+
+		// Assert
+		require.Equal(ExitSuccess, listing.Code, listing.Errors)
+		rows, exception := csv.NewReader(strings.NewReader(listing.Output)).ReadAll()
+		require.Nil(exception)
+		require.Len(rows, 4)
+		assert.Equal(videoColumns.Header, rows[0])
+		assert.Equal([]string{strconv.Itoa(int(video.ID)), "Dummy video", "", "https://www.youtube.com/watch?v=dummy", "01:30:00"}, rows[1][:5])
+	})
+
+	test.Run("Should list the videos as a table", func(test *testing.T) {
+		// Act
+		listing := notevook("", "videos", "list")
+
+		// Assert
+		require.Equal(ExitSuccess, listing.Code, listing.Errors)
+		lines := strings.Split(strings.TrimSpace(listing.Output), "\n")
+		assert.Len(lines, 4)
+		assert.Regexp(`^ID\s+TITLE\s+DESCRIPTION\s+LINK\s+DURATION\s+CREATED AT\s+UPDATED AT$`, lines[0])
+		assert.Contains(lines[1], "01:30:00")
+	})
+
+	test.Run("Should edit a video", func(test *testing.T) {
+		// Act
+		editing := notevook("", "videos", "edit", "-format", "json", "-title", "Renamed", strconv.Itoa(int(video.ID)))
+
+		// Assert
+		require.Equal(ExitSuccess, editing.Code, editing.Errors)
+		assert.Equal("Renamed", videos(editing.Output)[0].Title)
+	})
+
+	test.Run("Should annotate a video and export its annotations", func(test *testing.T) {
+		// Arrange
+		id := strconv.Itoa(int(video.ID))
+		input := strings.Join([]string{
+			`{"video_id": ` + id + `, "title": "Second", "start": "00:10:00", "end": "15m"}`,
+			`{"video_id": ` + id + `, "title": "Third", "start": 1800, "end": "2400"}`,
+		}, "\n")
+
+		// Act
+		adding := notevook("", "annotations", "add", "-video", id, "-title", "First", "-start", "10", "-end", "01:00")
+		bulk := notevook(input, "annotations", "add", "-bulk", "-format", "csv")
+		exporting := notevook("", "annotations", "export", id)
+
+		// Assert
+		require.Equal(ExitSuccess, adding.Code, adding.Errors)
+		require.Equal(ExitSuccess, bulk.Code, bulk.Errors)
+		require.Equal(ExitSuccess, exporting.Code, exporting.Errors)
+		assert.Contains(bulk.Output, "Second,,00:10:00,00:15:00")
+		lines := strings.Split(strings.TrimSpace(exporting.Output), "\n")
+		require.Len(lines, 3)
+		annotation := models.Annotation{}
+		require.Nil(json.Unmarshal([]byte(lines[0]), &annotation))
+		assert.Equal("First", annotation.Title)
+		assert.Equal(models.TimeStamp(10), annotation.Start)
+		assert.Equal(models.TimeStamp(60), annotation.End)
+	})
+
+	test.Run("Should edit and remove annotations in bulk", func(test *testing.T) {
+		// Arrange
+		exported := notevook("", "annotations", "export", strconv.Itoa(int(video.ID)))
+		lines := strings.Split(strings.TrimSpace(exported.Output), "\n")
+		editions := strings.ReplaceAll(strings.Join(lines, "\n"), `"title":"`, `"title":"Edited `)
+
+		// Act
+		editing := notevook(editions, "annotations", "edit", "-bulk", "-format", "json")
+		removing := notevook(strings.Join(lines, "\n"), "annotations", "rm", "-bulk")
+		exporting := notevook("", "annotations", "export", "-format", "csv", strconv.Itoa(int(video.ID)))
+
+		// Assert
+		require.Equal(ExitSuccess, editing.Code, editing.Errors)
+		assert.Equal(3, strings.Count(editing.Output, `"title": "Edited `))
+		require.Equal(ExitSuccess, removing.Code, removing.Errors)
+		assert.Equal(3, strings.Count(removing.Output, "Deleted annotation"))
+		assert.Equal(strings.Join(annotationColumns.Header, ",")+"\n", exporting.Output)
+	})
+
+	test.Run("Should remove videos", func(test *testing.T) {
+		// Arrange
+		listed := videos(notevook("", "videos", "list", "-format", "json").Output)
+		ids := []string{}
+		for _, record := range listed {
+			ids = append(ids, strconv.Itoa(int(record.ID)))
+		}
+
+		// Act
+		removing := notevook("", append([]string{"videos", "rm"}, ids...)...)
+		again := notevook("", "videos", "rm", ids[0])
+
+		// Assert
+		require.Equal(ExitSuccess, removing.Code, removing.Errors)
+		assert.Equal(3, strings.Count(removing.Output, "Deleted video"))
+		assert.Equal(ExitFailure, again.Code)
+		assert.Contains(again.Errors, "404 video_not_found")
+	})
+
+	test.Run("Should report the wrong invocations", func(test *testing.T) {
+		testcases := []struct {
+			Name      string
+			Arguments []string
+			Expected  string
+		}{
+			{Name: "Should report a missing command", Expected: "missing command"},
+			{Name: "Should report an unknown command", Arguments: []string{"dance"}, Expected: `unknown command "dance"`},
+			{Name: "Should report an unknown subcommand", Arguments: []string{"videos", "play"}, Expected: `unknown videos command "play"`},
+			{Name: "Should report an unknown format", Arguments: []string{"videos", "list", "-format", "xml"}, Expected: `unknown output format "xml"`},
+			{Name: "Should report an invalid time stamp", Arguments: []string{"videos", "add", "-duration", "soon"}, Expected: `invalid time stamp "soon"`},
+			{Name: "Should report a missing ID", Arguments: []string{"annotations", "rm"}, Expected: "missing ID"},
+			{Name: "Should report an invalid ID", Arguments: []string{"videos", "edit", "first"}, Expected: `invalid ID "first"`},
+		}
+
+		for _, testcase := range testcases {
+			test.Run(testcase.Name, func(test *testing.T) {
+				// Act
+				invocation := notevook("", testcase.Arguments...)
+
+				// Assert
+				assert.Equal(ExitUsage, invocation.Code)
+				assert.Contains(invocation.Errors, testcase.Expected)
+			})
+		}
+	})
+
+	test.Run("Should forget the token on log out", func(test *testing.T) {
+		// Act
+		logout := notevook("", "logout")
+		listing := notevook("", "videos", "list")
+
+		// Assert
+		assert.Equal(ExitSuccess, logout.Code)
+		saved, _ := LoadSettings(settings)
+		assert.Empty(saved.AccessToken)
+		assert.Equal(ExitFailure, listing.Code)
+		assert.Contains(listing.Errors, "401 unauthorised")
+	})
+}
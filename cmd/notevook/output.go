@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zatarain/note-vook/models"
+)
+
+const (
+	FormatTable string = "table"
+	FormatJSON  string = "json"
+	FormatJSONL string = "jsonl"
+	FormatCSV   string = "csv"
+)
+
+var formats = []string{FormatTable, FormatJSON, FormatJSONL, FormatCSV}
+
+// Columns tells how to write the records of a kind as rows of a table or CSV,
+// the header uses the same names as the JSON fields.
+type Columns[Record any] struct {
+	Header []string
+	Row    func(*Record) []string
+}
+
+var videoColumns = Columns[models.Video]{
+	Header: []string{"id", "title", "description", "link", "duration", "created_at", "updated_at"},
+	Row: func(video *models.Video) []string {
+		return []string{
+			strconv.FormatUint(uint64(video.ID), 10),
+			video.Title,
+			video.Description,
+			video.Link,
+			video.Duration.Clock(),
+			video.CreatedAt.Format(time.RFC3339),
+			video.UpdatedAt.Format(time.RFC3339),
+		}
+	},
+}
+
+var annotationColumns = Columns[models.Annotation]{
+	Header: []string{"id", "video_id", "type", "title", "notes", "start", "end"},
+	Row: func(annotation *models.Annotation) []string {
+		return []string{
+			strconv.FormatUint(uint64(annotation.ID), 10),
+			strconv.FormatUint(uint64(annotation.VideoID), 10),
+			strconv.FormatUint(uint64(annotation.Type), 10),
+			annotation.Title,
+			annotation.Notes,
+			annotation.Start.Clock(),
+			annotation.End.Clock(),
+		}
+	},
+}
+
+func validFormat(format string) error {
+	for _, known := range formats {
+		if format == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q, expected one of: %s", format, strings.Join(formats, ", "))
+}
+
+// write prints the records on the given format. The time stamps are always
+// written as clocks, e. g. 01:30:00.
+func write[Record any](output io.Writer, format string, records []Record, columns Columns[Record]) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(output)
+		encoder.SetIndent("", "  ")
+		if records == nil {
+			records = []Record{}
+		}
+		return encoder.Encode(records)
+	case FormatJSONL:
+		encoder := json.NewEncoder(output)
+		for index := range records {
+			if exception := encoder.Encode(&records[index]); exception != nil {
+				return exception
+			}
+		}
+		return nil
+	case FormatCSV:
+		writer := csv.NewWriter(output)
+		writer.Write(columns.Header)
+		for index := range records {
+			writer.Write(columns.Row(&records[index]))
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		writer := tabwriter.NewWriter(output, 0, 4, 2, ' ', 0)
+		header := make([]string, len(columns.Header))
+		for index, name := range columns.Header {
+			header[index] = strings.ToUpper(strings.ReplaceAll(name, "_", " "))
+		}
+		fmt.Fprintln(writer, strings.Join(header, "\t"))
+		for index := range records {
+			row := columns.Row(&records[index])
+			for column, value := range row {
+				row[column] = strings.ReplaceAll(value, "\n", " ")
+			}
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	}
+}
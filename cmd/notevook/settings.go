@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+const DefaultURL string = "http://localhost:8080"
+
+// Settings are kept in a TOML file only readable by its owner, so the user
+// logs in once and the following commands reuse the address and the token.
+type Settings struct {
+	URL         string `toml:"url"`
+	Nickname    string `toml:"nickname"`
+	AccessToken string `toml:"token"`
+
+	path string
+}
+
+// SettingsPath is the file given by NOTEVOOK_CONFIG variable or notevook.toml
+// on the configuration directory of the user.
+func SettingsPath() string {
+	if path := os.Getenv("NOTEVOOK_CONFIG"); path != "" {
+		return path
+	}
+	directory, exception := os.UserConfigDir()
+	if exception != nil {
+		directory = "."
+	}
+	return filepath.Join(directory, "notevook", "notevook.toml")
+}
+
+func LoadSettings(path string) (*Settings, error) {
+	settings := &Settings{URL: DefaultURL, path: path}
+	content, exception := os.ReadFile(path)
+	if errors.Is(exception, fs.ErrNotExist) {
+		return settings, nil
+	}
+	if exception != nil {
+		return nil, exception
+	}
+	if exception := toml.Unmarshal(content, settings); exception != nil {
+		return nil, exception
+	}
+	return settings, nil
+}
+
+func (settings *Settings) Save() error {
+	content, exception := toml.Marshal(settings)
+	if exception != nil {
+		return exception
+	}
+	if exception := os.MkdirAll(filepath.Dir(settings.path), 0o700); exception != nil {
+		return exception
+	}
+	return os.WriteFile(settings.path, content, 0o600)
+}
+
+// Token and SetToken make the settings the token store of the client.
+func (settings *Settings) Token() (string, error) {
+	return settings.AccessToken, nil
+}
+
+func (settings *Settings) SetToken(token string) error {
+	settings.AccessToken = token
+	return settings.Save()
+}
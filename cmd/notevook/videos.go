@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/models"
+)
+
+// Removal is the input of the bulk removals, one per line.
+type Removal struct {
+	ID uint `json:"id"`
+}
+
+// VideoEdition is the input of the bulk video editions, one per line.
+type VideoEdition struct {
+	ID uint `json:"id"`
+	controllers.EditVideoContract
+}
+
+func (command *Command) Videos(current context.Context, arguments []string) error {
+	name, rest := split(arguments)
+	switch name {
+	case "list":
+		return command.ListVideos(current, rest)
+	case "add":
+		return command.AddVideos(current, rest)
+	case "edit":
+		return command.EditVideos(current, rest)
+	case "rm":
+		return command.RemoveVideos(current, rest)
+	}
+	return unknown("videos command", name)
+}
+
+func videoFlags(set *flag.FlagSet, title *string, description *string, link *string, duration *models.TimeStamp) {
+	set.StringVar(title, "title", "", "Title of the video")
+	set.StringVar(description, "description", "", "Description of the video")
+	set.StringVar(link, "link", "", "Link to the video")
+	set.Var(timestamp{duration}, "duration", "Duration of the video, e. g. 90, 01:30, 00:01:30 or 1m30s")
+}
+
+func (command *Command) ListVideos(current context.Context, arguments []string) error {
+	var format string
+	set := command.flags("videos list", &format)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	videos, exception := command.API.Videos(current)
+	if exception != nil {
+		return exception
+	}
+	return write(command.Output, format, videos, videoColumns)
+}
+
+func (command *Command) AddVideos(current context.Context, arguments []string) error {
+	var format string
+	var input controllers.AddVideoContract
+	set := command.flags("videos add", &format)
+	videoFlags(set, &input.Title, &input.Description, &input.Link, &input.Duration)
+	many := set.Bool("bulk", false, "Read one video per line from the standard input as JSON")
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	if *many {
+		videos, exception := bulk(command, func(input *controllers.AddVideoContract) (*models.Video, error) {
+			return command.API.AddVideo(current, *input)
+		})
+		return writeAll(command, format, videos, videoColumns, exception)
+	}
+
+	video, exception := command.API.AddVideo(current, input)
+	if exception != nil {
+		return exception
+	}
+	return write(command.Output, format, []models.Video{*video}, videoColumns)
+}
+
+func (command *Command) EditVideos(current context.Context, arguments []string) error {
+	var format string
+	var input controllers.EditVideoContract
+	set := command.flags("videos edit", &format)
+	videoFlags(set, &input.Title, &input.Description, &input.Link, &input.Duration)
+	many := set.Bool("bulk", false, `Read one edition per line from the standard input as JSON, including the "id"`)
+	if exception := parse(set, arguments, &format); exception != nil {
+		return exception
+	}
+
+	if *many {
+		videos, exception := bulk(command, func(edition *VideoEdition) (*models.Video, error) {
+			return command.API.EditVideo(current, edition.ID, edition.EditVideoContract)
+		})
+		return writeAll(command, format, videos, videoColumns, exception)
+	}
+
+	ids, exception := identifiers(set.Args())
+	if exception != nil {
+		return exception
+	}
+	if len(ids) > 1 {
+		return fmt.Errorf("%w: only one video can be edited at once without -bulk", errUsage)
+	}
+
+	video, exception := command.API.EditVideo(current, ids[0], input)
+	if exception != nil {
+		return exception
+	}
+	return write(command.Output, format, []models.Video{*video}, videoColumns)
+}
+
+func (command *Command) RemoveVideos(current context.Context, arguments []string) error {
+	set := command.flags("videos rm", nil)
+	many := set.Bool("bulk", false, `Read one {"id": ...} object per line from the standard input`)
+	if exception := parse(set, arguments, nil); exception != nil {
+		return exception
+	}
+
+	remove := func(removal *Removal) (*Removal, error) {
+		if exception := command.API.DeleteVideo(current, removal.ID); exception != nil {
+			return nil, exception
+		}
+		fmt.Fprintf(command.Output, "Deleted video %d\n", removal.ID)
+		return nil, nil
+	}
+
+	if *many {
+		_, exception := bulk(command, remove)
+		return exception
+	}
+
+	ids, exception := identifiers(set.Args())
+	if exception != nil {
+		return exception
+	}
+	for _, id := range ids {
+		if _, exception := remove(&Removal{ID: id}); exception != nil {
+			return exception
+		}
+	}
+	return nil
+}
+
+// writeAll writes the records of a bulk operation, even when some of the
+// operations failed.
+func writeAll[Record any](command *Command, format string, records []Record, columns Columns[Record], exception error) error {
+	if writing := write(command.Output, format, records, columns); writing != nil {
+		return writing
+	}
+	return exception
+}
@@ -0,0 +1,36 @@
+package configuration
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/models"
+)
+
+// AdminPath is the prefix of the administration end-points, which are not
+// versioned along with the API.
+const AdminPath string = "/admin"
+
+// NewBackupManager creates the manager of the database backups as configured.
+func NewBackupManager(config *Config, database models.DataAccessInterface, logger *slog.Logger) *backup.Manager {
+	return &backup.Manager{
+		Database:  database,
+		Directory: config.Backup.Path(),
+		Compress:  config.Backup.Compress,
+		Keep:      config.Backup.Keep,
+		Logger:    logger,
+	}
+}
+
+// SetupBackups adds the administration end-points to back up the database,
+// protected by the admin token or the session of an administrator.
+func SetupBackups(server gin.IRouter, config *Config, manager *backup.Manager, administrator func(*gin.Context) bool) {
+	backups := &controllers.BackupsController{Manager: manager}
+
+	admin := server.Group(AdminPath, middleware.Admin(config.Security.AdminToken, administrator))
+	admin.GET("/backups", backups.Index)
+	admin.POST("/backups", backups.Create)
+}
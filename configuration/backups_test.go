@@ -0,0 +1,70 @@
+package configuration
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSetupBackups(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// Arrange
+	const token string = "0123456789abcdef0123456789abcdef"
+	directory := test.TempDir()
+	database, exception := gorm.Open(sqlite.Open(filepath.Join(directory, "live.db")), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(Models()...))
+	config := &Config{
+		Security: SecurityConfig{AdminToken: token},
+		Backup:   BackupConfig{Directory: filepath.Join(directory, "backups"), Keep: 3, Compress: true},
+	}
+	engine := gin.New()
+
+	// Act
+	manager := NewBackupManager(config, database, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	SetupBackups(engine, config, manager, nil)
+
+	// Assert
+	assert.Equal(config.Backup.Directory, manager.Directory)
+	assert.Equal(3, manager.Keep)
+	assert.True(manager.Compress)
+
+	testcases := []struct {
+		Description   string
+		Method        string
+		Authorization string
+		Status        int
+	}{
+		{"Should back up the database with the admin token", http.MethodPost, "Bearer " + token, http.StatusCreated},
+		{"Should list the backups with the admin token", http.MethodGet, "Bearer " + token, http.StatusOK},
+		{"Should not back up the database without the admin token", http.MethodPost, "", http.StatusUnauthorized},
+		{"Should not list the backups with another token", http.MethodGet, "Bearer " + token[1:] + "0", http.StatusUnauthorized},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			request, _ := http.NewRequest(testcase.Method, AdminPath+"/backups", nil)
+			request.Header.Set("Authorization", testcase.Authorization)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			engine.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,654 @@
+package configuration
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/policy"
+	"gopkg.in/yaml.v3"
+)
+
+const MinimumSecretTokenKeyLength = 32
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Config holds all the settings of the API. Each setting is described by its
+// struct tags: the environment variable (env), the command line flag (flag),
+// the key within the configuration file (file) and the default value (default).
+type Config struct {
+	Mode        string            `env:"GIN_MODE" flag:"mode" file:"mode" default:"debug" usage:"Running mode: debug, test or release"`
+	Server      ServerConfig      `file:"server"`
+	Database    DatabaseConfig    `file:"database"`
+	Security    SecurityConfig    `file:"security"`
+	Metrics     MetricsConfig     `file:"metrics"`
+	Tracing     TracingConfig     `file:"tracing"`
+	Logging     LoggingConfig     `file:"logging"`
+	Versioning  VersioningConfig  `file:"versioning"`
+	Backup      BackupConfig      `file:"backup"`
+	Idempotency IdempotencyConfig `file:"idempotency"`
+	Events      EventsConfig      `file:"events"`
+	Webhooks    WebhooksConfig    `file:"webhooks"`
+	Jobs        JobsConfig        `file:"jobs"`
+	RateLimit   RateLimitConfig   `file:"rate_limit"`
+	Login       LoginConfig       `file:"login"`
+	Password    PasswordConfig    `file:"password"`
+	Nickname    NicknameConfig    `file:"nickname"`
+	TwoFactor   TwoFactorConfig   `file:"two_factor"`
+	OIDC        OIDCConfig        `file:"oidc"`
+}
+
+type ServerConfig struct {
+	Port            string        `env:"PORT" flag:"port" file:"port" default:"8080" usage:"Port to listen to"`
+	ReadTimeout     time.Duration `env:"READ_TIMEOUT" flag:"read-timeout" file:"read_timeout" default:"15s" usage:"Maximum time to read a request"`
+	WriteTimeout    time.Duration `env:"WRITE_TIMEOUT" flag:"write-timeout" file:"write_timeout" default:"30s" usage:"Maximum time to write a response"`
+	IdleTimeout     time.Duration `env:"IDLE_TIMEOUT" flag:"idle-timeout" file:"idle_timeout" default:"60s" usage:"Maximum time to wait for the next request"`
+	ShutdownTimeout time.Duration `env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout" file:"shutdown_timeout" default:"10s" usage:"Maximum time to drain in-flight requests"`
+	Certificate     string        `env:"TLS_CERTIFICATE" flag:"tls-certificate" file:"tls_certificate" usage:"Path to the PEM certificate"`
+	Key             string        `env:"TLS_KEY" flag:"tls-key" file:"tls_key" usage:"Path to the PEM private key"`
+	TrustedProxies  string        `env:"TRUSTED_PROXIES" flag:"trusted-proxies" file:"trusted_proxies" usage:"Comma separated addresses or CIDR ranges of the proxies whose X-Forwarded-For is trusted, empty to trust none"`
+}
+
+type DatabaseConfig struct {
+	Filename         string        `env:"DATABASE" flag:"database" file:"filename" default:"data/beta.db" usage:"Path to the SQLite database file"`
+	SlowThreshold    time.Duration `env:"DATABASE_SLOW_THRESHOLD" flag:"database-slow-threshold" file:"slow_threshold" default:"200ms" usage:"Statements taking longer are logged as warnings"`
+	PingTimeout      time.Duration `env:"DATABASE_PING_TIMEOUT" flag:"database-ping-timeout" file:"ping_timeout" default:"2s" usage:"Maximum time to wait for the database on readiness checks"`
+	BusyTimeout      time.Duration `env:"DATABASE_BUSY_TIMEOUT" flag:"database-busy-timeout" file:"busy_timeout" default:"5s" usage:"Maximum time the statements wait for the locks of the database"`
+	MinimumFreeSpace uint64        `env:"DATABASE_MINIMUM_FREE_SPACE" flag:"database-minimum-free-space" file:"minimum_free_space" default:"104857600" usage:"Minimum free bytes on the database disk to be ready"`
+}
+
+type SecurityConfig struct {
+	SecretTokenKey string `env:"SECRET_TOKEN_KEY" flag:"secret-token-key" file:"secret_token_key" usage:"Key to sign the authorisation tokens"`
+	AdminToken     string `env:"ADMIN_TOKEN" flag:"admin-token" file:"admin_token" usage:"Bearer token of the administration end-points, empty to disable them"`
+}
+
+type MetricsConfig struct {
+	Enabled bool   `env:"METRICS_ENABLED" flag:"metrics" file:"enabled" default:"true" usage:"Expose metrics in Prometheus text format"`
+	Path    string `env:"METRICS_PATH" flag:"metrics-path" file:"path" default:"/metrics" usage:"Path of the metrics end-point"`
+	Port    string `env:"METRICS_PORT" flag:"metrics-port" file:"port" usage:"Dedicated port for the metrics, empty to use the API one"`
+}
+
+type TracingConfig struct {
+	Enabled     bool    `env:"TRACING_ENABLED" flag:"tracing" file:"enabled" default:"false" usage:"Record OpenTelemetry traces"`
+	Exporter    string  `env:"TRACING_EXPORTER" flag:"tracing-exporter" file:"exporter" usage:"Exporter for the traces: otlp, stdout or file. Empty to choose by the other settings"`
+	Endpoint    string  `env:"OTEL_EXPORTER_OTLP_ENDPOINT" flag:"tracing-endpoint" file:"endpoint" usage:"Base URL of the OTLP/HTTP collector"`
+	File        string  `env:"TRACING_FILE" flag:"tracing-file" file:"file" usage:"File to append the traces when exporting to a file"`
+	ServiceName string  `env:"OTEL_SERVICE_NAME" flag:"tracing-service-name" file:"service_name" default:"note-vook" usage:"Service name reported with the traces"`
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" flag:"tracing-sample-ratio" file:"sample_ratio" default:"1" usage:"Ratio of the traces to sample, from 0 to 1"`
+}
+
+type LoggingConfig struct {
+	Level  string `env:"LOG_LEVEL" flag:"log-level" file:"level" default:"info" usage:"Minimum level to log: debug, info, warn or error"`
+	Levels string `env:"LOG_LEVELS" flag:"log-levels" file:"levels" usage:"Minimum level per component, e. g. http=info,database=warn"`
+	Format string `env:"LOG_FORMAT" flag:"log-format" file:"format" default:"json" usage:"Format of the logs: json or text"`
+	Output string `env:"LOG_OUTPUT" flag:"log-output" file:"output" default:"stdout" usage:"Where to write the logs: stdout, stderr or a file path"`
+}
+
+type VersioningConfig struct {
+	Deprecation time.Time `env:"UNVERSIONED_DEPRECATION" flag:"unversioned-deprecation" file:"deprecation" default:"2026-10-19" usage:"Date since the unversioned routes are deprecated"`
+	Sunset      time.Time `env:"UNVERSIONED_SUNSET" flag:"unversioned-sunset" file:"sunset" default:"2027-04-19" usage:"Date when the unversioned routes will be removed"`
+}
+
+type BackupConfig struct {
+	Directory string `env:"BACKUP_DIRECTORY" flag:"backup-directory" file:"directory" default:"data/backups" usage:"Directory to keep the database backups"`
+	Schedule  string `env:"BACKUP_SCHEDULE" flag:"backup-schedule" file:"schedule" default:"@daily" usage:"Cron schedule (UTC) of the backups, empty to disable them"`
+	Keep      int    `env:"BACKUP_KEEP" flag:"backup-keep" file:"keep" default:"7" usage:"Number of backups to keep, the oldest ones are removed"`
+	Compress  bool   `env:"BACKUP_COMPRESS" flag:"backup-compress" file:"compress" default:"true" usage:"Compress the backups with gzip"`
+}
+
+type IdempotencyConfig struct {
+	TTL         time.Duration `env:"IDEMPOTENCY_TTL" flag:"idempotency-ttl" file:"ttl" default:"24h" usage:"Time to keep the responses of the requests with an Idempotency-Key, 0 to ignore the keys"`
+	MaximumBody int64         `env:"IDEMPOTENCY_MAXIMUM_BODY" flag:"idempotency-maximum-body" file:"maximum_body" default:"16777216" usage:"Largest body in bytes of the requests with an Idempotency-Key"`
+}
+
+type EventsConfig struct {
+	Heartbeat time.Duration `env:"EVENTS_HEARTBEAT" flag:"events-heartbeat" file:"heartbeat" default:"15s" usage:"Time between the comments keeping the idle event streams open"`
+	History   int           `env:"EVENTS_HISTORY" flag:"events-history" file:"history" default:"100" usage:"Number of events kept per video to resume the streams"`
+	Retention time.Duration `env:"EVENTS_RETENTION" flag:"events-retention" file:"retention" default:"5m" usage:"Time the events of a video nobody follows are kept to resume the streams"`
+}
+
+type WebhooksConfig struct {
+	Schedule string        `env:"WEBHOOKS_SCHEDULE" flag:"webhooks-schedule" file:"schedule" default:"* * * * *" usage:"Cron schedule (UTC) of the rounds delivering the pending webhooks left behind, empty to only deliver them along with the changes"`
+	Timeout  time.Duration `env:"WEBHOOKS_TIMEOUT" flag:"webhooks-timeout" file:"timeout" default:"10s" usage:"Maximum time to wait for the receivers of the webhooks"`
+	Backoff  time.Duration `env:"WEBHOOKS_BACKOFF" flag:"webhooks-backoff" file:"backoff" default:"30s" usage:"Time before the first retry of a delivery, doubled on each attempt"`
+	Attempts int           `env:"WEBHOOKS_ATTEMPTS" flag:"webhooks-attempts" file:"attempts" default:"8" usage:"Maximum number of attempts of each delivery"`
+	Workers  int           `env:"WEBHOOKS_WORKERS" flag:"webhooks-workers" file:"workers" default:"8" usage:"Maximum number of deliveries sent at the same time"`
+}
+
+type JobsConfig struct {
+	Concurrency   int           `env:"JOBS_CONCURRENCY" flag:"jobs-concurrency" file:"concurrency" default:"2" usage:"Number of background jobs performed at the same time"`
+	Interval      time.Duration `env:"JOBS_INTERVAL" flag:"jobs-interval" file:"interval" default:"1s" usage:"Time between the lookups of the due jobs"`
+	Backoff       time.Duration `env:"JOBS_BACKOFF" flag:"jobs-backoff" file:"backoff" default:"10s" usage:"Time before the first retry of a job, doubled on each attempt"`
+	Attempts      int           `env:"JOBS_ATTEMPTS" flag:"jobs-attempts" file:"attempts" default:"5" usage:"Maximum number of attempts of each job"`
+	Grace         time.Duration `env:"JOBS_GRACE" flag:"jobs-grace" file:"grace" default:"10s" usage:"Time the running jobs have to finish on shutdown before they are cancelled"`
+	Retention     time.Duration `env:"JOBS_RETENTION" flag:"jobs-retention" file:"retention" default:"168h" usage:"Time to keep the finished jobs"`
+	PurgeSchedule string        `env:"JOBS_PURGE_SCHEDULE" flag:"jobs-purge-schedule" file:"purge_schedule" default:"@daily" usage:"Cron schedule (UTC) to remove the finished jobs beyond the retention, empty to keep them"`
+}
+
+type RateLimitConfig struct {
+	Address int           `env:"RATE_LIMIT_ADDRESS" flag:"rate-limit-address" file:"address" default:"300" usage:"Maximum requests per period from each client address, 0 to disable the limit"`
+	User    int           `env:"RATE_LIMIT_USER" flag:"rate-limit-user" file:"user" default:"600" usage:"Maximum requests per period of each logged user, 0 to disable the limit"`
+	Login   int           `env:"RATE_LIMIT_LOGIN" flag:"rate-limit-login" file:"login" default:"10" usage:"Maximum logins and signups per period from each client address, 0 to disable the limit"`
+	Period  time.Duration `env:"RATE_LIMIT_PERIOD" flag:"rate-limit-period" file:"period" default:"1m" usage:"Time to refill the requests of the rate limits"`
+}
+
+type LoginConfig struct {
+	MaxFailures int           `env:"LOGIN_MAX_FAILURES" flag:"login-max-failures" file:"max_failures" default:"5" usage:"Failed logins in a row locking out the account, 0 to never lock it"`
+	Delay       time.Duration `env:"LOGIN_DELAY" flag:"login-delay" file:"delay" default:"1s" usage:"Time the login is locked after the first failure, doubled on each failure"`
+	Lockout     time.Duration `env:"LOGIN_LOCKOUT" flag:"login-lockout" file:"lockout" default:"15m" usage:"Time the account is locked out after the maximum failed logins"`
+}
+
+type PasswordConfig struct {
+	MinLength    int    `env:"PASSWORD_MIN_LENGTH" flag:"password-min-length" file:"min_length" default:"10" usage:"Minimum number of characters of the passwords"`
+	MinClasses   int    `env:"PASSWORD_MIN_CLASSES" flag:"password-min-classes" file:"min_classes" default:"3" usage:"Minimum number of classes of characters (lowercase, uppercase, digits and symbols) of the passwords"`
+	BreachedFile string `env:"PASSWORD_BREACHED_FILE" flag:"password-breached-file" file:"breached_file" usage:"File with a breached password per line to reject along with the most common ones"`
+}
+
+type NicknameConfig struct {
+	MinLength int    `env:"NICKNAME_MIN_LENGTH" flag:"nickname-min-length" file:"min_length" default:"3" usage:"Minimum number of characters of the nicknames"`
+	MaxLength int    `env:"NICKNAME_MAX_LENGTH" flag:"nickname-max-length" file:"max_length" default:"32" usage:"Maximum number of characters of the nicknames"`
+	Pattern   string `env:"NICKNAME_PATTERN" flag:"nickname-pattern" file:"pattern" default:"^[A-Za-z0-9][A-Za-z0-9._-]*$" usage:"Regular expression the nicknames must match"`
+	Reserved  string `env:"NICKNAME_RESERVED" flag:"nickname-reserved" file:"reserved" default:"admin,administrator,root,system,support,notevook" usage:"Comma separated nicknames nobody can take"`
+}
+
+type TwoFactorConfig struct {
+	Issuer        string        `env:"TWO_FACTOR_ISSUER" flag:"two-factor-issuer" file:"issuer" default:"NoteVook" usage:"Name of the API shown by the authenticator apps"`
+	ChallengeTTL  time.Duration `env:"TWO_FACTOR_CHALLENGE_TTL" flag:"two-factor-challenge-ttl" file:"challenge_ttl" default:"5m" usage:"Time to send the code of the authenticator app after the password on login"`
+	RecoveryCodes int           `env:"TWO_FACTOR_RECOVERY_CODES" flag:"two-factor-recovery-codes" file:"recovery_codes" default:"10" usage:"Number of single-use recovery codes generated for each user"`
+}
+
+type OIDCConfig struct {
+	Issuer          string        `env:"OIDC_ISSUER" flag:"oidc-issuer" file:"issuer" usage:"URL of the OpenID Connect identity provider, empty to disable the single sign-on"`
+	ClientID        string        `env:"OIDC_CLIENT_ID" flag:"oidc-client-id" file:"client_id" usage:"Client ID of the API on the identity provider"`
+	ClientSecret    string        `env:"OIDC_CLIENT_SECRET" flag:"oidc-client-secret" file:"client_secret" usage:"Client secret of the API on the identity provider"`
+	RedirectURL     string        `env:"OIDC_REDIRECT_URL" flag:"oidc-redirect-url" file:"redirect_url" usage:"URL of the callback registered on the identity provider, e. g. https://notevook.io/v1/login/oidc/callback"`
+	Scopes          string        `env:"OIDC_SCOPES" flag:"oidc-scopes" file:"scopes" default:"openid,profile,email" usage:"Comma separated scopes asked to the identity provider"`
+	NicknameClaim   string        `env:"OIDC_NICKNAME_CLAIM" flag:"oidc-nickname-claim" file:"nickname_claim" default:"preferred_username" usage:"Claim with the nickname of the provisioned users"`
+	RolesClaim      string        `env:"OIDC_ROLES_CLAIM" flag:"oidc-roles-claim" file:"roles_claim" default:"groups" usage:"Claim whose values are mapped to the roles of the users"`
+	Roles           string        `env:"OIDC_ROLES" flag:"oidc-roles" file:"roles" usage:"Comma separated value=role mapping of the roles claim, e. g. notevook-admins=admin, empty to leave the roles alone"`
+	Provision       bool          `env:"OIDC_PROVISION" flag:"oidc-provision" file:"provision" default:"true" usage:"Create the accounts of the users logging in for the first time"`
+	StateTTL        time.Duration `env:"OIDC_STATE_TTL" flag:"oidc-state-ttl" file:"state_ttl" default:"10m" usage:"Time to come back from the identity provider to complete the login"`
+	ConfirmationTTL time.Duration `env:"OIDC_CONFIRMATION_TTL" flag:"oidc-confirmation-ttl" file:"confirmation_ttl" default:"5m" usage:"Time the users without password have to confirm an operation once they log in again with the identity provider"`
+}
+
+// Proxies lists the trusted proxies, none when they are not configured.
+func (server *ServerConfig) Proxies() []string {
+	if strings.TrimSpace(server.TrustedProxies) == "" {
+		return nil
+	}
+	proxies := strings.Split(server.TrustedProxies, ",")
+	for index, proxy := range proxies {
+		proxies[index] = strings.TrimSpace(proxy)
+	}
+	return proxies
+}
+
+// IsProduction tells whether the API is running in release mode.
+func (config *Config) IsProduction() bool {
+	return config.Mode == gin.ReleaseMode
+}
+
+// Path returns the database filename relative to the module directory when
+// GOMOD is set, keeping the behaviour of the container and the test suites.
+func (database *DatabaseConfig) Path() string {
+	if filepath.IsAbs(database.Filename) || os.Getenv("GOMOD") == "" {
+		return database.Filename
+	}
+	return fmt.Sprintf("%s/%s", path.Dir(os.Getenv("GOMOD")), database.Filename)
+}
+
+// DSN returns the data source name of the database, which waits for the locks
+// up to the busy timeout and uses write-ahead logging, so the readers don't
+// block the writer.
+func (database *DatabaseConfig) DSN() string {
+	return fmt.Sprintf("%s?_busy_timeout=%d&_journal_mode=WAL", database.Path(), database.BusyTimeout.Milliseconds())
+}
+
+// Path returns the backups directory, relative to the module directory as the
+// database filename.
+func (backup *BackupConfig) Path() string {
+	if filepath.IsAbs(backup.Directory) || os.Getenv("GOMOD") == "" {
+		return backup.Directory
+	}
+	return fmt.Sprintf("%s/%s", path.Dir(os.Getenv("GOMOD")), backup.Directory)
+}
+
+// Load reads the configuration from (in order of precedence) the command line
+// arguments, the environment variables, an optional YAML or TOML file given
+// either with -config flag or CONFIG_FILE variable, and the default values.
+func Load(arguments []string) (*Config, error) {
+	config := &Config{}
+	overrides := map[string]string{}
+	filename := os.Getenv("CONFIG_FILE")
+
+	set := flag.NewFlagSet("note-vook", flag.ContinueOnError)
+	set.StringVar(&filename, "config", filename, "Path to a YAML or TOML configuration file")
+	walk(reflect.ValueOf(config).Elem(), nil, func(field reflect.StructField, _ reflect.Value, _ []string) error {
+		name := field.Tag.Get("flag")
+		if name != "" {
+			set.Func(name, field.Tag.Get("usage"), func(value string) error {
+				overrides[name] = value
+				return nil
+			})
+		}
+		return nil
+	})
+	if exception := set.Parse(arguments); exception != nil {
+		return nil, exception
+	}
+
+	settings, exception := readFile(filename)
+	if exception != nil {
+		return nil, exception
+	}
+
+	exception = walk(reflect.ValueOf(config).Elem(), nil, func(field reflect.StructField, value reflect.Value, keys []string) error {
+		raw, found := field.Tag.Lookup("default")
+		if setting, ok := lookup(settings, keys); ok {
+			raw, found = setting, true
+		}
+		if variable, ok := os.LookupEnv(field.Tag.Get("env")); ok && field.Tag.Get("env") != "" {
+			raw, found = variable, true
+		}
+		if override, ok := overrides[field.Tag.Get("flag")]; ok {
+			raw, found = override, true
+		}
+		if !found {
+			return nil
+		}
+		if exception := assign(value, raw); exception != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", raw, strings.Join(keys, "."), exception)
+		}
+		return nil
+	})
+	if exception != nil {
+		return nil, exception
+	}
+
+	return config, config.Validate()
+}
+
+// Validate checks the consistency of the settings, failing fast on the ones
+// that would make the API insecure or unusable.
+func (config *Config) Validate() error {
+	var exceptions []error
+
+	switch config.Mode {
+	case gin.DebugMode, gin.TestMode, gin.ReleaseMode:
+	default:
+		exceptions = append(exceptions, fmt.Errorf("unknown mode %q", config.Mode))
+	}
+
+	if port, exception := strconv.Atoi(config.Server.Port); exception != nil || port < 0 || port > 65535 {
+		exceptions = append(exceptions, fmt.Errorf("invalid port %q", config.Server.Port))
+	}
+
+	timeouts := map[string]time.Duration{
+		"read timeout":      config.Server.ReadTimeout,
+		"write timeout":     config.Server.WriteTimeout,
+		"idle timeout":      config.Server.IdleTimeout,
+		"shutdown timeout":  config.Server.ShutdownTimeout,
+		"ping timeout":      config.Database.PingTimeout,
+		"busy timeout":      config.Database.BusyTimeout,
+		"events retention":  config.Events.Retention,
+		"webhooks timeout":  config.Webhooks.Timeout,
+		"webhooks backoff":  config.Webhooks.Backoff,
+		"jobs interval":     config.Jobs.Interval,
+		"jobs backoff":      config.Jobs.Backoff,
+		"jobs retention":    config.Jobs.Retention,
+		"rate limit period": config.RateLimit.Period,
+	}
+	for name, timeout := range timeouts {
+		if timeout <= 0 {
+			exceptions = append(exceptions, fmt.Errorf("%s must be positive", name))
+		}
+	}
+
+	if (config.Server.Certificate == "") != (config.Server.Key == "") {
+		exceptions = append(exceptions, errors.New("both TLS certificate and key must be provided"))
+	}
+
+	if config.Metrics.Port != "" {
+		if port, exception := strconv.Atoi(config.Metrics.Port); exception != nil || port < 0 || port > 65535 {
+			exceptions = append(exceptions, fmt.Errorf("invalid metrics port %q", config.Metrics.Port))
+		} else if config.Metrics.Port == config.Server.Port {
+			exceptions = append(exceptions, errors.New("metrics port must be different from the API one"))
+		}
+	}
+
+	if !strings.HasPrefix(config.Metrics.Path, "/") {
+		exceptions = append(exceptions, fmt.Errorf("invalid metrics path %q", config.Metrics.Path))
+	}
+
+	switch config.Tracing.Exporter {
+	case "", ExporterOTLP, ExporterStdout, ExporterFile:
+	default:
+		exceptions = append(exceptions, fmt.Errorf("unknown tracing exporter %q", config.Tracing.Exporter))
+	}
+
+	if config.Tracing.Exporter == ExporterFile && config.Tracing.File == "" {
+		exceptions = append(exceptions, errors.New("tracing file is required to export traces to a file"))
+	}
+
+	if config.Tracing.SampleRatio < 0 || config.Tracing.SampleRatio > 1 {
+		exceptions = append(exceptions, fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", config.Tracing.SampleRatio))
+	}
+
+	if config.Database.Filename == "" {
+		exceptions = append(exceptions, errors.New("database filename is required"))
+	}
+
+	if _, exception := logging.ParseLevel(config.Logging.Level); exception != nil {
+		exceptions = append(exceptions, fmt.Errorf("invalid log level %q", config.Logging.Level))
+	}
+
+	if _, exception := logging.ParseLevels(config.Logging.Levels); exception != nil {
+		exceptions = append(exceptions, fmt.Errorf("invalid log levels %q: %w", config.Logging.Levels, exception))
+	}
+
+	if config.Logging.Format != logging.FormatJSON && config.Logging.Format != logging.FormatText {
+		exceptions = append(exceptions, fmt.Errorf("unknown log format %q", config.Logging.Format))
+	}
+
+	if !config.Versioning.Sunset.After(config.Versioning.Deprecation) {
+		exceptions = append(exceptions, errors.New("sunset of the unversioned routes must be after their deprecation"))
+	}
+
+	if config.Backup.Directory == "" {
+		exceptions = append(exceptions, errors.New("backup directory is required"))
+	}
+
+	if config.Idempotency.TTL < 0 {
+		exceptions = append(exceptions, fmt.Errorf("idempotency TTL must not be negative, got %v", config.Idempotency.TTL))
+	}
+	if config.Idempotency.MaximumBody < 1 {
+		exceptions = append(exceptions, fmt.Errorf("idempotency maximum body must be positive, got %d", config.Idempotency.MaximumBody))
+	}
+
+	if config.Events.Heartbeat <= 0 {
+		exceptions = append(exceptions, fmt.Errorf("events heartbeat must be positive, got %v", config.Events.Heartbeat))
+	}
+
+	if config.Events.History < 0 {
+		exceptions = append(exceptions, fmt.Errorf("events history must not be negative, got %d", config.Events.History))
+	}
+
+	if config.Webhooks.Attempts < 1 {
+		exceptions = append(exceptions, fmt.Errorf("webhooks need at least one attempt, got %d", config.Webhooks.Attempts))
+	}
+	if config.Webhooks.Workers < 1 {
+		exceptions = append(exceptions, fmt.Errorf("webhooks need at least one worker, got %d", config.Webhooks.Workers))
+	}
+
+	if config.Jobs.Concurrency < 1 {
+		exceptions = append(exceptions, fmt.Errorf("jobs need at least one worker, got %d", config.Jobs.Concurrency))
+	}
+
+	if config.Jobs.Attempts < 1 {
+		exceptions = append(exceptions, fmt.Errorf("jobs need at least one attempt, got %d", config.Jobs.Attempts))
+	}
+
+	if config.Jobs.Grace < 0 {
+		exceptions = append(exceptions, fmt.Errorf("jobs grace must not be negative, got %v", config.Jobs.Grace))
+	}
+
+	schedules := map[string]string{
+		"jobs purge schedule": config.Jobs.PurgeSchedule,
+		"webhooks schedule":   config.Webhooks.Schedule,
+		"backup schedule":     config.Backup.Schedule,
+	}
+	for name, schedule := range schedules {
+		if schedule == "" {
+			continue
+		}
+		if _, exception := jobs.ParseCron(schedule); exception != nil {
+			exceptions = append(exceptions, fmt.Errorf("invalid %s: %w", name, exception))
+		}
+	}
+
+	for _, proxy := range config.Server.Proxies() {
+		if net.ParseIP(proxy) == nil {
+			if _, _, exception := net.ParseCIDR(proxy); exception != nil {
+				exceptions = append(exceptions, fmt.Errorf("invalid trusted proxy %q", proxy))
+			}
+		}
+	}
+
+	limits := map[string]int{
+		"address rate limit": config.RateLimit.Address,
+		"user rate limit":    config.RateLimit.User,
+		"login rate limit":   config.RateLimit.Login,
+		"login max failures": config.Login.MaxFailures,
+	}
+	for name, limit := range limits {
+		if limit < 0 {
+			exceptions = append(exceptions, fmt.Errorf("%s must not be negative, got %d", name, limit))
+		}
+	}
+
+	if config.Login.Delay < 0 || config.Login.Lockout < 0 {
+		exceptions = append(exceptions, errors.New("login delay and lockout must not be negative"))
+	} else if config.Login.Delay > config.Login.Lockout {
+		exceptions = append(exceptions, errors.New("login delay must not be longer than the lockout"))
+	}
+
+	if config.Password.MinLength < 1 || config.Password.MinLength > policy.MaximumPasswordBytes {
+		exceptions = append(exceptions, fmt.Errorf(
+			"password min length must be between 1 and %d, got %d",
+			policy.MaximumPasswordBytes, config.Password.MinLength,
+		))
+	}
+
+	if config.Password.MinClasses < 0 || config.Password.MinClasses > 4 {
+		exceptions = append(exceptions, fmt.Errorf("password min classes must be between 0 and 4, got %d", config.Password.MinClasses))
+	}
+
+	if _, exception := NewPasswordPolicy(config.Password); exception != nil {
+		exceptions = append(exceptions, fmt.Errorf("invalid password breached file: %w", exception))
+	}
+
+	if config.Nickname.MinLength < 1 || config.Nickname.MaxLength < config.Nickname.MinLength {
+		exceptions = append(exceptions, fmt.Errorf(
+			"nickname lengths must be at least 1 and the max not less than the min, got %d and %d",
+			config.Nickname.MinLength, config.Nickname.MaxLength,
+		))
+	}
+
+	if _, exception := NewNicknamePolicy(config.Nickname); exception != nil {
+		exceptions = append(exceptions, fmt.Errorf("invalid nickname pattern: %w", exception))
+	}
+
+	if config.TwoFactor.ChallengeTTL <= 0 {
+		exceptions = append(exceptions, fmt.Errorf("two-factor challenge TTL must be positive, got %v", config.TwoFactor.ChallengeTTL))
+	}
+
+	if config.TwoFactor.RecoveryCodes < 1 {
+		exceptions = append(exceptions, fmt.Errorf("at least one recovery code must be generated, got %d", config.TwoFactor.RecoveryCodes))
+	}
+
+	if config.OIDC.Issuer != "" {
+		if address, exception := url.Parse(config.OIDC.Issuer); exception != nil || !address.IsAbs() {
+			exceptions = append(exceptions, fmt.Errorf("invalid OIDC issuer %q", config.OIDC.Issuer))
+		}
+		if config.OIDC.ClientID == "" {
+			exceptions = append(exceptions, errors.New("OIDC client ID must be provided along with the issuer"))
+		}
+		if address, exception := url.Parse(config.OIDC.RedirectURL); exception != nil || !address.IsAbs() {
+			exceptions = append(exceptions, fmt.Errorf("invalid OIDC redirect URL %q", config.OIDC.RedirectURL))
+		}
+		if config.OIDC.StateTTL <= 0 {
+			exceptions = append(exceptions, fmt.Errorf("OIDC state TTL must be positive, got %v", config.OIDC.StateTTL))
+		}
+		if config.OIDC.ConfirmationTTL <= 0 {
+			exceptions = append(exceptions, fmt.Errorf("OIDC confirmation TTL must be positive, got %v", config.OIDC.ConfirmationTTL))
+		}
+		if _, exception := NewRoleMapping(config.OIDC.Roles); exception != nil {
+			exceptions = append(exceptions, fmt.Errorf("invalid OIDC roles: %w", exception))
+		}
+	}
+
+	if config.Backup.Keep < 1 {
+		exceptions = append(exceptions, fmt.Errorf("at least one backup must be kept, got %d", config.Backup.Keep))
+	}
+
+	if config.Security.AdminToken != "" && len(config.Security.AdminToken) < MinimumSecretTokenKeyLength {
+		exceptions = append(exceptions, fmt.Errorf(
+			"admin token must have at least %d characters",
+			MinimumSecretTokenKeyLength,
+		))
+	}
+
+	if config.IsProduction() && len(config.Security.SecretTokenKey) < MinimumSecretTokenKeyLength {
+		exceptions = append(exceptions, fmt.Errorf(
+			"secret token key must have at least %d characters in production",
+			MinimumSecretTokenKeyLength,
+		))
+	} else if config.Security.SecretTokenKey == "" {
+		// Never sign tokens with an empty key, tokens won't survive a restart though
+		key := make([]byte, MinimumSecretTokenKeyLength)
+		rand.Read(key)
+		config.Security.SecretTokenKey = hex.EncodeToString(key)
+		slog.Warn("Empty secret token key, using an ephemeral random one")
+	}
+
+	return errors.Join(exceptions...)
+}
+
+func readFile(filename string) (map[string]interface{}, error) {
+	settings := map[string]interface{}{}
+	if filename == "" {
+		return settings, nil
+	}
+
+	content, exception := os.ReadFile(filename)
+	if exception != nil {
+		return nil, exception
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		exception = yaml.Unmarshal(content, &settings)
+	case ".toml":
+		exception = toml.Unmarshal(content, &settings)
+	default:
+		exception = fmt.Errorf("unsupported configuration file format %q", filepath.Ext(filename))
+	}
+
+	return settings, exception
+}
+
+func lookup(settings map[string]interface{}, keys []string) (string, bool) {
+	var current interface{} = settings
+	for _, key := range keys {
+		table, ok := current.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if current, ok = table[key]; !ok {
+			return "", false
+		}
+	}
+
+	if list, ok := current.([]interface{}); ok {
+		items := make([]string, 0, len(list))
+		for _, item := range list {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ","), true
+	}
+
+	if moment, ok := current.(time.Time); ok {
+		return moment.Format(time.RFC3339), true
+	}
+
+	return fmt.Sprint(current), true
+}
+
+// walk visits all the leaf settings of the configuration structure along with
+// the path of keys used to find them within the configuration file.
+func walk(
+	value reflect.Value,
+	keys []string,
+	visit func(reflect.StructField, reflect.Value, []string) error,
+) error {
+	for index := 0; index < value.NumField(); index++ {
+		field := value.Type().Field(index)
+		path := append(append([]string{}, keys...), field.Tag.Get("file"))
+		var exception error
+		if field.Type.Kind() == reflect.Struct && field.Type != timeType {
+			exception = walk(value.Field(index), path, visit)
+		} else {
+			exception = visit(field, value.Field(index), path)
+		}
+		if exception != nil {
+			return exception
+		}
+	}
+	return nil
+}
+
+func assign(value reflect.Value, raw string) error {
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		duration, exception := time.ParseDuration(raw)
+		value.SetInt(int64(duration))
+		return exception
+	}
+
+	if value.Type() == timeType {
+		// Either a date like 2027-04-19 or a full RFC 3339 date and time
+		moment, exception := time.Parse(time.DateOnly, raw)
+		if exception != nil {
+			moment, exception = time.Parse(time.RFC3339, raw)
+		}
+		value.Set(reflect.ValueOf(moment))
+		return exception
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		number, exception := strconv.ParseInt(raw, 10, 64)
+		if exception != nil {
+			return exception
+		}
+		value.SetInt(number)
+	case reflect.Uint, reflect.Uint64:
+		number, exception := strconv.ParseUint(raw, 10, 64)
+		if exception != nil {
+			return exception
+		}
+		value.SetUint(number)
+	case reflect.Float64:
+		number, exception := strconv.ParseFloat(raw, 64)
+		if exception != nil {
+			return exception
+		}
+		value.SetFloat(number)
+	case reflect.Bool:
+		boolean, exception := strconv.ParseBool(raw)
+		if exception != nil {
+			return exception
+		}
+		value.SetBool(boolean)
+	default:
+		return fmt.Errorf("unsupported setting type %s", value.Type())
+	}
+	return nil
+}
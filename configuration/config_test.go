@@ -0,0 +1,461 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	reset := func(test *testing.T) {
+		for _, name := range []string{
+			"GIN_MODE", "PORT", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT", "SHUTDOWN_TIMEOUT",
+			"TLS_CERTIFICATE", "TLS_KEY", "DATABASE", "LOG_LEVEL", "SECRET_TOKEN_KEY", "CONFIG_FILE",
+			"METRICS_ENABLED", "METRICS_PATH", "METRICS_PORT",
+			"LOG_LEVELS", "LOG_FORMAT", "LOG_OUTPUT", "DATABASE_SLOW_THRESHOLD",
+			"UNVERSIONED_DEPRECATION", "UNVERSIONED_SUNSET",
+		} {
+			test.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+
+	test.Run("Should use default values when nothing else is provided", func(test *testing.T) {
+		// Arrange
+		reset(test)
+
+		// Act
+		config, exception := Load(nil)
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal("debug", config.Mode)
+		assert.Equal("8080", config.Server.Port)
+		assert.Equal(15*time.Second, config.Server.ReadTimeout)
+		assert.Equal(10*time.Second, config.Server.ShutdownTimeout)
+		assert.Equal("data/beta.db", config.Database.Filename)
+		assert.Equal(200*time.Millisecond, config.Database.SlowThreshold)
+		assert.Equal("info", config.Logging.Level)
+		assert.Equal("json", config.Logging.Format)
+		assert.Equal(time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC), config.Versioning.Deprecation)
+		assert.Equal(time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC), config.Versioning.Sunset)
+		assert.Equal("@daily", config.Backup.Schedule)
+		assert.Equal(7, config.Backup.Keep)
+		assert.True(config.Backup.Compress)
+		assert.Equal(24*time.Hour, config.Idempotency.TTL)
+		assert.Equal(int64(16<<20), config.Idempotency.MaximumBody)
+		assert.Equal(15*time.Second, config.Events.Heartbeat)
+		assert.Equal(100, config.Events.History)
+		assert.Equal(5*time.Minute, config.Events.Retention)
+		assert.Equal("* * * * *", config.Webhooks.Schedule)
+		assert.Equal(30*time.Second, config.Webhooks.Backoff)
+		assert.Equal(8, config.Webhooks.Attempts)
+		assert.Equal(8, config.Webhooks.Workers)
+		assert.Equal(2, config.Jobs.Concurrency)
+		assert.Equal(5, config.Jobs.Attempts)
+		assert.Equal(7*24*time.Hour, config.Jobs.Retention)
+		assert.Equal("@daily", config.Jobs.PurgeSchedule)
+		assert.Equal(300, config.RateLimit.Address)
+		assert.Equal(600, config.RateLimit.User)
+		assert.Equal(10, config.RateLimit.Login)
+		assert.Equal(time.Minute, config.RateLimit.Period)
+		assert.Equal(5, config.Login.MaxFailures)
+		assert.Equal(time.Second, config.Login.Delay)
+		assert.Equal(15*time.Minute, config.Login.Lockout)
+		assert.Nil(config.Server.Proxies())
+		assert.Equal(10, config.Password.MinLength)
+		assert.Equal(3, config.Password.MinClasses)
+		assert.Equal(3, config.Nickname.MinLength)
+		assert.Equal(32, config.Nickname.MaxLength)
+		assert.Equal("^[A-Za-z0-9][A-Za-z0-9._-]*$", config.Nickname.Pattern)
+		assert.Equal("NoteVook", config.TwoFactor.Issuer)
+		assert.Equal(5*time.Minute, config.TwoFactor.ChallengeTTL)
+		assert.Equal(10, config.TwoFactor.RecoveryCodes)
+		assert.Empty(config.OIDC.Issuer)
+		assert.Equal("openid,profile,email", config.OIDC.Scopes)
+		assert.Equal("preferred_username", config.OIDC.NicknameClaim)
+		assert.Equal("groups", config.OIDC.RolesClaim)
+		assert.True(config.OIDC.Provision)
+		assert.Equal(10*time.Minute, config.OIDC.StateTTL)
+		assert.Equal(5*time.Minute, config.OIDC.ConfirmationTTL)
+		assert.Len(config.Security.SecretTokenKey, 2*MinimumSecretTokenKeyLength)
+	})
+
+	test.Run("Should give precedence to flags over environment over file over defaults", func(test *testing.T) {
+		// Arrange
+		reset(test)
+		filename := filepath.Join(test.TempDir(), "settings.yaml")
+		content := strings.Join([]string{
+			"server:",
+			"  port: 5000",
+			"  read_timeout: 20s",
+			"  write_timeout: 40s",
+			"database:",
+			"  filename: data/file.db",
+		}, "\n")
+		require.Nil(os.WriteFile(filename, []byte(content), 0600))
+		test.Setenv("WRITE_TIMEOUT", "45s")
+		test.Setenv("PORT", "6000")
+
+		// Act
+		config, exception := Load([]string{"-config", filename, "-port", "7000"})
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal("7000", config.Server.Port)
+		assert.Equal(45*time.Second, config.Server.WriteTimeout)
+		assert.Equal(20*time.Second, config.Server.ReadTimeout)
+		assert.Equal(60*time.Second, config.Server.IdleTimeout)
+		assert.Equal("data/file.db", config.Database.Filename)
+	})
+
+	test.Run("Should read TOML files given by environment", func(test *testing.T) {
+		// Arrange
+		reset(test)
+		filename := filepath.Join(test.TempDir(), "settings.toml")
+		content := strings.Join([]string{
+			`mode = "test"`,
+			`[server]`,
+			`idle_timeout = "2m"`,
+			`[logging]`,
+			`level = "debug"`,
+		}, "\n")
+		require.Nil(os.WriteFile(filename, []byte(content), 0600))
+		test.Setenv("CONFIG_FILE", filename)
+
+		// Act
+		config, exception := Load(nil)
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal("test", config.Mode)
+		assert.Equal(2*time.Minute, config.Server.IdleTimeout)
+		assert.Equal("debug", config.Logging.Level)
+	})
+
+	invalids := []struct {
+		Name        string
+		Environment map[string]string
+		Arguments   []string
+		Expected    string
+	}{
+		{
+			Name:        "unknown log level",
+			Environment: map[string]string{"LOG_LEVEL": "verbose"},
+			Expected:    `invalid log level "verbose"`,
+		},
+		{
+			Name:        "unknown component log level",
+			Environment: map[string]string{"LOG_LEVELS": "http=loud"},
+			Expected:    `invalid log levels "http=loud"`,
+		},
+		{
+			Name:        "unknown log format",
+			Environment: map[string]string{"LOG_FORMAT": "xml"},
+			Expected:    `unknown log format "xml"`,
+		},
+		{
+			Name:      "invalid duration",
+			Arguments: []string{"-read-timeout", "soon"},
+			Expected:  `invalid value "soon" for server.read_timeout`,
+		},
+		{
+			Name:        "invalid date",
+			Environment: map[string]string{"UNVERSIONED_SUNSET": "someday"},
+			Expected:    `invalid value "someday" for versioning.sunset`,
+		},
+		{
+			Name:      "sunset before deprecation",
+			Arguments: []string{"-unversioned-deprecation", "2027-01-01", "-unversioned-sunset", "2026-12-31"},
+			Expected:  "sunset of the unversioned routes must be after their deprecation",
+		},
+		{
+			Name:        "invalid backup schedule",
+			Environment: map[string]string{"BACKUP_SCHEDULE": "@fortnightly"},
+			Expected:    "invalid backup schedule",
+		},
+		{
+			Name:        "negative idempotency TTL",
+			Environment: map[string]string{"IDEMPOTENCY_TTL": "-1s"},
+			Expected:    "idempotency TTL must not be negative",
+		},
+		{
+			Name:      "no idempotency maximum body",
+			Arguments: []string{"-idempotency-maximum-body", "0"},
+			Expected:  "idempotency maximum body must be positive",
+		},
+		{
+			Name:      "no events heartbeat",
+			Arguments: []string{"-events-heartbeat", "0s"},
+			Expected:  "events heartbeat must be positive",
+		},
+		{
+			Name:        "negative events history",
+			Environment: map[string]string{"EVENTS_HISTORY": "-1"},
+			Expected:    "events history must not be negative",
+		},
+		{
+			Name:        "no events retention",
+			Environment: map[string]string{"EVENTS_RETENTION": "0s"},
+			Expected:    "events retention must be positive",
+		},
+		{
+			Name:        "no webhooks timeout",
+			Environment: map[string]string{"WEBHOOKS_TIMEOUT": "0s"},
+			Expected:    "webhooks timeout must be positive",
+		},
+		{
+			Name:      "no webhooks attempts",
+			Arguments: []string{"-webhooks-attempts", "0"},
+			Expected:  "webhooks need at least one attempt",
+		},
+		{
+			Name:        "no webhooks workers",
+			Environment: map[string]string{"WEBHOOKS_WORKERS": "0"},
+			Expected:    "webhooks need at least one worker",
+		},
+		{
+			Name:      "no jobs workers",
+			Arguments: []string{"-jobs-concurrency", "0"},
+			Expected:  "jobs need at least one worker",
+		},
+		{
+			Name:        "no jobs retention",
+			Environment: map[string]string{"JOBS_RETENTION": "0s"},
+			Expected:    "jobs retention must be positive",
+		},
+		{
+			Name:        "invalid jobs purge schedule",
+			Environment: map[string]string{"JOBS_PURGE_SCHEDULE": "0 25 * * *"},
+			Expected:    "invalid jobs purge schedule",
+		},
+		{
+			Name:        "invalid webhooks schedule",
+			Environment: map[string]string{"WEBHOOKS_SCHEDULE": "*/0 * * * *"},
+			Expected:    "invalid webhooks schedule",
+		},
+		{
+			Name:        "invalid trusted proxy",
+			Environment: map[string]string{"TRUSTED_PROXIES": "10.0.0.0/8, proxy"},
+			Expected:    `invalid trusted proxy "proxy"`,
+		},
+		{
+			Name:        "no rate limit period",
+			Environment: map[string]string{"RATE_LIMIT_PERIOD": "0s"},
+			Expected:    "rate limit period must be positive",
+		},
+		{
+			Name:      "negative login rate limit",
+			Arguments: []string{"-rate-limit-login", "-1"},
+			Expected:  "login rate limit must not be negative",
+		},
+		{
+			Name:        "login delay longer than the lockout",
+			Environment: map[string]string{"LOGIN_DELAY": "1h", "LOGIN_LOCKOUT": "15m"},
+			Expected:    "login delay must not be longer than the lockout",
+		},
+		{
+			Name:        "no password min length",
+			Environment: map[string]string{"PASSWORD_MIN_LENGTH": "0"},
+			Expected:    "password min length must be between 1 and 72, got 0",
+		},
+		{
+			Name:      "too many password classes",
+			Arguments: []string{"-password-min-classes", "5"},
+			Expected:  "password min classes must be between 0 and 4, got 5",
+		},
+		{
+			Name:        "missing password breached file",
+			Environment: map[string]string{"PASSWORD_BREACHED_FILE": "missing.txt"},
+			Expected:    "invalid password breached file",
+		},
+		{
+			Name:        "nickname max length below the min",
+			Environment: map[string]string{"NICKNAME_MIN_LENGTH": "8", "NICKNAME_MAX_LENGTH": "4"},
+			Expected:    "nickname lengths must be at least 1 and the max not less than the min, got 8 and 4",
+		},
+		{
+			Name:        "invalid nickname pattern",
+			Environment: map[string]string{"NICKNAME_PATTERN": "[a-z"},
+			Expected:    "invalid nickname pattern",
+		},
+		{
+			Name:        "no two-factor challenge TTL",
+			Environment: map[string]string{"TWO_FACTOR_CHALLENGE_TTL": "0s"},
+			Expected:    "two-factor challenge TTL must be positive, got 0s",
+		},
+		{
+			Name:      "no recovery codes",
+			Arguments: []string{"-two-factor-recovery-codes", "0"},
+			Expected:  "at least one recovery code must be generated, got 0",
+		},
+		{
+			Name:        "OIDC issuer without client",
+			Environment: map[string]string{"OIDC_ISSUER": "https://sso.io", "OIDC_REDIRECT_URL": "https://notevook.io/v1/login/oidc/callback"},
+			Expected:    "OIDC client ID must be provided along with the issuer",
+		},
+		{
+			Name:        "relative OIDC redirect URL",
+			Environment: map[string]string{"OIDC_ISSUER": "https://sso.io", "OIDC_CLIENT_ID": "notevook", "OIDC_REDIRECT_URL": "/v1/login/oidc/callback"},
+			Expected:    `invalid OIDC redirect URL "/v1/login/oidc/callback"`,
+		},
+		{
+			Name:        "unknown OIDC role",
+			Environment: map[string]string{"OIDC_ISSUER": "https://sso.io", "OIDC_CLIENT_ID": "notevook", "OIDC_REDIRECT_URL": "https://notevook.io/v1/login/oidc/callback", "OIDC_ROLES": "staff=editor"},
+			Expected:    `invalid OIDC roles: unknown role "editor"`,
+		},
+		{
+			Name:        "no OIDC confirmation TTL",
+			Environment: map[string]string{"OIDC_ISSUER": "https://sso.io", "OIDC_CLIENT_ID": "notevook", "OIDC_REDIRECT_URL": "https://notevook.io/v1/login/oidc/callback", "OIDC_CONFIRMATION_TTL": "0s"},
+			Expected:    "OIDC confirmation TTL must be positive",
+		},
+		{
+			Name:      "no backups to keep",
+			Arguments: []string{"-backup-keep", "0"},
+			Expected:  "at least one backup must be kept",
+		},
+		{
+			Name:        "short admin token",
+			Environment: map[string]string{"ADMIN_TOKEN": "secret"},
+			Expected:    "admin token must have at least 32 characters",
+		},
+		{
+			Name:      "unknown flag",
+			Arguments: []string{"-unknown"},
+			Expected:  "flag provided but not defined",
+		},
+		{
+			Name:        "unknown mode",
+			Environment: map[string]string{"GIN_MODE": "staging"},
+			Expected:    `unknown mode "staging"`,
+		},
+		{
+			Name:        "invalid port",
+			Environment: map[string]string{"PORT": "http"},
+			Expected:    `invalid port "http"`,
+		},
+		{
+			Name:        "non positive timeout",
+			Environment: map[string]string{"SHUTDOWN_TIMEOUT": "0s"},
+			Expected:    "shutdown timeout must be positive",
+		},
+		{
+			Name:        "TLS certificate without key",
+			Environment: map[string]string{"TLS_CERTIFICATE": "certificate.pem"},
+			Expected:    "both TLS certificate and key must be provided",
+		},
+		{
+			Name:        "empty secret in production",
+			Environment: map[string]string{"GIN_MODE": "release"},
+			Expected:    "secret token key must have at least 32 characters in production",
+		},
+		{
+			Name:        "short secret in production",
+			Environment: map[string]string{"GIN_MODE": "release", "SECRET_TOKEN_KEY": "too-short"},
+			Expected:    "secret token key must have at least 32 characters in production",
+		},
+		{
+			Name:        "metrics on the API port",
+			Environment: map[string]string{"PORT": "4000", "METRICS_PORT": "4000"},
+			Expected:    "metrics port must be different from the API one",
+		},
+		{
+			Name:        "invalid metrics path",
+			Environment: map[string]string{"METRICS_PATH": "metrics"},
+			Expected:    `invalid metrics path "metrics"`,
+		},
+		{
+			Name:      "missing configuration file",
+			Arguments: []string{"-config", "missing.yaml"},
+			Expected:  "missing.yaml",
+		},
+		{
+			Name:      "unsupported configuration file",
+			Arguments: []string{"-config", "config_test.go"},
+			Expected:  `unsupported configuration file format ".go"`,
+		},
+	}
+
+	for _, testcase := range invalids {
+		test.Run("Should fail fast on "+testcase.Name, func(test *testing.T) {
+			// Arrange
+			reset(test)
+			for name, value := range testcase.Environment {
+				test.Setenv(name, value)
+			}
+
+			// Act
+			_, exception := Load(testcase.Arguments)
+
+			// Assert
+			assert.ErrorContains(exception, testcase.Expected)
+		})
+	}
+
+	test.Run("Should list the trusted proxies", func(test *testing.T) {
+		// Arrange
+		reset(test)
+		test.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.1.1")
+
+		// Act
+		config, exception := Load(nil)
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal([]string{"10.0.0.0/8", "192.168.1.1"}, config.Server.Proxies())
+	})
+
+	test.Run("Should accept a long enough secret in production", func(test *testing.T) {
+		// Arrange
+		reset(test)
+		secret := strings.Repeat("s", MinimumSecretTokenKeyLength)
+		test.Setenv("GIN_MODE", "release")
+		test.Setenv("SECRET_TOKEN_KEY", secret)
+
+		// Act
+		config, exception := Load(nil)
+
+		// Assert
+		require.Nil(exception)
+		assert.True(config.IsProduction())
+		assert.Equal(secret, config.Security.SecretTokenKey)
+	})
+}
+
+func TestDatabasePath(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should be relative to the module directory when GOMOD is set", func(test *testing.T) {
+		test.Setenv("GOMOD", "/api/go.mod")
+		settings := DatabaseConfig{Filename: "data/test.db"}
+		assert.Equal("/api/data/test.db", settings.Path())
+	})
+
+	test.Run("Should keep absolute paths", func(test *testing.T) {
+		test.Setenv("GOMOD", "/api/go.mod")
+		settings := DatabaseConfig{Filename: "/var/lib/note-vook.db"}
+		assert.Equal("/var/lib/note-vook.db", settings.Path())
+	})
+
+	test.Run("Should open the database with the busy timeout and write-ahead logging", func(test *testing.T) {
+		test.Setenv("GOMOD", "/api/go.mod")
+		settings := DatabaseConfig{Filename: "data/test.db", BusyTimeout: 5 * time.Second}
+		assert.Equal("/api/data/test.db?_busy_timeout=5000&_journal_mode=WAL", settings.DSN())
+	})
+
+	test.Run("Should resolve the backups directory the same way", func(test *testing.T) {
+		test.Setenv("GOMOD", "/api/go.mod")
+		relative := BackupConfig{Directory: "data/backups"}
+		absolute := BackupConfig{Directory: "/var/backups/note-vook"}
+		assert.Equal("/api/data/backups", relative.Path())
+		assert.Equal("/var/backups/note-vook", absolute.Path())
+	})
+}
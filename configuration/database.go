@@ -3,46 +3,49 @@ package configuration
 import (
 	"database/sql"
 	"fmt"
-	"log"
-	"os"
-	"path"
-	"strconv"
+	"log/slog"
 
+	"github.com/zatarain/note-vook/logging"
 	"github.com/zatarain/note-vook/models"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 )
 
-var Database *gorm.DB
-
-func ConnectToDatabase() *sql.DB {
-	level, _ := strconv.Atoi(os.Getenv("LOG_LEVEL"))
-	filename := fmt.Sprintf("%s/%s", path.Dir(os.Getenv("GOMOD")), os.Getenv("DATABASE"))
-	log.Println("Database filename: ", filename)
-	dialector := sqlite.Open(filename)
+func ConnectToDatabase(settings DatabaseConfig, logger *slog.Logger) (*gorm.DB, *sql.DB, error) {
+	filename := settings.Path()
+	logger.Info("Connecting to the database", "filename", filename)
+	dialector := sqlite.Open(settings.DSN())
 	database, exception := gorm.Open(dialector, &gorm.Config{
-		Logger: logger.Default.LogMode(logger.LogLevel(level)),
+		Logger: &logging.GormLogger{Logger: logger, SlowThreshold: settings.SlowThreshold},
+		// Report the constraint failures as GORM errors (e. g. ErrDuplicatedKey)
+		TranslateError: true,
 	})
 	if exception != nil {
-		log.Panic("Failed to connect to the database.", exception.Error())
-		return nil
+		return nil, nil, fmt.Errorf("failed to connect to the database: %w", exception)
 	}
 
 	connection, exception := database.DB()
 	if exception != nil {
-		log.Panic("Failed to get generic SQL connection pointer.", exception.Error())
-		return nil
+		return nil, nil, fmt.Errorf("failed to get generic SQL connection pointer: %w", exception)
 	}
 
-	Database = database
-	return connection
+	return database, connection, nil
 }
 
-func MigrateDatabase(database models.DataAccessInterface) {
-	database.AutoMigrate(
+// Models lists the entities persisted in the database.
+func Models() []interface{} {
+	return []interface{}{
 		&models.Annotation{},
+		&models.IdempotencyKey{},
+		&models.Job{},
+		&models.RecoveryCode{},
 		&models.User{},
 		&models.Video{},
-	)
+		&models.Webhook{},
+		&models.WebhookDelivery{},
+	}
+}
+
+func MigrateDatabase(database models.DataAccessInterface) {
+	database.AutoMigrate(Models()...)
 }
@@ -1,30 +1,33 @@
 package configuration
 
 import (
-	"bytes"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/zatarain/note-vook/mocks"
+	"github.com/zatarain/note-vook/models"
 	"gorm.io/gorm"
 )
 
 func TestConnectToDatabase(test *testing.T) {
 	assert := assert.New(test)
-	monkey.Patch(log.Panic, log.Print)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 
 	// Teardown test suite
 	defer monkey.UnpatchAll()
-	defer log.SetOutput(os.Stderr)
 
 	test.Run("Should connect to database and return generic SQL connection pointer", func(test *testing.T) {
 		// Arrange
@@ -39,34 +42,31 @@ func TestConnectToDatabase(test *testing.T) {
 		})
 
 		// Act
-		actual := ConnectToDatabase()
+		database, actual, exception := ConnectToDatabase(DatabaseConfig{Filename: "data/dummy.db"}, logger)
 
 		// Assert
+		assert.Nil(exception)
 		assert.Equal(expected, actual)
-		assert.Equal(dummy, Database)
+		assert.Equal(dummy, database)
 	})
 
-	test.Run("Should log a panic when failed to connect to database and return nil", func(test *testing.T) {
+	test.Run("Should return an error when failed to connect to database", func(test *testing.T) {
 		// Arrange
-		var capture bytes.Buffer
-		log.SetOutput(&capture)
 		monkey.Patch(gorm.Open, func(gorm.Dialector, ...gorm.Option) (*gorm.DB, error) {
 			return nil, errors.New("Failed to connect to database")
 		})
 
 		// Act
-		actual := ConnectToDatabase()
+		database, actual, exception := ConnectToDatabase(DatabaseConfig{Filename: "data/dummy.db"}, logger)
 
 		// Assert
-		assert.Contains(capture.String(), "Failed to connect to database")
+		assert.ErrorContains(exception, "Failed to connect to database")
+		assert.Nil(database)
 		assert.Nil(actual)
 	})
 
-	test.Run("Should return nil when failed to get the generic SQL connection pointer", func(test *testing.T) {
+	test.Run("Should return an error when failed to get the generic SQL connection pointer", func(test *testing.T) {
 		// Arrange
-		var capture bytes.Buffer
-		log.SetOutput(&capture)
-
 		database := &gorm.DB{}
 		monkey.Patch(gorm.Open, func(gorm.Dialector, ...gorm.Option) (*gorm.DB, error) {
 			return database, nil
@@ -77,14 +77,61 @@ func TestConnectToDatabase(test *testing.T) {
 		})
 
 		// Act
-		actual := ConnectToDatabase()
+		_, actual, exception := ConnectToDatabase(DatabaseConfig{Filename: "data/dummy.db"}, logger)
 
 		// Assert
-		assert.Contains(capture.String(), "Failed to get SQL connection pointer")
+		assert.ErrorContains(exception, "Failed to get SQL connection pointer")
 		assert.Nil(actual)
 	})
 }
 
+func TestDuplicatedKeys(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should report unique constraint failures as duplicated keys", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "duplicates.db")
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		database, connection, exception := ConnectToDatabase(DatabaseConfig{Filename: filename}, logger)
+		assert.Nil(exception)
+		defer connection.Close()
+		MigrateDatabase(database)
+		video := models.Video{UserID: 1, Title: "Dummy", Link: "https://youtube.com/v/dummy"}
+		assert.Nil(database.Create(&video).Error)
+
+		// Act
+		duplicate := models.Video{UserID: 1, Title: "Again", Link: video.Link}
+		exception = database.Create(&duplicate).Error
+
+		// Assert
+		assert.ErrorIs(exception, gorm.ErrDuplicatedKey)
+	})
+}
+
+func TestDatabasePragmas(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should use write-ahead logging and wait for the locks", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "pragmas.db")
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		settings := DatabaseConfig{Filename: filename, BusyTimeout: 3 * time.Second}
+
+		// Act
+		database, connection, exception := ConnectToDatabase(settings, logger)
+
+		// Assert
+		assert.Nil(exception)
+		defer connection.Close()
+		var journal string
+		var timeout int
+		assert.Nil(database.Raw("PRAGMA journal_mode").Scan(&journal).Error)
+		assert.Nil(database.Raw("PRAGMA busy_timeout").Scan(&timeout).Error)
+		assert.Equal("wal", journal)
+		assert.Equal(3000, timeout)
+	})
+}
+
 func TestMigrateDatabase(test *testing.T) {
 	monkey.Patch(log.Panic, log.Print)
 
@@ -100,8 +147,13 @@ func TestMigrateDatabase(test *testing.T) {
 		database.On(
 			"AutoMigrate",
 			mock.AnythingOfType("*models.Annotation"),
+			mock.AnythingOfType("*models.IdempotencyKey"),
+			mock.AnythingOfType("*models.Job"),
+			mock.AnythingOfType("*models.RecoveryCode"),
 			mock.AnythingOfType("*models.User"),
 			mock.AnythingOfType("*models.Video"),
+			mock.AnythingOfType("*models.Webhook"),
+			mock.AnythingOfType("*models.WebhookDelivery"),
 		).Return(nil)
 
 		// Act
@@ -0,0 +1,26 @@
+package configuration
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// EnvironmentFile is the file with the variables of the environment given by
+// ENVIRONMENT variable, e. g. prod.env, the same the server is run with.
+func EnvironmentFile() string {
+	return os.Getenv("ENVIRONMENT") + ".env"
+}
+
+// LoadEnvironment sets the variables of the given file which are not set yet,
+// so the variables of the process still take precedence. A missing file is
+// only an error when it's required.
+func LoadEnvironment(filename string, required bool) error {
+	exception := godotenv.Load(filename)
+	if !required && errors.Is(exception, fs.ErrNotExist) {
+		return nil
+	}
+	return exception
+}
@@ -0,0 +1,54 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadEnvironment(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should name the file after the environment", func(test *testing.T) {
+		// Arrange
+		test.Setenv("ENVIRONMENT", "prod")
+
+		// Act
+		filename := EnvironmentFile()
+
+		// Assert
+		assert.Equal("prod.env", filename)
+	})
+
+	test.Run("Should set the variables that are not set yet", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "dummy.env")
+		os.WriteFile(filename, []byte("# Comment\nDUMMY_FROM_FILE=file\nDUMMY_FROM_PROCESS=file\n"), 0o600)
+		test.Setenv("DUMMY_FROM_FILE", "")
+		os.Unsetenv("DUMMY_FROM_FILE")
+		test.Setenv("DUMMY_FROM_PROCESS", "process")
+
+		// Act
+		exception := LoadEnvironment(filename, true)
+
+		// Assert
+		assert.Nil(exception)
+		assert.Equal("file", os.Getenv("DUMMY_FROM_FILE"))
+		assert.Equal("process", os.Getenv("DUMMY_FROM_PROCESS"))
+	})
+
+	test.Run("Should only fail on a missing file when it's required", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "missing.env")
+
+		// Act
+		optional := LoadEnvironment(filename, false)
+		required := LoadEnvironment(filename, true)
+
+		// Assert
+		assert.Nil(optional)
+		assert.ErrorIs(required, os.ErrNotExist)
+	})
+}
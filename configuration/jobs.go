@@ -0,0 +1,64 @@
+package configuration
+
+import (
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/webhooks"
+)
+
+// NewJobQueue creates the queue of the background jobs as configured, along
+// with the recurring purge of the finished jobs, the rounds delivering the
+// webhooks and the backups of the database.
+func NewJobQueue(config *Config, database models.DataAccessInterface, dispatcher *webhooks.Dispatcher, backups *backup.Manager, logger *slog.Logger) *jobs.Queue {
+	queue := jobs.NewQueue(database, logger)
+	queue.Concurrency = config.Jobs.Concurrency
+	queue.Interval = config.Jobs.Interval
+	queue.Backoff = config.Jobs.Backoff
+	queue.Attempts = config.Jobs.Attempts
+	queue.Grace = config.Jobs.Grace
+
+	queue.Register(jobs.PurgeKind, queue.Purge(config.Jobs.Retention))
+	queue.Register(webhooks.DeliverKind, dispatcher.Handle)
+	queue.Register(backup.CreateKind, backups.Handle)
+	dispatcher.Jobs = queue
+
+	// The schedules were validated with the configuration, empty ones disable
+	// the recurring jobs
+	schedules := []struct {
+		Kind     string
+		Schedule string
+		Name     string
+	}{
+		{jobs.PurgeKind, config.Jobs.PurgeSchedule, "the purge of the jobs"},
+		{webhooks.DeliverKind, config.Webhooks.Schedule, "the delivery of the webhooks"},
+		{backup.CreateKind, config.Backup.Schedule, "the backups"},
+	}
+	for _, recurring := range schedules {
+		if recurring.Schedule == "" {
+			continue
+		}
+		if exception := queue.Cron(recurring.Kind, recurring.Schedule, nil); exception != nil {
+			logger.Error("Failed to schedule "+recurring.Name, "error", exception)
+		}
+	}
+	return queue
+}
+
+// SetupJobs adds the administration end-points to follow the background jobs,
+// protected by the admin token or the session of an administrator.
+func SetupJobs(server gin.IRouter, config *Config, database models.DataAccessInterface, queue *jobs.Queue, administrator func(*gin.Context) bool) {
+	tasks := &controllers.JobsController{Database: database, Queue: queue}
+
+	admin := server.Group(AdminPath, middleware.Admin(config.Security.AdminToken, administrator))
+	admin.GET("/jobs", tasks.Index)
+	admin.GET("/jobs/statistics", tasks.Statistics)
+	admin.GET("/jobs/:id", tasks.View)
+	admin.POST("/jobs/:id/retry", tasks.Retry)
+	admin.POST("/jobs/:id/cancel", tasks.Cancel)
+}
@@ -0,0 +1,95 @@
+package configuration
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/webhooks"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSetupJobs(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// Arrange
+	const token string = "0123456789abcdef0123456789abcdef"
+	database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "live.db")), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(Models()...))
+	config := &Config{
+		Security: SecurityConfig{AdminToken: token},
+		Jobs: JobsConfig{
+			Concurrency:   4,
+			Interval:      time.Second,
+			Backoff:       time.Minute,
+			Attempts:      2,
+			Grace:         5 * time.Second,
+			Retention:     time.Hour,
+			PurgeSchedule: "@hourly",
+		},
+		Webhooks: WebhooksConfig{Schedule: "*/5 * * * *"},
+		Backup:   BackupConfig{Schedule: "@daily"},
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dispatcher := &webhooks.Dispatcher{Database: database, Logger: logger}
+	backups := NewBackupManager(config, database, logger)
+	engine := gin.New()
+
+	// Act
+	queue := NewJobQueue(config, database, dispatcher, backups, logger)
+	SetupJobs(engine, config, database, queue, nil)
+
+	// Assert
+	assert.Equal(4, queue.Concurrency)
+	assert.Equal(time.Minute, queue.Backoff)
+	assert.Equal(2, queue.Attempts)
+	assert.Equal(5*time.Second, queue.Grace)
+	assert.Same(queue, dispatcher.Jobs)
+	for _, kind := range []string{jobs.PurgeKind, webhooks.DeliverKind, backup.CreateKind} {
+		job, exception := queue.Enqueue(database, kind, nil)
+		require.Nil(exception)
+		assert.Equal(models.JobPending, job.Status)
+	}
+
+	testcases := []struct {
+		Description   string
+		Path          string
+		Authorization string
+		Status        int
+	}{
+		{"Should list the jobs with the admin token", "/jobs", "Bearer " + token, http.StatusOK},
+		{"Should count the jobs with the admin token", "/jobs/statistics", "Bearer " + token, http.StatusOK},
+		{"Should get a job with the admin token", "/jobs/1", "Bearer " + token, http.StatusOK},
+		{"Should not list the jobs without the admin token", "/jobs", "", http.StatusUnauthorized},
+		{"Should not get a job with another token", "/jobs/1", "Bearer " + token[1:] + "0", http.StatusUnauthorized},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			request, _ := http.NewRequest(http.MethodGet, AdminPath+testcase.Path, nil)
+			request.Header.Set("Authorization", testcase.Authorization)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			engine.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package configuration
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/problems"
+)
+
+func output(destination string) (io.Writer, error) {
+	switch destination {
+	case "", "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+	return os.OpenFile(destination, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+}
+
+// NewLoggers creates the factory of structured loggers for the components and
+// makes its logger the default one, so the standard log package writes to the
+// same sink.
+func NewLoggers(settings LoggingConfig) (*logging.Factory, error) {
+	writer, exception := output(settings.Output)
+	if exception != nil {
+		return nil, exception
+	}
+
+	// Both of them have been already checked by the validation
+	level, _ := logging.ParseLevel(settings.Level)
+	levels, _ := logging.ParseLevels(settings.Levels)
+
+	loggers := logging.New(writer, settings.Format, level, levels)
+	slog.SetDefault(loggers.Logger("default"))
+	return loggers, nil
+}
+
+// SetupLogging installs the middleware to identify the requests, log them once
+// they are served and recover from panics logging them as errors.
+func SetupLogging(server gin.IRouter, loggers *logging.Factory) {
+	logger := loggers.Logger("http")
+	recovery := gin.CustomRecoveryWithWriter(nil, func(context *gin.Context, failure any) {
+		logger.ErrorContext(context.Request.Context(), "Recovered from panic", "panic", failure)
+		problems.Abort(context, fmt.Errorf("panic: %v", failure))
+	})
+	server.Use(middleware.RequestID, middleware.AccessLog(logger), recovery)
+}
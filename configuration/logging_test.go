@@ -0,0 +1,84 @@
+package configuration
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/middleware"
+)
+
+func TestNewLoggers(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	// Teardown test suite
+	defer slog.SetDefault(slog.Default())
+
+	test.Run("Should write the logs to the given file and make them the default", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "note-vook.log")
+		settings := LoggingConfig{Level: "info", Levels: "database=error", Format: "json", Output: filename}
+
+		// Act
+		loggers, exception := NewLoggers(settings)
+		loggers.Logger("database").Warn("Slow database statement")
+		slog.Info("Using the default logger")
+
+		// Assert
+		require.Nil(exception)
+		content, exception := os.ReadFile(filename)
+		require.Nil(exception)
+		assert.NotContains(string(content), "Slow database statement")
+		assert.Contains(string(content), `"component":"default"`)
+		assert.Contains(string(content), "Using the default logger")
+	})
+
+	test.Run("Should return error when the output can't be opened", func(test *testing.T) {
+		// Arrange
+		settings := LoggingConfig{Level: "info", Output: filepath.Join(test.TempDir(), "missing", "note-vook.log")}
+
+		// Act
+		loggers, exception := NewLoggers(settings)
+
+		// Assert
+		assert.NotNil(exception)
+		assert.Nil(loggers)
+	})
+}
+
+func TestSetupLogging(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should log the panics with the request identifier and respond internal server error", func(test *testing.T) {
+		// Arrange
+		var buffer bytes.Buffer
+		engine := gin.New()
+		SetupLogging(engine, logging.New(&buffer, logging.FormatJSON, slog.LevelInfo, nil))
+		engine.GET("/panic", func(*gin.Context) {
+			panic("something went wrong")
+		})
+		request, _ := http.NewRequest(http.MethodGet, "/panic", nil)
+		request.Header.Set(middleware.RequestIDHeader, "request-1")
+		recorder := httptest.NewRecorder()
+
+		// Act
+		engine.ServeHTTP(recorder, request)
+
+		// Assert
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
+		assert.Equal("request-1", recorder.Header().Get(middleware.RequestIDHeader))
+		assert.Contains(buffer.String(), `"msg":"Recovered from panic"`)
+		assert.Contains(buffer.String(), "something went wrong")
+		assert.Contains(buffer.String(), `"status":500`)
+	})
+}
@@ -0,0 +1,112 @@
+package configuration
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/models"
+)
+
+// ActivityWindow is how far back we look for changes on videos or annotations
+// to consider a user as active.
+const ActivityWindow = 30 * 24 * time.Hour
+
+type BusinessCollector struct {
+	Connection  *sql.DB
+	videos      *prometheus.Desc
+	annotations *prometheus.Desc
+	users       *prometheus.Desc
+}
+
+func NewBusinessCollector(connection *sql.DB) *BusinessCollector {
+	return &BusinessCollector{
+		Connection:  connection,
+		videos:      prometheus.NewDesc("notevook_videos_total", "Number of videos stored.", nil, nil),
+		annotations: prometheus.NewDesc("notevook_annotations_total", "Number of annotations stored.", nil, nil),
+		users: prometheus.NewDesc(
+			"notevook_active_users",
+			"Number of users with changes on their videos or annotations within the last 30 days.",
+			nil, nil,
+		),
+	}
+}
+
+func (collector *BusinessCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- collector.videos
+	descriptions <- collector.annotations
+	descriptions <- collector.users
+}
+
+func (collector *BusinessCollector) Collect(metrics chan<- prometheus.Metric) {
+	since := time.Now().Add(-ActivityWindow)
+	gauges := []struct {
+		Description *prometheus.Desc
+		Query       string
+		Arguments   []interface{}
+	}{
+		{collector.videos, "SELECT COUNT(*) FROM videos", nil},
+		{collector.annotations, "SELECT COUNT(*) FROM annotations", nil},
+		{
+			collector.users,
+			`SELECT COUNT(DISTINCT user_id) FROM videos
+			WHERE updated_at >= ? OR id IN (SELECT video_id FROM annotations WHERE updated_at >= ?)`,
+			[]interface{}{since, since},
+		},
+	}
+
+	for _, gauge := range gauges {
+		var count float64
+		if exception := collector.Connection.QueryRow(gauge.Query, gauge.Arguments...).Scan(&count); exception != nil {
+			metrics <- prometheus.NewInvalidMetric(gauge.Description, exception)
+			continue
+		}
+		metrics <- prometheus.MustNewConstMetric(gauge.Description, prometheus.GaugeValue, count)
+	}
+}
+
+// SetupMetrics installs the middleware recording the requests and exposes the
+// metrics in Prometheus text format. When a dedicated port is configured it
+// returns the server to listen on it, otherwise the metrics end-point is added
+// to the API server and it returns nil.
+func SetupMetrics(server gin.IRouter, config *Config, database models.DataAccessInterface, logger *slog.Logger) *Server {
+	if !config.Metrics.Enabled {
+		return nil
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	if connection, exception := database.DB(); exception == nil {
+		registry.MustRegister(
+			collectors.NewDBStatsCollector(connection, "notevook"),
+			NewBusinessCollector(connection),
+		)
+	} else {
+		logger.Warn("Database metrics disabled", "error", exception)
+	}
+
+	metrics := middleware.NewMetrics(registry)
+	server.Use(metrics.Handler)
+
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+	if config.Metrics.Port == "" {
+		server.GET(config.Metrics.Path, gin.WrapH(handler))
+		return nil
+	}
+
+	router := gin.New()
+	router.GET(config.Metrics.Path, gin.WrapH(handler))
+	settings := config.Server
+	settings.Port = config.Metrics.Port
+	settings.Certificate, settings.Key = "", ""
+	return NewServer(router, settings, logger)
+}
@@ -0,0 +1,98 @@
+package configuration
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSetupMetrics(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	connect := func() *gorm.DB {
+		database, exception := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(Models()...))
+		return database
+	}
+
+	scrape := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should expose request, database pool and business metrics on the API server", func(test *testing.T) {
+		// Arrange
+		database := connect()
+		old := time.Now().Add(-2 * ActivityWindow)
+		database.Create(&models.User{ID: 1, Nickname: "active"})
+		database.Create(&models.User{ID: 2, Nickname: "inactive"})
+		database.Create(&models.Video{ID: 1, UserID: 1, Link: "https://videos/1"})
+		database.Create(&models.Video{ID: 2, UserID: 2, Link: "https://videos/2", CreatedAt: old, UpdatedAt: old})
+		database.Create(&models.Annotation{VideoID: 1, Title: "One"})
+		database.Create(&models.Annotation{VideoID: 1, Title: "Two"})
+		config := &Config{Metrics: MetricsConfig{Enabled: true, Path: "/metrics"}}
+		engine := gin.New()
+
+		// Act
+		server := SetupMetrics(engine, config, database, slog.Default())
+		engine.GET("/ping", func(context *gin.Context) { context.Status(http.StatusOK) })
+		scrape(engine, "/ping")
+		recorder := scrape(engine, "/metrics")
+
+		// Assert
+		assert.Nil(server)
+		assert.Equal(http.StatusOK, recorder.Code)
+		body := recorder.Body.String()
+		assert.Contains(body, `notevook_http_requests_total{method="GET",route="/ping",status="200"} 1`)
+		assert.Contains(body, `notevook_http_request_duration_seconds_count{method="GET",route="/ping"} 1`)
+		assert.Contains(body, `go_sql_open_connections{db_name="notevook"}`)
+		assert.Contains(body, "notevook_videos_total 2")
+		assert.Contains(body, "notevook_annotations_total 2")
+		assert.Contains(body, "notevook_active_users 1")
+	})
+
+	test.Run("Should return a dedicated server when metrics port is configured", func(test *testing.T) {
+		// Arrange
+		config := &Config{
+			Server:  ServerConfig{Port: "4000", Certificate: "certificate.pem", Key: "key.pem"},
+			Metrics: MetricsConfig{Enabled: true, Path: "/metrics", Port: "9090"},
+		}
+		engine := gin.New()
+
+		// Act
+		server := SetupMetrics(engine, config, connect(), slog.Default())
+
+		// Assert
+		require.NotNil(server)
+		assert.Equal(":9090", server.Addr)
+		assert.Empty(server.Certificate)
+		assert.Equal(http.StatusNotFound, scrape(engine, "/metrics").Code)
+		assert.Equal(http.StatusOK, scrape(server.Handler, "/metrics").Code)
+	})
+
+	test.Run("Should do nothing when metrics are disabled", func(test *testing.T) {
+		// Arrange
+		engine := gin.New()
+
+		// Act
+		server := SetupMetrics(engine, &Config{}, connect(), slog.Default())
+
+		// Assert
+		assert.Nil(server)
+		assert.Empty(engine.Routes())
+	})
+}
@@ -0,0 +1,72 @@
+package configuration
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/oidc"
+	"golang.org/x/exp/slices"
+)
+
+// OIDCTimeout is the maximum time to wait for the identity provider.
+const OIDCTimeout time.Duration = 10 * time.Second
+
+// NewSingleSignOn creates the login with the identity provider as configured,
+// which is disabled without issuer.
+func NewSingleSignOn(config OIDCConfig) (controllers.SingleSignOn, error) {
+	roles, exception := NewRoleMapping(config.Roles)
+	sso := controllers.SingleSignOn{
+		NicknameClaim:   config.NicknameClaim,
+		RolesClaim:      config.RolesClaim,
+		Roles:           roles,
+		Provision:       config.Provision,
+		StateTTL:        config.StateTTL,
+		ConfirmationTTL: config.ConfirmationTTL,
+	}
+	if config.Issuer == "" {
+		return sso, exception
+	}
+
+	scopes := []string{}
+	for _, scope := range strings.Split(config.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			scopes = append(scopes, scope)
+		}
+	}
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	sso.Provider = oidc.NewProvider(oidc.Config{
+		Issuer:       config.Issuer,
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		RedirectURL:  config.RedirectURL,
+		Scopes:       scopes,
+	}, &http.Client{Timeout: OIDCTimeout})
+	return sso, exception
+}
+
+// NewRoleMapping reads the comma separated value=role pairs mapping the values
+// of the roles claim to the roles of the users.
+func NewRoleMapping(mapping string) (map[string]string, error) {
+	roles := map[string]string{}
+	for _, pair := range strings.Split(mapping, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		value, role, found := strings.Cut(pair, "=")
+		value, role = strings.TrimSpace(value), strings.TrimSpace(role)
+		if !found || value == "" {
+			return roles, fmt.Errorf("expected value=role, got %q", pair)
+		}
+		if !slices.Contains(models.Roles, role) {
+			return roles, fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(models.Roles, ", "))
+		}
+		roles[value] = role
+	}
+	return roles, nil
+}
@@ -0,0 +1,83 @@
+package configuration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+)
+
+func TestNewSingleSignOn(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should create the provider with the openid scope", func(test *testing.T) {
+		// Act
+		sso, exception := NewSingleSignOn(OIDCConfig{
+			Issuer:          "https://sso.io/",
+			ClientID:        "notevook",
+			RedirectURL:     "https://notevook.io/v1/login/oidc/callback",
+			Scopes:          " profile, email ,",
+			NicknameClaim:   "preferred_username",
+			RolesClaim:      "groups",
+			Roles:           "notevook-admins=admin, staff = user",
+			Provision:       true,
+			StateTTL:        time.Minute,
+			ConfirmationTTL: 2 * time.Minute,
+		})
+
+		// Assert
+		require.Nil(exception)
+		require.True(sso.Enabled())
+		assert.Equal("https://sso.io", sso.Provider.Config.Issuer)
+		assert.Equal([]string{"openid", "profile", "email"}, sso.Provider.Config.Scopes)
+		assert.Equal(map[string]string{"notevook-admins": models.RoleAdmin, "staff": models.RoleUser}, sso.Roles)
+		assert.True(sso.Provision)
+		assert.Equal(time.Minute, sso.StateTTL)
+		assert.Equal(2*time.Minute, sso.ConfirmationTTL)
+	})
+
+	test.Run("Should be disabled without issuer", func(test *testing.T) {
+		// Act
+		sso, exception := NewSingleSignOn(OIDCConfig{ClientID: "notevook"})
+
+		// Assert
+		assert.Nil(exception)
+		assert.False(sso.Enabled())
+	})
+}
+
+func TestNewRoleMapping(test *testing.T) {
+	assert := assert.New(test)
+
+	testcases := []struct {
+		Description string
+		Mapping     string
+		Expected    string
+	}{
+		{"Should NOT map values without role", "notevook-admins", `expected value=role, got "notevook-admins"`},
+		{"Should NOT map empty values", "=admin", `expected value=role, got "=admin"`},
+		{"Should NOT map to unknown roles", "staff=editor", `unknown role "editor", expected one of user, admin`},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			_, exception := NewRoleMapping(testcase.Mapping)
+
+			// Assert
+			assert.EqualError(exception, testcase.Expected)
+		})
+	}
+
+	test.Run("Should map nothing when empty", func(test *testing.T) {
+		// Act
+		roles, exception := NewRoleMapping("")
+
+		// Assert
+		assert.Nil(exception)
+		assert.Empty(roles)
+	})
+}
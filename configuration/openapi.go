@@ -0,0 +1,367 @@
+package configuration
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/openapi"
+	"github.com/zatarain/note-vook/webhooks"
+)
+
+const (
+	APITitle          string = "NoteVook API"
+	APIVersion        string = "1.0.0"
+	SpecificationPath string = "/openapi.json"
+	DocsPath          string = "/docs"
+)
+
+func described(schema *openapi3.Schema, description string) *openapi3.Schema {
+	schema.Description = description
+	return schema
+}
+
+// TimeStampSchema describes the formats accepted for a models.TimeStamp, which
+// is always written as HH:MM:SS.
+func TimeStampSchema() *openapi3.Schema {
+	schema := openapi3.NewOneOfSchema(
+		described(openapi3.NewIntegerSchema().WithMin(0), "Number of seconds"),
+		described(openapi3.NewStringSchema().WithPattern(`^[0-9]+(\.[0-9]+)?$`), "Number of seconds as string, e. g. \"90\""),
+		described(openapi3.NewStringSchema().WithPattern(models.PATTERN), "Clock format HH:MM:SS or MM:SS, e. g. \"01:02:03\""),
+		described(openapi3.NewStringSchema().WithPattern(`^([0-9]+(\.[0-9]+)?(h|m|s|ms))+$`), "Go duration, e. g. \"1h2m3s\""),
+	)
+	schema.Description = "Time stamp within a video, it's always written in clock format HH:MM:SS"
+	schema.Example = "00:01:30"
+	return schema
+}
+
+// Specification documents all the end-points routed by Setup.
+func Specification() *openapi.Document {
+	document := openapi.NewDocument(APITitle, APIVersion)
+	document.Schemas.Custom[reflect.TypeOf(models.TimeStamp(0))] = TimeStampSchema()
+
+	document.Add(
+		openapi.Operation{
+			Method: http.MethodHead, Path: "/health", Tag: "health",
+			Summary: "Service health check", Status: http.StatusOK,
+		},
+		openapi.Operation{
+			Method: http.MethodGet, Path: "/livez", Tag: "health",
+			Summary: "Liveness probe (process is up)", Status: http.StatusOK,
+			Response: controllers.HealthReport{},
+		},
+		openapi.Operation{
+			Method: http.MethodGet, Path: "/readyz", Tag: "health",
+			Summary: "Readiness probe (database, schema, disk)", Status: http.StatusOK,
+			Response: controllers.HealthReport{}, Failures: []int{http.StatusServiceUnavailable},
+		},
+	)
+
+	// The administration end-points are not versioned
+	document.Add(
+		openapi.Operation{
+			Method: http.MethodGet, Path: AdminPath + "/backups", Tag: "admin",
+			Summary: "List the database backups, the newest first", Status: http.StatusOK,
+			Response: []backup.Backup{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+		},
+		openapi.Operation{
+			Method: http.MethodPost, Path: AdminPath + "/backups", Tag: "admin",
+			Summary:     "Back up the database while it's being used",
+			Description: "The `compress` query parameter (`true` or `false`) overrides whether the backup is compressed with gzip.",
+			Status:      http.StatusCreated, Response: backup.Backup{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+			Failures: []int{http.StatusBadRequest},
+		},
+		openapi.Operation{
+			Method: http.MethodGet, Path: AdminPath + "/jobs", Tag: "admin",
+			Summary:     "List the latest background jobs, the newest first",
+			Description: "The `status` and `kind` query parameters only list the jobs with the given status or kind.",
+			Status:      http.StatusOK, Response: []models.Job{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+			Failures: []int{http.StatusBadRequest},
+		},
+		openapi.Operation{
+			Method: http.MethodGet, Path: AdminPath + "/jobs/statistics", Tag: "admin",
+			Summary: "Count the background jobs on each status", Status: http.StatusOK,
+			Response: controllers.JobStatistics{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+		},
+		openapi.Operation{
+			Method: http.MethodGet, Path: AdminPath + "/jobs/:id", Tag: "admin",
+			Summary: "Get the status of a background job", Status: http.StatusOK,
+			Response: models.Job{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+			Failures: []int{http.StatusNotFound},
+		},
+		openapi.Operation{
+			Method: http.MethodPost, Path: AdminPath + "/jobs/:id/retry", Tag: "admin",
+			Summary: "Enqueue again a failed or cancelled job with all its attempts", Status: http.StatusAccepted,
+			Response: models.Job{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+			Failures: []int{http.StatusNotFound, http.StatusConflict},
+		},
+		openapi.Operation{
+			Method: http.MethodPost, Path: AdminPath + "/jobs/:id/cancel", Tag: "admin",
+			Summary: "Cancel a pending job", Status: http.StatusOK,
+			Response: models.Job{}, Authorised: true, Scheme: openapi.BearerAuthScheme,
+			Failures: []int{http.StatusNotFound, http.StatusConflict},
+		},
+	)
+
+	// The API end-points are served under /v1 and, deprecated, without prefix
+	operations := []openapi.Operation{
+		{
+			Method: http.MethodPost, Path: "/signup", Tag: "users",
+			Summary:     "User sign up to create users",
+			Description: "The nickname and password must follow the rules, the ones broken are listed in the `errors` of the problem.",
+			Request:     controllers.Credentials{}, Status: http.StatusCreated, Response: models.User{},
+			Failures: []int{http.StatusBadRequest, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/login", Tag: "users",
+			Summary: "User login and get authorisation token",
+			Description: "Sets the `Authorisation` cookie with the token used by the other end-points. " +
+				"Each failed login locks the login of the user for a while, longer on each failure in a row, " +
+				"and too many of them lock out the account. The users with two-factor authentication get a " +
+				"`202 Accepted` with a challenge instead, which has to be sent along with a code to `/login/two-factor`.",
+			Request: controllers.Credentials{}, Status: http.StatusOK, Response: controllers.Message{},
+			Alternatives: map[int]interface{}{http.StatusAccepted: controllers.TwoFactorChallenge{}},
+			Failures:     []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPost, Path: "/login/two-factor", Tag: "users",
+			Summary: "Complete the login of a user with two-factor authentication",
+			Description: "The `code` is either the current one of the authenticator app or an unused recovery code, " +
+				"each of them is accepted only once. Sets the `Authorisation` cookie and the wrong codes count as failed logins.",
+			Request: controllers.TwoFactorLoginContract{}, Status: http.StatusOK, Response: controllers.Message{},
+			Failures: []int{http.StatusBadRequest, http.StatusUnauthorized},
+		},
+		{
+			Method: http.MethodGet, Path: "/login/oidc", Tag: "users",
+			Summary: "Log in with the identity provider",
+			Description: "Redirects to the OpenID Connect identity provider, which redirects back to `/login/oidc/callback`. " +
+				"The logged users link their account to the identity provider with `link=true` instead, " +
+				"or log in again with `confirm=true` to confirm an operation without password.",
+			Query:  controllers.SSOLoginQuery{},
+			Status: http.StatusFound,
+			Failures: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusConflict, http.StatusBadGateway},
+		},
+		{
+			Method: http.MethodGet, Path: "/login/oidc/callback", Tag: "users",
+			Summary: "Complete the login with the identity provider",
+			Description: "Sets the `Authorisation` cookie of the user linked to the identity provider user, " +
+				"creating its account on the first login unless the provisioning is disabled. " +
+				"The role of the user is updated from the claims on each login. " +
+				"The users with two-factor authentication get a challenge instead, like on `/login`.",
+			Query:  controllers.SSOCallbackQuery{},
+			Status: http.StatusOK, Response: controllers.Message{},
+			Failures: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound,
+				http.StatusConflict, http.StatusBadGateway},
+		},
+		{
+			Method: http.MethodGet, Path: "/videos", Tag: "videos", Authorised: true,
+			Summary: "List of all videos owned by logged user", Status: http.StatusOK,
+			Response: []models.Video{},
+		},
+		{
+			Method: http.MethodPost, Path: "/videos", Tag: "videos", Authorised: true,
+			Summary: "Create a video record in the system", Request: controllers.AddVideoContract{},
+			Status: http.StatusCreated, Response: models.Video{},
+			Failures: []int{http.StatusBadRequest, http.StatusConflict},
+		},
+		{
+			Method: http.MethodGet, Path: "/videos/:id", Tag: "videos", Authorised: true,
+			Summary: "Get video details and its annotations", Status: http.StatusOK,
+			Response: models.Video{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPatch, Path: "/videos/:id", Tag: "videos", Authorised: true,
+			Summary: "Edit details for a given video", Request: controllers.EditVideoContract{},
+			Status: http.StatusOK, Response: models.Video{},
+			Failures: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict},
+		},
+		{
+			Method: http.MethodDelete, Path: "/videos/:id", Tag: "videos", Authorised: true,
+			Summary: "Delete a video and its annotations", Status: http.StatusOK,
+			Response: controllers.Message{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/annotations", Tag: "annotations", Authorised: true,
+			Summary: "Create an annotation record for a video", Request: controllers.AddAnnotationContract{},
+			Status: http.StatusCreated, Response: models.Annotation{},
+			Failures: []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPatch, Path: "/annotations/:id", Tag: "annotations", Authorised: true,
+			Summary: "Edit details for an annotation", Request: controllers.EditAnnotationContract{},
+			Status: http.StatusOK, Response: models.Annotation{},
+			Failures: []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		{
+			Method: http.MethodDelete, Path: "/annotations/:id", Tag: "annotations", Authorised: true,
+			Summary: "Delete an annotation", Status: http.StatusOK,
+			Response: controllers.Message{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/videos/:id/annotations/batch", Tag: "annotations", Authorised: true,
+			Summary: "Create, update and delete many annotations of a video at once",
+			Description: "The operations (`" + controllers.BatchCreate + "` with a `temp_id`, `" + controllers.BatchUpdate +
+				"` or `" + controllers.BatchDelete + "` with the `id`) are validated together and applied in order within a " +
+				"single transaction, nothing is saved unless all of them are valid. The `ids` of the response map the " +
+				"temporary IDs to the new ones. The batch is rejected with the report in the problem when any operation " +
+				"is not valid.",
+			Request: controllers.BatchContract{}, Status: http.StatusOK, Response: controllers.BatchReport{},
+			Failures: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/videos/:id/events", Tag: "annotations", Authorised: true,
+			Summary: "Follow the changes of the annotations of a video as Server-Sent Events",
+			Description: "Each event has an `id`, its type (`" + events.AnnotationCreated + "`, `" + events.AnnotationUpdated +
+				"` or `" + events.AnnotationDeleted + "`) and the annotation as JSON `data`. Reconnecting with the " +
+				"`" + controllers.LastEventIDHeader + "` header (or the `last_event_id` query parameter) sends the events " +
+				"missed first, a `" + events.Resync + "` event means they are no longer kept and the video must be reloaded. " +
+				"Comments are sent periodically to keep the stream open.",
+			Status: http.StatusOK, Response: "", ContentType: controllers.EventStreamContentType,
+			Failures: []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/import", Tag: "videos", Authorised: true,
+			Summary: "Create or update (by link) videos along with their annotations",
+			Description: "Each line of JSON Lines is a video with its `annotations`. Each CSV record is a video (columns `" +
+				strings.Join(controllers.CSVColumns[:4], "`, `") + "`) with up to one annotation (columns `" +
+				strings.Join(controllers.CSVColumns[4:], "`, `") + "`). The query parameter `mode` is either `" +
+				controllers.ImportAtomic + "` (the default, nothing is saved unless all the rows are valid, otherwise the " +
+				"import is rejected with the report in the problem) or `" +
+				controllers.ImportBestEffort + "` (the valid rows are saved anyway).",
+			Request:  controllers.ImportVideoContract{},
+			Consumes: []string{controllers.JSONLinesContentType, controllers.NDJSONContentType, controllers.CSVContentType},
+			Status:   http.StatusOK, Response: controllers.ImportReport{},
+			Failures: []int{http.StatusBadRequest, http.StatusUnsupportedMediaType, http.StatusUnprocessableEntity},
+		},
+		{
+			Method: http.MethodGet, Path: "/export", Tag: "videos", Authorised: true,
+			Summary: "Export the videos of the logged user along with their annotations",
+			Description: "The `format` is either `" + controllers.ExportCSV + "` (the default, the same columns as the import), `" +
+				controllers.ExportJSONLines + "` (a video with its annotations per line) or `" + controllers.ExportXLSX +
+				"` (an Excel workbook with the CSV columns). The annotations are filtered by `type` and by their creation " +
+				"date from `since` to `until` (both included), only the videos with some matching annotations are exported then.",
+			Query:  controllers.ExportQuery{},
+			Status: http.StatusOK, Response: openapi.Binary{}, ContentType: controllers.CSVContentType,
+			Failures: []int{http.StatusBadRequest},
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks", Tag: "webhooks", Authorised: true,
+			Summary: "List the webhooks of the logged user", Status: http.StatusOK,
+			Response: []models.Webhook{},
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks", Tag: "webhooks", Authorised: true,
+			Summary: "Register a URL to be notified of the chosen events",
+			Description: "The events are `" + strings.Join(webhooks.Events, "`, `") + "`. The deliveries are signed with the " +
+				"`secret` (generated unless it's given, only shown on this response) in the `" + webhooks.SignatureHeader +
+				"` header as the HMAC-SHA256 of the `" + webhooks.TimestampHeader + "` header, a dot and the body.",
+			Request: controllers.AddWebhookContract{}, Status: http.StatusCreated, Response: models.Webhook{},
+			Failures: []int{http.StatusBadRequest},
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks/:id", Tag: "webhooks", Authorised: true,
+			Summary: "Get the details of a webhook", Status: http.StatusOK,
+			Response: models.Webhook{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPatch, Path: "/webhooks/:id", Tag: "webhooks", Authorised: true,
+			Summary:     "Edit the URL, events, secret or activation of a webhook",
+			Description: "The secret is only shown when it's changed.",
+			Request:     controllers.EditWebhookContract{}, Status: http.StatusOK, Response: models.Webhook{},
+			Failures: []int{http.StatusBadRequest, http.StatusNotFound},
+		},
+		{
+			Method: http.MethodDelete, Path: "/webhooks/:id", Tag: "webhooks", Authorised: true,
+			Summary: "Delete a webhook along with its deliveries", Status: http.StatusOK,
+			Response: controllers.Message{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/webhooks/:id/deliveries", Tag: "webhooks", Authorised: true,
+			Summary: "List the latest deliveries of a webhook, the newest first", Status: http.StatusOK,
+			Response: []models.WebhookDelivery{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodPost, Path: "/webhooks/:id/deliveries/:delivery/redeliver", Tag: "webhooks", Authorised: true,
+			Summary: "Send the event of a delivery again as a new delivery", Status: http.StatusAccepted,
+			Response: models.WebhookDelivery{}, Failures: []int{http.StatusNotFound},
+		},
+		{
+			Method: http.MethodGet, Path: "/me/export", Tag: "users", Authorised: true,
+			Summary:     "Export all the data of the logged user",
+			Description: "ZIP archive with `profile.json`, `videos.json` (videos along with their annotations) and a WebVTT file per video in `subtitles/`.",
+			Status:      http.StatusOK, Response: openapi.Binary{}, ContentType: controllers.ExportContentType,
+		},
+		{
+			Method: http.MethodPost, Path: "/me/password", Tag: "users", Authorised: true,
+			Summary:     "Change the password of the logged user",
+			Description: "Revokes all the tokens issued before, the `Authorisation` cookie is set with a new token.",
+			Request:     controllers.ChangePasswordContract{}, Status: http.StatusOK, Response: controllers.Message{},
+			Failures: []int{http.StatusBadRequest, http.StatusForbidden},
+		},
+		{
+			Method: http.MethodPost, Path: "/me/two-factor", Tag: "users", Authorised: true,
+			Summary: "Enrol a new secret for the authenticator app of the logged user",
+			Description: "The `uri` is the otpauth URI of the secret, to be shown as a QR code. " +
+				"The two-factor authentication is only enabled once a code is confirmed.",
+			Request: controllers.EnrolTwoFactorContract{}, Status: http.StatusOK, Response: controllers.TwoFactorEnrolment{},
+			Failures: []int{http.StatusBadRequest, http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/me/two-factor/confirm", Tag: "users", Authorised: true,
+			Summary:     "Enable the two-factor authentication confirming a code of the secret enrolled",
+			Description: "The recovery codes are only shown on this response.",
+			Request:     controllers.TwoFactorCodeContract{}, Status: http.StatusOK, Response: controllers.TwoFactorRecovery{},
+			Failures: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict},
+		},
+		{
+			Method: http.MethodPost, Path: "/me/two-factor/recovery-codes", Tag: "users", Authorised: true,
+			Summary:     "Replace the recovery codes of the logged user",
+			Description: "The previous recovery codes no longer work, the new ones are only shown on this response.",
+			Request:     controllers.TwoFactorCodeContract{}, Status: http.StatusOK, Response: controllers.TwoFactorRecovery{},
+			Failures: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusConflict},
+		},
+		{
+			Method: http.MethodDelete, Path: "/me/two-factor", Tag: "users", Authorised: true,
+			Summary: "Disable the two-factor authentication of the logged user",
+			Request: controllers.DisableTwoFactorContract{}, Status: http.StatusOK, Response: controllers.Message{},
+			Failures: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusConflict},
+		},
+		{
+			Method: http.MethodDelete, Path: "/me", Tag: "users", Authorised: true,
+			Summary: "Delete the account of the logged user along with its videos and annotations",
+			Request: controllers.DeleteAccountContract{}, Status: http.StatusOK, Response: controllers.Message{},
+			Failures: []int{http.StatusBadRequest, http.StatusForbidden},
+		},
+	}
+	for _, operation := range operations {
+		operation.Idempotent = operation.Method == http.MethodPost
+
+		// All of them are rate limited
+		operation.Failures = append(append([]int{}, operation.Failures...), http.StatusTooManyRequests)
+		versioned := operation
+		versioned.Path = "/" + APIVersionName + operation.Path
+		deprecated := operation
+		deprecated.Deprecated = true
+		deprecated.Description = strings.TrimSpace(operation.Description + " Use " + versioned.Path + " instead.")
+		document.Add(versioned, deprecated)
+	}
+
+	return document
+}
+
+// SetupDocs serves the specification and its documentation UI.
+func SetupDocs(server gin.IRouter) {
+	document := Specification()
+	server.GET(SpecificationPath, document.Specification)
+	server.GET(DocsPath, func(context *gin.Context) {
+		context.Redirect(http.StatusMovedPermanently, DocsPath+"/")
+	})
+	server.GET(DocsPath+"/*filepath", openapi.Docs(SpecificationPath))
+}
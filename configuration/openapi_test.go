@@ -0,0 +1,111 @@
+package configuration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/mocks"
+	"github.com/zatarain/note-vook/openapi"
+)
+
+func TestSpecification(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should document every route setup for the API", func(test *testing.T) {
+		// Arrange
+		engine := gin.New()
+		loggers := logging.New(io.Discard, logging.FormatJSON, slog.LevelInfo, nil)
+		database := new(mocks.MockedDataAccessInterface)
+		services := Setup(engine, &Config{}, database, loggers)
+		SetupBackups(engine, &Config{}, services.Backups, services.Administrator)
+		SetupJobs(engine, &Config{}, database, services.Jobs, services.Administrator)
+		routes := []string{}
+		for _, route := range engine.Routes() {
+			routes = append(routes, route.Method+" "+openapi.Path(route.Path))
+		}
+
+		// Act
+		documented := Specification().Operations()
+
+		// Assert
+		assert.ElementsMatch(routes, documented)
+	})
+
+	test.Run("Should be a valid OpenAPI 3 document", func(test *testing.T) {
+		// Arrange
+		document := Specification()
+
+		// Act
+		exception := document.Validate(context.Background())
+
+		// Assert
+		assert.Nil(exception)
+	})
+
+	test.Run("Should describe the contracts with their required fields and time stamps", func(test *testing.T) {
+		// Act
+		schemas := Specification().Components.Schemas
+
+		// Assert
+		contract := schemas["AddAnnotationContract"].Value
+		assert.ElementsMatch([]string{"video_id", "title", "start", "end"}, contract.Required)
+		assert.Equal(openapi.ComponentsPrefix+"TimeStamp", contract.Properties["start"].Ref)
+		assert.Len(schemas["TimeStamp"].Value.OneOf, 4)
+		assert.Equal("uri", schemas["AddVideoContract"].Value.Properties["link"].Value.Format)
+		assert.Equal(openapi.ComponentsPrefix+"Annotation", schemas["Video"].Value.Properties["annotations"].Value.Items.Ref)
+		assert.Equal(openapi.ComponentsPrefix+"Video", schemas["Annotation"].Value.Properties["video"].Ref)
+	})
+}
+
+func TestSetupDocs(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	engine := gin.New()
+	SetupDocs(engine)
+	serve := func(path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		recorder := httptest.NewRecorder()
+		engine.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should serve the specification as JSON", func(test *testing.T) {
+		// Act
+		recorder := serve(SpecificationPath)
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		document := &openapi3.T{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), document))
+		assert.Equal(openapi.Version, document.OpenAPI)
+		assert.False(document.Paths.Find("/v1/videos/{id}").Get.Deprecated)
+		assert.True(document.Paths.Find("/videos/{id}").Get.Deprecated)
+	})
+
+	test.Run("Should serve the documentation UI loading the specification", func(test *testing.T) {
+		// Act
+		page := serve(DocsPath + "/")
+		initializer := serve(DocsPath + "/swagger-initializer.js")
+		redirection := serve(DocsPath)
+
+		// Assert
+		assert.Equal(http.StatusOK, page.Code)
+		assert.Contains(page.Body.String(), "swagger-ui")
+		assert.Equal(http.StatusOK, initializer.Code)
+		assert.Contains(initializer.Body.String(), `url: "/openapi.json"`)
+		assert.Equal(http.StatusMovedPermanently, redirection.Code)
+	})
+}
@@ -0,0 +1,54 @@
+package configuration
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/zatarain/note-vook/policy"
+)
+
+// NewPasswordPolicy creates the rules of the passwords as configured, the
+// breached passwords are the most common ones along with the ones of the file.
+func NewPasswordPolicy(config PasswordConfig) (policy.Password, error) {
+	passwords := policy.Password{
+		MinLength:  config.MinLength,
+		MinClasses: config.MinClasses,
+		Breached:   policy.Common(),
+	}
+	if config.BreachedFile == "" {
+		return passwords, nil
+	}
+
+	file, exception := os.Open(config.BreachedFile)
+	if exception != nil {
+		return passwords, exception
+	}
+	defer file.Close()
+	breached, exception := policy.ReadList(file)
+	for word := range breached {
+		passwords.Breached.Add(word)
+	}
+	return passwords, exception
+}
+
+// NewNicknamePolicy creates the rules of the nicknames as configured.
+func NewNicknamePolicy(config NicknameConfig) (policy.Nickname, error) {
+	nicknames := policy.Nickname{
+		MinLength: config.MinLength,
+		MaxLength: config.MaxLength,
+		Reserved:  policy.NewList(),
+	}
+	for _, reserved := range strings.Split(config.Reserved, ",") {
+		if reserved = strings.TrimSpace(reserved); reserved != "" {
+			nicknames.Reserved.Add(reserved)
+		}
+	}
+	if config.Pattern == "" {
+		return nicknames, nil
+	}
+
+	pattern, exception := regexp.Compile(config.Pattern)
+	nicknames.Pattern = pattern
+	return nicknames, exception
+}
@@ -0,0 +1,66 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPasswordPolicy(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should reject the common passwords along with the ones of the file", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "breached.txt")
+		require.Nil(os.WriteFile(filename, []byte("# Leaked\nSunset-Drive-1986\n"), 0600))
+
+		// Act
+		passwords, exception := NewPasswordPolicy(PasswordConfig{MinLength: 10, MinClasses: 3, BreachedFile: filename})
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal(10, passwords.MinLength)
+		assert.Equal(3, passwords.MinClasses)
+		assert.True(passwords.Breached.Contains("sunset-drive-1986"))
+		assert.True(passwords.Breached.Contains("123456"))
+	})
+
+	test.Run("Should NOT read a missing file", func(test *testing.T) {
+		// Act
+		_, exception := NewPasswordPolicy(PasswordConfig{BreachedFile: filepath.Join(test.TempDir(), "missing.txt")})
+
+		// Assert
+		assert.ErrorIs(exception, os.ErrNotExist)
+	})
+}
+
+func TestNewNicknamePolicy(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should reserve the listed nicknames and compile the pattern", func(test *testing.T) {
+		// Act
+		nicknames, exception := NewNicknamePolicy(NicknameConfig{MinLength: 3, MaxLength: 8, Pattern: "^[a-z]+$", Reserved: " admin, Root ,"})
+
+		// Assert
+		require.Nil(exception)
+		assert.Len(nicknames.Reserved, 2)
+		assert.True(nicknames.Reserved.Contains("root"))
+		assert.Nil(nicknames.Check("andres"))
+		assert.NotNil(nicknames.Check("Admin"))
+	})
+
+	test.Run("Should allow any characters without pattern", func(test *testing.T) {
+		// Act
+		nicknames, exception := NewNicknamePolicy(NicknameConfig{})
+
+		// Assert
+		require.Nil(exception)
+		assert.Nil(nicknames.Pattern)
+		assert.Nil(nicknames.Check("# Andrés #"))
+	})
+}
@@ -0,0 +1,16 @@
+package configuration
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/problems"
+)
+
+// SetupProblems makes the engine respond with problem details to the failed
+// requests, including the ones to unknown routes or methods.
+func SetupProblems(engine *gin.Engine) {
+	engine.HandleMethodNotAllowed = true
+	engine.NoRoute(problems.Handler(problems.RouteNotFound))
+	engine.NoMethod(problems.Handler(problems.MethodNotAllowed))
+	engine.Use(middleware.Problems)
+}
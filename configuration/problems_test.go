@@ -0,0 +1,47 @@
+package configuration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zatarain/note-vook/problems"
+)
+
+func TestSetupProblems(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	testcases := []struct {
+		Method string
+		Path   string
+		Status int
+		Code   string
+	}{
+		{Method: http.MethodGet, Path: "/missing", Status: http.StatusNotFound, Code: `"code":"route_not_found"`},
+		{Method: http.MethodDelete, Path: "/videos", Status: http.StatusMethodNotAllowed, Code: `"code":"method_not_allowed"`},
+	}
+
+	for _, testcase := range testcases {
+		test.Run("Should respond problem details to "+testcase.Method+" "+testcase.Path, func(test *testing.T) {
+			// Arrange
+			engine := gin.New()
+			SetupProblems(engine)
+			engine.GET("/videos", func(context *gin.Context) {
+				context.Status(http.StatusOK)
+			})
+			request, _ := http.NewRequest(testcase.Method, testcase.Path, nil)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			engine.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Equal(problems.ContentType, recorder.Header().Get("Content-Type"))
+			assert.Contains(recorder.Body.String(), testcase.Code)
+		})
+	}
+}
@@ -1,38 +1,214 @@
 package configuration
 
 import (
-	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/backup"
 	"github.com/zatarain/note-vook/controllers"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/versioning"
+	"github.com/zatarain/note-vook/webhooks"
 )
 
-func Setup(server gin.IRouter) {
+const (
+	// APIVersionName is the prefix of the current version of the API routes.
+	APIVersionName string = "v1"
+
+	// WebhooksBatchSize is the maximum number of deliveries sent on each round
+	WebhooksBatchSize int = 100
+)
+
+// Services are the parts of the API working along with the end-points, which
+// have to be started or stopped with the server.
+type Services struct {
+	// Hub publishes the changes of the videos, it's closed on shutdown
+	Hub *events.Hub
+
+	// Webhooks delivers the events to the webhooks in the background
+	Webhooks *webhooks.Dispatcher
+
+	// Backups copies the database on schedule and on demand
+	Backups *backup.Manager
+
+	// Jobs performs the background jobs until the server shuts down
+	Jobs *jobs.Queue
+
+	// Administrator tells whether the request comes from the session of a user
+	// with the admin role, who may use the administration end-points
+	Administrator func(context *gin.Context) bool
+}
+
+// Setup routes the end-points of the API and returns the services they use.
+func Setup(server gin.IRouter, config *Config, database models.DataAccessInterface, loggers *logging.Factory) *Services {
+	hub := events.NewHub(config.Events.History)
+	hub.Retention = config.Events.Retention
+	dispatcher := &webhooks.Dispatcher{
+		Database:  database,
+		Client:    webhooks.NewClient(config.Webhooks.Timeout),
+		Logger:    loggers.Logger("webhooks"),
+		Backoff:   config.Webhooks.Backoff,
+		Attempts:  config.Webhooks.Attempts,
+		BatchSize: WebhooksBatchSize,
+		Workers:   config.Webhooks.Workers,
+	}
+	backups := NewBackupManager(config, database, loggers.Logger("backup"))
+	queue := NewJobQueue(config, database, dispatcher, backups, loggers.Logger("jobs"))
+
+	// The policies and the single sign-on were validated with the configuration
+	logger := loggers.Logger("users")
+	passwords, exception := NewPasswordPolicy(config.Password)
+	if exception != nil {
+		logger.Error("Failed to read the breached passwords", "error", exception)
+	}
+	nicknames, exception := NewNicknamePolicy(config.Nickname)
+	if exception != nil {
+		logger.Error("Failed to compile the nickname pattern", "error", exception)
+	}
+	sso, exception := NewSingleSignOn(config.OIDC)
+	if exception != nil {
+		logger.Error("Failed to read the roles of the identity provider", "error", exception)
+	}
+
 	users := &controllers.UsersController{
-		Database:       Database,
-		SecretTokenKey: os.Getenv("SECRET_TOKEN_KEY"),
+		Database:       database,
+		SecretTokenKey: config.Security.SecretTokenKey,
+		Logger:         logger,
+		Nicknames:      nicknames,
+		Passwords:      passwords,
+		Throttle: controllers.LoginThrottle{
+			MaxFailures: config.Login.MaxFailures,
+			Delay:       config.Login.Delay,
+			Lockout:     config.Login.Lockout,
+		},
+		TwoFactor: controllers.TwoFactorSettings{
+			Issuer:        config.TwoFactor.Issuer,
+			ChallengeTTL:  config.TwoFactor.ChallengeTTL,
+			RecoveryCodes: config.TwoFactor.RecoveryCodes,
+		},
+		SSO: sso,
+		Hub: hub,
 	}
 
 	videos := &controllers.VideosController{
-		Database: Database,
+		Database: database,
+		Hub:      hub,
+		Webhooks: dispatcher,
 	}
 
 	annotations := &controllers.AnnotationsController{
-		Database: Database,
+		Database: database,
+		Hub:      hub,
+		Webhooks: dispatcher,
+	}
+
+	hooks := &controllers.WebhooksController{
+		Database: database,
+		Webhooks: dispatcher,
 	}
 
+	streams := &controllers.EventsController{
+		Database:  database,
+		Hub:       hub,
+		Heartbeat: config.Events.Heartbeat,
+	}
+
+	imports := &controllers.ImportController{
+		Database: database,
+		Hub:      hub,
+		Webhooks: dispatcher,
+	}
+
+	exports := &controllers.ExportController{
+		Database: database,
+	}
+
+	health := &controllers.HealthController{
+		Database:         database,
+		Filename:         config.Database.Path(),
+		Models:           Models(),
+		MinimumFreeSpace: config.Database.MinimumFreeSpace,
+		Timeout:          config.Database.PingTimeout,
+		Started:          time.Now(),
+	}
+
+	// The retries of the POST requests with the same Idempotency-Key get the
+	// first response instead of repeating it
+	idempotent := middleware.Idempotency(database, config.Idempotency.TTL, config.Idempotency.MaximumBody)
+
+	// The requests are limited per client address, the ones of the logged
+	// users also per user and the logins and signups more strictly, as the
+	// password hashing is expensive
+	limited := middleware.RateLimit(
+		middleware.NewLimiter(config.RateLimit.Address, config.RateLimit.Period),
+		middleware.ClientAddress,
+	)
+	throttled := middleware.RateLimit(
+		middleware.NewLimiter(config.RateLimit.User, config.RateLimit.Period),
+		middleware.LoggedUser,
+	)
+	hashing := middleware.RateLimit(
+		middleware.NewLimiter(config.RateLimit.Login, config.RateLimit.Period),
+		middleware.ClientAddress,
+	)
+
 	server.HEAD("/health", controllers.HealthCheck)
-	server.POST("/signup", users.Signup)
-	server.POST("/login", users.Login)
+	server.GET("/livez", health.Livez)
+	server.GET("/readyz", health.Readyz)
+
+	v1 := versioning.New(APIVersionName)
+	v1.Use(limited)
+	v1.POST("/signup", hashing, idempotent, users.Signup)
+	v1.POST("/login", hashing, idempotent, users.Login)
+	v1.POST("/login/two-factor", hashing, idempotent, users.LoginTwoFactor)
+	v1.GET("/login/oidc", hashing, users.LoginSSO)
+	v1.GET("/login/oidc/callback", hashing, users.SSOCallback)
 
 	// Authorised end-points
-	server.GET("/videos", users.Authorise, videos.Index)
-	server.POST("/videos", users.Authorise, videos.Add)
-	server.GET("/videos/:id", users.Authorise, videos.View)
-	server.PATCH("/videos/:id", users.Authorise, videos.Edit)
-	server.DELETE("/videos/:id", users.Authorise, videos.Delete)
-
-	server.POST("/annotations", users.Authorise, annotations.Add)
-	server.PATCH("/annotations/:id", users.Authorise, annotations.Edit)
-	server.DELETE("/annotations/:id", users.Authorise, annotations.Delete)
+	v1.GET("/videos", users.Authorise, throttled, videos.Index)
+	v1.POST("/videos", users.Authorise, throttled, idempotent, videos.Add)
+	v1.GET("/videos/:id", users.Authorise, throttled, videos.View)
+	v1.PATCH("/videos/:id", users.Authorise, throttled, videos.Edit)
+	v1.DELETE("/videos/:id", users.Authorise, throttled, videos.Delete)
+
+	v1.POST("/annotations", users.Authorise, throttled, idempotent, annotations.Add)
+	v1.PATCH("/annotations/:id", users.Authorise, throttled, annotations.Edit)
+	v1.DELETE("/annotations/:id", users.Authorise, throttled, annotations.Delete)
+	v1.POST("/videos/:id/annotations/batch", users.Authorise, throttled, idempotent, annotations.Batch)
+	v1.GET("/videos/:id/events", users.Authorise, throttled, streams.Stream)
+
+	v1.POST("/import", users.Authorise, throttled, idempotent, imports.Import)
+	v1.GET("/export", users.Authorise, throttled, exports.Export)
+
+	v1.GET("/webhooks", users.Authorise, throttled, hooks.Index)
+	v1.POST("/webhooks", users.Authorise, throttled, idempotent, hooks.Add)
+	v1.GET("/webhooks/:id", users.Authorise, throttled, hooks.View)
+	v1.PATCH("/webhooks/:id", users.Authorise, throttled, hooks.Edit)
+	v1.DELETE("/webhooks/:id", users.Authorise, throttled, hooks.Delete)
+	v1.GET("/webhooks/:id/deliveries", users.Authorise, throttled, hooks.Deliveries)
+	v1.POST("/webhooks/:id/deliveries/:delivery/redeliver", users.Authorise, throttled, idempotent, hooks.Redeliver)
+
+	v1.GET("/me/export", users.Authorise, throttled, users.Export)
+	v1.POST("/me/password", users.Authorise, throttled, hashing, idempotent, users.ChangePassword)
+	v1.POST("/me/two-factor", users.Authorise, throttled, hashing, idempotent, users.EnrolTwoFactor)
+	v1.POST("/me/two-factor/confirm", users.Authorise, throttled, hashing, idempotent, users.ConfirmTwoFactor)
+	v1.POST("/me/two-factor/recovery-codes", users.Authorise, throttled, hashing, idempotent, users.RecoveryCodes)
+	v1.DELETE("/me/two-factor", users.Authorise, throttled, hashing, users.DisableTwoFactor)
+	v1.DELETE("/me", users.Authorise, throttled, hashing, users.Delete)
+
+	// The next versions are created with v1.Next("v2"), inheriting the routes
+	// and registering only the end-points whose contracts change
+	v1.Mount(server)
+
+	// Unversioned routes are kept for the existing clients until the sunset
+	v1.Alias(server, versioning.Deprecation{
+		Since:  config.Versioning.Deprecation,
+		Sunset: config.Versioning.Sunset,
+	})
+
+	return &Services{Hub: hub, Webhooks: dispatcher, Backups: backups, Jobs: queue, Administrator: users.Administrator}
 }
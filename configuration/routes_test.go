@@ -1,10 +1,14 @@
 package configuration
 
 import (
+	"io"
+	"log/slog"
 	"testing"
 
 	"github.com/stretchr/testify/mock"
+	"github.com/zatarain/note-vook/logging"
 	"github.com/zatarain/note-vook/mocks"
+	"golang.org/x/exp/slices"
 )
 
 func TestSetup(test *testing.T) {
@@ -13,23 +17,83 @@ func TestSetup(test *testing.T) {
 		server := new(mocks.MockedEngine)
 		endPointHandler := mock.AnythingOfType("gin.HandlerFunc")
 		authorisationHandler := mock.AnythingOfType("gin.HandlerFunc")
+		idempotencyHandler := mock.AnythingOfType("gin.HandlerFunc")
+		addressLimitHandler := mock.AnythingOfType("gin.HandlerFunc")
+		userLimitHandler := mock.AnythingOfType("gin.HandlerFunc")
+		loginLimitHandler := mock.AnythingOfType("gin.HandlerFunc")
 		server.On("HEAD", "/health", endPointHandler).Return(server)
-		server.On("POST", "/signup", endPointHandler).Return(server)
-		server.On("POST", "/login", endPointHandler).Return(server)
+		server.On("GET", "/livez", endPointHandler).Return(server)
+		server.On("GET", "/readyz", endPointHandler).Return(server)
+		deprecationHandler := mock.AnythingOfType("gin.HandlerFunc")
+		routes := []struct {
+			Method     string
+			Path       string
+			Authorised bool
+		}{
+			{"POST", "/signup", false},
+			{"POST", "/login", false},
+			{"POST", "/login/two-factor", false},
+			{"GET", "/login/oidc", false},
+			{"GET", "/login/oidc/callback", false},
 
-		// Authorised end-points
-		server.On("GET", "/videos", authorisationHandler, endPointHandler).Return(server)
-		server.On("POST", "/videos", authorisationHandler, endPointHandler).Return(server)
-		server.On("GET", "/videos/:id", authorisationHandler, endPointHandler).Return(server)
-		server.On("PATCH", "/videos/:id", authorisationHandler, endPointHandler).Return(server)
-		server.On("DELETE", "/videos/:id", authorisationHandler, endPointHandler).Return(server)
+			// Authorised end-points
+			{"GET", "/videos", true},
+			{"POST", "/videos", true},
+			{"GET", "/videos/:id", true},
+			{"PATCH", "/videos/:id", true},
+			{"DELETE", "/videos/:id", true},
 
-		server.On("POST", "/annotations", authorisationHandler, endPointHandler).Return(server)
-		server.On("PATCH", "/annotations/:id", authorisationHandler, endPointHandler).Return(server)
-		server.On("DELETE", "/annotations/:id", authorisationHandler, endPointHandler).Return(server)
+			{"POST", "/annotations", true},
+			{"PATCH", "/annotations/:id", true},
+			{"DELETE", "/annotations/:id", true},
+			{"POST", "/videos/:id/annotations/batch", true},
+			{"GET", "/videos/:id/events", true},
+
+			{"POST", "/import", true},
+			{"GET", "/export", true},
+
+			{"GET", "/webhooks", true},
+			{"POST", "/webhooks", true},
+			{"GET", "/webhooks/:id", true},
+			{"PATCH", "/webhooks/:id", true},
+			{"DELETE", "/webhooks/:id", true},
+			{"GET", "/webhooks/:id/deliveries", true},
+			{"POST", "/webhooks/:id/deliveries/:delivery/redeliver", true},
+
+			{"GET", "/me/export", true},
+			{"POST", "/me/password", true},
+			{"POST", "/me/two-factor", true},
+			{"POST", "/me/two-factor/confirm", true},
+			{"POST", "/me/two-factor/recovery-codes", true},
+			{"DELETE", "/me/two-factor", true},
+			{"DELETE", "/me", true},
+		}
+
+		// The authorised end-points checking the password are limited as logins
+		hashing := []string{"/me/password", "/me/two-factor", "/me/two-factor/confirm", "/me/two-factor/recovery-codes", "/me"}
+
+		for _, route := range routes {
+			handlers := []any{endPointHandler}
+			if route.Method == "POST" {
+				handlers = append([]any{idempotencyHandler}, handlers...)
+			}
+			if !route.Authorised || slices.Contains(hashing, route.Path) {
+				handlers = append([]any{loginLimitHandler}, handlers...)
+			}
+			if route.Authorised {
+				handlers = append([]any{authorisationHandler, userLimitHandler}, handlers...)
+			}
+			handlers = append([]any{addressLimitHandler}, handlers...)
+
+			versioned := append([]any{route.Method, "/v1" + route.Path}, handlers...)
+			server.On("Handle", versioned...).Return(server)
+
+			deprecated := append([]any{route.Method, route.Path, deprecationHandler}, handlers...)
+			server.On("Handle", deprecated...).Return(server)
+		}
 
 		// Act
-		Setup(server)
+		Setup(server, &Config{}, new(mocks.MockedDataAccessInterface), logging.New(io.Discard, logging.FormatJSON, slog.LevelInfo, nil))
 
 		// Assert
 		server.AssertExpectations(test)
@@ -0,0 +1,70 @@
+package configuration
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type Server struct {
+	*http.Server
+	Certificate     string
+	Key             string
+	ShutdownTimeout time.Duration
+	Logger          *slog.Logger
+}
+
+func NewServer(handler http.Handler, settings ServerConfig, logger *slog.Logger) *Server {
+	return &Server{
+		Logger: logger,
+		Server: &http.Server{
+			ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelError),
+			Addr:              ":" + settings.Port,
+			Handler:           handler,
+			ReadTimeout:       settings.ReadTimeout,
+			ReadHeaderTimeout: settings.ReadTimeout,
+			WriteTimeout:      settings.WriteTimeout,
+			IdleTimeout:       settings.IdleTimeout,
+		},
+		Certificate:     settings.Certificate,
+		Key:             settings.Key,
+		ShutdownTimeout: settings.ShutdownTimeout,
+	}
+}
+
+func (server *Server) listen() error {
+	if server.Certificate != "" || server.Key != "" {
+		server.Logger.Info("Listening with TLS", "address", server.Addr)
+		return server.ListenAndServeTLS(server.Certificate, server.Key)
+	}
+
+	server.Logger.Info("Listening", "address", server.Addr)
+	return server.ListenAndServe()
+}
+
+// Serve blocks until either the listener fails or the interruption context is
+// done. In the latter case, it stops accepting new requests and waits for the
+// in-flight ones to finish within the shutdown timeout.
+func (server *Server) Serve(interruption context.Context) error {
+	failure := make(chan error, 1)
+	go func() {
+		failure <- server.listen()
+	}()
+
+	select {
+	case exception := <-failure:
+		if errors.Is(exception, http.ErrServerClosed) {
+			return nil
+		}
+		return exception
+	case <-interruption.Done():
+	}
+
+	server.Logger.Info("Shutting down the server", "timeout", server.ShutdownTimeout)
+	deadline, cancel := context.WithTimeout(context.Background(), server.ShutdownTimeout)
+	defer cancel()
+
+	return server.Shutdown(deadline)
+}
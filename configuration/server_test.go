@@ -0,0 +1,120 @@
+package configuration
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewServer(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should setup timeouts, port and TLS files from settings", func(test *testing.T) {
+		// Arrange
+		handler := http.NewServeMux()
+		settings := ServerConfig{
+			Port:            "4321",
+			ReadTimeout:     3 * time.Second,
+			WriteTimeout:    4 * time.Second,
+			IdleTimeout:     5 * time.Second,
+			ShutdownTimeout: 6 * time.Second,
+			Certificate:     "certificate.pem",
+			Key:             "key.pem",
+		}
+
+		// Act
+		server := NewServer(handler, settings, slog.Default())
+
+		// Assert
+		assert.Equal(":4321", server.Addr)
+		assert.Equal(handler, server.Handler)
+		assert.Equal(3*time.Second, server.ReadTimeout)
+		assert.Equal(4*time.Second, server.WriteTimeout)
+		assert.Equal(5*time.Second, server.IdleTimeout)
+		assert.Equal(6*time.Second, server.ShutdownTimeout)
+		assert.Equal("certificate.pem", server.Certificate)
+		assert.Equal("key.pem", server.Key)
+	})
+}
+
+func TestServe(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should drain in-flight requests when interrupted", func(test *testing.T) {
+		// Arrange
+		listener, exception := net.Listen("tcp", "127.0.0.1:0")
+		require.Nil(exception)
+		address := listener.Addr().String()
+		listener.Close()
+
+		started := make(chan bool)
+		handler := http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			started <- true
+			time.Sleep(200 * time.Millisecond)
+			writer.WriteHeader(http.StatusOK)
+		})
+		server := NewServer(handler, ServerConfig{}, slog.Default())
+		server.Addr = address
+		server.ShutdownTimeout = 5 * time.Second
+		interruption, interrupt := context.WithCancel(context.Background())
+
+		served := make(chan error)
+		go func() {
+			served <- server.Serve(interruption)
+		}()
+
+		responded := make(chan int)
+		go func() {
+			for {
+				response, exception := http.Get("http://" + address)
+				if exception == nil {
+					response.Body.Close()
+					responded <- response.StatusCode
+					return
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+
+		// Act
+		<-started
+		interrupt()
+
+		// Assert
+		assert.Equal(http.StatusOK, <-responded)
+		assert.Nil(<-served)
+	})
+
+	test.Run("Should return error when the server fails to listen", func(test *testing.T) {
+		// Arrange
+		server := NewServer(http.NewServeMux(), ServerConfig{}, slog.Default())
+		server.Addr = "invalid-address"
+
+		// Act
+		exception := server.Serve(context.Background())
+
+		// Assert
+		assert.NotNil(exception)
+	})
+
+	test.Run("Should return error when TLS files are not found", func(test *testing.T) {
+		// Arrange
+		server := NewServer(http.NewServeMux(), ServerConfig{}, slog.Default())
+		server.Addr = "127.0.0.1:0"
+		server.Certificate = "missing-certificate.pem"
+		server.Key = "missing-key.pem"
+
+		// Act
+		exception := server.Serve(context.Background())
+
+		// Assert
+		assert.ErrorContains(exception, "missing-certificate.pem")
+	})
+}
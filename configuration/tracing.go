@@ -0,0 +1,119 @@
+package configuration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/middleware"
+	"github.com/zatarain/note-vook/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	tracing "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"gorm.io/gorm"
+)
+
+const (
+	ExporterOTLP   string = "otlp"
+	ExporterStdout string = "stdout"
+	ExporterFile   string = "file"
+)
+
+// Shutdown flushes the pending telemetry and releases its resources.
+type Shutdown func(context.Context) error
+
+func newExporter(settings TracingConfig) (tracing.SpanExporter, io.Closer, error) {
+	exporter := settings.Exporter
+	if exporter == "" {
+		// Fall back to the offline exporters when there is no collector
+		switch {
+		case settings.Endpoint != "":
+			exporter = ExporterOTLP
+		case settings.File != "":
+			exporter = ExporterFile
+		default:
+			exporter = ExporterStdout
+		}
+	}
+
+	switch exporter {
+	case ExporterOTLP:
+		options := []otlptracehttp.Option{}
+		if settings.Endpoint != "" {
+			endpoint, exception := url.Parse(settings.Endpoint)
+			if exception != nil {
+				return nil, nil, exception
+			}
+			options = append(options,
+				otlptracehttp.WithEndpoint(endpoint.Host),
+				otlptracehttp.WithURLPath(strings.TrimSuffix(endpoint.Path, "/")+"/v1/traces"),
+			)
+			if endpoint.Scheme == "http" {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+		}
+		client, exception := otlptracehttp.New(context.Background(), options...)
+		return client, nil, exception
+	case ExporterFile:
+		file, exception := os.OpenFile(settings.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if exception != nil {
+			return nil, nil, exception
+		}
+		client, exception := stdouttrace.New(stdouttrace.WithWriter(file))
+		return client, file, exception
+	case ExporterStdout:
+		client, exception := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		return client, nil, exception
+	}
+
+	return nil, nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+}
+
+// SetupTracing creates the OpenTelemetry tracer provider and propagator, then
+// it installs the middleware starting a span per request and the GORM plugin
+// starting a span per database operation.
+func SetupTracing(server gin.IRouter, config *Config, database *gorm.DB, logger *slog.Logger) (Shutdown, error) {
+	nothing := func(context.Context) error { return nil }
+	if !config.Tracing.Enabled {
+		return nothing, nil
+	}
+
+	exporter, file, exception := newExporter(config.Tracing)
+	if exception != nil {
+		return nothing, exception
+	}
+
+	provider := tracing.NewTracerProvider(
+		tracing.WithBatcher(exporter),
+		tracing.WithSampler(tracing.ParentBased(tracing.TraceIDRatioBased(config.Tracing.SampleRatio))),
+		tracing.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(config.Tracing.ServiceName),
+		)),
+	)
+	propagator := propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+
+	server.Use(middleware.Tracing(provider, propagator))
+	if exception := database.Use(&models.TracingPlugin{Provider: provider}); exception != nil {
+		logger.Warn("Failed to trace the database operations", "error", exception)
+	}
+
+	return func(context context.Context) error {
+		exception := provider.Shutdown(context)
+		if file != nil {
+			file.Close()
+		}
+		return exception
+	}, nil
+}
@@ -0,0 +1,116 @@
+package configuration
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSetupTracing(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	connect := func() *gorm.DB {
+		database, exception := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		require.Nil(exception)
+		return database
+	}
+
+	test.Run("Should export request and database spans to a file", func(test *testing.T) {
+		// Arrange
+		filename := filepath.Join(test.TempDir(), "traces.json")
+		config := &Config{Tracing: TracingConfig{
+			Enabled:     true,
+			File:        filename,
+			ServiceName: "note-vook-test",
+			SampleRatio: 1,
+		}}
+		engine := gin.New()
+		database := connect()
+
+		// Act
+		shutdown, exception := SetupTracing(engine, config, database, slog.Default())
+		require.Nil(exception)
+		engine.GET("/ping", func(context *gin.Context) {
+			database.WithContext(context.Request.Context()).Exec("SELECT 1")
+			context.Status(http.StatusOK)
+		})
+		request, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+		engine.ServeHTTP(httptest.NewRecorder(), request)
+		require.Nil(shutdown(context.Background()))
+
+		// Assert
+		content, exception := os.ReadFile(filename)
+		require.Nil(exception)
+		assert.Contains(string(content), `"Name":"GET /ping"`)
+		assert.Contains(string(content), `"Name":"gorm.raw"`)
+		assert.Contains(string(content), "note-vook-test")
+	})
+
+	test.Run("Should prefer the OTLP exporter when an endpoint is configured", func(test *testing.T) {
+		// Arrange
+		collected := make(chan string, 1)
+		collector := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			collected <- request.URL.Path
+			writer.WriteHeader(http.StatusOK)
+		}))
+		defer collector.Close()
+		config := &Config{Tracing: TracingConfig{
+			Enabled:     true,
+			Endpoint:    collector.URL,
+			ServiceName: "note-vook-test",
+			SampleRatio: 1,
+		}}
+		engine := gin.New()
+
+		// Act
+		shutdown, exception := SetupTracing(engine, config, connect(), slog.Default())
+		require.Nil(exception)
+		engine.GET("/ping", func(context *gin.Context) { context.Status(http.StatusOK) })
+		request, _ := http.NewRequest(http.MethodGet, "/ping", nil)
+		engine.ServeHTTP(httptest.NewRecorder(), request)
+		shutdown(context.Background())
+
+		// Assert
+		assert.Equal("/v1/traces", <-collected)
+	})
+
+	test.Run("Should do nothing when tracing is disabled", func(test *testing.T) {
+		// Arrange
+		engine := gin.New()
+
+		// Act
+		shutdown, exception := SetupTracing(engine, &Config{}, connect(), slog.Default())
+
+		// Assert
+		assert.Nil(exception)
+		assert.Nil(shutdown(context.Background()))
+		assert.Empty(engine.Handlers)
+	})
+
+	test.Run("Should fail when the exporter can't be created", func(test *testing.T) {
+		// Arrange
+		config := &Config{Tracing: TracingConfig{
+			Enabled:  true,
+			Exporter: ExporterFile,
+			File:     filepath.Join(test.TempDir(), "missing", "traces.json"),
+		}}
+
+		// Act
+		_, exception := SetupTracing(gin.New(), config, connect(), slog.Default())
+
+		// Assert
+		assert.NotNil(exception)
+	})
+}
@@ -0,0 +1,259 @@
+package controllers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"gorm.io/gorm"
+)
+
+const (
+	ExportContentType string = "application/zip"
+
+	// AccountExportBatchSize is the number of videos read at once by the
+	// export of the account
+	AccountExportBatchSize int = 100
+)
+
+// Profile is the user as exported, without the password hash.
+type Profile struct {
+	ID        uint      `json:"id"`
+	Nickname  string    `json:"nickname"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeleteAccountContract confirms the deletion with the password, which the
+// users without password leave out, and a two-factor code when the user has
+// two-factor authentication.
+type DeleteAccountContract struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type ChangePasswordContract struct {
+	Password    string `json:"password"`
+	Code        string `json:"code"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// Export sends a ZIP archive with all the data of the current user: the
+// profile, the videos along with their annotations and a WebVTT file with the
+// annotations of each video. The videos are read and written a batch at a
+// time, so the library is never loaded in memory as a whole.
+func (users *UsersController) Export(context *gin.Context) {
+	owner := &models.User{}
+	searching := Session(context, users.Database).First(owner, CurrentUser(context).ID).Error
+	if searching != nil {
+		problems.Abort(context, searching)
+		return
+	}
+
+	profile := Profile{
+		ID:        owner.ID,
+		Nickname:  owner.Nickname,
+		CreatedAt: owner.CreatedAt,
+		UpdatedAt: owner.UpdatedAt,
+	}
+	videos := func(each func(video *models.Video) error) error {
+		batch := []models.Video{}
+		return Session(context, users.Database).
+			Preload("Annotations").
+			Where("user_id = ?", owner.ID).
+			FindInBatches(&batch, AccountExportBatchSize, func(*gorm.DB, int) error {
+				for index := range batch {
+					if exception := each(&batch[index]); exception != nil {
+						return exception
+					}
+				}
+				return nil
+			}).Error
+	}
+
+	// The archive of a large library outlives the write timeout of the server
+	http.NewResponseController(context.Writer).SetWriteDeadline(time.Time{})
+	filename := fmt.Sprintf("notevook-%s-%s.zip", owner.Nickname, time.Now().UTC().Format("20060102"))
+	context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	context.Header("Content-Type", ExportContentType)
+	context.Status(http.StatusOK)
+
+	// The status is already sent, so a failure from now on can only be logged
+	// and the archive is left unfinished
+	count, exception := writeExport(context.Writer, &profile, videos)
+	if exception != nil {
+		context.Error(exception)
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User data exported", "user_id", owner.ID, "videos", count)
+}
+
+// writeExport writes the ZIP archive with the profile, the videos and their
+// subtitles, returning how many videos were written. The videos are gone
+// through twice, as their subtitles go on their own files after videos.json.
+func writeExport(writer io.Writer, profile *Profile, videos func(each func(video *models.Video) error) error) (int, error) {
+	archive := zip.NewWriter(writer)
+	if exception := writeJSON(archive, "profile.json", profile); exception != nil {
+		return 0, exception
+	}
+
+	// The array is written an item at a time, indented like a whole one
+	file, exception := archive.Create("videos.json")
+	if exception != nil {
+		return 0, exception
+	}
+	count := 0
+	exception = videos(func(video *models.Video) error {
+		encoded, exception := json.MarshalIndent(video, "  ", "  ")
+		if exception != nil {
+			return exception
+		}
+		separator := ",\n  "
+		if count == 0 {
+			separator = "[\n  "
+		}
+		count++
+		if _, exception := io.WriteString(file, separator); exception != nil {
+			return exception
+		}
+		_, exception = file.Write(encoded)
+		return exception
+	})
+	if exception != nil {
+		return count, exception
+	}
+	closing := "\n]\n"
+	if count == 0 {
+		closing = "[]\n"
+	}
+	if _, exception := io.WriteString(file, closing); exception != nil {
+		return count, exception
+	}
+
+	exception = videos(func(video *models.Video) error {
+		file, exception := archive.Create(fmt.Sprintf("subtitles/%d.vtt", video.ID))
+		if exception != nil {
+			return exception
+		}
+		return video.WriteWebVTT(file)
+	})
+	if exception != nil {
+		return count, exception
+	}
+	return count, archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, exception := archive.Create(name)
+	if exception != nil {
+		return exception
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// ChangePassword replaces the password of the current user, once the user
+// confirms the current one along with a two-factor code when enabled, and logs
+// out all the other sessions by revoking the tokens issued before. The current
+// session gets a new token.
+func (users *UsersController) ChangePassword(context *gin.Context) {
+	var input ChangePasswordContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	user := CurrentUser(context)
+	if !users.confirm(context, user, input.Password, "Wrong password to change it") {
+		return
+	}
+	if !users.confirmCode(context, user, input.Code, "Wrong two-factor code to change the password") {
+		return
+	}
+	if exception := users.Passwords.Check(input.NewPassword); exception != nil {
+		problems.Abort(context, violated(problems.WeakPassword, "new_password", exception))
+		return
+	}
+
+	credentials := Credentials{Password: input.NewPassword}
+	if exception := credentials.HashPassword(); exception != nil {
+		problems.Abort(context, fmt.Errorf("failed to create the hash for password: %w", exception))
+		return
+	}
+
+	changing := Session(context, users.Database).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{
+			"password":      credentials.Password,
+			"token_version": gorm.Expr("token_version + 1"),
+		}).Error
+	if changing != nil {
+		problems.Abort(context, changing)
+		return
+	}
+
+	// Reloading the user to sign the new token with the current version
+	changed := &models.User{}
+	if searching := Session(context, users.Database).First(changed, user.ID).Error; searching != nil {
+		problems.Abort(context, searching)
+		return
+	}
+	if exception := users.setToken(context, changed); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User changed the password", "user_id", user.ID)
+	context.JSON(http.StatusOK, &Message{Message: "Password successfully changed, the other sessions are logged out"})
+}
+
+// Delete removes the account of the current user along with all its videos
+// and their annotations, once the user confirms it with the password or by
+// logging in again with the identity provider, along with a two-factor code
+// when enabled.
+func (users *UsersController) Delete(context *gin.Context) {
+	var input DeleteAccountContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	user := CurrentUser(context)
+	if !users.confirm(context, user, input.Password, "Wrong password to delete the account") {
+		return
+	}
+	if !users.confirmCode(context, user, input.Code, "Wrong two-factor code to delete the account") {
+		return
+	}
+
+	var videos []uint
+	deleting := Session(context, users.Database).Transaction(func(transaction *gorm.DB) error {
+		if exception := transaction.Model(&models.Video{}).Where("user_id = ?", user.ID).Pluck("id", &videos).Error; exception != nil {
+			return exception
+		}
+		_, _, exception := user.Delete(transaction)
+		return exception
+	})
+	if deleting != nil {
+		problems.Abort(context, deleting)
+		return
+	}
+	for _, video := range videos {
+		users.Hub.Remove(video)
+	}
+
+	// The token is useless from now on, the browsers can forget it
+	users.logger().InfoContext(context.Request.Context(), "User deleted the account", "user_id", user.ID)
+	context.SetSameSite(http.SameSiteLaxMode)
+	context.SetCookie("Authorisation", "", -1, "", "", false, true)
+	context.JSON(http.StatusOK, &Message{Message: "Account successfully deleted"})
+}
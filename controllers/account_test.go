@@ -0,0 +1,480 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/policy"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAccount(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// seed creates a user with a video with two annotations and another user
+	// with a video, so we can check nothing of the latter is touched.
+	seed := func(test *testing.T) (*gorm.DB, *models.User) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "account.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.RecoveryCode{}, &models.IdempotencyKey{}, &models.Job{}))
+		hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		owner := &models.User{Nickname: "owner", Password: string(hash), Videos: []models.Video{{
+			Title:    "Dummy",
+			Link:     "https://dummy.io/video",
+			Duration: 120,
+			Annotations: []models.Annotation{
+				{Title: "Second", Start: 60, End: 90},
+				{Title: "First", Notes: "Notes", Start: 0, End: 30},
+			},
+		}}}
+		require.Nil(database.Create(owner).Error)
+		other := &models.User{Nickname: "other", Videos: []models.Video{{
+			Title:       "Other",
+			Link:        "https://dummy.io/video",
+			Duration:    60,
+			Annotations: []models.Annotation{{Title: "Other", Start: 0, End: 10}},
+		}}}
+		require.Nil(database.Create(other).Error)
+		for _, user := range []*models.User{owner, other} {
+			webhook := models.Webhook{UserID: user.ID, URL: "https://ci.io/hook", Events: []string{"video.created"}, Active: true}
+			require.Nil(database.Create(&webhook).Error)
+			require.Nil(database.Create(&models.WebhookDelivery{WebhookID: webhook.ID, Status: models.DeliveryPending}).Error)
+			require.Nil(database.Create(&models.IdempotencyKey{UserID: user.ID, Key: "key", Body: []byte(`{"secret":true}`)}).Error)
+			require.Nil(database.Create(&models.Job{UserID: user.ID, Kind: "webhooks.deliver", Status: models.JobPending}).Error)
+		}
+		return database, owner
+	}
+
+	perform := func(database *gorm.DB, user *models.User, method string, path string, body string) *httptest.ResponseRecorder {
+		users := &UsersController{Database: database}
+		server := gin.New()
+		authorise := func(context *gin.Context) { context.Set("user", user) }
+		server.GET("/me/export", authorise, users.Export)
+		server.DELETE("/me", authorise, users.Delete)
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	count := func(database *gorm.DB, model interface{}) int64 {
+		var total int64
+		database.Model(model).Count(&total)
+		return total
+	}
+
+	test.Run("Should export the profile, the videos and their subtitles", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+
+		// Act
+		recorder := perform(database, owner, http.MethodGet, "/me/export", "")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(ExportContentType, recorder.Header().Get("Content-Type"))
+		assert.Regexp(`^attachment; filename="notevook-owner-\d{8}\.zip"$`, recorder.Header().Get("Content-Disposition"))
+		archive, exception := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+		require.Nil(exception)
+		files := map[string]string{}
+		for _, file := range archive.File {
+			reader, _ := file.Open()
+			content, _ := io.ReadAll(reader)
+			files[file.Name] = string(content)
+		}
+
+		video := owner.Videos[0]
+		assert.Len(files, 3)
+		assert.NotContains(files["profile.json"], "password")
+		assert.NotContains(files["profile.json"], owner.Password)
+		profile := Profile{}
+		require.Nil(json.Unmarshal([]byte(files["profile.json"]), &profile))
+		assert.Equal("owner", profile.Nickname)
+		videos := []models.Video{}
+		require.Nil(json.Unmarshal([]byte(files["videos.json"]), &videos))
+		require.Len(videos, 1)
+		assert.Equal(video.Link, videos[0].Link)
+		assert.Len(videos[0].Annotations, 2)
+		subtitles := files[fmt.Sprintf("subtitles/%d.vtt", video.ID)]
+		assert.True(strings.HasPrefix(subtitles, "WEBVTT Dummy\n"))
+		assert.Less(strings.Index(subtitles, "First"), strings.Index(subtitles, "Second"))
+	})
+
+	test.Run("Should export an empty list when there are no videos", func(test *testing.T) {
+		// Arrange
+		database, _ := seed(test)
+		lonely := &models.User{Nickname: "lonely"}
+		require.Nil(database.Create(lonely).Error)
+
+		// Act
+		recorder := perform(database, lonely, http.MethodGet, "/me/export", "")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		archive, exception := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+		require.Nil(exception)
+		require.Len(archive.File, 2)
+		reader, _ := archive.File[1].Open()
+		content, _ := io.ReadAll(reader)
+		assert.Equal("[]\n", string(content))
+	})
+
+	test.Run("Should export the videos of several batches like a whole array", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+		for index := 1; index <= AccountExportBatchSize; index++ {
+			video := models.Video{UserID: owner.ID, Title: fmt.Sprintf("Video %d", index), Link: fmt.Sprintf("https://dummy.io/%d", index), Duration: 60}
+			require.Nil(database.Create(&video).Error)
+		}
+
+		// Act
+		recorder := perform(database, owner, http.MethodGet, "/me/export", "")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		archive, exception := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+		require.Nil(exception)
+		assert.Len(archive.File, AccountExportBatchSize+3)
+		reader, _ := archive.File[1].Open()
+		content, _ := io.ReadAll(reader)
+		videos := []models.Video{}
+		require.Nil(json.Unmarshal(content, &videos))
+		require.Len(videos, AccountExportBatchSize+1)
+		expected, _ := json.MarshalIndent(videos, "", "  ")
+		assert.Equal(string(expected)+"\n", string(content))
+		assert.Len(videos[0].Annotations, 2)
+	})
+
+	test.Run("Should delete the account with its videos, annotations, webhooks, idempotency keys and jobs", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+
+		// Act
+		recorder := perform(database, owner, http.MethodDelete, "/me", `{"password":"secret"}`)
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Contains(recorder.Body.String(), "Account successfully deleted")
+		assert.Contains(recorder.Header().Get("Set-Cookie"), "Authorisation=;")
+		assert.Equal(int64(1), count(database, &models.User{}))
+		assert.Equal(int64(1), count(database, &models.Video{}))
+		assert.Equal(int64(1), count(database, &models.Annotation{}))
+		assert.Equal(int64(1), count(database, &models.Webhook{}))
+		assert.Equal(int64(1), count(database, &models.WebhookDelivery{}))
+		assert.Equal(int64(1), count(database, &models.IdempotencyKey{}))
+		assert.Equal(int64(1), count(database, &models.Job{}))
+	})
+
+	test.Run("Should NOT accept the tokens of the deleted account for a new user with the same nickname", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+		users := &UsersController{Database: database, SecretTokenKey: "secret-token-key"}
+		token, exception := users.NewToken(owner)
+		require.Nil(exception)
+		require.Equal(http.StatusOK, perform(database, owner, http.MethodDelete, "/me", `{"password":"secret"}`).Code)
+		require.Nil(database.Create(&models.User{Nickname: owner.Nickname}).Error)
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodGet, "/videos", nil)
+		context.Request.AddCookie(&http.Cookie{Name: "Authorisation", Value: token})
+
+		// Act
+		user, exception := users.ValidateToken(context)
+
+		// Assert
+		assert.Nil(user)
+		assert.ErrorContains(exception, "user not found")
+	})
+
+	test.Run("Should end the event streams of the deleted videos", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+		var videos []uint
+		require.Nil(database.Model(&models.Video{}).Where("user_id = ?", owner.ID).Pluck("id", &videos).Error)
+		require.NotEmpty(videos)
+		hub := events.NewHub(10)
+		owned := hub.Subscribe(videos[0], 0)
+		other := hub.Subscribe(videos[len(videos)-1]+100, 0)
+		users := &UsersController{Database: database, Hub: hub}
+		server := gin.New()
+		server.DELETE("/me", func(context *gin.Context) { context.Set("user", owner) }, users.Delete)
+		request, _ := http.NewRequest(http.MethodDelete, "/me", strings.NewReader(`{"password":"secret"}`))
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		_, open := <-owned.Events
+		assert.False(open)
+		select {
+		case <-other.Events:
+			assert.Fail("The streams of the other videos should go on")
+		default:
+		}
+		other.Close()
+	})
+
+	testcases := []struct {
+		Description string
+		Body        string
+		Status      int
+		Code        string
+	}{
+		{"Should NOT delete the account with a wrong password", `{"password":"guess"}`, http.StatusForbidden, "password_mismatch"},
+		{"Should NOT delete the account without password", `{}`, http.StatusBadRequest, "validation_failed"},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner := seed(test)
+
+			// Act
+			recorder := perform(database, owner, http.MethodDelete, "/me", testcase.Body)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			assert.Equal(int64(2), count(database, &models.User{}))
+			assert.Equal(int64(3), count(database, &models.Annotation{}))
+		})
+	}
+
+	confirmations := []struct {
+		Description     string
+		Reauthenticated time.Duration
+		Status          int
+		Code            string
+		Users           int64
+	}{
+		{"Should delete the account without password after logging in again with the provider", -time.Minute, http.StatusOK, "Account successfully deleted", 1},
+		{"Should NOT delete the account without password when the provider login is too old", -time.Hour, http.StatusForbidden, "reauthentication_required", 2},
+		{"Should NOT delete the account without password without logging in again", 0, http.StatusForbidden, "reauthentication_required", 2},
+	}
+
+	for _, testcase := range confirmations {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, _ := seed(test)
+			other := &models.User{}
+			require.Nil(database.First(other, "nickname = ?", "other").Error)
+			if testcase.Reauthenticated != 0 {
+				reauthenticated := time.Now().Add(testcase.Reauthenticated)
+				require.Nil(database.Model(other).Update("reauthenticated_at", reauthenticated).Error)
+			}
+
+			// Act
+			recorder := perform(database, other, http.MethodDelete, "/me", `{}`)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			assert.Equal(testcase.Users, count(database, &models.User{}))
+		})
+	}
+
+	test.Run("Should use up the confirmation of the provider login", func(test *testing.T) {
+		// Arrange
+		database, _ := seed(test)
+		other := &models.User{}
+		require.Nil(database.First(other, "nickname = ?", "other").Error)
+		require.Nil(database.Model(other).Update("reauthenticated_at", time.Now()).Error)
+		users := &UsersController{Database: database}
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodDelete, "/me", nil)
+
+		// Act
+		first := users.confirm(context, other, "", "Wrong password")
+		second := users.confirm(context, other, "", "Wrong password")
+
+		// Assert
+		assert.True(first)
+		assert.False(second)
+	})
+}
+
+func TestChangePassword(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	seed := func(test *testing.T) (*gorm.DB, *models.User) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "password.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}))
+		hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+		owner := &models.User{Nickname: "owner", Password: string(hash)}
+		require.Nil(database.Create(owner).Error)
+		return database, owner
+	}
+
+	controller := func(database *gorm.DB) *UsersController {
+		return &UsersController{
+			Database:       database,
+			SecretTokenKey: "secret-token-key",
+			Passwords:      policy.Password{MinLength: 10, MinClasses: 3, Breached: policy.NewList("Password123!")},
+		}
+	}
+
+	perform := func(database *gorm.DB, user *models.User, body string) *httptest.ResponseRecorder {
+		users := controller(database)
+		server := gin.New()
+		server.POST("/me/password", func(context *gin.Context) { context.Set("user", user) }, users.ChangePassword)
+		request, _ := http.NewRequest(http.MethodPost, "/me/password", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	validate := func(database *gorm.DB, token string) error {
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodGet, "/videos", nil)
+		context.Request.AddCookie(&http.Cookie{Name: "Authorisation", Value: token})
+		_, exception := controller(database).ValidateToken(context)
+		return exception
+	}
+
+	test.Run("Should change the password and revoke the previous tokens", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+		previous, exception := controller(database).NewToken(owner)
+		require.Nil(exception)
+		require.Nil(validate(database, previous))
+
+		// Act
+		recorder := perform(database, owner, `{"password":"secret","new_password":"Sunset-Drive-1986"}`)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Contains(recorder.Body.String(), "Password successfully changed")
+		changed := models.User{}
+		require.Nil(database.First(&changed, owner.ID).Error)
+		assert.Nil(bcrypt.CompareHashAndPassword([]byte(changed.Password), []byte("Sunset-Drive-1986")))
+		assert.Equal(uint(1), changed.TokenVersion)
+		assert.ErrorContains(validate(database, previous), "revoked token")
+		cookies := recorder.Result().Cookies()
+		require.Len(cookies, 1)
+		assert.Nil(validate(database, cookies[0].Value))
+	})
+
+	testcases := []struct {
+		Description string
+		Body        string
+		Status      int
+		Code        string
+		Rule        string
+	}{
+		{"Should NOT change the password with a wrong current one", `{"password":"guess","new_password":"Sunset-Drive-1986"}`, http.StatusForbidden, "password_mismatch", ""},
+		{"Should NOT change the password without the new one", `{"password":"secret"}`, http.StatusBadRequest, "validation_failed", ""},
+		{"Should NOT change the password to a short one", `{"password":"secret","new_password":"Sun-1986"}`, http.StatusBadRequest, "weak_password", `"rule":"min_length"`},
+		{"Should NOT change the password to one with too few classes", `{"password":"secret","new_password":"sunset-drive"}`, http.StatusBadRequest, "weak_password", `"rule":"character_classes"`},
+		{"Should NOT change the password to a breached one", `{"password":"secret","new_password":"password123!"}`, http.StatusBadRequest, "weak_password", `"rule":"breached"`},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner := seed(test)
+
+			// Act
+			recorder := perform(database, owner, testcase.Body)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			assert.Contains(recorder.Body.String(), testcase.Rule)
+			assert.Empty(recorder.Result().Cookies())
+			unchanged := models.User{}
+			require.Nil(database.First(&unchanged, owner.ID).Error)
+			assert.Equal(owner.Password, unchanged.Password)
+			assert.Zero(unchanged.TokenVersion)
+		})
+	}
+}
+
+func TestAccountTwoFactor(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	perform := func(database *gorm.DB, user *models.User, method string, path string, body string) *httptest.ResponseRecorder {
+		users := &UsersController{
+			Database:       database,
+			SecretTokenKey: "secret-token-key",
+			Throttle:       LoginThrottle{MaxFailures: 3, Delay: time.Minute, Lockout: time.Hour},
+		}
+		server := gin.New()
+		authorise := func(context *gin.Context) { context.Set("user", user) }
+		server.POST("/me/password", authorise, users.ChangePassword)
+		server.DELETE("/me", authorise, users.Delete)
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	testcases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Body        string
+		Code        string
+		Status      int
+		Contains    string
+		Failures    int
+		Users       int64
+	}{
+		{"Should change the password with a two-factor code", http.MethodPost, "/me/password", `{"password":"secret","new_password":"Sunset-Drive-1986","code":%q}`, "current", http.StatusOK, "Password successfully changed", 0, 1},
+		{"Should NOT change the password without a two-factor code", http.MethodPost, "/me/password", `{"password":"secret","new_password":"Sunset-Drive-1986","code":%q}`, "", http.StatusBadRequest, `"code":"validation_failed"`, 0, 1},
+		{"Should NOT change the password with a wrong two-factor code", http.MethodPost, "/me/password", `{"password":"secret","new_password":"Sunset-Drive-1986","code":%q}`, "000000", http.StatusUnauthorized, `"code":"invalid_two_factor_code"`, 1, 1},
+		{"Should delete the account with a two-factor code", http.MethodDelete, "/me", `{"password":"secret","code":%q}`, "current", http.StatusOK, "Account successfully deleted", 0, 0},
+		{"Should NOT delete the account without a two-factor code", http.MethodDelete, "/me", `{"password":"secret","code":%q}`, "", http.StatusBadRequest, `"code":"validation_failed"`, 0, 1},
+		{"Should NOT delete the account with a wrong two-factor code", http.MethodDelete, "/me", `{"password":"secret","code":%q}`, "000000", http.StatusUnauthorized, `"code":"invalid_two_factor_code"`, 1, 1},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, user := twoFactorSeed(test, true)
+			require.Nil(database.AutoMigrate(&models.Video{}, &models.Annotation{}, &models.Webhook{}, &models.WebhookDelivery{}, &models.IdempotencyKey{}, &models.Job{}))
+			code := testcase.Code
+			if code == "current" {
+				code = currentCode(test, user)
+			}
+
+			// Act
+			recorder := perform(database, user, testcase.Method, testcase.Path, fmt.Sprintf(testcase.Body, code))
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code, recorder.Body.String())
+			assert.Contains(recorder.Body.String(), testcase.Contains)
+			var total int64
+			require.Nil(database.Model(&models.User{}).Count(&total).Error)
+			assert.Equal(testcase.Users, total)
+			if total > 0 {
+				current := &models.User{}
+				require.Nil(database.First(current, user.ID).Error)
+				assert.Equal(testcase.Failures, current.FailedLogins)
+			}
+		})
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/events"
 	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/webhooks"
 )
 
 type AnnotationsController struct {
 	Database models.DataAccessInterface
+	Hub      *events.Hub
+	Webhooks *webhooks.Dispatcher
 }
 
 type AddAnnotationContract struct {
@@ -31,12 +36,9 @@ type EditAnnotationContract struct {
 
 func (annotations *AnnotationsController) findVideo(context *gin.Context, video *models.Video, id uint) bool {
 	user := CurrentUser(context)
-	searching := annotations.Database.First(video, "id = ? AND user_id = ?", id, user.ID).Error
+	searching := Session(context, annotations.Database).First(video, "id = ? AND user_id = ?", id, user.ID).Error
 	if searching != nil {
-		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-			"error":  "Video not found",
-			"reason": searching.Error(),
-		})
+		problems.Abort(context, notFound(problems.VideoNotFound, searching))
 		return false
 	}
 	return true
@@ -46,13 +48,10 @@ func (annotations *AnnotationsController) search(context *gin.Context, annotatio
 	user := CurrentUser(context)
 	id := context.Param("id")
 
-	searching := annotations.Database.
+	searching := Session(context, annotations.Database).
 		Joins("Video").First(annotation, "annotations.id = ? AND user_id = ?", id, user.ID).Error
 	if searching != nil {
-		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-			"error":  "Annotation not found",
-			"reason": searching.Error(),
-		})
+		problems.Abort(context, notFound(problems.AnnotationNotFound, searching))
 		return false
 	}
 	return true
@@ -62,17 +61,25 @@ func isInRange(timestamp models.TimeStamp, duration models.TimeStamp) bool {
 	return timestamp >= 0 && timestamp <= duration
 }
 
+// ValidateInterval tells whether the start and end are within the duration of
+// the video.
+func ValidateInterval(start models.TimeStamp, end models.TimeStamp, duration models.TimeStamp) error {
+	if !isInRange(start, duration) || !isInRange(end, duration) {
+		return problems.InvalidInterval.WithDetail(
+			"start and end must be positive and less or equal than video duration",
+		)
+	}
+	return nil
+}
+
 func (annotations *AnnotationsController) CheckInterval(
 	context *gin.Context,
 	start models.TimeStamp,
 	end models.TimeStamp,
 	duration models.TimeStamp,
 ) bool {
-	if !isInRange(start, duration) || !isInRange(end, duration) {
-		context.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-			"error":  "Invalid time interval",
-			"reason": "start and end must be positive and less or equal than video duration",
-		})
+	if exception := ValidateInterval(start, end, duration); exception != nil {
+		problems.Abort(context, exception)
 		return false
 	}
 	return true
@@ -83,10 +90,7 @@ func (annotations *AnnotationsController) Add(context *gin.Context) {
 	var input AddAnnotationContract
 
 	if binding := context.ShouldBindJSON(&input); binding != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to read input",
-			"reason": binding.Error(),
-		})
+		problems.Abort(context, problems.Input(binding))
 		return
 	}
 
@@ -110,14 +114,17 @@ func (annotations *AnnotationsController) Add(context *gin.Context) {
 		Start:   input.Start,
 		End:     input.End,
 	}
-	inserting := annotations.Database.Create(&annotation).Error
+	inserting := notified(context, annotations.Webhooks, annotations.Database, events.AnnotationCreated,
+		func(database models.DataAccessInterface) (interface{}, error) {
+			exception := database.Create(&annotation).Error
+			return detached(annotation), exception
+		},
+	)
 	if inserting != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to save the annotation",
-			"reason": inserting.Error(),
-		})
+		problems.Abort(context, inserting)
 		return
 	}
+	annotations.publish(context, events.AnnotationCreated, annotation)
 
 	// Send status created with the new annotation
 	context.JSON(http.StatusCreated, &annotation)
@@ -127,10 +134,7 @@ func (annotations *AnnotationsController) Edit(context *gin.Context) {
 	// Try to bind the input from JSON
 	var input EditAnnotationContract
 	if binding := context.ShouldBindJSON(&input); binding != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to read input",
-			"reason": binding.Error(),
-		})
+		problems.Abort(context, problems.Input(binding))
 		return
 	}
 
@@ -146,14 +150,17 @@ func (annotations *AnnotationsController) Edit(context *gin.Context) {
 	}
 
 	annotation.UpdatedAt = time.Now()
-	saving := annotations.Database.Model(&annotation).Updates(input).Error
+	saving := notified(context, annotations.Webhooks, annotations.Database, events.AnnotationUpdated,
+		func(database models.DataAccessInterface) (interface{}, error) {
+			exception := database.Model(&annotation).Updates(input).Error
+			return detached(annotation), exception
+		},
+	)
 	if saving != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to save the annotation",
-			"reason": saving.Error(),
-		})
+		problems.Abort(context, saving)
 		return
 	}
+	annotations.publish(context, events.AnnotationUpdated, annotation)
 
 	// Send success status with new values
 	context.JSON(http.StatusOK, &annotation)
@@ -167,17 +174,17 @@ func (annotations *AnnotationsController) Delete(context *gin.Context) {
 	}
 
 	// Try to delete the annotation from database
-	deleting := annotations.Database.Delete(&annotation).Error
+	deleting := notified(context, annotations.Webhooks, annotations.Database, events.AnnotationDeleted,
+		func(database models.DataAccessInterface) (interface{}, error) {
+			return detached(annotation), database.Delete(&annotation).Error
+		},
+	)
 	if deleting != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to delete the annotation",
-			"reason": deleting.Error(),
-		})
+		problems.Abort(context, deleting)
 		return
 	}
+	annotations.publish(context, events.AnnotationDeleted, annotation)
 
 	// Send success message
-	context.JSON(http.StatusOK, gin.H{
-		"message": "Annotation successfully deleted",
-	})
+	context.JSON(http.StatusOK, &Message{Message: "Annotation successfully deleted"})
 }
@@ -175,7 +175,7 @@ func TestAnnotationsAdd(test *testing.T) {
 				"start":    7*60 + 20,
 				"end":      "07:30",
 			},
-			Expected: "Field validation for 'Title' failed on the 'required' tag",
+			Expected: `{"field":"title","rule":"required","message":"is required"}`,
 		},
 		{
 			Input: gin.H{
@@ -227,7 +227,7 @@ func TestAnnotationsAdd(test *testing.T) {
 				"start":    "01:25",
 				"end":      "01:10",
 			},
-			Expected: "Field validation for 'Start' failed on the 'ltefield' tag",
+			Expected: `{"field":"start","rule":"ltefield","message":"must be less than or equal to end"}`,
 		},
 	}
 
@@ -261,7 +261,7 @@ func TestAnnotationsAdd(test *testing.T) {
 		annotations := &AnnotationsController{Database: database}
 		database.
 			On("First", mock.AnythingOfType("*models.Video"), "id = ? AND user_id = ?", video.ID, current.ID).
-			Return(&gorm.DB{Error: errors.New("invalid video_id")}).Run(
+			Return(&gorm.DB{Error: gorm.ErrRecordNotFound}).Run(
 			func(arguments mock.Arguments) {
 				result := arguments.Get(0).(*models.Video)
 				*result = video
@@ -285,7 +285,7 @@ func TestAnnotationsAdd(test *testing.T) {
 		// Assert
 		assert.Equal(http.StatusNotFound, recorder.Code)
 		assert.Contains(recorder.Body.String(), "Video not found")
-		assert.Contains(recorder.Body.String(), "invalid video_id")
+		assert.Contains(recorder.Body.String(), `"code":"video_not_found"`)
 		database.AssertExpectations(test)
 	})
 
@@ -346,6 +346,7 @@ func TestAnnotationsAdd(test *testing.T) {
 			// Assert
 			assert.Equal(http.StatusBadRequest, recorder.Code)
 			assert.Contains(recorder.Body.String(), "Invalid time interval")
+			assert.Contains(recorder.Body.String(), `"code":"invalid_interval"`)
 			assert.Contains(recorder.Body.String(), "start and end must be positive and less or equal than video duration")
 			database.AssertExpectations(test)
 		})
@@ -385,9 +386,9 @@ func TestAnnotationsAdd(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Failed to save the annotation")
-		assert.Contains(recorder.Body.String(), "database insertion error")
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"internal_error"`)
+		assert.NotContains(recorder.Body.String(), "database insertion error")
 		database.AssertExpectations(test)
 	})
 }
@@ -560,7 +561,7 @@ func TestAnnotationsEdit(test *testing.T) {
 				"start": "01:25",
 				"end":   "01:10",
 			},
-			Expected: "Field validation for 'Start' failed on the 'ltefield' tag",
+			Expected: `{"field":"start","rule":"ltefield","message":"must be less than or equal to end"}`,
 		},
 	}
 
@@ -655,6 +656,7 @@ func TestAnnotationsEdit(test *testing.T) {
 			// Assert
 			assert.Equal(http.StatusBadRequest, recorder.Code)
 			assert.Contains(recorder.Body.String(), "Invalid time interval")
+			assert.Contains(recorder.Body.String(), `"code":"invalid_interval"`)
 			assert.Contains(recorder.Body.String(), "start and end must be positive and less or equal than video duration")
 			database.AssertExpectations(test)
 		})
@@ -723,9 +725,9 @@ func TestAnnotationsEdit(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Failed to save the annotation")
-		assert.Contains(recorder.Body.String(), "unable to update annotations table")
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"internal_error"`)
+		assert.NotContains(recorder.Body.String(), "unable to update annotations table")
 
 		assert.Equal("*models.Annotation", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
@@ -761,7 +763,7 @@ func TestAnnotationsEdit(test *testing.T) {
 			func(DB *gorm.DB, value interface{}, conditions ...interface{}) *gorm.DB {
 				arguments.ValueType = reflect.TypeOf(value).String()
 				arguments.Conditions = conditions
-				return &gorm.DB{Error: errors.New("no results")}
+				return &gorm.DB{Error: gorm.ErrRecordNotFound}
 			},
 		)
 		defer monkey.UnpatchAll()
@@ -783,6 +785,7 @@ func TestAnnotationsEdit(test *testing.T) {
 		// Assert
 		assert.Equal(http.StatusNotFound, recorder.Code)
 		assert.Contains(recorder.Body.String(), "Annotation not found")
+		assert.Contains(recorder.Body.String(), `"code":"annotation_not_found"`)
 
 		assert.Equal("*models.Annotation", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
@@ -877,7 +880,7 @@ func TestAnnotationsDelete(test *testing.T) {
 			func(DB *gorm.DB, value interface{}, conditions ...interface{}) *gorm.DB {
 				arguments.ValueType = reflect.TypeOf(value).String()
 				arguments.Conditions = conditions
-				return &gorm.DB{Error: errors.New("no results")}
+				return &gorm.DB{Error: gorm.ErrRecordNotFound}
 			},
 		)
 		defer monkey.UnpatchAll()
@@ -892,6 +895,7 @@ func TestAnnotationsDelete(test *testing.T) {
 		// Assert
 		assert.Equal(http.StatusNotFound, recorder.Code)
 		assert.Contains(recorder.Body.String(), "Annotation not found")
+		assert.Contains(recorder.Body.String(), `"code":"annotation_not_found"`)
 
 		assert.Equal("*models.Annotation", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
@@ -901,7 +905,7 @@ func TestAnnotationsDelete(test *testing.T) {
 		database.AssertExpectations(test)
 	})
 
-	test.Run("Should response with HTTP 400 when the database returns an error", func(test *testing.T) {
+	test.Run("Should response with HTTP 500 without the database error when it fails", func(test *testing.T) {
 		// Arrange
 		server := gin.New()
 		database := new(mocks.MockedDataAccessInterface)
@@ -937,9 +941,9 @@ func TestAnnotationsDelete(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Failed to delete the annotation")
-		assert.Contains(recorder.Body.String(), "unable to delete")
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"internal_error"`)
+		assert.NotContains(recorder.Body.String(), "unable to delete")
 
 		assert.Equal("*models.Annotation", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/problems"
+)
+
+type BackupsController struct {
+	Manager *backup.Manager
+}
+
+// Index lists the backups within the backups directory, the newest first.
+func (backups *BackupsController) Index(context *gin.Context) {
+	recordset, exception := backups.Manager.List()
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	context.JSON(http.StatusOK, recordset)
+}
+
+// Create backs up the database while it's still being used. The backup is
+// compressed as configured unless the compress query parameter says otherwise.
+func (backups *BackupsController) Create(context *gin.Context) {
+	compress := backups.Manager.Compress
+	if value, given := context.GetQuery("compress"); given {
+		parsed, exception := strconv.ParseBool(value)
+		if exception != nil {
+			problems.Abort(context, problems.InvalidInput.Wrap(exception).WithDetail("compress must be a boolean"))
+			return
+		}
+		compress = parsed
+	}
+
+	created, exception := backups.Manager.Create(context.Request.Context(), compress)
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	context.JSON(http.StatusCreated, created)
+}
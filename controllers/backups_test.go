@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/backup"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBackups(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	directory := test.TempDir()
+	database, exception := gorm.Open(sqlite.Open(filepath.Join(directory, "live.db")), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}))
+	backups := &BackupsController{Manager: &backup.Manager{
+		Database:  database,
+		Directory: filepath.Join(directory, "backups"),
+		Compress:  true,
+		Keep:      5,
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}}
+	server := gin.New()
+	server.GET("/backups", backups.Index)
+	server.POST("/backups", backups.Create)
+	perform := func(method string, path string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, path, nil)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should list no backups before creating any", func(test *testing.T) {
+		// Act
+		recorder := perform(http.MethodGet, "/backups")
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.JSONEq("[]", recorder.Body.String())
+	})
+
+	testcases := []struct {
+		Description string
+		Path        string
+		Compressed  bool
+	}{
+		{"Should compress the backup as configured", "/backups", true},
+		{"Should not compress the backup when asked to", "/backups?compress=false", false},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			recorder := perform(http.MethodPost, testcase.Path)
+
+			// Assert
+			var created backup.Backup
+			json.Unmarshal(recorder.Body.Bytes(), &created)
+			assert.Equal(http.StatusCreated, recorder.Code)
+			assert.Equal(testcase.Compressed, created.Compressed)
+			assert.Positive(created.Size)
+		})
+	}
+
+	test.Run("Should reject an invalid compress value", func(test *testing.T) {
+		// Act
+		recorder := perform(http.MethodPost, "/backups?compress=maybe")
+
+		// Assert
+		assert.Equal(http.StatusBadRequest, recorder.Code)
+		assert.Contains(recorder.Body.String(), "compress must be a boolean")
+	})
+
+	test.Run("Should list the backups created, the newest first", func(test *testing.T) {
+		// Act
+		recorder := perform(http.MethodGet, "/backups")
+
+		// Assert
+		var listed []backup.Backup
+		json.Unmarshal(recorder.Body.Bytes(), &listed)
+		assert.Equal(http.StatusOK, recorder.Code)
+		require.Len(listed, 2)
+		assert.False(listed[0].Compressed)
+		assert.True(listed[1].Compressed)
+	})
+}
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"gorm.io/gorm"
+)
+
+const (
+	BatchCreate string = "create"
+	BatchUpdate string = "update"
+	BatchDelete string = "delete"
+)
+
+// batchStatuses are the statuses of the operations done.
+var batchStatuses = map[string]string{
+	BatchCreate: ResultCreated,
+	BatchUpdate: ResultUpdated,
+	BatchDelete: ResultDeleted,
+}
+
+// batchEvents are the events published for the operations once committed.
+var batchEvents = map[string]string{
+	BatchCreate: events.AnnotationCreated,
+	BatchUpdate: events.AnnotationUpdated,
+	BatchDelete: events.AnnotationDeleted,
+}
+
+// BatchOperation creates, updates or deletes an annotation of the video. The
+// new annotations are identified by a temporary ID chosen by the client, the
+// others by their ID. The updates only change the given fields.
+type BatchOperation struct {
+	Operation string `json:"op" binding:"required,oneof=create update delete"`
+	TempID    string `json:"temp_id" binding:"required_if=Operation create"`
+	ID        uint   `json:"id" binding:"required_unless=Operation create"`
+	EditAnnotationContract
+}
+
+// BatchContract has up to 500 operations.
+type BatchContract struct {
+	Operations []BatchOperation `json:"operations" binding:"required,min=1,max=500"`
+}
+
+// BatchResult tells what happened with an operation of the batch.
+type BatchResult struct {
+	Index      int                `json:"index"`
+	Operation  string             `json:"op"`
+	TempID     string             `json:"temp_id,omitempty"`
+	ID         uint               `json:"id,omitempty"`
+	Status     string             `json:"status"`
+	Annotation *models.Annotation `json:"annotation,omitempty"`
+	Error      *problems.Problem  `json:"error,omitempty"`
+}
+
+// BatchReport sums up a batch, nothing is saved unless it's committed. The
+// IDs map the temporary IDs of the created annotations to their new IDs.
+type BatchReport struct {
+	Committed bool            `json:"committed"`
+	IDs       map[string]uint `json:"ids"`
+	Results   []BatchResult   `json:"results"`
+}
+
+// Batch validates all the operations on the annotations of the video first,
+// including their intervals, and applies them in order within a single
+// transaction only when all of them are valid. Otherwise the batch is
+// rejected with the report of each operation.
+func (annotations *AnnotationsController) Batch(context *gin.Context) {
+	var input BatchContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	video := models.Video{}
+	id, _ := strconv.ParseUint(context.Param("id"), 10, 0)
+	if !annotations.findVideo(context, &video, uint(id)) {
+		return
+	}
+
+	database := Session(context, annotations.Database)
+	existing := map[uint]*models.Annotation{}
+	identifiers := []uint{}
+	for _, operation := range input.Operations {
+		if operation.ID != 0 {
+			identifiers = append(identifiers, operation.ID)
+		}
+	}
+	if len(identifiers) > 0 {
+		var recordset []models.Annotation
+		searching := database.Find(&recordset, "video_id = ? AND id IN ?", video.ID, identifiers).Error
+		if searching != nil {
+			problems.Abort(context, searching)
+			return
+		}
+		for index := range recordset {
+			existing[recordset[index].ID] = &recordset[index]
+		}
+	}
+
+	report := &BatchReport{IDs: map[string]uint{}, Results: make([]BatchResult, len(input.Operations))}
+	changes := make([]models.Annotation, len(input.Operations))
+	failed := false
+	for index, operation := range input.Operations {
+		report.Results[index] = BatchResult{
+			Index:     index,
+			Operation: operation.Operation,
+			TempID:    operation.TempID,
+			ID:        operation.ID,
+		}
+		report.Results[index].Status = batchStatuses[operation.Operation]
+		exception := validateOperation(&operation, &video, existing, report.IDs, &changes[index])
+		if exception != nil {
+			report.Results[index].Status = ResultFailed
+			report.Results[index].Error = problems.From(exception)
+			failed = true
+		}
+	}
+	if failed {
+		report.IDs = map[string]uint{}
+		failures := make([]*problems.Problem, len(report.Results))
+		for index := range report.Results {
+			failures[index] = report.Results[index].Error
+		}
+		problems.Abort(context, problems.BatchRejected.Items("operations", failures).WithReport(report))
+		return
+	}
+
+	exception := database.Transaction(func(transaction *gorm.DB) error {
+		for index, operation := range input.Operations {
+			result := &report.Results[index]
+			change := &changes[index]
+			var applying error
+			switch operation.Operation {
+			case BatchCreate:
+				applying = transaction.Create(change).Error
+				result.ID, report.IDs[operation.TempID] = change.ID, change.ID
+			case BatchUpdate:
+				change.UpdatedAt = time.Now()
+				applying = transaction.Save(change).Error
+			case BatchDelete:
+				applying = transaction.Delete(change).Error
+			}
+			if applying != nil {
+				return applying
+			}
+			kind := batchEvents[operation.Operation]
+			if exception := notify(context, annotations.Webhooks, transaction, kind, detached(*change)); exception != nil {
+				return exception
+			}
+			if operation.Operation != BatchDelete {
+				result.Annotation = change
+			}
+		}
+		return nil
+	})
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+
+	report.Committed = true
+	annotations.Webhooks.Notify()
+	for index, operation := range input.Operations {
+		annotations.publish(context, batchEvents[operation.Operation], changes[index])
+	}
+	context.JSON(http.StatusOK, report)
+}
+
+// validateOperation checks the operation as the single end-points would, and
+// leaves in change the annotation as it will be saved. The existing
+// annotations are kept up to date, so the following operations of the batch
+// see the previous ones.
+func validateOperation(
+	operation *BatchOperation,
+	video *models.Video,
+	existing map[uint]*models.Annotation,
+	identifiers map[string]uint,
+	change *models.Annotation,
+) error {
+	if exception := binding.Validator.ValidateStruct(operation); exception != nil {
+		return problems.Input(exception)
+	}
+
+	if operation.Operation == BatchCreate {
+		if _, exists := identifiers[operation.TempID]; exists {
+			return problems.InvalidInput.WithDetail(fmt.Sprintf("temp_id %q is repeated", operation.TempID))
+		}
+		identifiers[operation.TempID] = 0
+		*change = models.Annotation{VideoID: video.ID}
+	} else {
+		current, exists := existing[operation.ID]
+		if !exists {
+			return problems.AnnotationNotFound
+		}
+		*change = *current
+		if operation.Operation == BatchDelete {
+			delete(existing, operation.ID)
+			return nil
+		}
+	}
+
+	// The updates only change the given fields, as in the single end-point
+	if operation.Operation == BatchCreate || operation.Type != 0 {
+		change.Type = operation.Type
+	}
+	if operation.Title != "" {
+		change.Title = operation.Title
+	}
+	if operation.Notes != "" {
+		change.Notes = operation.Notes
+	}
+	if operation.Start != 0 {
+		change.Start = operation.Start
+	}
+	if operation.End != 0 {
+		change.End = operation.End
+	}
+
+	resulting := AddAnnotationContract{
+		VideoID: change.VideoID,
+		Type:    change.Type,
+		Title:   change.Title,
+		Notes:   change.Notes,
+		Start:   change.Start,
+		End:     change.End,
+	}
+	if exception := binding.Validator.ValidateStruct(&resulting); exception != nil {
+		return problems.Input(exception)
+	}
+	if exception := ValidateInterval(change.Start, change.End, video.Duration); exception != nil {
+		return exception
+	}
+
+	if operation.Operation == BatchUpdate {
+		updated := *change
+		existing[operation.ID] = &updated
+	}
+	return nil
+}
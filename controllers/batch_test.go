@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBatch(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// seed creates a video with two annotations for the user and another one
+	// owned by someone else.
+	seed := func(test *testing.T) (*gorm.DB, *models.User, *models.User) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "batch.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}))
+		owner := &models.User{Nickname: "owner", Videos: []models.Video{
+			{Title: "One", Link: "https://dummy.io/one", Duration: 120, Annotations: []models.Annotation{
+				{Title: "Intro", Start: 1, End: 30},
+				{Title: "Outro", Start: 90, End: 120},
+			}},
+		}}
+		require.Nil(database.Create(owner).Error)
+		other := &models.User{Nickname: "other", Videos: []models.Video{
+			{Title: "Other", Link: "https://dummy.io/other", Duration: 60, Annotations: []models.Annotation{
+				{Title: "Foreign", Start: 1, End: 10},
+			}},
+		}}
+		require.Nil(database.Create(other).Error)
+		return database, owner, other
+	}
+
+	perform := func(database *gorm.DB, user *models.User, video uint, body string) (*httptest.ResponseRecorder, BatchReport) {
+		annotations := &AnnotationsController{Database: database}
+		server := gin.New()
+		server.POST("/videos/:id/annotations/batch", func(context *gin.Context) { context.Set("user", user) }, annotations.Batch)
+		path := fmt.Sprintf("/videos/%d/annotations/batch", video)
+		request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		report := BatchReport{}
+		json.Unmarshal(recorder.Body.Bytes(), &report)
+		return recorder, report
+	}
+
+	annotationsOf := func(database *gorm.DB, video uint) []models.Annotation {
+		recordset := []models.Annotation{}
+		database.Order("id").Find(&recordset, "video_id = ?", video)
+		return recordset
+	}
+
+	test.Run("Should apply all the operations and map the temporary IDs", func(test *testing.T) {
+		// Arrange
+		database, owner, _ := seed(test)
+		video := owner.Videos[0]
+		intro, outro := video.Annotations[0].ID, video.Annotations[1].ID
+		body := fmt.Sprintf(`{"operations":[
+			{"op":"create","temp_id":"a","title":"Middle","start":"00:00:40","end":60},
+			{"op":"update","id":%d,"title":"Opening"},
+			{"op":"update","id":%d,"end":20},
+			{"op":"delete","id":%d},
+			{"op":"create","temp_id":"b","title":"Credits","start":100,"end":120,"type":2}
+		]}`, intro, intro, outro)
+
+		// Act
+		recorder, report := perform(database, owner, video.ID, body)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.True(report.Committed)
+		require.Len(report.Results, 5)
+		assert.Equal(ResultCreated, report.Results[0].Status)
+		assert.Equal(ResultUpdated, report.Results[2].Status)
+		assert.Equal(ResultDeleted, report.Results[3].Status)
+		assert.Nil(report.Results[3].Annotation)
+		assert.Equal(models.TimeStamp(20), report.Results[2].Annotation.End)
+		assert.Equal("Opening", report.Results[2].Annotation.Title)
+
+		saved := annotationsOf(database, video.ID)
+		require.Len(saved, 3)
+		assert.Equal("Opening", saved[0].Title)
+		assert.Equal(models.TimeStamp(20), saved[0].End)
+		assert.Equal(map[string]uint{"a": saved[1].ID, "b": saved[2].ID}, report.IDs)
+		assert.Equal(saved[1].ID, report.Results[0].ID)
+		assert.Equal(models.TimeStamp(40), saved[1].Start)
+		assert.Equal(uint(2), saved[2].Type)
+	})
+
+	test.Run("Should save nothing when any operation is invalid", func(test *testing.T) {
+		// Arrange
+		database, owner, other := seed(test)
+		video := owner.Videos[0]
+		intro, outro := video.Annotations[0].ID, video.Annotations[1].ID
+		foreign := other.Videos[0].Annotations[0].ID
+		body := fmt.Sprintf(`{"operations":[
+			{"op":"create","temp_id":"a","title":"Valid","start":1,"end":2},
+			{"op":"create","temp_id":"b","title":"Too long","start":100,"end":130},
+			{"op":"update","id":%d,"start":50},
+			{"op":"delete","id":%d},
+			{"op":"delete","id":%d},
+			{"op":"update","id":%d,"title":"Deleted"},
+			{"op":"create","temp_id":"a","title":"Repeated","start":1,"end":2},
+			{"op":"create","title":"Anonymous","start":1,"end":2},
+			{"op":"move","id":%d}
+		]}`, intro, foreign, outro, outro, intro)
+
+		// Act
+		recorder, _ := perform(database, owner, video.ID, body)
+
+		// Assert
+		require.Equal(http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+		assert.Equal(problems.ContentType, recorder.Header().Get("Content-Type"))
+		rejection := struct {
+			Code   string                `json:"code"`
+			Errors []problems.FieldError `json:"errors"`
+			Report BatchReport           `json:"report"`
+		}{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &rejection))
+		assert.Equal("batch_rejected", rejection.Code)
+		fields := []string{}
+		for _, failure := range rejection.Errors {
+			fields = append(fields, failure.Field)
+		}
+		assert.Equal([]string{
+			"operations[1]", "operations[2].start", "operations[3]", "operations[5]",
+			"operations[6]", "operations[7].temp_id", "operations[8].op",
+		}, fields)
+		report := rejection.Report
+		assert.False(report.Committed)
+		assert.Empty(report.IDs)
+		statuses, codes := []string{}, []string{}
+		for _, result := range report.Results {
+			statuses = append(statuses, result.Status)
+			if result.Error == nil {
+				codes = append(codes, "")
+				continue
+			}
+			codes = append(codes, result.Error.Code)
+		}
+		assert.Equal([]string{
+			ResultCreated, ResultFailed, ResultFailed, ResultFailed, ResultDeleted,
+			ResultFailed, ResultFailed, ResultFailed, ResultFailed,
+		}, statuses)
+		assert.Equal([]string{
+			"", "invalid_interval", "validation_failed", "annotation_not_found", "",
+			"annotation_not_found", "invalid_input", "validation_failed", "validation_failed",
+		}, codes)
+		assert.Equal("start", report.Results[2].Error.Errors[0].Field)
+		assert.Equal("temp_id", report.Results[7].Error.Errors[0].Field)
+		assert.Equal("op", report.Results[8].Error.Errors[0].Field)
+		assert.Len(annotationsOf(database, video.ID), 2)
+	})
+
+	testcases := []struct {
+		Description string
+		Video       func(owner *models.User, other *models.User) uint
+		Body        string
+		Status      int
+		Code        string
+	}{
+		{
+			"Should fail when the video belongs to another user",
+			func(owner *models.User, other *models.User) uint { return other.Videos[0].ID },
+			`{"operations":[{"op":"create","temp_id":"a","title":"New","start":1,"end":2}]}`,
+			http.StatusNotFound, "video_not_found",
+		},
+		{
+			"Should fail without operations",
+			func(owner *models.User, other *models.User) uint { return owner.Videos[0].ID },
+			`{"operations":[]}`,
+			http.StatusBadRequest, "validation_failed",
+		},
+		{
+			"Should fail when the body is not JSON",
+			func(owner *models.User, other *models.User) uint { return owner.Videos[0].ID },
+			`operations`,
+			http.StatusBadRequest, "invalid_input",
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner, other := seed(test)
+
+			// Act
+			recorder, _ := perform(database, owner, testcase.Video(owner, other), testcase.Body)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), `"code":"`+testcase.Code+`"`)
+			assert.Len(annotationsOf(database, other.Videos[0].ID), 1)
+		})
+	}
+}
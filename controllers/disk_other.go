@@ -0,0 +1,7 @@
+//go:build !linux && !darwin
+
+package controllers
+
+func freeSpace(directory string) (uint64, error) {
+	return 0, ErrDiskSpaceUnsupported
+}
@@ -0,0 +1,13 @@
+//go:build linux || darwin
+
+package controllers
+
+import "syscall"
+
+func freeSpace(directory string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if exception := syscall.Statfs(directory, &stat); exception != nil {
+		return 0, exception
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
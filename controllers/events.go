@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+)
+
+const (
+	EventStreamContentType string = "text/event-stream"
+	LastEventIDHeader      string = "Last-Event-ID"
+)
+
+// EventsController streams the changes of the videos as Server-Sent Events.
+type EventsController struct {
+	Database models.DataAccessInterface
+	Hub      *events.Hub
+
+	// Heartbeat is the time between the comments keeping the idle streams
+	// open through the proxies, 0 to send none
+	Heartbeat time.Duration
+}
+
+// detached returns the annotation without its video, as it's sent on the
+// events.
+func detached(annotation models.Annotation) models.Annotation {
+	annotation.Video = nil
+	return annotation
+}
+
+// publish tells the followers of the video about the change of the
+// annotation. Failing to publish doesn't fail the request, as the change is
+// already saved.
+func (annotations *AnnotationsController) publish(context *gin.Context, kind string, annotation models.Annotation) {
+	if exception := annotations.Hub.Publish(annotation.VideoID, kind, detached(annotation)); exception != nil {
+		context.Error(exception)
+	}
+}
+
+// Stream follows the events of a video owned by the logged user until the
+// client disconnects or the server shuts down. The clients reconnecting with
+// the Last-Event-ID header (or the last_event_id query parameter, for the
+// ones unable to set headers) get the events they missed first.
+func (streams *EventsController) Stream(context *gin.Context) {
+	user := CurrentUser(context)
+	video := models.Video{}
+	searching := Session(context, streams.Database).
+		First(&video, "id = ? AND user_id = ?", context.Param("id"), user.ID).Error
+	if searching != nil {
+		problems.Abort(context, notFound(problems.VideoNotFound, searching))
+		return
+	}
+
+	var last uint64
+	resuming := context.GetHeader(LastEventIDHeader)
+	if resuming == "" {
+		resuming = context.Query("last_event_id")
+	}
+	if resuming != "" {
+		var exception error
+		if last, exception = strconv.ParseUint(resuming, 10, 64); exception != nil {
+			problems.Abort(context, problems.InvalidInput.WithDetail("the last event ID must be a positive integer"))
+			return
+		}
+	}
+
+	subscription := streams.Hub.Subscribe(video.ID, last)
+	defer subscription.Close()
+
+	// The stream outlives the write timeout of the server
+	http.NewResponseController(context.Writer).SetWriteDeadline(time.Time{})
+	context.Header("Content-Type", EventStreamContentType)
+	context.Header("Cache-Control", "no-cache")
+	context.Header("X-Accel-Buffering", "no")
+	context.Status(http.StatusOK)
+	context.Writer.Flush()
+
+	var heartbeat <-chan time.Time
+	if streams.Heartbeat > 0 {
+		ticker := time.NewTicker(streams.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-context.Request.Context().Done():
+			return
+		case event, open := <-subscription.Events:
+			if !open {
+				return
+			}
+			fmt.Fprintf(context.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data(event))
+		case <-heartbeat:
+			fmt.Fprint(context.Writer, ": heartbeat\n\n")
+		}
+		context.Writer.Flush()
+	}
+}
+
+// data is the payload of the event, the resync ones have none but the data
+// field is required for the browsers to dispatch them.
+func data(event events.Event) []byte {
+	if len(event.Data) == 0 {
+		return []byte("{}")
+	}
+	return event.Data
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// frame is an event or comment read from the stream.
+type frame struct {
+	ID    string
+	Event string
+	Data  string
+	Lines []string
+}
+
+// readFrame reads the lines of the stream until the next blank one.
+func readFrame(reader *bufio.Reader) (frame, error) {
+	current := frame{}
+	for {
+		line, exception := reader.ReadString('\n')
+		if exception != nil {
+			return current, exception
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return current, nil
+		}
+		current.Lines = append(current.Lines, line)
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			current.ID = value
+		case "event":
+			current.Event = value
+		case "data":
+			current.Data = value
+		}
+	}
+}
+
+func TestEventsStream(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// serve seeds a video for the owner and another one for someone else, and
+	// serves the stream along with the annotation end-points on a real server,
+	// as the recorder can't be read while the handler is running.
+	serve := func(test *testing.T, heartbeat time.Duration) (*httptest.Server, *events.Hub, *gorm.DB, *models.User) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "events.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}))
+		owner := &models.User{Nickname: "owner", Videos: []models.Video{
+			{Title: "One", Link: "https://dummy.io/one", Duration: 120},
+		}}
+		require.Nil(database.Create(owner).Error)
+		other := &models.User{Nickname: "other", Videos: []models.Video{
+			{Title: "Other", Link: "https://dummy.io/other", Duration: 60},
+		}}
+		require.Nil(database.Create(other).Error)
+
+		hub := events.NewHub(10)
+		annotations := &AnnotationsController{Database: database, Hub: hub}
+		videos := &VideosController{Database: database, Hub: hub}
+		streams := &EventsController{Database: database, Hub: hub, Heartbeat: heartbeat}
+		server := gin.New()
+		authorise := func(context *gin.Context) { context.Set("user", owner) }
+		server.GET("/videos/:id/events", authorise, streams.Stream)
+		server.POST("/annotations", authorise, annotations.Add)
+		server.DELETE("/annotations/:id", authorise, annotations.Delete)
+		server.POST("/videos/:id/annotations/batch", authorise, annotations.Batch)
+		server.DELETE("/videos/:id", authorise, videos.Delete)
+
+		listener := httptest.NewServer(server)
+		test.Cleanup(listener.Close)
+		test.Cleanup(hub.Close)
+		return listener, hub, database, other
+	}
+
+	follow := func(test *testing.T, server *httptest.Server, video uint, last string) *http.Response {
+		// Never wait forever for the events that didn't come
+		current, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		test.Cleanup(cancel)
+		path := fmt.Sprintf("%s/videos/%d/events", server.URL, video)
+		request, _ := http.NewRequestWithContext(current, http.MethodGet, path, nil)
+		if last != "" {
+			request.Header.Set(LastEventIDHeader, last)
+		}
+		response, exception := server.Client().Do(request)
+		require.Nil(exception)
+		test.Cleanup(func() { response.Body.Close() })
+		return response
+	}
+
+	send := func(server *httptest.Server, method string, path string, body string) {
+		request, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		response, exception := server.Client().Do(request)
+		require.Nil(exception)
+		response.Body.Close()
+		require.Less(response.StatusCode, http.StatusBadRequest)
+	}
+
+	test.Run("Should stream the changes of the annotations of the video", func(test *testing.T) {
+		// Arrange
+		server, _, _, _ := serve(test, time.Hour)
+		response := follow(test, server, 1, "")
+		reader := bufio.NewReader(response.Body)
+
+		// Act
+		send(server, http.MethodPost, "/annotations", `{"video_id":1,"title":"Intro","start":1,"end":30}`)
+		send(server, http.MethodDelete, "/annotations/1", "")
+
+		// Assert
+		assert.Equal(http.StatusOK, response.StatusCode)
+		assert.Equal(EventStreamContentType, response.Header.Get("Content-Type"))
+		assert.Equal("no-cache", response.Header.Get("Cache-Control"))
+		created, exception := readFrame(reader)
+		require.Nil(exception)
+		assert.Equal(events.AnnotationCreated, created.Event)
+		assert.Contains(created.Data, `"title":"Intro"`)
+		assert.Contains(created.Data, `"video":null`)
+		deleted, exception := readFrame(reader)
+		require.Nil(exception)
+		assert.Equal(events.AnnotationDeleted, deleted.Event)
+		assert.Contains(deleted.Data, `"id":1`)
+		assert.NotEqual(created.ID, deleted.ID)
+	})
+
+	test.Run("Should publish the changes of a batch once committed", func(test *testing.T) {
+		// Arrange
+		server, _, _, _ := serve(test, time.Hour)
+		send(server, http.MethodPost, "/annotations", `{"video_id":1,"title":"Intro","start":1,"end":30}`)
+		response := follow(test, server, 1, "")
+		reader := bufio.NewReader(response.Body)
+
+		// Act
+		send(server, http.MethodPost, "/videos/1/annotations/batch", `{"operations":[
+			{"op":"create","temp_id":"a","title":"One","start":1,"end":10},
+			{"op":"create","temp_id":"b","title":"Two","start":20,"end":30},
+			{"op":"update","id":1,"title":"First"}
+		]}`)
+
+		// Assert
+		kinds := []string{}
+		for index := 0; index < 3; index++ {
+			event, exception := readFrame(reader)
+			require.Nil(exception)
+			kinds = append(kinds, event.Event)
+		}
+		assert.Equal([]string{events.AnnotationCreated, events.AnnotationCreated, events.AnnotationUpdated}, kinds)
+	})
+
+	test.Run("Should resume after the last event received", func(test *testing.T) {
+		// Arrange
+		server, _, _, _ := serve(test, time.Hour)
+		first := follow(test, server, 1, "")
+		send(server, http.MethodPost, "/annotations", `{"video_id":1,"title":"Intro","start":1,"end":30}`)
+		received, exception := readFrame(bufio.NewReader(first.Body))
+		require.Nil(exception)
+		first.Body.Close()
+		send(server, http.MethodPost, "/annotations", `{"video_id":1,"title":"Middle","start":40,"end":60}`)
+		send(server, http.MethodDelete, "/annotations/1", "")
+
+		// Act
+		response := follow(test, server, 1, received.ID)
+
+		// Assert
+		reader := bufio.NewReader(response.Body)
+		missed, exception := readFrame(reader)
+		require.Nil(exception)
+		assert.Equal(events.AnnotationCreated, missed.Event)
+		assert.Contains(missed.Data, `"title":"Middle"`)
+		missed, exception = readFrame(reader)
+		require.Nil(exception)
+		assert.Equal(events.AnnotationDeleted, missed.Event)
+	})
+
+	test.Run("Should ask to resync when the missed events are unknown", func(test *testing.T) {
+		// Arrange
+		server, _, _, _ := serve(test, time.Hour)
+
+		// Act
+		response := follow(test, server, 1, "1")
+
+		// Assert
+		event, exception := readFrame(bufio.NewReader(response.Body))
+		require.Nil(exception)
+		assert.Equal(events.Resync, event.Event)
+		assert.Equal("{}", event.Data)
+	})
+
+	test.Run("Should keep the idle stream open with comments", func(test *testing.T) {
+		// Arrange
+		server, _, _, _ := serve(test, 10*time.Millisecond)
+
+		// Act
+		response := follow(test, server, 1, "")
+
+		// Assert
+		comment, exception := readFrame(bufio.NewReader(response.Body))
+		require.Nil(exception)
+		assert.Equal([]string{": heartbeat"}, comment.Lines)
+	})
+
+	test.Run("Should end the stream when the hub is closed", func(test *testing.T) {
+		// Arrange
+		server, hub, _, _ := serve(test, time.Hour)
+		response := follow(test, server, 1, "")
+
+		// Act
+		hub.Close()
+
+		// Assert
+		_, exception := readFrame(bufio.NewReader(response.Body))
+		assert.Error(exception)
+	})
+
+	test.Run("Should end the stream when the video is deleted", func(test *testing.T) {
+		// Arrange
+		server, _, _, _ := serve(test, time.Hour)
+		response := follow(test, server, 1, "")
+
+		// Act
+		send(server, http.MethodDelete, "/videos/1", "")
+
+		// Assert
+		_, exception := readFrame(bufio.NewReader(response.Body))
+		assert.ErrorIs(exception, io.EOF)
+	})
+
+	failures := []struct {
+		Description string
+		Video       func(other *models.User) uint
+		Last        string
+		Status      int
+	}{
+		{"Should fail to follow the videos of other users", func(other *models.User) uint { return other.Videos[0].ID }, "", http.StatusNotFound},
+		{"Should fail to follow a missing video", func(*models.User) uint { return 99 }, "", http.StatusNotFound},
+		{"Should fail to resume from an invalid event", func(*models.User) uint { return 1 }, "latest", http.StatusBadRequest},
+	}
+
+	for _, testcase := range failures {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			server, _, _, other := serve(test, time.Hour)
+
+			// Act
+			response := follow(test, server, testcase.Video(other), testcase.Last)
+
+			// Assert
+			assert.Equal(testcase.Status, response.StatusCode)
+		})
+	}
+}
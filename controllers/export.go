@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/spreadsheet"
+)
+
+const (
+	ExportCSV       string = "csv"
+	ExportJSONLines string = "jsonl"
+	ExportXLSX      string = "xlsx"
+
+	// ExportChunkSize is the number of rows read between the flushes of the
+	// response.
+	ExportChunkSize int = 500
+
+	// exportColumns are the columns read for each row, a video without
+	// annotations has NULL on the annotation ones.
+	exportColumns string = "videos.id, videos.title, videos.description, videos.link, videos.duration, videos.created_at, " +
+		"annotations.id, annotations.type, annotations.title, annotations.notes, " +
+		"annotations.`start`, annotations.`end`, annotations.created_at"
+)
+
+type ExportController struct {
+	Database models.DataAccessInterface
+}
+
+// ExportQuery filters the export. The annotations are filtered by their type
+// and creation date, only the videos with some matching annotations are
+// exported when doing so.
+type ExportQuery struct {
+	Format string    `form:"format" binding:"omitempty,oneof=csv jsonl xlsx"`
+	Videos []uint    `form:"video_id"`
+	Types  []uint    `form:"type"`
+	Since  time.Time `form:"since" time_format:"2006-01-02"`
+	Until  time.Time `form:"until" time_format:"2006-01-02" binding:"omitempty,gtefield=Since"`
+}
+
+// ExportAnnotation is an annotation of an exported video.
+type ExportAnnotation struct {
+	ID        uint             `json:"id"`
+	Type      uint             `json:"type"`
+	Title     string           `json:"title"`
+	Notes     string           `json:"notes"`
+	Start     models.TimeStamp `json:"start"`
+	End       models.TimeStamp `json:"end"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// ExportVideo is each line of a JSON Lines export, it can be imported back.
+type ExportVideo struct {
+	ID          uint               `json:"id"`
+	Title       string             `json:"title"`
+	Description string             `json:"description"`
+	Link        string             `json:"link"`
+	Duration    models.TimeStamp   `json:"duration"`
+	CreatedAt   time.Time          `json:"created_at"`
+	Annotations []ExportAnnotation `json:"annotations"`
+}
+
+// exportWriter writes the videos on one of the export formats.
+type exportWriter interface {
+	Write(video *ExportVideo) error
+	Flush() error
+	Close() error
+}
+
+// Export streams the videos of the current user along with their annotations
+// as CSV (the same columns as the import), JSON Lines (a video per line) or
+// an Excel workbook. The rows are read one by one and sent in chunks, so the
+// library is never loaded in memory as a whole.
+func (exports *ExportController) Export(context *gin.Context) {
+	var input ExportQuery
+	if binding := context.ShouldBindQuery(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+	if input.Format == "" {
+		input.Format = ExportCSV
+	}
+
+	user := CurrentUser(context)
+	query := Session(context, exports.Database).
+		Model(&models.Video{}).
+		Select(exportColumns).
+		Joins("LEFT JOIN annotations ON annotations.video_id = videos.id").
+		Where("videos.user_id = ?", user.ID)
+	if len(input.Videos) > 0 {
+		query = query.Where("videos.id IN ?", input.Videos)
+	}
+	if len(input.Types) > 0 {
+		query = query.Where("annotations.type IN ?", input.Types)
+	}
+	if !input.Since.IsZero() {
+		query = query.Where("annotations.created_at >= ?", input.Since)
+	}
+	if !input.Until.IsZero() {
+		query = query.Where("annotations.created_at < ?", input.Until.AddDate(0, 0, 1))
+	}
+	rows, exception := query.Order("videos.id, annotations.`start`, annotations.id").Rows()
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	defer rows.Close()
+
+	// The export of a large library outlives the write timeout of the server
+	http.NewResponseController(context.Writer).SetWriteDeadline(time.Time{})
+	filename := fmt.Sprintf("notevook-%s-%s.%s", user.Nickname, time.Now().UTC().Format("20060102"), input.Format)
+	context.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	context.Status(http.StatusOK)
+
+	var writer exportWriter
+	switch input.Format {
+	case ExportJSONLines:
+		context.Header("Content-Type", JSONLinesContentType)
+		writer = newJSONLinesExport(context.Writer)
+	case ExportXLSX:
+		context.Header("Content-Type", spreadsheet.ContentType)
+		writer, exception = newSpreadsheetExport(context.Writer)
+	default:
+		context.Header("Content-Type", CSVContentType+"; charset=utf-8")
+		writer, exception = newCSVExport(context.Writer)
+	}
+
+	// The status is already sent, so a failure from now on can only be logged
+	// and the response is left unfinished
+	count := 0
+	var video *ExportVideo
+	for exception == nil && rows.Next() {
+		var row exportRow
+		if exception = row.Scan(rows); exception != nil {
+			break
+		}
+		if video != nil && video.ID != row.Video.ID {
+			exception = writer.Write(video)
+			video = nil
+		}
+		if video == nil {
+			video = &row.Video
+		}
+		if row.Annotation != nil {
+			video.Annotations = append(video.Annotations, *row.Annotation)
+		}
+
+		if count++; exception == nil && count%ExportChunkSize == 0 {
+			exception = writer.Flush()
+			context.Writer.Flush()
+		}
+	}
+	if exception == nil {
+		exception = rows.Err()
+	}
+	if exception == nil && video != nil {
+		exception = writer.Write(video)
+	}
+	if exception == nil {
+		exception = writer.Close()
+	}
+	if exception != nil {
+		context.Error(exception)
+	}
+}
+
+// exportRow is a video along with one of its annotations, if any.
+type exportRow struct {
+	Video      ExportVideo
+	Annotation *ExportAnnotation
+}
+
+func (row *exportRow) Scan(rows *sql.Rows) error {
+	var (
+		id, kind    *uint
+		title       *string
+		notes       *string
+		start, end  *models.TimeStamp
+		createdAt   *time.Time
+		video       = &row.Video
+		destination = []any{
+			&video.ID, &video.Title, &video.Description, &video.Link, &video.Duration, &video.CreatedAt,
+			&id, &kind, &title, &notes, &start, &end, &createdAt,
+		}
+	)
+	if exception := rows.Scan(destination...); exception != nil {
+		return exception
+	}
+	video.Annotations = []ExportAnnotation{}
+	if id != nil {
+		row.Annotation = &ExportAnnotation{
+			ID: *id, Type: *kind, Title: *title, Notes: *notes,
+			Start: *start, End: *end, CreatedAt: *createdAt,
+		}
+	}
+	return nil
+}
+
+// formulaPrefixes are the first characters which make the spreadsheets take a
+// cell for a formula.
+const formulaPrefixes string = "=+-@\t\r"
+
+// escapeFormula prefixes the cells the spreadsheets would take for formulas
+// with a quote, so they are shown as text instead of being evaluated.
+func escapeFormula(cell string) string {
+	if cell != "" && strings.ContainsRune(formulaPrefixes, rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// unescapeFormula removes the quote of the cells escaped by escapeFormula.
+func unescapeFormula(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// records turns the video into CSV records as read by the import, one per
+// annotation or a single one when the video has none. The texts which could be
+// taken for formulas are escaped, the import removes the escaping.
+func (video *ExportVideo) records() [][]string {
+	fields := []string{
+		escapeFormula(video.Title), escapeFormula(video.Description), escapeFormula(video.Link), video.Duration.Clock(),
+	}
+	if len(video.Annotations) == 0 {
+		return [][]string{append(fields, make([]string, len(CSVColumns)-len(fields))...)}
+	}
+
+	records := make([][]string, 0, len(video.Annotations))
+	for _, annotation := range video.Annotations {
+		records = append(records, append(append([]string{}, fields...),
+			strconv.FormatUint(uint64(annotation.Type), 10),
+			escapeFormula(annotation.Title),
+			escapeFormula(annotation.Notes),
+			annotation.Start.Clock(),
+			annotation.End.Clock(),
+		))
+	}
+	return records
+}
+
+type csvExport struct {
+	*csv.Writer
+}
+
+func newCSVExport(output io.Writer) (exportWriter, error) {
+	writer := &csvExport{csv.NewWriter(output)}
+	return writer, writer.Writer.Write(CSVColumns)
+}
+
+func (writer *csvExport) Write(video *ExportVideo) error {
+	return writer.WriteAll(video.records())
+}
+
+func (writer *csvExport) Flush() error {
+	writer.Writer.Flush()
+	return writer.Error()
+}
+
+func (writer *csvExport) Close() error {
+	return writer.Flush()
+}
+
+type jsonLinesExport struct {
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+}
+
+func newJSONLinesExport(output io.Writer) exportWriter {
+	buffer := bufio.NewWriter(output)
+	return &jsonLinesExport{buffer: buffer, encoder: json.NewEncoder(buffer)}
+}
+
+func (writer *jsonLinesExport) Write(video *ExportVideo) error {
+	return writer.encoder.Encode(video)
+}
+
+func (writer *jsonLinesExport) Flush() error {
+	return writer.buffer.Flush()
+}
+
+func (writer *jsonLinesExport) Close() error {
+	return writer.buffer.Flush()
+}
+
+type spreadsheetExport struct {
+	*spreadsheet.Writer
+}
+
+func newSpreadsheetExport(output io.Writer) (exportWriter, error) {
+	writer, exception := spreadsheet.NewWriter(output, "Annotations")
+	if exception != nil {
+		return nil, exception
+	}
+	return &spreadsheetExport{writer}, writer.Write(CSVColumns)
+}
+
+func (writer *spreadsheetExport) Write(video *ExportVideo) error {
+	for _, record := range video.records() {
+		if exception := writer.Writer.Write(record); exception != nil {
+			return exception
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/spreadsheet"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestExport(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	yesterday := time.Now().AddDate(0, 0, -1)
+	lastYear := time.Now().AddDate(-1, 0, 0)
+	database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "export.db")), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}))
+	owner := &models.User{Nickname: "owner", Videos: []models.Video{
+		{Title: "One", Link: "https://dummy.io/one", Duration: 120, Annotations: []models.Annotation{
+			{Type: 2, Title: "Outro", Notes: "Bye, \"all\"", Start: 90, End: 120, CreatedAt: yesterday},
+			{Type: 1, Title: "Intro", Start: 1, End: 30, CreatedAt: lastYear},
+		}},
+		{Title: "Two", Link: "https://dummy.io/two", Duration: 3600},
+	}}
+	require.Nil(database.Create(owner).Error)
+	other := &models.User{Nickname: "other", Videos: []models.Video{
+		{Title: "Other", Link: "https://dummy.io/one", Duration: 10},
+	}}
+	require.Nil(database.Create(other).Error)
+
+	perform := func(path string) *httptest.ResponseRecorder {
+		exports := &ExportController{Database: database}
+		server := gin.New()
+		server.GET("/export", func(context *gin.Context) { context.Set("user", owner) }, exports.Export)
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should export the videos as CSV with the columns of the import", func(test *testing.T) {
+		// Act
+		recorder := perform("/export")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal("text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Contains(recorder.Header().Get("Content-Disposition"), `filename="notevook-owner-`)
+		records, exception := csv.NewReader(recorder.Body).ReadAll()
+		require.Nil(exception)
+		assert.Equal([][]string{
+			CSVColumns,
+			{"One", "", "https://dummy.io/one", "00:02:00", "1", "Intro", "", "00:00:01", "00:00:30"},
+			{"One", "", "https://dummy.io/one", "00:02:00", "2", "Outro", "Bye, \"all\"", "00:01:30", "00:02:00"},
+			{"Two", "", "https://dummy.io/two", "01:00:00", "", "", "", "", ""},
+		}, records)
+	})
+
+	test.Run("Should export a video per line as JSON Lines", func(test *testing.T) {
+		// Act
+		recorder := perform("/export?format=jsonl")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(JSONLinesContentType, recorder.Header().Get("Content-Type"))
+		lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+		require.Len(lines, 2)
+		assert.Contains(lines[0], `"duration":"00:02:00"`)
+		videos := make([]ExportVideo, len(lines))
+		for index, line := range lines {
+			require.Nil(json.Unmarshal([]byte(line), &videos[index]))
+		}
+		assert.Equal(owner.Videos[0].ID, videos[0].ID)
+		require.Len(videos[0].Annotations, 2)
+		assert.Equal("Intro", videos[0].Annotations[0].Title)
+		assert.Equal(models.TimeStamp(90), videos[0].Annotations[1].Start)
+		assert.Empty(videos[1].Annotations)
+	})
+
+	test.Run("Should export an Excel workbook", func(test *testing.T) {
+		// Act
+		recorder := perform("/export?format=xlsx")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(spreadsheet.ContentType, recorder.Header().Get("Content-Type"))
+		archive, exception := zip.NewReader(bytes.NewReader(recorder.Body.Bytes()), int64(recorder.Body.Len()))
+		require.Nil(exception)
+		sheet, exception := archive.Open("xl/worksheets/sheet1.xml")
+		require.Nil(exception)
+		content, _ := io.ReadAll(sheet)
+		assert.Equal(4, strings.Count(string(content), "<row "))
+		assert.Contains(string(content), "Bye, &#34;all&#34;")
+	})
+
+	filters := []struct {
+		Description string
+		Query       string
+		Expected    []string
+	}{
+		{"Should filter by video", fmt.Sprintf("?video_id=0&video_id=%d", owner.Videos[1].ID), []string{"Two"}},
+		{"Should filter by annotation type", "?type=2&type=3", []string{"Outro"}},
+		{"Should filter by creation date", "?since=" + yesterday.Format(time.DateOnly) + "&until=" + yesterday.Format(time.DateOnly), []string{"Outro"}},
+		{"Should export nothing when nothing matches", "?until=" + lastYear.AddDate(0, 0, -1).Format(time.DateOnly), []string{}},
+	}
+
+	for _, testcase := range filters {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			recorder := perform("/export" + testcase.Query)
+
+			// Assert
+			require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+			records, _ := csv.NewReader(recorder.Body).ReadAll()
+			titles := []string{}
+			for _, record := range records[1:] {
+				title := record[5]
+				if title == "" {
+					title = record[0]
+				}
+				titles = append(titles, title)
+			}
+			assert.Equal(testcase.Expected, titles)
+		})
+	}
+
+	invalids := []struct {
+		Description string
+		Query       string
+		Expected    string
+	}{
+		{"Should reject unknown formats", "?format=pdf", `"field":"format"`},
+		{"Should reject the dates in other format", "?since=19/10/2026", `"code":"invalid_input"`},
+		{"Should reject ranges ending before they start", "?since=2026-10-19&until=2026-10-18", `"field":"until"`},
+	}
+
+	for _, testcase := range invalids {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			recorder := perform("/export" + testcase.Query)
+
+			// Assert
+			assert.Equal(http.StatusBadRequest, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Expected)
+		})
+	}
+}
+
+func TestExportFormulas(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "formulas.db")), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}))
+	owner := &models.User{Nickname: "owner", Videos: []models.Video{
+		{Title: `=HYPERLINK("https://evil.io","Click")`, Description: "+1", Link: "https://dummy.io/one", Duration: 120, Annotations: []models.Annotation{
+			{Title: "@SUM(A1:A9)", Notes: "-2 degrees", Start: 1, End: 30},
+		}},
+	}}
+	require.Nil(database.Create(owner).Error)
+	importer := &models.User{Nickname: "importer"}
+	require.Nil(database.Create(importer).Error)
+
+	perform := func(user *models.User, method string, path string, body io.Reader) *httptest.ResponseRecorder {
+		exports := &ExportController{Database: database}
+		imports := &ImportController{Database: database}
+		server := gin.New()
+		authorise := func(context *gin.Context) { context.Set("user", user) }
+		server.GET("/export", authorise, exports.Export)
+		server.POST("/import", authorise, imports.Import)
+		request, _ := http.NewRequest(method, path, body)
+		request.Header.Set("Content-Type", CSVContentType)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should escape the cells taken for formulas", func(test *testing.T) {
+		// Act
+		csvExport := perform(owner, http.MethodGet, "/export", nil)
+		xlsxExport := perform(owner, http.MethodGet, "/export?format=xlsx", nil)
+
+		// Assert
+		require.Equal(http.StatusOK, csvExport.Code)
+		records, exception := csv.NewReader(csvExport.Body).ReadAll()
+		require.Nil(exception)
+		assert.Equal([][]string{
+			CSVColumns,
+			{`'=HYPERLINK("https://evil.io","Click")`, "'+1", "https://dummy.io/one", "00:02:00", "0", "'@SUM(A1:A9)", "'-2 degrees", "00:00:01", "00:00:30"},
+		}, records)
+		require.Equal(http.StatusOK, xlsxExport.Code)
+		archive, exception := zip.NewReader(bytes.NewReader(xlsxExport.Body.Bytes()), int64(xlsxExport.Body.Len()))
+		require.Nil(exception)
+		sheet, exception := archive.Open("xl/worksheets/sheet1.xml")
+		require.Nil(exception)
+		content, _ := io.ReadAll(sheet)
+		assert.Contains(string(content), "&#39;=HYPERLINK(")
+		assert.Contains(string(content), "&#39;@SUM(A1:A9)")
+		assert.NotContains(string(content), `preserve">=`)
+	})
+
+	test.Run("Should import back the escaped cells as they were", func(test *testing.T) {
+		// Arrange
+		exported := perform(owner, http.MethodGet, "/export", nil)
+		require.Equal(http.StatusOK, exported.Code)
+
+		// Act
+		recorder := perform(importer, http.MethodPost, "/import", exported.Body)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		imported := models.Video{}
+		require.Nil(database.Preload("Annotations").First(&imported, "user_id = ?", importer.ID).Error)
+		original := owner.Videos[0]
+		assert.Equal(original.Title, imported.Title)
+		assert.Equal(original.Description, imported.Description)
+		require.Len(imported.Annotations, 1)
+		assert.Equal(original.Annotations[0].Title, imported.Annotations[0].Title)
+		assert.Equal(original.Annotations[0].Notes, imported.Annotations[0].Notes)
+	})
+}
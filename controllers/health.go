@@ -1,11 +1,126 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"path/filepath"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
 )
 
+const (
+	StatusUp   string = "up"
+	StatusDown string = "down"
+)
+
+var ErrDiskSpaceUnsupported = errors.New("disk space check is not supported on this platform")
+
+type HealthController struct {
+	Database         models.DataAccessInterface
+	Filename         string
+	Models           []interface{}
+	MinimumFreeSpace uint64
+	Timeout          time.Duration
+	Started          time.Time
+}
+
+type Check struct {
+	Status  string `json:"status"`
+	Latency string `json:"latency"`
+	Error   string `json:"error,omitempty"`
+	Details gin.H  `json:"details,omitempty"`
+}
+
+type HealthReport struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
 func HealthCheck(context *gin.Context) {
 	context.String(http.StatusOK, "OK, go!")
 }
+
+func measure(probe func() (gin.H, error)) Check {
+	start := time.Now()
+	details, exception := probe()
+	check := Check{
+		Status:  StatusUp,
+		Latency: time.Since(start).String(),
+		Details: details,
+	}
+	if exception != nil {
+		check.Status = StatusDown
+		check.Error = exception.Error()
+	}
+	return check
+}
+
+func report(context *gin.Context, checks map[string]Check) {
+	status := http.StatusOK
+	health := HealthReport{Status: StatusUp, Checks: checks}
+	for _, check := range checks {
+		if check.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+			health.Status = StatusDown
+		}
+	}
+	context.JSON(status, &health)
+}
+
+// Livez tells whether the process is able to serve requests at all, so it
+// doesn't check any dependency.
+func (health *HealthController) Livez(context *gin.Context) {
+	report(context, map[string]Check{
+		"server": measure(func() (gin.H, error) {
+			return gin.H{"uptime": time.Since(health.Started).Round(time.Second).String()}, nil
+		}),
+	})
+}
+
+// Readyz tells whether the dependencies are ready to serve requests: the
+// database answers, its schema is up to date and there is space left for it.
+func (health *HealthController) Readyz(context *gin.Context) {
+	report(context, map[string]Check{
+		"database":   measure(func() (gin.H, error) { return nil, health.ping(context.Request.Context()) }),
+		"migrations": measure(health.migrations),
+		"disk":       measure(health.disk),
+	})
+}
+
+func (health *HealthController) ping(request context.Context) error {
+	connection, exception := health.Database.DB()
+	if exception != nil {
+		return exception
+	}
+
+	deadline, cancel := context.WithTimeout(request, health.Timeout)
+	defer cancel()
+	return connection.PingContext(deadline)
+}
+
+func (health *HealthController) migrations() (gin.H, error) {
+	if exception := models.CheckSchema(health.Database.Migrator(), health.Models); exception != nil {
+		return nil, exception
+	}
+	return gin.H{"tables": len(health.Models)}, nil
+}
+
+func (health *HealthController) disk() (gin.H, error) {
+	free, exception := freeSpace(filepath.Dir(health.Filename))
+	if errors.Is(exception, ErrDiskSpaceUnsupported) {
+		return gin.H{"supported": false}, nil
+	}
+	if exception != nil {
+		return nil, exception
+	}
+
+	details := gin.H{"free_bytes": free, "minimum_bytes": health.MinimumFreeSpace}
+	if free < health.MinimumFreeSpace {
+		return details, fmt.Errorf("only %d bytes left for the database", free)
+	}
+	return details, nil
+}
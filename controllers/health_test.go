@@ -1,7 +1,12 @@
 package controllers
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +14,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/mocks"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
 )
 
 func TestHealth(test *testing.T) {
@@ -28,3 +37,156 @@ func TestHealth(test *testing.T) {
 	// Check to see if the response was what you expected
 	assert.Equal(http.StatusOK, recorder.Code)
 }
+
+func TestLivez(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should report the server as up with its uptime", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		health := &HealthController{Started: time.Now().Add(-time.Minute)}
+		server.GET("/livez", health.Livez)
+		request, _ := http.NewRequest(http.MethodGet, "/livez", nil)
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		var report HealthReport
+		json.Unmarshal(recorder.Body.Bytes(), &report)
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(StatusUp, report.Status)
+		assert.Equal(StatusUp, report.Checks["server"].Status)
+		assert.NotEmpty(report.Checks["server"].Latency)
+		assert.Equal("1m0s", report.Checks["server"].Details["uptime"])
+	})
+}
+
+func TestReadyz(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	connect := func(test *testing.T) *gorm.DB {
+		database, exception := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		require.Nil(exception)
+		return database
+	}
+
+	perform := func(health *HealthController) (*httptest.ResponseRecorder, HealthReport) {
+		server := gin.New()
+		server.GET("/readyz", health.Readyz)
+		request, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+
+		var report HealthReport
+		json.Unmarshal(recorder.Body.Bytes(), &report)
+		return recorder, report
+	}
+
+	test.Run("Should be ready when database answers, it's migrated and has disk space", func(test *testing.T) {
+		// Arrange
+		database := connect(test)
+		require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}))
+		health := &HealthController{
+			Database: database,
+			Filename: filepath.Join(test.TempDir(), "test.db"),
+			Models:   []interface{}{&models.User{}, &models.Video{}},
+			Timeout:  time.Second,
+		}
+
+		// Act
+		recorder, report := perform(health)
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(StatusUp, report.Status)
+		for _, name := range []string{"database", "migrations", "disk"} {
+			assert.Equal(StatusUp, report.Checks[name].Status, name)
+			assert.NotEmpty(report.Checks[name].Latency, name)
+		}
+	})
+
+	test.Run("Should NOT be ready when migrations are pending", func(test *testing.T) {
+		// Arrange
+		database := connect(test)
+		require.Nil(database.AutoMigrate(&models.User{}))
+		health := &HealthController{
+			Database: database,
+			Filename: filepath.Join(test.TempDir(), "test.db"),
+			Models:   []interface{}{&models.User{}, &models.Video{}},
+			Timeout:  time.Second,
+		}
+
+		// Act
+		recorder, report := perform(health)
+
+		// Assert
+		assert.Equal(http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(StatusDown, report.Status)
+		assert.Equal(StatusUp, report.Checks["database"].Status)
+		assert.Equal(StatusDown, report.Checks["migrations"].Status)
+		assert.Equal("missing table videos", report.Checks["migrations"].Error)
+	})
+
+	test.Run("Should NOT be ready when database is closed", func(test *testing.T) {
+		// Arrange
+		database := connect(test)
+		connection, _ := database.DB()
+		connection.Close()
+		health := &HealthController{
+			Database: database,
+			Filename: filepath.Join(test.TempDir(), "test.db"),
+			Timeout:  time.Second,
+		}
+
+		// Act
+		recorder, report := perform(health)
+
+		// Assert
+		assert.Equal(http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(StatusDown, report.Checks["database"].Status)
+		assert.Contains(report.Checks["database"].Error, "database is closed")
+	})
+
+	test.Run("Should NOT be ready when there is no generic SQL connection", func(test *testing.T) {
+		// Arrange
+		database := new(mocks.MockedDataAccessInterface)
+		database.On("DB").Return(nil, errors.New("no connection"))
+		health := &HealthController{
+			Database: database,
+			Filename: filepath.Join(test.TempDir(), "test.db"),
+		}
+		database.On("Migrator").Return(connect(test).Migrator())
+
+		// Act
+		recorder, report := perform(health)
+
+		// Assert
+		assert.Equal(http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal("no connection", report.Checks["database"].Error)
+		database.AssertExpectations(test)
+	})
+
+	test.Run("Should NOT be ready when disk space is below the minimum", func(test *testing.T) {
+		// Arrange
+		database := connect(test)
+		health := &HealthController{
+			Database:         database,
+			Filename:         filepath.Join(test.TempDir(), "test.db"),
+			MinimumFreeSpace: math.MaxUint64,
+			Timeout:          time.Second,
+		}
+
+		// Act
+		recorder, report := perform(health)
+
+		// Assert
+		assert.Equal(http.StatusServiceUnavailable, recorder.Code)
+		assert.Equal(StatusDown, report.Checks["disk"].Status)
+		assert.Contains(report.Checks["disk"].Error, "bytes left for the database")
+	})
+}
@@ -0,0 +1,462 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/webhooks"
+	"gorm.io/gorm"
+)
+
+const (
+	ImportAtomic     string = "atomic"
+	ImportBestEffort string = "best-effort"
+
+	// Statuses of each row of an import or operation of a batch
+	ResultCreated string = "created"
+	ResultUpdated string = "updated"
+	ResultDeleted string = "deleted"
+	ResultFailed  string = "failed"
+
+	JSONLinesContentType string = "application/jsonl"
+	NDJSONContentType    string = "application/x-ndjson"
+	CSVContentType       string = "text/csv"
+
+	// ImportMaximumSize is the largest body accepted by an import
+	ImportMaximumSize int64 = 16 << 20
+)
+
+// CSVColumns are the columns accepted on the CSV imports. Each row has a
+// video and optionally one of its annotations, the video columns are repeated
+// to add more annotations to the same video.
+var CSVColumns = []string{
+	"title", "description", "link", "duration",
+	"annotation_type", "annotation_title", "annotation_notes", "annotation_start", "annotation_end",
+}
+
+// errRolledBack discards the whole import on atomic mode when any row failed.
+var errRolledBack = errors.New("import rolled back")
+
+type ImportController struct {
+	Database models.DataAccessInterface
+	Hub      *events.Hub
+	Webhooks *webhooks.Dispatcher
+}
+
+// ImportAnnotationContract is an annotation of an imported video, it's
+// validated with the same rules as AddAnnotationContract.
+type ImportAnnotationContract struct {
+	Type  uint             `json:"type"`
+	Title string           `json:"title" binding:"required"`
+	Notes string           `json:"notes"`
+	Start models.TimeStamp `json:"start" binding:"required,ltefield=End"`
+	End   models.TimeStamp `json:"end" binding:"required"`
+}
+
+// ImportVideoContract is each line of a JSON Lines import.
+type ImportVideoContract struct {
+	AddVideoContract
+	Annotations []ImportAnnotationContract `json:"annotations"`
+}
+
+// ImportResult tells what happened with a row of the import.
+type ImportResult struct {
+	Line        int               `json:"line"`
+	Link        string            `json:"link,omitempty"`
+	Status      string            `json:"status"`
+	VideoID     uint              `json:"video_id,omitempty"`
+	Annotations int               `json:"annotations"`
+	Error       *problems.Problem `json:"error,omitempty"`
+}
+
+// ImportReport sums up an import along with the result of each row. Nothing
+// is saved when it's not committed.
+type ImportReport struct {
+	Mode      string         `json:"mode"`
+	Committed bool           `json:"committed"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Failed    int            `json:"failed"`
+	Results   []ImportResult `json:"results"`
+}
+
+// importRow is a video read from the input, or the reason it couldn't be read.
+type importRow struct {
+	Line  int
+	Video ImportVideoContract
+	Error error
+}
+
+// importChange is a saved annotation, published to the followers of its video
+// once the import is committed.
+type importChange struct {
+	Kind       string
+	Annotation models.Annotation
+}
+
+// Import creates or updates (by link) the videos of the current user along
+// with their annotations, reading them either as JSON Lines or CSV. On atomic
+// mode nothing is saved unless all the rows are valid, otherwise the import is
+// rejected, and on best-effort mode the valid rows are saved anyway. In both
+// cases the result of each row is reported. The webhooks are notified of the
+// saved videos and annotations, and the followers of the videos get the
+// changes of their annotations once they are committed.
+func (imports *ImportController) Import(context *gin.Context) {
+	mode := context.DefaultQuery("mode", ImportAtomic)
+	if mode != ImportAtomic && mode != ImportBestEffort {
+		problems.Abort(context, problems.InvalidInput.WithDetail(
+			fmt.Sprintf("mode must be either %q or %q", ImportAtomic, ImportBestEffort),
+		))
+		return
+	}
+
+	var read func(io.Reader) ([]importRow, error)
+	switch context.ContentType() {
+	case JSONLinesContentType, NDJSONContentType:
+		read = readJSONLines
+	case CSVContentType:
+		read = readCSV
+	default:
+		problems.Abort(context, problems.UnsupportedMedia.WithDetail(
+			fmt.Sprintf("the import must be either %s or %s", JSONLinesContentType, CSVContentType),
+		))
+		return
+	}
+
+	rows, exception := read(http.MaxBytesReader(context.Writer, context.Request.Body, ImportMaximumSize))
+	if exception != nil {
+		problems.Abort(context, problems.InvalidInput.Wrap(exception).WithDetail(exception.Error()))
+		return
+	}
+
+	user := CurrentUser(context)
+	report := &ImportReport{Mode: mode, Results: make([]ImportResult, 0, len(rows))}
+	database := Session(context, imports.Database)
+	if mode == ImportBestEffort {
+		changes := imports.importRows(context, database, user, rows, report)
+		report.Committed = true
+		imports.Webhooks.Notify()
+		imports.publish(context, changes)
+		context.JSON(http.StatusOK, report)
+		return
+	}
+
+	var changes []importChange
+	exception = database.Transaction(func(transaction *gorm.DB) error {
+		changes = imports.importRows(context, transaction, user, rows, report)
+		if report.Failed > 0 {
+			return errRolledBack
+		}
+		return nil
+	})
+	if exception != nil && !errors.Is(exception, errRolledBack) {
+		problems.Abort(context, exception)
+		return
+	}
+
+	report.Committed = exception == nil
+	if !report.Committed {
+		// The failures are listed by the line of their row
+		failures := []*problems.Problem{}
+		for index, result := range report.Results {
+			report.Results[index].VideoID = 0
+			for len(failures) <= result.Line {
+				failures = append(failures, nil)
+			}
+			failures[result.Line] = result.Error
+		}
+		problems.Abort(context, problems.ImportRolledBack.Items("lines", failures).WithReport(report))
+		return
+	}
+	imports.Webhooks.Notify()
+	imports.publish(context, changes)
+	context.JSON(http.StatusOK, report)
+}
+
+// publish tells the followers of the videos about the changes of their
+// annotations. Failing to publish doesn't fail the request, as the changes are
+// already saved.
+func (imports *ImportController) publish(context *gin.Context, changes []importChange) {
+	for _, change := range changes {
+		if exception := imports.Hub.Publish(change.Annotation.VideoID, change.Kind, detached(change.Annotation)); exception != nil {
+			context.Error(exception)
+		}
+	}
+}
+
+// importRows saves each row on its own (nested) transaction, so a failing row
+// leaves nothing behind, and returns the changes of the annotations of the
+// rows saved.
+func (imports *ImportController) importRows(
+	context *gin.Context,
+	database models.DataAccessInterface,
+	user *models.User,
+	rows []importRow,
+	report *ImportReport,
+) []importChange {
+	changes := []importChange{}
+	for _, row := range rows {
+		result := ImportResult{Line: row.Line, Link: row.Video.Link}
+		var saved []importChange
+		exception := row.Error
+		if exception == nil {
+			exception = database.Transaction(func(transaction *gorm.DB) error {
+				var importing error
+				saved, importing = imports.importVideo(context, transaction, user, &row.Video, &result)
+				return importing
+			})
+		}
+
+		switch {
+		case exception != nil:
+			result.Status, result.VideoID, result.Annotations = ResultFailed, 0, 0
+			result.Error = problems.From(exception)
+			report.Failed++
+		case result.Status == ResultCreated:
+			report.Created++
+		default:
+			report.Updated++
+		}
+		if exception == nil {
+			changes = append(changes, saved...)
+		}
+		report.Results = append(report.Results, result)
+	}
+	return changes
+}
+
+// importVideo validates the video and creates it, or updates the one of the
+// user with the same link, and then does the same for its annotations, which
+// are matched by title, start and end. The webhooks are notified of each
+// change within the transaction.
+func (imports *ImportController) importVideo(
+	context *gin.Context,
+	transaction *gorm.DB,
+	user *models.User,
+	input *ImportVideoContract,
+	result *ImportResult,
+) ([]importChange, error) {
+	if exception := binding.Validator.ValidateStruct(&input.AddVideoContract); exception != nil {
+		return nil, problems.Input(exception)
+	}
+
+	video := models.Video{}
+	searching := transaction.Where("user_id = ? AND link = ?", user.ID, input.Link).Limit(1).Find(&video)
+	if searching.Error != nil {
+		return nil, searching.Error
+	}
+
+	video.UserID = user.ID
+	video.Title, video.Description = input.Title, input.Description
+	video.Link, video.Duration = input.Link, input.Duration
+	kind := events.VideoUpdated
+	result.Status = ResultUpdated
+	if searching.RowsAffected == 0 {
+		result.Status, kind = ResultCreated, events.VideoCreated
+	}
+	if exception := transaction.Save(&video).Error; exception != nil {
+		return nil, exception
+	}
+	if exception := notify(context, imports.Webhooks, transaction, kind, &video); exception != nil {
+		return nil, exception
+	}
+	result.VideoID = video.ID
+
+	changes := make([]importChange, 0, len(input.Annotations))
+	for index, annotation := range input.Annotations {
+		contract := AddAnnotationContract{
+			VideoID: video.ID,
+			Type:    annotation.Type,
+			Title:   annotation.Title,
+			Notes:   annotation.Notes,
+			Start:   annotation.Start,
+			End:     annotation.End,
+		}
+		change, exception := imports.importAnnotation(context, transaction, &contract, video.Duration)
+		if exception != nil {
+			problem := problems.From(exception)
+			detail := fmt.Sprintf("annotation %d", index+1)
+			if problem.Detail != "" {
+				detail += ": " + problem.Detail
+			}
+			return nil, problem.WithDetail(detail)
+		}
+		changes = append(changes, change)
+		result.Annotations++
+	}
+	return changes, nil
+}
+
+func (imports *ImportController) importAnnotation(
+	context *gin.Context,
+	transaction *gorm.DB,
+	input *AddAnnotationContract,
+	duration models.TimeStamp,
+) (importChange, error) {
+	if exception := binding.Validator.ValidateStruct(input); exception != nil {
+		return importChange{}, problems.Input(exception)
+	}
+	if exception := ValidateInterval(input.Start, input.End, duration); exception != nil {
+		return importChange{}, exception
+	}
+
+	annotation := models.Annotation{}
+	searching := transaction.Where(map[string]interface{}{
+		"video_id": input.VideoID,
+		"title":    input.Title,
+		"start":    input.Start,
+		"end":      input.End,
+	}).Limit(1).Find(&annotation)
+	if searching.Error != nil {
+		return importChange{}, searching.Error
+	}
+
+	annotation.VideoID, annotation.Type = input.VideoID, input.Type
+	annotation.Title, annotation.Notes = input.Title, input.Notes
+	annotation.Start, annotation.End = input.Start, input.End
+	kind := events.AnnotationUpdated
+	if searching.RowsAffected == 0 {
+		kind = events.AnnotationCreated
+	}
+	if exception := transaction.Save(&annotation).Error; exception != nil {
+		return importChange{}, exception
+	}
+	if exception := notify(context, imports.Webhooks, transaction, kind, detached(annotation)); exception != nil {
+		return importChange{}, exception
+	}
+	return importChange{Kind: kind, Annotation: annotation}, nil
+}
+
+// readJSONLines reads a video with its annotations from each line, skipping
+// the blank ones.
+func readJSONLines(reader io.Reader) ([]importRow, error) {
+	rows := []importRow{}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(ImportMaximumSize))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		row := importRow{Line: line}
+		if exception := json.Unmarshal([]byte(text), &row.Video); exception != nil {
+			row.Error = problems.Input(exception)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// readCSV reads a video and up to one of its annotations from each record,
+// the columns are given by the header.
+func readCSV(reader io.Reader) ([]importRow, error) {
+	records := csv.NewReader(reader)
+	header, exception := records.Read()
+	if errors.Is(exception, io.EOF) {
+		return []importRow{}, nil
+	}
+	if exception != nil {
+		return nil, exception
+	}
+
+	columns := map[string]int{}
+	for index, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		known := false
+		for _, column := range CSVColumns {
+			known = known || column == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown column %q, expected any of %s", name, strings.Join(CSVColumns, ", "))
+		}
+		columns[name] = index
+	}
+
+	rows := []importRow{}
+	for {
+		record, exception := records.Read()
+		if errors.Is(exception, io.EOF) {
+			return rows, nil
+		}
+
+		// The malformed records reject the whole input, as the following
+		// ones can't be told apart
+		var parsing *csv.ParseError
+		if exception != nil && !errors.Is(exception, csv.ErrFieldCount) {
+			return nil, exception
+		}
+
+		row := importRow{}
+		if errors.As(exception, &parsing) {
+			row.Line = parsing.StartLine
+			row.Error = problems.InvalidInput.WithDetail(fmt.Sprintf("expected %d fields, got %d", len(header), len(record)))
+		} else {
+			row.Line, _ = records.FieldPos(0)
+			row.Video, row.Error = csvVideo(record, columns)
+		}
+		rows = append(rows, row)
+	}
+}
+
+func csvVideo(record []string, columns map[string]int) (ImportVideoContract, error) {
+	field := func(name string) string {
+		if index, exists := columns[name]; exists {
+			return unescapeFormula(strings.TrimSpace(record[index]))
+		}
+		return ""
+	}
+	failures := []string{}
+	timestamp := func(name string) models.TimeStamp {
+		value := field(name)
+		if value == "" {
+			return 0
+		}
+		parsed, exception := models.ParseTimeStamp(value)
+		if exception != nil {
+			failures = append(failures, fmt.Sprintf("invalid %s %q", name, value))
+		}
+		return parsed
+	}
+
+	video := ImportVideoContract{AddVideoContract: AddVideoContract{
+		Title:       field("title"),
+		Description: field("description"),
+		Link:        field("link"),
+		Duration:    timestamp("duration"),
+	}}
+
+	annotation := ImportAnnotationContract{
+		Title: field("annotation_title"),
+		Notes: field("annotation_notes"),
+		Start: timestamp("annotation_start"),
+		End:   timestamp("annotation_end"),
+	}
+	if value := field("annotation_type"); value != "" {
+		parsed, exception := strconv.ParseUint(value, 10, 0)
+		if exception != nil {
+			failures = append(failures, fmt.Sprintf("invalid annotation_type %q", value))
+		}
+		annotation.Type = uint(parsed)
+	}
+	if annotation != (ImportAnnotationContract{}) {
+		video.Annotations = []ImportAnnotationContract{annotation}
+	}
+
+	if len(failures) > 0 {
+		return video, problems.InvalidInput.WithDetail(strings.Join(failures, ", "))
+	}
+	return video, nil
+}
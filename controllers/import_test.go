@@ -0,0 +1,284 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/webhooks"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestImport(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// seed creates the importing user and another one already owning a video
+	// with the same link as the imported ones.
+	seed := func(test *testing.T) (*gorm.DB, *models.User) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "import.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}))
+		owner := &models.User{Nickname: "owner"}
+		require.Nil(database.Create(owner).Error)
+		other := &models.User{Nickname: "other", Videos: []models.Video{{
+			Title:    "Other",
+			Link:     "https://dummy.io/one",
+			Duration: 10,
+		}}}
+		require.Nil(database.Create(other).Error)
+		return database, owner
+	}
+
+	perform := func(database *gorm.DB, user *models.User, path string, contentType string, body string) (*httptest.ResponseRecorder, ImportReport) {
+		imports := &ImportController{Database: database}
+		server := gin.New()
+		server.POST("/import", func(context *gin.Context) { context.Set("user", user) }, imports.Import)
+		request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		request.Header.Set("Content-Type", contentType)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		report := ImportReport{}
+		json.Unmarshal(recorder.Body.Bytes(), &report)
+		return recorder, report
+	}
+
+	videos := func(database *gorm.DB, user *models.User) []models.Video {
+		recordset := []models.Video{}
+		database.Preload("Annotations").Order("id").Find(&recordset, "user_id = ?", user.ID)
+		return recordset
+	}
+
+	lines := strings.Join([]string{
+		`{"title":"One","link":"https://dummy.io/one","duration":"00:02:00","annotations":[{"title":"Intro","start":1,"end":30},{"title":"Outro","start":"1m30s","end":120}]}`,
+		``,
+		`{"title":"Two","link":"https://dummy.io/two","duration":60}`,
+	}, "\n")
+
+	test.Run("Should create the videos with their annotations", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+
+		// Act
+		recorder, report := perform(database, owner, "/import", JSONLinesContentType, lines)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.True(report.Committed)
+		assert.Equal(ImportAtomic, report.Mode)
+		assert.Equal(2, report.Created)
+		assert.Equal(0, report.Failed)
+		require.Len(report.Results, 2)
+		assert.Equal(1, report.Results[0].Line)
+		assert.Equal(2, report.Results[0].Annotations)
+		assert.Equal(3, report.Results[1].Line)
+		saved := videos(database, owner)
+		require.Len(saved, 2)
+		assert.Equal(saved[0].ID, report.Results[0].VideoID)
+		assert.Equal(models.TimeStamp(90), saved[0].Annotations[1].Start)
+	})
+
+	test.Run("Should update the videos by link when importing again", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+		perform(database, owner, "/import", NDJSONContentType, lines)
+		again := strings.Replace(lines, `"title":"Two"`, `"title":"Second"`, 1)
+
+		// Act
+		recorder, report := perform(database, owner, "/import", NDJSONContentType, again)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(0, report.Created)
+		assert.Equal(2, report.Updated)
+		assert.Equal(ResultUpdated, report.Results[0].Status)
+		saved := videos(database, owner)
+		require.Len(saved, 2)
+		assert.Len(saved[0].Annotations, 2)
+		assert.Equal("Second", saved[1].Title)
+	})
+
+	invalid := lines + "\n" +
+		`{"title":"Three","link":"https://dummy.io/three","duration":60,"annotations":[{"title":"Late","start":30,"end":90}]}` + "\n" +
+		`{"title":"Four","link":"not a link","duration":60}` + "\n" +
+		`{"title":"Five",`
+
+	test.Run("Should save nothing on atomic mode when any row fails", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+
+		// Act
+		recorder, _ := perform(database, owner, "/import?mode=atomic", JSONLinesContentType, invalid)
+
+		// Assert
+		require.Equal(http.StatusUnprocessableEntity, recorder.Code, recorder.Body.String())
+		assert.Equal(problems.ContentType, recorder.Header().Get("Content-Type"))
+		rejection := struct {
+			Code   string                `json:"code"`
+			Errors []problems.FieldError `json:"errors"`
+			Report ImportReport          `json:"report"`
+		}{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &rejection))
+		assert.Equal("import_rolled_back", rejection.Code)
+		fields := []string{}
+		for _, failure := range rejection.Errors {
+			fields = append(fields, failure.Field)
+		}
+		assert.Equal([]string{"lines[4]", "lines[5].link", "lines[6]"}, fields)
+		report := rejection.Report
+		assert.False(report.Committed)
+		assert.Equal(3, report.Failed)
+		assert.Empty(videos(database, owner))
+		assert.Zero(report.Results[0].VideoID)
+		late := report.Results[2]
+		assert.Equal(4, late.Line)
+		assert.Equal(ResultFailed, late.Status)
+		assert.Equal("invalid_interval", late.Error.Code)
+		assert.Contains(late.Error.Detail, "annotation 1: start and end must be")
+		assert.Equal("validation_failed", report.Results[3].Error.Code)
+		assert.Equal("link", report.Results[3].Error.Errors[0].Field)
+		assert.Equal("invalid_input", report.Results[4].Error.Code)
+	})
+
+	test.Run("Should save the valid rows on best-effort mode", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+
+		// Act
+		recorder, report := perform(database, owner, "/import?mode=best-effort", JSONLinesContentType, invalid)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		assert.True(report.Committed)
+		assert.Equal(2, report.Created)
+		assert.Equal(3, report.Failed)
+		saved := videos(database, owner)
+		require.Len(saved, 2)
+		assert.Equal("https://dummy.io/two", saved[1].Link)
+	})
+
+	test.Run("Should read a video and one annotation from each CSV record", func(test *testing.T) {
+		// Arrange
+		database, owner := seed(test)
+		records := "Title,Link,Duration,Annotation_Title,Annotation_Start,Annotation_End,Annotation_Type\n" +
+			"One,https://dummy.io/one,2m,Intro,1,30,1\n" +
+			"One,https://dummy.io/one,2m,Outro,01:30,02:00,\n" +
+			"Two,https://dummy.io/two,1m,,,,\n" +
+			"Three,https://dummy.io/three,soon,,,,\n" +
+			"Four,https://dummy.io/four\n"
+
+		// Act
+		recorder, report := perform(database, owner, "/import?mode=best-effort", CSVContentType+"; charset=utf-8", records)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal(2, report.Created)
+		assert.Equal(1, report.Updated)
+		assert.Equal(2, report.Failed)
+		assert.Equal(5, report.Results[3].Line)
+		assert.Contains(report.Results[3].Error.Detail, `invalid duration "soon"`)
+		assert.Contains(report.Results[4].Error.Detail, "expected 7 fields, got 2")
+		saved := videos(database, owner)
+		require.Len(saved, 2)
+		require.Len(saved[0].Annotations, 2)
+		assert.Equal(uint(1), saved[0].Annotations[0].Type)
+		assert.Empty(saved[1].Annotations)
+	})
+
+	testcases := []struct {
+		Description string
+		Path        string
+		ContentType string
+		Body        string
+		Status      int
+		Code        string
+	}{
+		{"Should reject an unknown mode", "/import?mode=maybe", JSONLinesContentType, lines, http.StatusBadRequest, "invalid_input"},
+		{"Should reject other formats", "/import", "application/json", lines, http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"Should reject unknown CSV columns", "/import", CSVContentType, "title,link,colour\n", http.StatusBadRequest, `unknown column \"colour\"`},
+		{"Should reject a malformed CSV record", "/import", CSVContentType, "title,link\nab\"c,x\n", http.StatusBadRequest, `parse error on line 2, column 3`},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner := seed(test)
+
+			// Act
+			recorder, _ := perform(database, owner, testcase.Path, testcase.ContentType, testcase.Body)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			assert.Empty(videos(database, owner))
+		})
+	}
+
+	notifications := []struct {
+		Description string
+		Path        string
+		Body        string
+		Deliveries  []string
+		Published   int
+	}{
+		{
+			"Should notify the changes of the committed import", "/import", lines,
+			[]string{events.AnnotationCreated, events.AnnotationCreated, events.VideoCreated, events.VideoUpdated}, 2,
+		},
+		{
+			"Should notify only the changes of the rows saved on best-effort mode", "/import?mode=best-effort", invalid,
+			[]string{events.AnnotationCreated, events.AnnotationCreated, events.VideoCreated, events.VideoUpdated}, 2,
+		},
+		{"Should NOT notify the changes of the rolled back import", "/import?mode=atomic", invalid, []string{}, 0},
+	}
+
+	for _, testcase := range notifications {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner := seed(test)
+			require.Nil(database.AutoMigrate(&models.Webhook{}, &models.WebhookDelivery{}))
+			webhook := models.Webhook{UserID: owner.ID, URL: "https://ci.io/hook", Events: webhooks.Events, Active: true}
+			require.Nil(database.Create(&webhook).Error)
+			existing := models.Video{UserID: owner.ID, Title: "One", Link: "https://dummy.io/one", Duration: 120}
+			require.Nil(database.Create(&existing).Error)
+			hub := events.NewHub(10)
+			subscription := hub.Subscribe(existing.ID, 0)
+			defer subscription.Close()
+			imports := &ImportController{Database: database, Hub: hub, Webhooks: &webhooks.Dispatcher{}}
+			server := gin.New()
+			server.POST("/import", func(context *gin.Context) { context.Set("user", owner) }, imports.Import)
+			request, _ := http.NewRequest(http.MethodPost, testcase.Path, strings.NewReader(testcase.Body))
+			request.Header.Set("Content-Type", JSONLinesContentType)
+
+			// Act
+			server.ServeHTTP(httptest.NewRecorder(), request)
+
+			// Assert
+			enqueued := []string{}
+			require.Nil(database.Model(&models.WebhookDelivery{}).Order("event, id").Pluck("event", &enqueued).Error)
+			assert.Equal(testcase.Deliveries, enqueued)
+			published := 0
+			for pending := true; pending; {
+				select {
+				case event := <-subscription.Events:
+					assert.Equal(events.AnnotationCreated, event.Type)
+					published++
+				default:
+					pending = false
+				}
+			}
+			assert.Equal(testcase.Published, published)
+		})
+	}
+}
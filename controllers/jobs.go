@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"golang.org/x/exp/slices"
+)
+
+// MaximumJobs is the number of the latest jobs listed.
+const MaximumJobs int = 100
+
+// JobStatistics counts the jobs on each status.
+type JobStatistics map[string]int64
+
+type JobsController struct {
+	Database models.DataAccessInterface
+	Queue    *jobs.Queue
+}
+
+func (tasks *JobsController) search(context *gin.Context, job *models.Job) bool {
+	searching := Session(context, tasks.Database).First(job, "id = ?", context.Param("id")).Error
+	if searching != nil {
+		problems.Abort(context, notFound(problems.JobNotFound, searching))
+		return false
+	}
+	return true
+}
+
+// Index lists the latest jobs, the newest first, optionally only the ones with
+// the status or kind given as query parameters.
+func (tasks *JobsController) Index(context *gin.Context) {
+	database := Session(context, tasks.Database).Model(&models.Job{}).Order("id DESC").Limit(MaximumJobs)
+	if status, given := context.GetQuery("status"); given {
+		if !slices.Contains(models.JobStatuses, status) {
+			exception := fmt.Errorf("status must be one of %s", strings.Join(models.JobStatuses, ", "))
+			problems.Abort(context, problems.InvalidInput.Wrap(exception).WithDetail(exception.Error()))
+			return
+		}
+		database = database.Where("status = ?", status)
+	}
+	if kind, given := context.GetQuery("kind"); given {
+		database = database.Where("kind = ?", kind)
+	}
+
+	recordset := []models.Job{}
+	if searching := database.Find(&recordset).Error; searching != nil {
+		problems.Abort(context, searching)
+		return
+	}
+	context.JSON(http.StatusOK, recordset)
+}
+
+// Statistics counts the jobs on each status, including the ones without jobs.
+func (tasks *JobsController) Statistics(context *gin.Context) {
+	var rows []struct {
+		Status string
+		Total  int64
+	}
+	counting := Session(context, tasks.Database).
+		Model(&models.Job{}).
+		Select("status, COUNT(*) AS total").
+		Group("status").
+		Scan(&rows).Error
+	if counting != nil {
+		problems.Abort(context, counting)
+		return
+	}
+
+	statistics := JobStatistics{}
+	for _, status := range models.JobStatuses {
+		statistics[status] = 0
+	}
+	for _, row := range rows {
+		statistics[row.Status] = row.Total
+	}
+	context.JSON(http.StatusOK, statistics)
+}
+
+func (tasks *JobsController) View(context *gin.Context) {
+	var job models.Job
+	if !tasks.search(context, &job) {
+		return
+	}
+	context.JSON(http.StatusOK, &job)
+}
+
+// Retry enqueues again a failed or cancelled job to run as soon as possible.
+func (tasks *JobsController) Retry(context *gin.Context) {
+	var job models.Job
+	if !tasks.search(context, &job) {
+		return
+	}
+
+	if exception := tasks.Queue.Retry(Session(context, tasks.Database), &job); exception != nil {
+		problems.Abort(context, conflict(exception))
+		return
+	}
+	context.JSON(http.StatusAccepted, &job)
+}
+
+// Cancel stops a pending job from running, the running ones can't be stopped.
+func (tasks *JobsController) Cancel(context *gin.Context) {
+	var job models.Job
+	if !tasks.search(context, &job) {
+		return
+	}
+
+	if exception := tasks.Queue.Cancel(Session(context, tasks.Database), &job); exception != nil {
+		problems.Abort(context, conflict(exception))
+		return
+	}
+	context.JSON(http.StatusOK, &job)
+}
+
+// conflict reports the changes not allowed on the current status of the job.
+func conflict(exception error) error {
+	if errors.Is(exception, jobs.ErrNotCancellable) || errors.Is(exception, jobs.ErrNotRetriable) {
+		return problems.JobStatusConflict.Wrap(exception).WithDetail(exception.Error())
+	}
+	return exception
+}
@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestJobs(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// seed stores a job on each status, the pending one is the newest.
+	seed := func(test *testing.T) (*gorm.DB, map[string]models.Job) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "jobs.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.Job{}))
+		seeded := map[string]models.Job{}
+		now := time.Now()
+		for _, status := range []string{models.JobSucceeded, models.JobFailed, models.JobCancelled, models.JobRunning, models.JobPending} {
+			job := models.Job{Kind: "export", Status: status, RunAt: now, Attempts: 1, MaxAttempts: 3}
+			if status == models.JobSucceeded {
+				job.Kind = jobs.PurgeKind
+			}
+			require.Nil(database.Create(&job).Error)
+			seeded[status] = job
+		}
+		return database, seeded
+	}
+
+	perform := func(database *gorm.DB, method string, path string) *httptest.ResponseRecorder {
+		queue := jobs.NewQueue(database, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		tasks := &JobsController{Database: database, Queue: queue}
+		server := gin.New()
+		server.GET("/jobs", tasks.Index)
+		server.GET("/jobs/statistics", tasks.Statistics)
+		server.GET("/jobs/:id", tasks.View)
+		server.POST("/jobs/:id/retry", tasks.Retry)
+		server.POST("/jobs/:id/cancel", tasks.Cancel)
+		request, _ := http.NewRequest(method, path, nil)
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	listed := func(recorder *httptest.ResponseRecorder) []models.Job {
+		recordset := []models.Job{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &recordset))
+		return recordset
+	}
+
+	test.Run("Should list the jobs, the newest first", func(test *testing.T) {
+		// Arrange
+		database, _ := seed(test)
+
+		// Act
+		recorder := perform(database, http.MethodGet, "/jobs")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		recordset := listed(recorder)
+		require.Len(recordset, 5)
+		assert.Equal(models.JobPending, recordset[0].Status)
+		assert.Equal(models.JobSucceeded, recordset[4].Status)
+	})
+
+	test.Run("Should list only the jobs with the given status and kind", func(test *testing.T) {
+		// Arrange
+		database, seeded := seed(test)
+
+		// Act
+		failed := perform(database, http.MethodGet, "/jobs?status=failed")
+		purges := perform(database, http.MethodGet, "/jobs?kind="+jobs.PurgeKind)
+
+		// Assert
+		require.Equal(http.StatusOK, failed.Code)
+		recordset := listed(failed)
+		require.Len(recordset, 1)
+		assert.Equal(seeded[models.JobFailed].ID, recordset[0].ID)
+		require.Equal(http.StatusOK, purges.Code)
+		recordset = listed(purges)
+		require.Len(recordset, 1)
+		assert.Equal(seeded[models.JobSucceeded].ID, recordset[0].ID)
+	})
+
+	test.Run("Should NOT list the jobs of an unknown status", func(test *testing.T) {
+		// Arrange
+		database, _ := seed(test)
+
+		// Act
+		recorder := perform(database, http.MethodGet, "/jobs?status=lost")
+
+		// Assert
+		assert.Equal(http.StatusBadRequest, recorder.Code)
+		assert.Contains(recorder.Body.String(), "invalid_input")
+		assert.Contains(recorder.Body.String(), "status must be one of pending, running")
+	})
+
+	test.Run("Should count the jobs on each status", func(test *testing.T) {
+		// Arrange
+		database, seeded := seed(test)
+		require.Nil(database.Delete(&models.Job{}, seeded[models.JobCancelled].ID).Error)
+		require.Nil(database.Create(&models.Job{Kind: "export", Status: models.JobPending}).Error)
+
+		// Act
+		recorder := perform(database, http.MethodGet, "/jobs/statistics")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		assert.JSONEq(`{"pending":2,"running":1,"succeeded":1,"failed":1,"cancelled":0}`, recorder.Body.String())
+	})
+
+	test.Run("Should get the status of a job", func(test *testing.T) {
+		// Arrange
+		database, seeded := seed(test)
+		job := seeded[models.JobRunning]
+
+		// Act
+		recorder := perform(database, http.MethodGet, fmt.Sprintf("/jobs/%d", job.ID))
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		viewed := models.Job{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &viewed))
+		assert.Equal(job.ID, viewed.ID)
+		assert.Equal(models.JobRunning, viewed.Status)
+		assert.Equal(1, viewed.Attempts)
+	})
+
+	test.Run("Should retry a failed job", func(test *testing.T) {
+		// Arrange
+		database, seeded := seed(test)
+		job := seeded[models.JobFailed]
+
+		// Act
+		recorder := perform(database, http.MethodPost, fmt.Sprintf("/jobs/%d/retry", job.ID))
+
+		// Assert
+		require.Equal(http.StatusAccepted, recorder.Code, recorder.Body.String())
+		retried := models.Job{}
+		require.Nil(database.First(&retried, job.ID).Error)
+		assert.Equal(models.JobPending, retried.Status)
+		assert.Zero(retried.Attempts)
+	})
+
+	test.Run("Should cancel a pending job", func(test *testing.T) {
+		// Arrange
+		database, seeded := seed(test)
+		job := seeded[models.JobPending]
+
+		// Act
+		recorder := perform(database, http.MethodPost, fmt.Sprintf("/jobs/%d/cancel", job.ID))
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		cancelled := models.Job{}
+		require.Nil(database.First(&cancelled, job.ID).Error)
+		assert.Equal(models.JobCancelled, cancelled.Status)
+		assert.NotNil(cancelled.FinishedAt)
+	})
+
+	testcases := []struct {
+		Description string
+		Method      string
+		Path        string
+		Status      int
+		Code        string
+	}{
+		{"Should NOT retry a running job", http.MethodPost, "/jobs/%d/retry", http.StatusConflict, "job_status_conflict"},
+		{"Should NOT cancel a running job", http.MethodPost, "/jobs/%d/cancel", http.StatusConflict, "job_status_conflict"},
+		{"Should NOT get a missing job", http.MethodGet, "/jobs/%d0", http.StatusNotFound, "job_not_found"},
+		{"Should NOT retry a missing job", http.MethodPost, "/jobs/%d0/retry", http.StatusNotFound, "job_not_found"},
+		{"Should NOT cancel a missing job", http.MethodPost, "/jobs/%d0/cancel", http.StatusNotFound, "job_not_found"},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, seeded := seed(test)
+			job := seeded[models.JobRunning]
+
+			// Act
+			recorder := perform(database, testcase.Method, fmt.Sprintf(testcase.Path, job.ID))
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			unchanged := models.Job{}
+			require.Nil(database.First(&unchanged, job.ID).Error)
+			assert.Equal(models.JobRunning, unchanged.Status)
+		})
+	}
+}
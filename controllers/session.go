@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"gorm.io/gorm"
+)
+
+type contextual interface {
+	WithContext(context.Context) *gorm.DB
+}
+
+// Session scopes the database to the request context, so the database calls
+// are traced as part of the request. Databases unaware of the context (e. g.
+// the mocks) are returned as they are.
+func Session(context *gin.Context, database models.DataAccessInterface) models.DataAccessInterface {
+	if scoped, ok := database.(contextual); ok && context.Request != nil {
+		return scoped.WithContext(context.Request.Context())
+	}
+	return database
+}
+
+// notFound tells apart the missing records from any other failure when
+// searching them, so only the former are reported as the given problem.
+func notFound(problem *problems.Problem, exception error) error {
+	if errors.Is(exception, gorm.ErrRecordNotFound) {
+		return problem.Wrap(exception)
+	}
+	return exception
+}
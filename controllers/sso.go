@@ -0,0 +1,480 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/oidc"
+	"github.com/zatarain/note-vook/problems"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	DefaultSSOStateTTL        time.Duration = 10 * time.Minute
+	DefaultSSOConfirmationTTL time.Duration = 5 * time.Minute
+
+	// SSOStateCookie keeps the state of the login while the user is on the
+	// identity provider
+	SSOStateCookie string = "SSOState"
+)
+
+// SingleSignOn tells how the users log in with the identity provider, it's
+// disabled without provider.
+type SingleSignOn struct {
+	Provider *oidc.Provider
+
+	// NicknameClaim is the claim with the nickname of the provisioned users
+	NicknameClaim string
+
+	// RolesClaim is the claim whose values are mapped to the roles by Roles,
+	// the roles are not managed by the provider when the mapping is empty
+	RolesClaim string
+	Roles      map[string]string
+
+	// Provision creates the accounts of the users logging in for the first time
+	Provision bool
+
+	// StateTTL is the time the users have to come back from the provider
+	StateTTL time.Duration
+
+	// ConfirmationTTL is the time the users without password have to confirm
+	// an operation once they log in again with the provider
+	ConfirmationTTL time.Duration
+}
+
+// SSOLoginQuery starts the login with the identity provider, the logged users
+// link their account with it or log in again to confirm an operation instead.
+type SSOLoginQuery struct {
+	Link    bool `form:"link"`
+	Confirm bool `form:"confirm"`
+}
+
+// SSOCallbackQuery is what the identity provider sends back, either the code
+// or the error along with the state.
+type SSOCallbackQuery struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
+
+// ssoState is what the API remembers of the login while the user is on the
+// identity provider.
+type ssoState struct {
+	State    string
+	Nonce    string
+	Verifier string
+
+	// Link is the user linking its account, none when logging in
+	Link uint
+
+	// Confirm is the user logging in again to confirm an operation
+	Confirm uint
+}
+
+func (sso SingleSignOn) Enabled() bool {
+	return sso.Provider.Enabled()
+}
+
+func (sso SingleSignOn) stateTTL() time.Duration {
+	if sso.StateTTL <= 0 {
+		return DefaultSSOStateTTL
+	}
+	return sso.StateTTL
+}
+
+func (sso SingleSignOn) confirmationTTL() time.Duration {
+	if sso.ConfirmationTTL <= 0 {
+		return DefaultSSOConfirmationTTL
+	}
+	return sso.ConfirmationTTL
+}
+
+// role is the most privileged role mapped from the claims, which is the user
+// role when none of them is mapped. It tells whether the roles are managed by
+// the provider at all.
+func (sso SingleSignOn) role(claims oidc.Claims) (string, bool) {
+	if len(sso.Roles) == 0 {
+		return "", false
+	}
+	role := models.RoleUser
+	for _, value := range claims.Strings(sso.RolesClaim) {
+		mapped, found := sso.Roles[value]
+		if found && slices.Index(models.Roles, mapped) > slices.Index(models.Roles, role) {
+			role = mapped
+		}
+	}
+	return role, true
+}
+
+// nicknames are the nicknames to try for a provisioned user in order, the one
+// of the claims followed by the same one and then a generic one with a suffix
+// unique per user.
+func (sso SingleSignOn) nicknames(claims oidc.Claims, issuer string, subject string) []string {
+	sum := sha256.Sum256([]byte(issuer + " " + subject))
+	suffix := hex.EncodeToString(sum[:3])
+
+	nickname := claims.String(sso.NicknameClaim)
+	if nickname == "" {
+		nickname, _, _ = strings.Cut(claims.String("email"), "@")
+	}
+	if nickname == "" {
+		return []string{"user-" + suffix}
+	}
+	return []string{nickname, nickname + "-" + suffix, "user-" + suffix}
+}
+
+// LoginSSO sends the user to log in on the identity provider, which sends it
+// back to SSOCallback. The logged users link their account with ?link=true or
+// log in again with ?confirm=true to confirm an operation without password.
+func (users *UsersController) LoginSSO(context *gin.Context) {
+	if !users.SSO.Enabled() {
+		problems.Abort(context, problems.SSONotConfigured)
+		return
+	}
+
+	var query SSOLoginQuery
+	if binding := context.ShouldBindQuery(&query); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	if query.Link && query.Confirm {
+		problems.Abort(context, problems.InvalidInput.WithDetail("The account can't be linked and confirmed at once"))
+		return
+	}
+
+	state := &ssoState{}
+	var parameters url.Values
+	if query.Link || query.Confirm {
+		user, exception := users.ValidateToken(context)
+		if exception != nil {
+			problems.Abort(context, problems.Unauthorised.Wrap(exception).WithDetail(exception.Error()))
+			return
+		}
+		switch {
+		case query.Link && user.Linked():
+			problems.Abort(context, problems.SSOAlreadyLinked.WithDetail("The account is already linked to the identity provider"))
+			return
+		case query.Link:
+			state.Link = user.ID
+		case !user.Linked():
+			problems.Abort(context, problems.SSONotLinked.WithDetail("The account is not linked to the identity provider"))
+			return
+		default:
+			// The provider has to ask the user to log in again
+			state.Confirm = user.ID
+			parameters = url.Values{"prompt": {"login"}, "max_age": {"0"}}
+		}
+	}
+
+	// The same generator of the verifiers is good for the state and the nonce
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		random, exception := oidc.NewVerifier()
+		if exception != nil {
+			problems.Abort(context, exception)
+			return
+		}
+		*value = random
+	}
+
+	address, exception := users.SSO.Provider.AuthCodeURL(context.Request.Context(), state.State, state.Nonce, state.Verifier, parameters)
+	if exception != nil {
+		problems.Abort(context, problems.SSOUnavailable.Wrap(exception))
+		return
+	}
+
+	expiration := time.Now().Add(users.SSO.stateTTL())
+	data := jwt.MapClaims{
+		"sso_state":  state.State,
+		"nonce":      state.Nonce,
+		"verifier":   state.Verifier,
+		"link":       state.Link,
+		"confirm":    state.Confirm,
+		"expiration": expiration.Unix(),
+	}
+	cookie, exception := jwt.NewWithClaims(jwt.SigningMethodHS256, data).SignedString([]byte(users.SecretTokenKey))
+	if exception != nil {
+		problems.Abort(context, fmt.Errorf("unable to sign the single sign-on state: %w", exception))
+		return
+	}
+
+	// The callback may be under another path, e. g. when starting on the
+	// unversioned route
+	context.SetSameSite(http.SameSiteLaxMode)
+	context.SetCookie(SSOStateCookie, cookie, int(users.SSO.stateTTL().Seconds()), "/", "", false, true)
+	context.Header("Cache-Control", "no-store")
+	context.Redirect(http.StatusFound, address)
+}
+
+// ssoState reads the state of the login from its cookie, as long as it's still
+// valid and it matches the one sent back by the provider.
+func (users *UsersController) ssoState(context *gin.Context, sent string, now time.Time) (*ssoState, error) {
+	cookie, exception := context.Cookie(SSOStateCookie)
+	if exception != nil {
+		return nil, errors.New("the login was not started or it took too long")
+	}
+	token, exception := jwt.Parse(cookie, users.Decoder)
+	if exception != nil {
+		return nil, exception
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !(ok && token.Valid) {
+		return nil, errors.New("invalid state")
+	}
+	expiration, _ := claims["expiration"].(float64)
+	if now.Unix() > int64(expiration) {
+		return nil, errors.New("expired state")
+	}
+
+	state := &ssoState{}
+	state.State, _ = claims["sso_state"].(string)
+	state.Nonce, _ = claims["nonce"].(string)
+	state.Verifier, _ = claims["verifier"].(string)
+	link, _ := claims["link"].(float64)
+	state.Link = uint(link)
+	confirm, _ := claims["confirm"].(float64)
+	state.Confirm = uint(confirm)
+	if state.State == "" || subtle.ConstantTimeCompare([]byte(state.State), []byte(sent)) != 1 {
+		return nil, errors.New("the state doesn't match")
+	}
+	return state, nil
+}
+
+// SSOCallback completes the login with the identity provider. The users are
+// found by their subject on the provider and, unless disabled, the ones
+// logging in for the first time get an account without password.
+func (users *UsersController) SSOCallback(context *gin.Context) {
+	if !users.SSO.Enabled() {
+		problems.Abort(context, problems.SSONotConfigured)
+		return
+	}
+
+	// The state is single use, whatever the outcome
+	now := time.Now()
+	context.SetSameSite(http.SameSiteLaxMode)
+	context.SetCookie(SSOStateCookie, "", -1, "/", "", false, true)
+	context.Header("Cache-Control", "no-store")
+	var query SSOCallbackQuery
+	if binding := context.ShouldBindQuery(&query); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+	state, exception := users.ssoState(context, query.State, now)
+	if exception != nil {
+		problems.Abort(context, problems.InvalidSSOState.Wrap(exception).WithDetail(exception.Error()))
+		return
+	}
+	if query.Error != "" {
+		detail := strings.TrimSpace(query.Error + " " + query.ErrorDescription)
+		problems.Abort(context, problems.SSODenied.WithDetail("The identity provider answered: "+detail))
+		return
+	}
+
+	claims, exception := users.authenticate(context.Request.Context(), state, query.Code, now)
+	if errors.Is(exception, oidc.ErrDenied) {
+		users.logger().WarnContext(context.Request.Context(), "Single sign-on denied", "error", exception)
+		problems.Abort(context, problems.SSODenied.Wrap(exception))
+		return
+	}
+	if exception != nil {
+		problems.Abort(context, problems.SSOUnavailable.Wrap(exception))
+		return
+	}
+	users.signOn(context, state, claims, now)
+}
+
+// authenticate trades the code for the ID token of the user and verifies it.
+func (users *UsersController) authenticate(current context.Context, state *ssoState, code string, now time.Time) (oidc.Claims, error) {
+	raw, exception := users.SSO.Provider.Exchange(current, code, state.Verifier)
+	if exception != nil {
+		return nil, exception
+	}
+	return users.SSO.Provider.Verify(current, raw, state.Nonce, now)
+}
+
+// signOn links or confirms the account, or logs in the user identified by the
+// claims.
+func (users *UsersController) signOn(context *gin.Context, state *ssoState, claims oidc.Claims, now time.Time) {
+	issuer := users.SSO.Provider.Config.Issuer
+	subject := claims.String("sub")
+	role, managed := users.SSO.role(claims)
+
+	user := &models.User{}
+	Session(context, users.Database).First(user, "oidc_issuer = ? AND oidc_subject = ?", issuer, subject)
+	if state.Link != 0 {
+		users.link(context, user, state.Link, issuer, subject, role, managed)
+		return
+	}
+	if state.Confirm != 0 {
+		users.reauthenticate(context, user, state.Confirm, claims, now)
+		return
+	}
+
+	if user.ID == 0 {
+		if !users.SSO.Provision {
+			problems.Abort(context, problems.SSONotLinked)
+			return
+		}
+		provisioned, exception := users.provision(context, claims, issuer, subject, role)
+		if exception != nil {
+			problems.Abort(context, exception)
+			return
+		}
+		user = provisioned
+	} else if managed && user.Role != role {
+		updating := Session(context, users.Database).
+			Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("role", role).Error
+		if updating != nil {
+			problems.Abort(context, fmt.Errorf("unable to update the role: %w", updating))
+			return
+		}
+		users.logger().InfoContext(context.Request.Context(), "User role changed by the identity provider", "user_id", user.ID, "role", role)
+	}
+
+	if user.Disabled() {
+		users.logger().WarnContext(context.Request.Context(), "Single sign-on on a disabled account", "user_id", user.ID)
+		problems.Abort(context, problems.AccountDisabled)
+		return
+	}
+
+	// The users with two-factor authentication still have to send a code
+	if user.TwoFactor() {
+		users.challenge(context, user, now)
+		return
+	}
+
+	if exception := users.setToken(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	context.JSON(http.StatusOK, &Message{Message: "Yaaay! You are logged in :)"})
+}
+
+// link sets the subject on the provider to the account of the user who
+// started the login, unless it's linked to another account already.
+func (users *UsersController) link(context *gin.Context, linked *models.User, identifier uint, issuer string, subject string, role string, managed bool) {
+	user := &models.User{}
+	Session(context, users.Database).First(user, identifier)
+	if user.ID == 0 || user.Disabled() {
+		problems.Abort(context, problems.InvalidSSOState.WithDetail("The user linking the account is gone"))
+		return
+	}
+	if linked.ID != user.ID && (linked.ID != 0 || user.Linked()) {
+		problems.Abort(context, problems.SSOAlreadyLinked)
+		return
+	}
+
+	changes := map[string]interface{}{"oidc_issuer": issuer, "oidc_subject": subject}
+	if managed {
+		changes["role"] = role
+	}
+	linking := Session(context, users.Database).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(changes).Error
+	if linking != nil {
+		problems.Abort(context, fmt.Errorf("unable to link the account: %w", linking))
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User linked the identity provider", "user_id", user.ID)
+	context.JSON(http.StatusOK, &Message{Message: "Account successfully linked"})
+}
+
+// reauthenticate records that the user logged in again with the identity
+// provider, so it can confirm an operation without password for a while.
+func (users *UsersController) reauthenticate(context *gin.Context, linked *models.User, identifier uint, claims oidc.Claims, now time.Time) {
+	if linked.ID == 0 || linked.ID != identifier {
+		problems.Abort(context, problems.SSONotLinked.WithDetail("The identity provider user is not the one linked to the account"))
+		return
+	}
+	if linked.Disabled() {
+		problems.Abort(context, problems.AccountDisabled)
+		return
+	}
+
+	// Some providers keep the session instead of asking to log in again
+	authenticated, found := claims.Time("auth_time")
+	if !found || now.Sub(authenticated) > users.SSO.confirmationTTL() {
+		problems.Abort(context, problems.SSODenied.WithDetail("The identity provider didn't ask the user to log in again"))
+		return
+	}
+
+	confirming := Session(context, users.Database).
+		Model(&models.User{}).
+		Where("id = ?", linked.ID).
+		Update("reauthenticated_at", now).Error
+	if confirming != nil {
+		problems.Abort(context, fmt.Errorf("unable to confirm the identity: %w", confirming))
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User logged in again with the identity provider", "user_id", linked.ID)
+	context.JSON(http.StatusOK, &Message{Message: "Identity successfully confirmed"})
+}
+
+// reauthenticated tells whether the user without password logged in again with
+// the identity provider recently, using up the confirmation, so it's good for
+// a single operation.
+func (users *UsersController) reauthenticated(context *gin.Context, user *models.User, now time.Time) bool {
+	using := Session(context, users.Database).
+		Model(&models.User{}).
+		Where("id = ? AND reauthenticated_at >= ?", user.ID, now.Add(-users.SSO.confirmationTTL())).
+		Update("reauthenticated_at", nil)
+	if using.Error != nil {
+		problems.Abort(context, fmt.Errorf("unable to use the confirmation: %w", using.Error))
+		return false
+	}
+	if using.RowsAffected != 1 {
+		problems.Abort(context, problems.Reauthentication.WithDetail(
+			"Log in again with the identity provider on /v1/login/oidc?confirm=true to confirm the operation",
+		))
+		return false
+	}
+	return true
+}
+
+// provision creates the account of a user logging in for the first time with
+// the first nickname following the rules and not taken yet.
+func (users *UsersController) provision(context *gin.Context, claims oidc.Claims, issuer string, subject string, role string) (*models.User, error) {
+	if role == "" {
+		role = models.RoleUser
+	}
+	for _, nickname := range users.SSO.nicknames(claims, issuer, subject) {
+		if users.Nicknames.Check(nickname) != nil {
+			continue
+		}
+		var taken int64
+		Session(context, users.Database).Model(&models.User{}).Where("nickname = ?", nickname).Count(&taken)
+		if taken > 0 {
+			continue
+		}
+
+		user := &models.User{
+			Nickname:    nickname,
+			Role:        role,
+			OIDCIssuer:  issuer,
+			OIDCSubject: &subject,
+		}
+		if inserting := Session(context, users.Database).Create(user).Error; inserting != nil {
+			return nil, fmt.Errorf("unable to provision the user: %w", inserting)
+		}
+		users.logger().InfoContext(context.Request.Context(), "User provisioned by the identity provider", "user_id", user.ID)
+		return user, nil
+	}
+	return nil, problems.InvalidNickname.WithDetail("None of the nicknames of the identity provider user follow the rules or are free")
+}
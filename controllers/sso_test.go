@@ -0,0 +1,510 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/oidc"
+	"github.com/zatarain/note-vook/oidc/oidctest"
+	"github.com/zatarain/note-vook/policy"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSingleSignOn(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+	identity := oidctest.New("notevook", "client-secret")
+	defer identity.Close()
+	config := oidc.Config{
+		Issuer:       identity.Issuer(),
+		ClientID:     "notevook",
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://notevook.io/login/oidc/callback",
+		Scopes:       []string{"openid", "profile"},
+	}
+
+	seed := func(test *testing.T) *gorm.DB {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "sso.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}))
+		return database
+	}
+
+	controller := func(database *gorm.DB, provision bool) *UsersController {
+		return &UsersController{
+			Database:       database,
+			SecretTokenKey: "secret-token-key",
+			Nicknames: policy.Nickname{
+				MinLength: 3,
+				MaxLength: 32,
+				Pattern:   regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`),
+				Reserved:  policy.NewList("admin"),
+			},
+			SSO: SingleSignOn{
+				Provider:      oidc.NewProvider(config, nil),
+				NicknameClaim: "preferred_username",
+				RolesClaim:    "groups",
+				Roles:         map[string]string{"notevook-admins": models.RoleAdmin},
+				Provision:     provision,
+			},
+		}
+	}
+
+	perform := func(users *UsersController, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		server := gin.New()
+		server.GET("/login/oidc", users.LoginSSO)
+		server.GET("/login/oidc/callback", users.SSOCallback)
+		request, _ := http.NewRequest(http.MethodGet, path, nil)
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// login goes through the whole flow like a browser, from the API to the
+	// provider and back to the callback
+	login := func(users *UsersController, path string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		started := perform(users, path, cookies...)
+		require.Equal(http.StatusFound, started.Code, started.Body.String())
+		state := started.Result().Cookies()
+		require.Len(state, 1)
+		location, exception := identity.Authorize(started.Header().Get("Location"))
+		require.Nil(exception)
+		callback, exception := url.Parse(location)
+		require.Nil(exception)
+		return perform(users, callback.RequestURI(), append(cookies, state[0])...)
+	}
+
+	token := func(recorder *httptest.ResponseRecorder) *http.Cookie {
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == "Authorisation" && cookie.Value != "" {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	test.Run("Should redirect to the provider with PKCE and remember the state", func(test *testing.T) {
+		// Act
+		recorder := perform(controller(seed(test), true), "/login/oidc")
+
+		// Assert
+		require.Equal(http.StatusFound, recorder.Code)
+		address, exception := url.Parse(recorder.Header().Get("Location"))
+		require.Nil(exception)
+		query := address.Query()
+		assert.Equal(identity.Issuer()+"/authorize", address.Scheme+"://"+address.Host+address.Path)
+		assert.Equal("notevook", query.Get("client_id"))
+		assert.Equal(config.RedirectURL, query.Get("redirect_uri"))
+		assert.Equal("openid profile", query.Get("scope"))
+		assert.Equal(oidc.ChallengeMethod, query.Get("code_challenge_method"))
+		assert.NotEmpty(query.Get("code_challenge"))
+		assert.NotEmpty(query.Get("state"))
+		assert.NotEmpty(query.Get("nonce"))
+		assert.Equal("no-store", recorder.Header().Get("Cache-Control"))
+		cookies := recorder.Result().Cookies()
+		require.Len(cookies, 1)
+		assert.Equal(SSOStateCookie, cookies[0].Name)
+		assert.True(cookies[0].HttpOnly)
+		assert.NotContains(cookies[0].Value, query.Get("state"))
+	})
+
+	test.Run("Should provision the user on the first login with the mapped role", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("jane-subject", map[string]interface{}{"preferred_username": "jane", "groups": []string{"staff", "notevook-admins"}})
+
+		// Act
+		recorder := login(users, "/login/oidc")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Contains(recorder.Body.String(), "You are logged in")
+		provisioned := models.User{}
+		require.Nil(database.First(&provisioned, "nickname = ?", "jane").Error)
+		assert.Equal(models.RoleAdmin, provisioned.Role)
+		assert.Equal(identity.Issuer(), provisioned.OIDCIssuer)
+		require.NotNil(provisioned.OIDCSubject)
+		assert.Equal("jane-subject", *provisioned.OIDCSubject)
+		assert.Empty(provisioned.Password)
+		cookie := token(recorder)
+		require.NotNil(cookie)
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodGet, "/videos", nil)
+		context.Request.AddCookie(cookie)
+		user, exception := users.ValidateToken(context)
+		require.Nil(exception)
+		assert.Equal(provisioned.ID, user.ID)
+	})
+
+	test.Run("Should log in the same user again and update its role", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("john-subject", map[string]interface{}{"preferred_username": "john", "groups": []string{"notevook-admins"}})
+		require.Equal(http.StatusOK, login(users, "/login/oidc").Code)
+		identity.SetUser("john-subject", map[string]interface{}{"preferred_username": "johnny", "groups": []string{"staff"}})
+
+		// Act
+		recorder := login(users, "/login/oidc")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		all := []models.User{}
+		require.Nil(database.Find(&all).Error)
+		require.Len(all, 1)
+		assert.Equal("john", all[0].Nickname)
+		assert.Equal(models.RoleUser, all[0].Role)
+	})
+
+	test.Run("Should provision the user with another nickname when it's taken", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		require.Nil(database.Create(&models.User{Nickname: "jane", Password: "hash"}).Error)
+		identity.SetUser("another-jane", map[string]interface{}{"preferred_username": "jane"})
+
+		// Act
+		recorder := login(controller(database, true), "/login/oidc")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		provisioned := models.User{}
+		require.Nil(database.First(&provisioned, "oidc_subject = ?", "another-jane").Error)
+		assert.Regexp(`^jane-[0-9a-f]{6}$`, provisioned.Nickname)
+		assert.Equal(models.RoleUser, provisioned.Role)
+	})
+
+	test.Run("Should provision the user with a generic nickname when the claimed one is not valid", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		identity.SetUser("spaced", map[string]interface{}{"preferred_username": "Jane Doe"})
+
+		// Act
+		recorder := login(controller(database, true), "/login/oidc")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		provisioned := models.User{}
+		require.Nil(database.First(&provisioned, "oidc_subject = ?", "spaced").Error)
+		assert.Regexp(`^user-[0-9a-f]{6}$`, provisioned.Nickname)
+	})
+
+	test.Run("Should NOT provision the user when it's disabled", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		identity.SetUser("stranger", map[string]interface{}{"preferred_username": "stranger"})
+
+		// Act
+		recorder := login(controller(database, false), "/login/oidc")
+
+		// Assert
+		assert.Equal(http.StatusForbidden, recorder.Code)
+		assert.Contains(recorder.Body.String(), "sso_not_linked")
+		assert.Nil(token(recorder))
+		var total int64
+		database.Model(&models.User{}).Count(&total)
+		assert.Zero(total)
+	})
+
+	test.Run("Should link the account of the logged user and log it in afterwards", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, false)
+		owner := &models.User{Nickname: "owner", Password: "hash"}
+		require.Nil(database.Create(owner).Error)
+		authorisation, exception := users.NewToken(owner)
+		require.Nil(exception)
+		identity.SetUser("owner-subject", map[string]interface{}{"preferred_username": "someone", "groups": []string{"notevook-admins"}})
+
+		// Act
+		linking := login(users, "/login/oidc?link=true", &http.Cookie{Name: "Authorisation", Value: authorisation})
+		recorder := login(users, "/login/oidc")
+
+		// Assert
+		require.Equal(http.StatusOK, linking.Code, linking.Body.String())
+		assert.Contains(linking.Body.String(), "Account successfully linked")
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		linked := models.User{}
+		require.Nil(database.First(&linked, owner.ID).Error)
+		assert.True(linked.Linked())
+		assert.Equal(models.RoleAdmin, linked.Role)
+		var total int64
+		database.Model(&models.User{}).Count(&total)
+		assert.Equal(int64(1), total)
+	})
+
+	test.Run("Should NOT link a user of the provider linked to another account", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("taken-subject", map[string]interface{}{"preferred_username": "taken"})
+		require.Equal(http.StatusOK, login(users, "/login/oidc").Code)
+		owner := &models.User{Nickname: "owner", Password: "hash"}
+		require.Nil(database.Create(owner).Error)
+		authorisation, _ := users.NewToken(owner)
+
+		// Act
+		recorder := login(users, "/login/oidc?link=true", &http.Cookie{Name: "Authorisation", Value: authorisation})
+
+		// Assert
+		assert.Equal(http.StatusConflict, recorder.Code)
+		assert.Contains(recorder.Body.String(), "sso_already_linked")
+		unchanged := models.User{}
+		require.Nil(database.First(&unchanged, owner.ID).Error)
+		assert.False(unchanged.Linked())
+	})
+
+	test.Run("Should NOT start linking without being logged in", func(test *testing.T) {
+		// Act
+		recorder := perform(controller(seed(test), true), "/login/oidc?link=true")
+
+		// Assert
+		assert.Equal(http.StatusUnauthorized, recorder.Code)
+		assert.Contains(recorder.Body.String(), "unauthorised")
+		assert.Empty(recorder.Result().Cookies())
+	})
+
+	test.Run("Should NOT log in a disabled account", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("disabled-subject", map[string]interface{}{"preferred_username": "disabled"})
+		require.Equal(http.StatusOK, login(users, "/login/oidc").Code)
+		require.Nil(database.Model(&models.User{}).Where("nickname = ?", "disabled").Update("disabled_at", time.Now()).Error)
+
+		// Act
+		recorder := login(users, "/login/oidc")
+
+		// Assert
+		assert.Equal(http.StatusForbidden, recorder.Code)
+		assert.Contains(recorder.Body.String(), "account_disabled")
+		assert.Nil(token(recorder))
+	})
+
+	test.Run("Should ask for the two-factor code of the users who enabled it", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("careful-subject", map[string]interface{}{"preferred_username": "careful"})
+		require.Equal(http.StatusOK, login(users, "/login/oidc").Code)
+		enabled := time.Now()
+		require.Nil(database.Model(&models.User{}).Where("nickname = ?", "careful").Updates(map[string]interface{}{
+			"totp_secret":           "JBSWY3DPEHPK3PXP",
+			"two_factor_enabled_at": enabled,
+		}).Error)
+
+		// Act
+		recorder := login(users, "/login/oidc")
+
+		// Assert
+		assert.Equal(http.StatusAccepted, recorder.Code, recorder.Body.String())
+		assert.Contains(recorder.Body.String(), "challenge")
+		assert.Nil(token(recorder))
+	})
+
+	test.Run("Should ask the provider to log in again to confirm the identity", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("confirming-subject", map[string]interface{}{"preferred_username": "confirming"})
+		session := token(login(users, "/login/oidc"))
+		require.NotNil(session)
+
+		// Act
+		started := perform(users, "/login/oidc?confirm=true", session)
+		recorder := login(users, "/login/oidc?confirm=true", session)
+
+		// Assert
+		require.Equal(http.StatusFound, started.Code)
+		address, _ := url.Parse(started.Header().Get("Location"))
+		assert.Equal("login", address.Query().Get("prompt"))
+		assert.Equal("0", address.Query().Get("max_age"))
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Contains(recorder.Body.String(), "Identity successfully confirmed")
+		confirmed := models.User{}
+		require.Nil(database.First(&confirmed, "nickname = ?", "confirming").Error)
+		require.NotNil(confirmed.ReauthenticatedAt)
+		assert.WithinDuration(time.Now(), *confirmed.ReauthenticatedAt, time.Minute)
+	})
+
+	test.Run("Should NOT confirm the identity when the provider doesn't ask to log in again", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		users.SSO.ConfirmationTTL = time.Nanosecond
+		identity.SetUser("lazy-subject", map[string]interface{}{"preferred_username": "lazy"})
+		session := token(login(users, "/login/oidc"))
+		require.NotNil(session)
+		identity.IgnorePrompt = true
+		defer func() { identity.IgnorePrompt = false }()
+
+		// Act
+		recorder := login(users, "/login/oidc?confirm=true", session)
+
+		// Assert
+		assert.Equal(http.StatusUnauthorized, recorder.Code)
+		assert.Contains(recorder.Body.String(), "sso_denied")
+		unconfirmed := models.User{}
+		require.Nil(database.First(&unconfirmed, "nickname = ?", "lazy").Error)
+		assert.Nil(unconfirmed.ReauthenticatedAt)
+	})
+
+	test.Run("Should NOT confirm the identity with another user of the provider", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		identity.SetUser("first-subject", map[string]interface{}{"preferred_username": "first"})
+		session := token(login(users, "/login/oidc"))
+		require.NotNil(session)
+		identity.SetUser("second-subject", map[string]interface{}{"preferred_username": "second"})
+		require.Equal(http.StatusOK, login(users, "/login/oidc").Code)
+
+		// Act
+		recorder := login(users, "/login/oidc?confirm=true", session)
+
+		// Assert
+		assert.Equal(http.StatusForbidden, recorder.Code)
+		assert.Contains(recorder.Body.String(), "sso_not_linked")
+		all := []models.User{}
+		require.Nil(database.Find(&all).Error)
+		for _, user := range all {
+			assert.Nil(user.ReauthenticatedAt)
+		}
+	})
+
+	test.Run("Should NOT start confirming an account which is not linked", func(test *testing.T) {
+		// Arrange
+		database := seed(test)
+		users := controller(database, true)
+		owner := &models.User{Nickname: "owner", Password: "hash"}
+		require.Nil(database.Create(owner).Error)
+		authorisation, _ := users.NewToken(owner)
+
+		// Act
+		recorder := perform(users, "/login/oidc?confirm=true", &http.Cookie{Name: "Authorisation", Value: authorisation})
+
+		// Assert
+		assert.Equal(http.StatusForbidden, recorder.Code)
+		assert.Contains(recorder.Body.String(), "sso_not_linked")
+		assert.Empty(recorder.Result().Cookies())
+	})
+
+	test.Run("Should NOT link and confirm the account at once", func(test *testing.T) {
+		// Act
+		recorder := perform(controller(seed(test), true), "/login/oidc?link=true&confirm=true")
+
+		// Assert
+		assert.Equal(http.StatusBadRequest, recorder.Code)
+		assert.Contains(recorder.Body.String(), "invalid_input")
+	})
+
+	testcases := []struct {
+		Description string
+		Query       string
+		Cookie      bool
+		Status      int
+		Code        string
+	}{
+		{"Should NOT complete a login that was not started", "code=code&state=%s", false, http.StatusBadRequest, "invalid_sso_state"},
+		{"Should NOT complete a login with another state", "code=code&state=forged", true, http.StatusBadRequest, "invalid_sso_state"},
+		{"Should NOT complete a login denied by the provider", "error=access_denied&state=%s", true, http.StatusUnauthorized, "sso_denied"},
+		{"Should NOT complete a login with an unknown code", "code=forged&state=%s", true, http.StatusUnauthorized, "sso_denied"},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			users := controller(seed(test), true)
+			started := perform(users, "/login/oidc")
+			address, _ := url.Parse(started.Header().Get("Location"))
+			state := address.Query().Get("state")
+			cookies := []*http.Cookie{}
+			if testcase.Cookie {
+				cookies = started.Result().Cookies()
+			}
+			query := strings.ReplaceAll(testcase.Query, "%s", url.QueryEscape(state))
+
+			// Act
+			recorder := perform(users, "/login/oidc/callback?"+query, cookies...)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			assert.Nil(token(recorder))
+		})
+	}
+
+	test.Run("Should NOT log in when the single sign-on is not configured", func(test *testing.T) {
+		// Arrange
+		users := &UsersController{Database: seed(test)}
+
+		// Act
+		starting := perform(users, "/login/oidc")
+		completing := perform(users, "/login/oidc/callback?code=code&state=state")
+
+		// Assert
+		assert.Equal(http.StatusNotFound, starting.Code)
+		assert.Contains(starting.Body.String(), "sso_not_configured")
+		assert.Equal(http.StatusNotFound, completing.Code)
+	})
+
+	test.Run("Should NOT log in while the provider is unavailable", func(test *testing.T) {
+		// Arrange
+		gone := httptest.NewServer(http.NotFoundHandler())
+		gone.Close()
+		users := controller(seed(test), true)
+		users.SSO.Provider = oidc.NewProvider(oidc.Config{Issuer: gone.URL, ClientID: "notevook"}, nil)
+
+		// Act
+		recorder := perform(users, "/login/oidc")
+
+		// Assert
+		assert.Equal(http.StatusBadGateway, recorder.Code)
+		assert.Contains(recorder.Body.String(), "sso_unavailable")
+	})
+}
+
+func TestSingleSignOnRole(test *testing.T) {
+	assert := assert.New(test)
+	sso := SingleSignOn{RolesClaim: "groups", Roles: map[string]string{"admins": models.RoleAdmin, "staff": models.RoleUser}}
+
+	testcases := []struct {
+		Description string
+		Settings    SingleSignOn
+		Claims      oidc.Claims
+		Role        string
+		Managed     bool
+	}{
+		{"Should map the most privileged role", sso, oidc.Claims{"groups": []interface{}{"admins", "staff"}}, models.RoleAdmin, true},
+		{"Should map a single value", sso, oidc.Claims{"groups": "admins"}, models.RoleAdmin, true},
+		{"Should fall back to the user role", sso, oidc.Claims{"groups": []interface{}{"others"}}, models.RoleUser, true},
+		{"Should fall back to the user role without the claim", sso, oidc.Claims{}, models.RoleUser, true},
+		{"Should NOT manage the roles without mapping", SingleSignOn{RolesClaim: "groups"}, oidc.Claims{"groups": "admins"}, "", false},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			role, managed := testcase.Settings.role(testcase.Claims)
+
+			// Assert
+			assert.Equal(testcase.Role, role)
+			assert.Equal(testcase.Managed, managed)
+		})
+	}
+}
@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/totp"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultChallengeTTL  time.Duration = 5 * time.Minute
+	DefaultRecoveryCodes int           = 10
+
+	// recoveryAlphabet are the characters of the recovery codes, 32 of them so
+	// each random byte picks one evenly
+	recoveryAlphabet string = "abcdefghijklmnopqrstuvwxyz234567"
+	recoveryLength   int    = 10
+)
+
+// TwoFactorSettings tell how the two-factor authentication works, the zero
+// value uses the defaults.
+type TwoFactorSettings struct {
+	// Issuer is the name of the API shown by the authenticator apps
+	Issuer string
+
+	// ChallengeTTL is the time the users have to send the code after the password
+	ChallengeTTL time.Duration
+
+	// RecoveryCodes is the number of recovery codes generated at once
+	RecoveryCodes int
+}
+
+type EnrolTwoFactorContract struct {
+	Password string `json:"password"`
+}
+
+type TwoFactorCodeContract struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorContract struct {
+	Password string `json:"password"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorLoginContract struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+// TwoFactorChallenge is the response of the login of the users with two-factor
+// authentication, the challenge has to be sent back along with a code before
+// it expires to get the token.
+type TwoFactorChallenge struct {
+	Message   string    `json:"message"`
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TwoFactorEnrolment is the secret to add to the authenticator app, either
+// typing it or scanning the URI as a QR code.
+type TwoFactorEnrolment struct {
+	Message string `json:"message"`
+	Secret  string `json:"secret"`
+	URI     string `json:"uri"`
+}
+
+// TwoFactorRecovery lists the recovery codes, they are only shown once.
+type TwoFactorRecovery struct {
+	Message       string   `json:"message"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (settings TwoFactorSettings) challengeTTL() time.Duration {
+	if settings.ChallengeTTL <= 0 {
+		return DefaultChallengeTTL
+	}
+	return settings.ChallengeTTL
+}
+
+func (settings TwoFactorSettings) recoveryCodes() int {
+	if settings.RecoveryCodes <= 0 {
+		return DefaultRecoveryCodes
+	}
+	return settings.RecoveryCodes
+}
+
+// challenge responds the login of a user with two-factor authentication with
+// a short-lived token, which only tells the password was right.
+func (users *UsersController) challenge(context *gin.Context, user *models.User, now time.Time) {
+	expiration := now.Add(users.TwoFactor.challengeTTL())
+	data := jwt.MapClaims{
+		"challenge":  user.Nickname,
+		"user":       user.ID,
+		"version":    user.TokenVersion,
+		"expiration": expiration.Unix(),
+	}
+	challenge, exception := jwt.NewWithClaims(jwt.SigningMethodHS256, data).SignedString([]byte(users.SecretTokenKey))
+	if exception != nil {
+		problems.Abort(context, fmt.Errorf("unable to generate the two-factor challenge: %w", exception))
+		return
+	}
+
+	context.Header("Cache-Control", "no-store")
+	context.JSON(http.StatusAccepted, &TwoFactorChallenge{
+		Message:   "Send the code of your authenticator app to log in",
+		Challenge: challenge,
+		ExpiresAt: expiration.UTC().Truncate(time.Second),
+	})
+}
+
+// challenged finds the user a challenge was given to, as long as it's still
+// valid.
+func (users *UsersController) challenged(context *gin.Context, challenge string, now time.Time) (*models.User, error) {
+	token, exception := jwt.Parse(challenge, users.Decoder)
+	if exception != nil {
+		return nil, exception
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !(ok && token.Valid) {
+		return nil, errors.New("invalid challenge")
+	}
+	expiration, _ := claims["expiration"].(float64)
+	if now.Unix() > int64(expiration) {
+		return nil, errors.New("expired challenge")
+	}
+	nickname, ok := claims["challenge"].(string)
+	identifier, identified := claims["user"].(float64)
+	if !(ok && identified) {
+		return nil, errors.New("not a challenge")
+	}
+
+	user := &models.User{}
+	Session(context, users.Database).First(user, "id = ? AND nickname = ?", uint(identifier), nickname)
+	if user.ID == 0 || user.Disabled() || !user.TwoFactor() {
+		return nil, errors.New("user not challenged")
+	}
+	version, _ := claims["version"].(float64)
+	if uint(version) != user.TokenVersion {
+		return nil, errors.New("revoked challenge")
+	}
+	return user, nil
+}
+
+// LoginTwoFactor completes the login of a user with two-factor authentication
+// once it sends the challenge along with a code of the authenticator app or a
+// recovery code. The wrong codes count as failed logins.
+func (users *UsersController) LoginTwoFactor(context *gin.Context) {
+	var input TwoFactorLoginContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	now := time.Now()
+	user, exception := users.challenged(context, input.Challenge, now)
+	if exception != nil {
+		problems.Abort(context, problems.InvalidChallenge.Wrap(exception))
+		return
+	}
+	if users.refuseLocked(context, user, now) {
+		return
+	}
+
+	valid, exception := users.verify(context, user, input.Code, now)
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	if !valid {
+		users.refuseCode(context, user, now, "Wrong two-factor code on login")
+		return
+	}
+
+	if exception := users.forget(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	if exception := users.setToken(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	context.JSON(http.StatusOK, &Message{Message: "Yaaay! You are logged in :)"})
+}
+
+// refuseCode counts the wrong code as a failed login, so the sessions can't be
+// used to guess the codes either, and responds it's invalid.
+func (users *UsersController) refuseCode(context *gin.Context, user *models.User, now time.Time, warning string) {
+	users.logger().WarnContext(context.Request.Context(), warning, "user_id", user.ID)
+	if exception := users.fail(context, user, now); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	problems.Abort(context, problems.InvalidCode)
+}
+
+// confirmCode checks the code given by the current user to confirm an
+// operation, as long as the user has two-factor authentication. The wrong ones
+// count as failed logins, like the wrong passwords.
+func (users *UsersController) confirmCode(context *gin.Context, user *models.User, code string, warning string) bool {
+	if !user.TwoFactor() {
+		return true
+	}
+	if strings.TrimSpace(code) == "" {
+		problem := problems.ValidationFailed.WithDetail("The two-factor code is required to confirm the operation")
+		problem.Errors = []problems.FieldError{{Field: "code", Rule: "required", Message: "is required"}}
+		problems.Abort(context, problem)
+		return false
+	}
+
+	now := time.Now()
+	valid, exception := users.verify(context, user, code, now)
+	if exception != nil {
+		problems.Abort(context, exception)
+		return false
+	}
+	if !valid {
+		users.refuseCode(context, user, now, warning)
+		return false
+	}
+	if exception := users.forget(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return false
+	}
+	return true
+}
+
+// verify checks the code is either a code of the authenticator app not used
+// yet or an unused recovery code of the user, using it up.
+func (users *UsersController) verify(context *gin.Context, user *models.User, code string, now time.Time) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits && strings.Trim(code, "0123456789") == "" {
+		step, valid := totp.Verify(user.TOTPSecret, code, now, user.TOTPStep)
+		if !valid {
+			return false, nil
+		}
+
+		// Only the first request sending the code moves the step forward
+		using := Session(context, users.Database).
+			Model(&models.User{}).
+			Where("id = ? AND totp_step < ?", user.ID, step).
+			Updates(map[string]interface{}{"totp_step": step})
+		return using.Error == nil && using.RowsAffected == 1, using.Error
+	}
+
+	using := Session(context, users.Database).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", user.ID, models.HashRecoveryCode(code)).
+		Updates(map[string]interface{}{"used_at": now})
+	if using.Error != nil {
+		return false, using.Error
+	}
+	if using.RowsAffected == 1 {
+		users.logger().InfoContext(context.Request.Context(), "Recovery code used", "user_id", user.ID)
+	}
+	return using.RowsAffected == 1, nil
+}
+
+// EnrolTwoFactor generates a new secret for the authenticator app of the
+// current user, once the user confirms the password. The two-factor
+// authentication is only enabled once a code of the secret is confirmed.
+func (users *UsersController) EnrolTwoFactor(context *gin.Context) {
+	var input EnrolTwoFactorContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	user := CurrentUser(context)
+	if !users.confirm(context, user, input.Password, "Wrong password to enrol two-factor") {
+		return
+	}
+	if user.TwoFactor() {
+		problems.Abort(context, problems.TwoFactorConflict.WithDetail("The two-factor authentication is already enabled"))
+		return
+	}
+
+	secret, exception := totp.NewSecret()
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	enrolling := Session(context, users.Database).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_secret": secret, "totp_step": 0}).Error
+	if enrolling != nil {
+		problems.Abort(context, enrolling)
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User enrolled two-factor", "user_id", user.ID)
+	context.Header("Cache-Control", "no-store")
+	context.JSON(http.StatusOK, &TwoFactorEnrolment{
+		Message: "Add the secret to your authenticator app and confirm it with a code",
+		Secret:  secret,
+		URI:     totp.URI(users.TwoFactor.Issuer, user.Nickname, secret),
+	})
+}
+
+// ConfirmTwoFactor enables the two-factor authentication of the current user
+// once it sends a code of the secret enrolled, responding with the recovery
+// codes. The wrong codes count as failed logins.
+func (users *UsersController) ConfirmTwoFactor(context *gin.Context) {
+	var input TwoFactorCodeContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	user := CurrentUser(context)
+	if user.TwoFactor() {
+		problems.Abort(context, problems.TwoFactorConflict.WithDetail("The two-factor authentication is already enabled"))
+		return
+	}
+	if user.TOTPSecret == "" {
+		problems.Abort(context, problems.TwoFactorConflict.WithDetail("There is no secret to confirm, enrol first"))
+		return
+	}
+
+	now := time.Now()
+	if users.refuseLocked(context, user, now) {
+		return
+	}
+	step, valid := totp.Verify(user.TOTPSecret, strings.TrimSpace(input.Code), now, user.TOTPStep)
+	if !valid {
+		users.refuseCode(context, user, now, "Wrong two-factor code to enable it")
+		return
+	}
+	if exception := users.forget(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+
+	codes, exception := newRecoveryCodes(users.TwoFactor.recoveryCodes())
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	confirming := Session(context, users.Database).Transaction(func(transaction *gorm.DB) error {
+		enabling := transaction.Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Updates(map[string]interface{}{"two_factor_enabled_at": now, "totp_step": step}).Error
+		if enabling != nil {
+			return enabling
+		}
+		return replaceRecoveryCodes(transaction, user, codes, now)
+	})
+	if confirming != nil {
+		problems.Abort(context, confirming)
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User enabled two-factor", "user_id", user.ID)
+	context.Header("Cache-Control", "no-store")
+	context.JSON(http.StatusOK, &TwoFactorRecovery{
+		Message:       "Two-factor authentication enabled, keep the recovery codes safe",
+		RecoveryCodes: codes,
+	})
+}
+
+// RecoveryCodes replaces the recovery codes of the current user with new ones,
+// once the user sends a code. The wrong codes count as failed logins.
+func (users *UsersController) RecoveryCodes(context *gin.Context) {
+	var input TwoFactorCodeContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	user := CurrentUser(context)
+	if !user.TwoFactor() {
+		problems.Abort(context, problems.TwoFactorConflict.WithDetail("The two-factor authentication is not enabled"))
+		return
+	}
+	now := time.Now()
+	if users.refuseLocked(context, user, now) {
+		return
+	}
+	valid, exception := users.verify(context, user, input.Code, now)
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	if !valid {
+		users.refuseCode(context, user, now, "Wrong two-factor code to replace the recovery codes")
+		return
+	}
+	if exception := users.forget(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+
+	codes, exception := newRecoveryCodes(users.TwoFactor.recoveryCodes())
+	if exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	replacing := Session(context, users.Database).Transaction(func(transaction *gorm.DB) error {
+		return replaceRecoveryCodes(transaction, user, codes, now)
+	})
+	if replacing != nil {
+		problems.Abort(context, replacing)
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User generated recovery codes", "user_id", user.ID)
+	context.Header("Cache-Control", "no-store")
+	context.JSON(http.StatusOK, &TwoFactorRecovery{
+		Message:       "New recovery codes generated, the previous ones no longer work",
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTwoFactor disables the two-factor authentication of the current
+// user, once the user confirms both the password and a code.
+func (users *UsersController) DisableTwoFactor(context *gin.Context) {
+	var input DisableTwoFactorContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	user := CurrentUser(context)
+	if !user.TwoFactor() {
+		problems.Abort(context, problems.TwoFactorConflict.WithDetail("The two-factor authentication is not enabled"))
+		return
+	}
+	if !users.confirm(context, user, input.Password, "Wrong password to disable two-factor") {
+		return
+	}
+	if !users.confirmCode(context, user, input.Code, "Wrong two-factor code to disable it") {
+		return
+	}
+
+	disabling := Session(context, users.Database).Transaction(func(transaction *gorm.DB) error {
+		return user.DisableTwoFactor(transaction)
+	})
+	if disabling != nil {
+		problems.Abort(context, disabling)
+		return
+	}
+
+	users.logger().InfoContext(context.Request.Context(), "User disabled two-factor", "user_id", user.ID)
+	context.JSON(http.StatusOK, &Message{Message: "Two-factor authentication disabled"})
+}
+
+// newRecoveryCodes generates the given number of random recovery codes, e. g.
+// "k3v7q-m2xpa".
+func newRecoveryCodes(count int) ([]string, error) {
+	codes := make([]string, 0, count)
+	random := make([]byte, recoveryLength)
+	for index := 0; index < count; index++ {
+		if _, exception := rand.Read(random); exception != nil {
+			return nil, fmt.Errorf("unable to generate the recovery codes: %w", exception)
+		}
+		code := make([]byte, recoveryLength)
+		for position, value := range random {
+			code[position] = recoveryAlphabet[int(value)%len(recoveryAlphabet)]
+		}
+		half := recoveryLength / 2
+		codes = append(codes, string(code[:half])+"-"+string(code[half:]))
+	}
+	return codes, nil
+}
+
+// replaceRecoveryCodes keeps the hashes of the given codes instead of the ones
+// of the user.
+func replaceRecoveryCodes(transaction *gorm.DB, user *models.User, codes []string, now time.Time) error {
+	if exception := transaction.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; exception != nil {
+		return exception
+	}
+	records := make([]models.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		records = append(records, models.RecoveryCode{UserID: user.ID, Hash: models.HashRecoveryCode(code), CreatedAt: now})
+	}
+	return transaction.Create(&records).Error
+}
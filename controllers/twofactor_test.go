@@ -0,0 +1,435 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// twoFactorSeed creates a user with the password "secret", with the two-factor
+// authentication enabled along with the given recovery codes when asked to.
+func twoFactorSeed(test *testing.T, enabled bool, codes ...string) (*gorm.DB, *models.User) {
+	require := require.New(test)
+	database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "two-factor.db")), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(&models.User{}, &models.RecoveryCode{}))
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	user := &models.User{Nickname: "owner", Password: string(hash)}
+	if enabled {
+		now := time.Now()
+		user.TOTPSecret, exception = totp.NewSecret()
+		require.Nil(exception)
+		user.TwoFactorEnabledAt = &now
+	}
+	require.Nil(database.Create(user).Error)
+	if len(codes) > 0 {
+		require.Nil(replaceRecoveryCodes(database, user, codes, time.Now()))
+	}
+	return database, user
+}
+
+// currentCode is the code shown now by the authenticator app of the user.
+func currentCode(test *testing.T, user *models.User) string {
+	code, exception := totp.Code(user.TOTPSecret, totp.Step(time.Now()))
+	require.Nil(test, exception)
+	return code
+}
+
+func TestLoginTwoFactor(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	controller := func(database *gorm.DB) *UsersController {
+		return &UsersController{
+			Database:       database,
+			SecretTokenKey: "secret-token-key",
+			Throttle:       LoginThrottle{MaxFailures: 3, Delay: time.Minute, Lockout: time.Hour},
+		}
+	}
+
+	perform := func(database *gorm.DB, path string, body string) *httptest.ResponseRecorder {
+		users := controller(database)
+		server := gin.New()
+		server.POST("/login", users.Login)
+		server.POST("/login/two-factor", users.LoginTwoFactor)
+		request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	challenge := func(test *testing.T, database *gorm.DB) string {
+		recorder := perform(database, "/login", `{"nickname":"owner","password":"secret"}`)
+		require.Equal(http.StatusAccepted, recorder.Code, recorder.Body.String())
+		var response TwoFactorChallenge
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response.Challenge
+	}
+
+	second := func(database *gorm.DB, challenge string, code string) *httptest.ResponseRecorder {
+		return perform(database, "/login/two-factor", fmt.Sprintf(`{"challenge":%q,"code":%q}`, challenge, code))
+	}
+
+	test.Run("Should challenge the users with two-factor authentication instead of logging them in", func(test *testing.T) {
+		// Arrange
+		database, _ := twoFactorSeed(test, true)
+
+		// Act
+		recorder := perform(database, "/login", `{"nickname":"owner","password":"secret"}`)
+
+		// Assert
+		assert.Equal(http.StatusAccepted, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"challenge":"`)
+		assert.Equal("no-store", recorder.Header().Get("Cache-Control"))
+		assert.Empty(recorder.Result().Cookies())
+	})
+
+	test.Run("Should log in the users without two-factor authentication right away", func(test *testing.T) {
+		// Arrange
+		database, _ := twoFactorSeed(test, false)
+
+		// Act
+		recorder := perform(database, "/login", `{"nickname":"owner","password":"secret"}`)
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Len(recorder.Result().Cookies(), 1)
+	})
+
+	test.Run("Should log in with the challenge and the code of the authenticator app only once", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, true)
+		given := challenge(test, database)
+		code := currentCode(test, user)
+
+		// Act
+		recorder := second(database, given, code)
+		replayed := second(database, given, code)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		cookies := recorder.Result().Cookies()
+		require.Len(cookies, 1)
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodGet, "/videos", nil)
+		context.Request.AddCookie(cookies[0])
+		logged, exception := controller(database).ValidateToken(context)
+		require.Nil(exception)
+		assert.Equal(user.ID, logged.ID)
+		assert.Equal(http.StatusUnauthorized, replayed.Code)
+		assert.Contains(replayed.Body.String(), `"code":"invalid_two_factor_code"`)
+	})
+
+	test.Run("Should log in with a recovery code only once", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, true, "abcde-fghij", "klmno-pqrst")
+		given := challenge(test, database)
+
+		// Act
+		recorder := second(database, given, "ABCDE FGHIJ")
+		reused := second(database, given, "abcde-fghij")
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal(http.StatusUnauthorized, reused.Code)
+		var used int64
+		database.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NOT NULL", user.ID).Count(&used)
+		assert.Equal(int64(1), used)
+	})
+
+	test.Run("Should count the wrong codes as failed logins", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, true)
+		given := challenge(test, database)
+
+		// Act
+		recorder := second(database, given, "000000")
+		locked := second(database, given, currentCode(test, user))
+
+		// Assert
+		assert.Equal(http.StatusUnauthorized, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"invalid_two_factor_code"`)
+		assert.Equal(http.StatusTooManyRequests, locked.Code)
+		failed := models.User{}
+		require.Nil(database.First(&failed, user.ID).Error)
+		assert.Equal(1, failed.FailedLogins)
+	})
+
+	test.Run("Should NOT forget the failed logins until the code is sent", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, true)
+		require.Nil(database.Model(user).Update("failed_logins", 2).Error)
+
+		// Act
+		challenge(test, database)
+
+		// Assert
+		unchanged := models.User{}
+		require.Nil(database.First(&unchanged, user.ID).Error)
+		assert.Equal(2, unchanged.FailedLogins)
+	})
+
+	testcases := []struct {
+		Description string
+		Challenge   func(*testing.T, *gorm.DB, *models.User) string
+	}{
+		{"Should NOT accept an invalid challenge", func(*testing.T, *gorm.DB, *models.User) string {
+			return "not-a-token"
+		}},
+		{"Should NOT accept an authorisation token as challenge", func(test *testing.T, database *gorm.DB, user *models.User) string {
+			token, _ := controller(database).NewToken(user)
+			return token
+		}},
+		{"Should NOT accept a challenge once the password changed", func(test *testing.T, database *gorm.DB, user *models.User) string {
+			given := challenge(test, database)
+			database.Model(user).Update("token_version", 1)
+			return given
+		}},
+		{"Should NOT accept a challenge once the two-factor authentication is disabled", func(test *testing.T, database *gorm.DB, user *models.User) string {
+			given := challenge(test, database)
+			database.Model(user).Update("two_factor_enabled_at", nil)
+			return given
+		}},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, user := twoFactorSeed(test, true)
+			given := testcase.Challenge(test, database, user)
+
+			// Act
+			recorder := second(database, given, currentCode(test, user))
+
+			// Assert
+			assert.Equal(http.StatusUnauthorized, recorder.Code)
+			assert.Contains(recorder.Body.String(), `"code":"invalid_challenge"`)
+			assert.Empty(recorder.Result().Cookies())
+		})
+	}
+
+	test.Run("Should NOT accept a challenge as authorisation token", func(test *testing.T) {
+		// Arrange
+		database, _ := twoFactorSeed(test, true)
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodGet, "/videos", nil)
+		context.Request.AddCookie(&http.Cookie{Name: "Authorisation", Value: challenge(test, database)})
+
+		// Act
+		_, exception := controller(database).ValidateToken(context)
+
+		// Assert
+		assert.ErrorContains(exception, "invalid authentication token")
+	})
+}
+
+func TestTwoFactorSettings(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	perform := func(database *gorm.DB, user *models.User, method string, path string, body string) *httptest.ResponseRecorder {
+		users := &UsersController{Database: database, TwoFactor: TwoFactorSettings{Issuer: "NoteVook", RecoveryCodes: 3}}
+		server := gin.New()
+		authorise := func(context *gin.Context) {
+			current := &models.User{}
+			database.First(current, user.ID)
+			context.Set("user", current)
+		}
+		server.POST("/me/two-factor", authorise, users.EnrolTwoFactor)
+		server.POST("/me/two-factor/confirm", authorise, users.ConfirmTwoFactor)
+		server.POST("/me/two-factor/recovery-codes", authorise, users.RecoveryCodes)
+		server.DELETE("/me/two-factor", authorise, users.DisableTwoFactor)
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	reload := func(database *gorm.DB, user *models.User) *models.User {
+		current := &models.User{}
+		require.Nil(database.First(current, user.ID).Error)
+		return current
+	}
+
+	test.Run("Should enrol a secret and enable the two-factor authentication once a code is confirmed", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, false)
+
+		// Act
+		enrolment := perform(database, user, http.MethodPost, "/me/two-factor", `{"password":"secret"}`)
+		pending := reload(database, user)
+		confirmation := perform(database, user, http.MethodPost, "/me/two-factor/confirm",
+			fmt.Sprintf(`{"code":%q}`, currentCode(test, pending)))
+
+		// Assert
+		require.Equal(http.StatusOK, enrolment.Code, enrolment.Body.String())
+		var enrolled TwoFactorEnrolment
+		require.Nil(json.Unmarshal(enrolment.Body.Bytes(), &enrolled))
+		assert.Equal(pending.TOTPSecret, enrolled.Secret)
+		assert.Equal(totp.URI("NoteVook", "owner", enrolled.Secret), enrolled.URI)
+		assert.Equal("no-store", enrolment.Header().Get("Cache-Control"))
+		assert.False(pending.TwoFactor())
+
+		require.Equal(http.StatusOK, confirmation.Code, confirmation.Body.String())
+		var recovery TwoFactorRecovery
+		require.Nil(json.Unmarshal(confirmation.Body.Bytes(), &recovery))
+		assert.Len(recovery.RecoveryCodes, 3)
+		assert.Regexp(`^[a-z2-7]{5}-[a-z2-7]{5}$`, recovery.RecoveryCodes[0])
+		assert.True(reload(database, user).TwoFactor())
+		var stored []models.RecoveryCode
+		require.Nil(database.Where("user_id = ?", user.ID).Find(&stored).Error)
+		require.Len(stored, 3)
+		assert.Equal(models.HashRecoveryCode(recovery.RecoveryCodes[0]), stored[0].Hash)
+	})
+
+	test.Run("Should replace the recovery codes", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, true, "abcde-fghij")
+
+		// Act
+		recorder := perform(database, user, http.MethodPost, "/me/two-factor/recovery-codes",
+			fmt.Sprintf(`{"code":%q}`, currentCode(test, user)))
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Equal("no-store", recorder.Header().Get("Cache-Control"))
+		var stored []models.RecoveryCode
+		require.Nil(database.Where("user_id = ?", user.ID).Find(&stored).Error)
+		assert.Len(stored, 3)
+		for _, code := range stored {
+			assert.NotEqual(models.HashRecoveryCode("abcde-fghij"), code.Hash)
+		}
+	})
+
+	test.Run("Should disable the two-factor authentication with a recovery code", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, true, "abcde-fghij")
+
+		// Act
+		recorder := perform(database, user, http.MethodDelete, "/me/two-factor", `{"password":"secret","code":"abcde-fghij"}`)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		disabled := reload(database, user)
+		assert.False(disabled.TwoFactor())
+		assert.Empty(disabled.TOTPSecret)
+		var remaining int64
+		database.Model(&models.RecoveryCode{}).Where("user_id = ?", user.ID).Count(&remaining)
+		assert.Zero(remaining)
+	})
+
+	testcases := []struct {
+		Description string
+		Enabled     bool
+		Method      string
+		Path        string
+		Body        string
+		Status      int
+		Code        string
+	}{
+		{"Should NOT enrol with a wrong password", false, http.MethodPost, "/me/two-factor", `{"password":"guess"}`, http.StatusForbidden, "password_mismatch"},
+		{"Should NOT enrol again while enabled", true, http.MethodPost, "/me/two-factor", `{"password":"secret"}`, http.StatusConflict, "two_factor_conflict"},
+		{"Should NOT confirm without enrolment", false, http.MethodPost, "/me/two-factor/confirm", `{"code":"123456"}`, http.StatusConflict, "two_factor_conflict"},
+		{"Should NOT confirm again while enabled", true, http.MethodPost, "/me/two-factor/confirm", `{"code":"123456"}`, http.StatusConflict, "two_factor_conflict"},
+		{"Should NOT replace the recovery codes while disabled", false, http.MethodPost, "/me/two-factor/recovery-codes", `{"code":"123456"}`, http.StatusConflict, "two_factor_conflict"},
+		{"Should NOT replace the recovery codes with a wrong code", true, http.MethodPost, "/me/two-factor/recovery-codes", `{"code":"wrong-code"}`, http.StatusUnauthorized, "invalid_two_factor_code"},
+		{"Should NOT disable without a code", true, http.MethodDelete, "/me/two-factor", `{"password":"secret"}`, http.StatusBadRequest, "validation_failed"},
+		{"Should NOT disable with a wrong password", true, http.MethodDelete, "/me/two-factor", `{"password":"guess","code":"123456"}`, http.StatusForbidden, "password_mismatch"},
+		{"Should NOT disable with a wrong code", true, http.MethodDelete, "/me/two-factor", `{"password":"secret","code":"wrong-code"}`, http.StatusUnauthorized, "invalid_two_factor_code"},
+		{"Should NOT disable while disabled", false, http.MethodDelete, "/me/two-factor", `{"password":"secret","code":"123456"}`, http.StatusConflict, "two_factor_conflict"},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, user := twoFactorSeed(test, testcase.Enabled)
+
+			// Act
+			recorder := perform(database, user, testcase.Method, testcase.Path, testcase.Body)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), fmt.Sprintf(`"code":%q`, testcase.Code))
+			unchanged := reload(database, user)
+			assert.Equal(user.TOTPSecret, unchanged.TOTPSecret)
+			assert.Equal(testcase.Enabled, unchanged.TwoFactor())
+		})
+	}
+
+	throttled := []struct {
+		Description string
+		Enabled     bool
+		Path        string
+		Handler     func(*UsersController, *gin.Context)
+	}{
+		{"Should count the wrong codes confirming the enrolment as failed logins", false, "/me/two-factor/confirm", (*UsersController).ConfirmTwoFactor},
+		{"Should count the wrong codes replacing the recovery codes as failed logins", true, "/me/two-factor/recovery-codes", (*UsersController).RecoveryCodes},
+	}
+
+	for _, testcase := range throttled {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, user := twoFactorSeed(test, testcase.Enabled)
+			if !testcase.Enabled {
+				perform(database, user, http.MethodPost, "/me/two-factor", `{"password":"secret"}`)
+			}
+			users := &UsersController{Database: database, Throttle: LoginThrottle{MaxFailures: 3, Delay: time.Minute, Lockout: time.Hour}}
+			server := gin.New()
+			server.POST(testcase.Path, func(context *gin.Context) {
+				current := &models.User{}
+				database.First(current, user.ID)
+				context.Set("user", current)
+				testcase.Handler(users, context)
+			})
+			send := func(code string) *httptest.ResponseRecorder {
+				request, _ := http.NewRequest(http.MethodPost, testcase.Path, strings.NewReader(fmt.Sprintf(`{"code":%q}`, code)))
+				recorder := httptest.NewRecorder()
+				server.ServeHTTP(recorder, request)
+				return recorder
+			}
+
+			// Act
+			wrong := send("000000")
+			locked := send(currentCode(test, reload(database, user)))
+
+			// Assert
+			assert.Equal(http.StatusUnauthorized, wrong.Code)
+			assert.Contains(wrong.Body.String(), `"code":"invalid_two_factor_code"`)
+			assert.Equal(http.StatusTooManyRequests, locked.Code)
+			assert.Contains(locked.Body.String(), `"code":"login_locked"`)
+			failed := reload(database, user)
+			assert.Equal(1, failed.FailedLogins)
+			assert.Equal(testcase.Enabled, failed.TwoFactor())
+		})
+	}
+
+	test.Run("Should NOT confirm a wrong code", func(test *testing.T) {
+		// Arrange
+		database, user := twoFactorSeed(test, false)
+		perform(database, user, http.MethodPost, "/me/two-factor", `{"password":"secret"}`)
+
+		// Act
+		recorder := perform(database, user, http.MethodPost, "/me/two-factor/confirm", `{"code":"abcdef"}`)
+
+		// Assert
+		assert.Equal(http.StatusUnauthorized, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"invalid_two_factor_code"`)
+		assert.False(reload(database, user).TwoFactor())
+	})
+}
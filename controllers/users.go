@@ -3,13 +3,19 @@ package controllers
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/middleware"
 	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/policy"
+	"github.com/zatarain/note-vook/problems"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type Credentials struct {
@@ -17,9 +23,48 @@ type Credentials struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// Message is the response of the operations that don't return any record.
+type Message struct {
+	Message string `json:"message"`
+}
+
 type UsersController struct {
 	Database       models.DataAccessInterface
 	SecretTokenKey string
+	Logger         *slog.Logger
+	Throttle       LoginThrottle
+	Nicknames      policy.Nickname
+	Passwords      policy.Password
+	TwoFactor      TwoFactorSettings
+	SSO            SingleSignOn
+	Hub            *events.Hub
+}
+
+// LoginThrottle locks the login of a user for a while after each failed login
+// in a row, doubling the delay on each of them up to the lockout, which is
+// reached anyway after the maximum number of failures. The zero value never
+// locks the login.
+type LoginThrottle struct {
+	MaxFailures int
+	Delay       time.Duration
+	Lockout     time.Duration
+}
+
+// Enabled tells whether the failed logins lock the login.
+func (throttle LoginThrottle) Enabled() bool {
+	return throttle.MaxFailures > 0 && throttle.Lockout > 0
+}
+
+// Wait is how long the login is locked after the given number of failures.
+func (throttle LoginThrottle) Wait(failures int) time.Duration {
+	if failures >= throttle.MaxFailures {
+		return throttle.Lockout
+	}
+	wait := throttle.Delay
+	for step := 1; step < failures && wait < throttle.Lockout; step++ {
+		wait *= 2
+	}
+	return min(wait, throttle.Lockout)
 }
 
 type TokenMaker interface {
@@ -36,15 +81,19 @@ func (credentials *Credentials) HashPassword() error {
 	return exception
 }
 
+func (users *UsersController) logger() *slog.Logger {
+	if users.Logger == nil {
+		return slog.Default()
+	}
+	return users.Logger
+}
+
 func getCredentialsFromRequest(context *gin.Context) *Credentials {
 	var credentials Credentials
 
 	// Trying to bind input from JSON
-	if binding := context.BindJSON(&credentials); binding != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to read input",
-			"reason": binding.Error(),
-		})
+	if binding := context.ShouldBindJSON(&credentials); binding != nil {
+		problems.Abort(context, problems.Input(binding))
 		return nil
 	}
 
@@ -57,12 +106,19 @@ func (users *UsersController) Signup(context *gin.Context) {
 		return
 	}
 
+	// Checking the nickname and password follow the rules
+	if exception := users.Nicknames.Check(credentials.Nickname); exception != nil {
+		problems.Abort(context, violated(problems.InvalidNickname, "nickname", exception))
+		return
+	}
+	if exception := users.Passwords.Check(credentials.Password); exception != nil {
+		problems.Abort(context, violated(problems.WeakPassword, "password", exception))
+		return
+	}
+
 	// Trying to crete a hash for password
 	if exception := credentials.HashPassword(); exception != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to create the hash for password",
-			"reason": exception.Error(),
-		})
+		problems.Abort(context, fmt.Errorf("failed to create the hash for password: %w", exception))
 		return
 	}
 
@@ -71,22 +127,44 @@ func (users *UsersController) Signup(context *gin.Context) {
 		Nickname: credentials.Nickname,
 		Password: credentials.Password,
 	}
-	inserting := users.Database.Create(&user).Error
+	inserting := Session(context, users.Database).Create(&user).Error
+	if errors.Is(inserting, gorm.ErrDuplicatedKey) {
+		problems.Abort(context, problems.DuplicateNickname.Wrap(inserting))
+		return
+	}
 	if inserting != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to insert user into table users",
-			"reason": inserting.Error(),
-		})
+		problems.Abort(context, inserting)
 		return
 	}
 
+	users.logger().InfoContext(context.Request.Context(), "User signed up", "user_id", user.ID)
 	context.JSON(http.StatusCreated, &user)
 }
 
+// violated reports the rules of the policy broken by the given field.
+func violated(problem *problems.Problem, field string, exception error) error {
+	var violations policy.Violations
+	if !errors.As(exception, &violations) {
+		return exception
+	}
+
+	reported := problem.Wrap(exception).WithDetail(fmt.Sprintf("The %s %s", field, exception.Error()))
+	for _, violation := range violations {
+		reported.Errors = append(reported.Errors, problems.FieldError{
+			Field:   field,
+			Rule:    violation.Rule,
+			Message: violation.Message,
+		})
+	}
+	return reported
+}
+
 func (users *UsersController) NewToken(user *models.User) (string, error) {
 	// Create the token for user that last for 7 days
 	data := jwt.MapClaims{
 		"identifier": user.Nickname,
+		"user":       user.ID,
+		"version":    user.TokenVersion,
 		"expiration": time.Now().Add(7 * 24 * time.Hour).Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, data)
@@ -101,34 +179,181 @@ func (users *UsersController) Login(context *gin.Context) {
 		return
 	}
 
-	// Checking the credentials
+	// Checking the credentials, not even comparing the password while locked
 	user := &models.User{}
-	users.Database.First(user, "nickname = ?", credentials.Nickname)
+	Session(context, users.Database).First(user, "nickname = ?", credentials.Nickname)
+	now := time.Now()
+	if users.refuseLocked(context, user, now) {
+		return
+	}
+
 	failed := bcrypt.CompareHashAndPassword(
 		[]byte(user.Password),
 		[]byte(credentials.Password),
 	)
 	if user.ID == 0 || failed != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error": "Invalid nickname or password",
-		})
+		users.logger().WarnContext(context.Request.Context(), "Failed login attempt", "nickname", credentials.Nickname)
+		if exception := users.fail(context, user, now); exception != nil {
+			problems.Abort(context, exception)
+			return
+		}
+		problems.Abort(context, problems.InvalidCredentials)
+		return
+	}
+
+	// Forgetting the previous failures, unless the code is still missing
+	if !user.TwoFactor() {
+		if exception := users.forget(context, user); exception != nil {
+			problems.Abort(context, exception)
+			return
+		}
+	}
+
+	// Only telling the account is disabled to whom knows the password
+	if user.Disabled() {
+		users.logger().WarnContext(context.Request.Context(), "Login attempt on a disabled account", "user_id", user.ID)
+		problems.Abort(context, problems.AccountDisabled)
+		return
+	}
+
+	// The users with two-factor authentication still have to send a code
+	if user.TwoFactor() {
+		users.challenge(context, user, now)
 		return
 	}
 
 	// Generate JWT Token and send it in the Cookies
+	if exception := users.setToken(context, user); exception != nil {
+		problems.Abort(context, exception)
+		return
+	}
+	context.JSON(http.StatusOK, &Message{Message: "Yaaay! You are logged in :)"})
+}
+
+// setToken sends to the client the cookie with a new token for the user.
+func (users *UsersController) setToken(context *gin.Context, user *models.User) error {
 	token, exception := users.NewToken(user)
 	if exception != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{
-			"error":  "Unable to generate access token",
-			"reason": exception.Error(),
-		})
-		return
+		return fmt.Errorf("unable to generate access token: %w", exception)
 	}
 
-	// Send cookie to the client
 	context.SetSameSite(http.SameSiteLaxMode)
 	context.SetCookie("Authorisation", token, 7*24*60*60, "", "", false, true)
-	context.JSON(http.StatusOK, gin.H{"message": "Yaaay! You are logged in :)"})
+	return nil
+}
+
+// refuseLocked rejects the login of a user while it's locked, telling when to
+// try again.
+func (users *UsersController) refuseLocked(context *gin.Context, user *models.User, now time.Time) bool {
+	if !users.Throttle.Enabled() || user.ID == 0 || !user.Locked(now) {
+		return false
+	}
+
+	wait := user.LockedUntil.Sub(now)
+	users.logger().WarnContext(context.Request.Context(), "Login attempt on a locked account", "user_id", user.ID)
+	context.Header(middleware.RetryAfterHeader, middleware.Delta(wait))
+	problems.Abort(context, problems.LoginLocked.WithDetail(fmt.Sprintf(
+		"Too many failed logins, try again in %s seconds", middleware.Delta(wait),
+	)))
+	return true
+}
+
+// forget resets the failed logins of a user once it logs in.
+func (users *UsersController) forget(context *gin.Context, user *models.User) error {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return nil
+	}
+
+	resetting := Session(context, users.Database).
+		Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+	if resetting != nil {
+		return fmt.Errorf("unable to reset the failed logins: %w", resetting)
+	}
+	return nil
+}
+
+// fail counts a failed login of an existing user and locks its login for a
+// while, as long as the throttle is enabled. The failures are counted by the
+// database, so the parallel guesses can't overwrite each other.
+func (users *UsersController) fail(context *gin.Context, user *models.User, now time.Time) error {
+	if !users.Throttle.Enabled() || user.ID == 0 {
+		return nil
+	}
+
+	var failures int
+	var until time.Time
+	counting := Session(context, users.Database).Transaction(func(transaction *gorm.DB) error {
+		counted := transaction.
+			Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("failed_logins", gorm.Expr("failed_logins + 1")).Error
+		if counted != nil {
+			return counted
+		}
+		reading := transaction.
+			Model(&models.User{}).
+			Select("failed_logins").
+			Where("id = ?", user.ID).
+			Scan(&failures).Error
+		if reading != nil {
+			return reading
+		}
+		until = now.Add(users.Throttle.Wait(failures))
+		return transaction.
+			Model(&models.User{}).
+			Where("id = ?", user.ID).
+			Update("locked_until", until).Error
+	})
+	if counting != nil {
+		return fmt.Errorf("unable to count the failed login: %w", counting)
+	}
+	if failures >= users.Throttle.MaxFailures {
+		users.logger().WarnContext(context.Request.Context(), "Login locked out", "user_id", user.ID, "until", until)
+	}
+	return nil
+}
+
+// confirm checks the password given by the current user to confirm an
+// operation. The wrong ones count as failed logins, so the sessions can't be
+// used to guess the password either. The users without password confirm it
+// by logging in again with the identity provider instead.
+func (users *UsersController) confirm(context *gin.Context, user *models.User, password string, warning string) bool {
+	now := time.Now()
+	if users.refuseLocked(context, user, now) {
+		return false
+	}
+
+	// The users without password log in again with the identity provider
+	if user.Password == "" {
+		return users.reauthenticated(context, user, now)
+	}
+	if password == "" {
+		problem := problems.ValidationFailed.WithDetail("The password is required to confirm the operation")
+		problem.Errors = []problems.FieldError{{Field: "password", Rule: "required", Message: "is required"}}
+		problems.Abort(context, problem)
+		return false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		users.logger().WarnContext(context.Request.Context(), warning, "user_id", user.ID)
+		if exception := users.fail(context, user, now); exception != nil {
+			problems.Abort(context, exception)
+			return false
+		}
+		problems.Abort(context, problems.PasswordMismatch)
+		return false
+	}
+
+	// Forgetting the previous failures, unless a code is still missing
+	if !user.TwoFactor() {
+		if exception := users.forget(context, user); exception != nil {
+			problems.Abort(context, exception)
+			return false
+		}
+	}
+	return true
 }
 
 func (users *UsersController) Decoder(token *jwt.Token) (interface{}, error) {
@@ -138,6 +363,13 @@ func (users *UsersController) Decoder(token *jwt.Token) (interface{}, error) {
 	return []byte(users.SecretTokenKey), nil
 }
 
+// Administrator tells whether the request comes from the session of a user
+// with the admin role.
+func (users *UsersController) Administrator(context *gin.Context) bool {
+	user, exception := users.ValidateToken(context)
+	return exception == nil && user.Role == models.RoleAdmin
+}
+
 func (users *UsersController) ValidateToken(context *gin.Context) (*models.User, error) {
 	// Retrieving the Authorisation cookie
 	cookie, exception := context.Cookie("Authorisation")
@@ -158,17 +390,34 @@ func (users *UsersController) ValidateToken(context *gin.Context) (*models.User,
 	}
 
 	// Checking expiration date/time
-	expiration := int64(claims["expiration"].(float64))
-	if time.Now().Unix() > expiration {
+	expiration, _ := claims["expiration"].(float64)
+	if time.Now().Unix() > int64(expiration) {
 		return nil, errors.New("expired session")
 	}
 
-	// Looking for the user nickname
+	// The two-factor challenges have no identifier, so they can't be used instead
+	nickname, ok := claims["identifier"].(string)
+	identifier, identified := claims["user"].(float64)
+	if !(ok && identified) {
+		return nil, errors.New("invalid authentication token")
+	}
+
+	// Looking for the user by both ID and nickname, as the nickname of a
+	// deleted user can be taken again by someone else
 	user := &models.User{}
-	users.Database.First(user, "nickname = ?", claims["identifier"].(string))
+	Session(context, users.Database).First(user, "id = ? AND nickname = ?", uint(identifier), nickname)
 	if user.ID == 0 {
 		return nil, errors.New("user not found")
 	}
+	if user.Disabled() {
+		return nil, errors.New("user disabled")
+	}
+
+	// The tokens issued before e. g. changing the password are revoked
+	version, _ := claims["version"].(float64)
+	if uint(version) != user.TokenVersion {
+		return nil, errors.New("revoked token")
+	}
 
 	return user, nil
 }
@@ -176,13 +425,8 @@ func (users *UsersController) ValidateToken(context *gin.Context) (*models.User,
 func (users *UsersController) Authorise(context *gin.Context) {
 	user, exception := users.ValidateToken(context)
 	if exception != nil {
-		context.AbortWithStatusJSON(
-			http.StatusUnauthorized,
-			gin.H{
-				"error":  "Unauthorised",
-				"reason": exception.Error(),
-			},
-		)
+		problems.Abort(context, problems.Unauthorised.Wrap(exception).WithDetail(exception.Error()))
+		return
 	}
 
 	// Attach user to context, allow access and continue
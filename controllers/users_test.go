@@ -6,7 +6,10 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,8 +21,11 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/zatarain/note-vook/mocks"
 	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/policy"
+	"github.com/zatarain/note-vook/problems"
 	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/exp/slices"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
@@ -62,7 +68,7 @@ func TestSignup(test *testing.T) {
 		users := &UsersController{Database: database}
 		database.
 			On("Create", mock.AnythingOfType("*models.User")).
-			Return(&gorm.DB{Error: errors.New("User already exists")})
+			Return(&gorm.DB{Error: gorm.ErrDuplicatedKey})
 		server.POST("/signup", users.Signup)
 		user := Credentials{
 			Nickname: "dummy-user",
@@ -76,8 +82,8 @@ func TestSignup(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "User already exists")
+		assert.Equal(http.StatusConflict, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"duplicate_nickname"`)
 		database.AssertExpectations(test)
 	})
 
@@ -127,10 +133,88 @@ func TestSignup(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Failed to create the hash for password")
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"internal_error"`)
 		database.AssertNotCalled(test, "Create", mock.AnythingOfType("*models.User"))
 	})
+
+	PolicyTestcases := []struct {
+		Description string
+		Credentials Credentials
+		Code        string
+		Errors      []problems.FieldError
+	}{
+		{
+			Description: "Should NOT create a user with a reserved nickname",
+			Credentials: Credentials{Nickname: "admin", Password: "Sunset-Drive-1986"},
+			Code:        "invalid_nickname",
+			Errors:      []problems.FieldError{{Field: "nickname", Rule: policy.RuleReserved, Message: "is reserved"}},
+		},
+		{
+			Description: "Should NOT create a user with a nickname out of the charset and too short",
+			Credentials: Credentials{Nickname: "é", Password: "Sunset-Drive-1986"},
+			Code:        "invalid_nickname",
+			Errors: []problems.FieldError{
+				{Field: "nickname", Rule: policy.RuleMinLength, Message: "must have at least 3 characters"},
+				{Field: "nickname", Rule: policy.RuleCharset, Message: "must match ^[a-z0-9-]+$"},
+			},
+		},
+		{
+			Description: "Should NOT create a user with a short password",
+			Credentials: Credentials{Nickname: "dummy-user", Password: "Sun-1986"},
+			Code:        "weak_password",
+			Errors:      []problems.FieldError{{Field: "password", Rule: policy.RuleMinLength, Message: "must have at least 10 characters"}},
+		},
+		{
+			Description: "Should NOT create a user with a password of too few classes",
+			Credentials: Credentials{Nickname: "dummy-user", Password: "sunset-drive"},
+			Code:        "weak_password",
+			Errors: []problems.FieldError{{
+				Field:   "password",
+				Rule:    policy.RuleClasses,
+				Message: "must have characters of at least 3 classes among lowercase, uppercase, digits and symbols",
+			}},
+		},
+		{
+			Description: "Should NOT create a user with a breached password",
+			Credentials: Credentials{Nickname: "dummy-user", Password: "P@ssw0rd123"},
+			Code:        "weak_password",
+			Errors:      []problems.FieldError{{Field: "password", Rule: policy.RuleBreached, Message: "is too common, it's known from breaches"}},
+		},
+	}
+
+	for _, testcase := range PolicyTestcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			server := gin.New()
+			database := new(mocks.MockedDataAccessInterface)
+			users := &UsersController{
+				Database: database,
+				Nicknames: policy.Nickname{
+					MinLength: 3,
+					MaxLength: 32,
+					Pattern:   regexp.MustCompile(`^[a-z0-9-]+$`),
+					Reserved:  policy.NewList("admin"),
+				},
+				Passwords: policy.Password{MinLength: 10, MinClasses: 3, Breached: policy.Common()},
+			}
+			server.POST("/signup", users.Signup)
+			body, _ := json.Marshal(testcase.Credentials)
+			request, _ := http.NewRequest(http.MethodPost, "/signup", bytes.NewBuffer(body))
+			recorder := httptest.NewRecorder()
+
+			// Act
+			server.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(http.StatusBadRequest, recorder.Code)
+			problem := problems.Problem{}
+			require.Nil(test, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(testcase.Code, problem.Code)
+			assert.Equal(testcase.Errors, problem.Errors)
+			database.AssertNotCalled(test, "Create", mock.AnythingOfType("*models.User"))
+		})
+	}
 }
 
 func TestLogin(test *testing.T) {
@@ -203,6 +287,40 @@ func TestLogin(test *testing.T) {
 		assert.True(cookies[index].HttpOnly)
 	})
 
+	test.Run("Should NOT login a disabled user", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		database := new(mocks.MockedDataAccessInterface)
+		users := &UsersController{Database: database}
+		anyUser := mock.AnythingOfType("*models.User")
+		call := database.
+			On("First", anyUser, "nickname = ?", "dummy-user").
+			Return(&gorm.DB{Error: nil})
+		call.RunFn = func(arguments mock.Arguments) {
+			user := arguments.Get(0).(*models.User)
+			disabled := time.Now()
+			user.ID = 12345
+			user.Nickname = "dummy-user"
+			user.Password = "top-secret"
+			user.DisabledAt = &disabled
+		}
+
+		monkey.Patch(bcrypt.CompareHashAndPassword, CompareSuccessful)
+		server.POST("/login", users.Login)
+		body, _ := json.Marshal(Credentials{Nickname: "dummy-user", Password: "top-secret"})
+		request, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		database.AssertExpectations(test)
+		assert.Equal(http.StatusForbidden, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"account_disabled"`)
+		assert.Empty(recorder.Result().Cookies())
+	})
+
 	test.Run("Should response with internal server error when unable to generate token", func(test *testing.T) {
 		// Arrange
 		server := gin.New()
@@ -238,7 +356,7 @@ func TestLogin(test *testing.T) {
 		// Assert
 		database.AssertExpectations(test)
 		assert.Equal(http.StatusInternalServerError, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Unable to generate access token")
+		assert.Contains(recorder.Body.String(), `"code":"internal_error"`)
 		require.Equal(test, index, -1)
 	})
 
@@ -331,13 +449,196 @@ func TestLogin(test *testing.T) {
 			server.ServeHTTP(recorder, request)
 
 			// Assert
-			assert.Equal(http.StatusBadRequest, recorder.Code)
+			assert.Equal(http.StatusUnauthorized, recorder.Code)
 			assert.Contains(recorder.Body.String(), "Invalid nickname or password")
+			assert.Contains(recorder.Body.String(), `"code":"invalid_credentials"`)
 			database.AssertExpectations(test)
 		})
 	}
 }
 
+func TestLoginThrottle(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+	throttle := LoginThrottle{MaxFailures: 5, Delay: time.Second, Lockout: 15 * time.Second}
+
+	test.Run("Should double the wait on each failure up to the lockout", func(test *testing.T) {
+		assert.Equal(time.Second, throttle.Wait(1))
+		assert.Equal(2*time.Second, throttle.Wait(2))
+		assert.Equal(8*time.Second, throttle.Wait(4))
+		assert.Equal(15*time.Second, throttle.Wait(5))
+		assert.Equal(15*time.Second, LoginThrottle{MaxFailures: 10, Delay: time.Second, Lockout: 15 * time.Second}.Wait(7))
+		assert.False(LoginThrottle{}.Enabled())
+	})
+
+	// seed stores a user with the given failed logins, locked until the given
+	// time if any.
+	seed := func(test *testing.T, failures int, until *time.Time) (*gorm.DB, models.User) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "users.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}))
+		hash, exception := bcrypt.GenerateFromPassword([]byte("top-secret"), bcrypt.MinCost)
+		require.Nil(exception)
+		user := models.User{Nickname: "dummy-user", Password: string(hash), FailedLogins: failures, LockedUntil: until}
+		require.Nil(database.Create(&user).Error)
+		return database, user
+	}
+
+	login := func(database *gorm.DB, password string) *httptest.ResponseRecorder {
+		users := &UsersController{Database: database, SecretTokenKey: "secret", Throttle: throttle}
+		server := gin.New()
+		server.POST("/login", users.Login)
+		body, _ := json.Marshal(Credentials{Nickname: "dummy-user", Password: password})
+		request, _ := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	reload := func(database *gorm.DB, user models.User) models.User {
+		stored := models.User{}
+		require.Nil(database.First(&stored, user.ID).Error)
+		return stored
+	}
+
+	test.Run("Should lock the login for a while after a failure", func(test *testing.T) {
+		// Arrange
+		database, user := seed(test, 1, nil)
+
+		// Act
+		recorder := login(database, "wrong-secret")
+
+		// Assert
+		assert.Equal(http.StatusUnauthorized, recorder.Code)
+		stored := reload(database, user)
+		assert.Equal(2, stored.FailedLogins)
+		require.NotNil(stored.LockedUntil)
+		assert.WithinDuration(time.Now().Add(2*time.Second), *stored.LockedUntil, time.Second)
+	})
+
+	test.Run("Should lock out the account after the maximum failures", func(test *testing.T) {
+		// Arrange
+		database, user := seed(test, 4, nil)
+
+		// Act
+		recorder := login(database, "wrong-secret")
+
+		// Assert
+		assert.Equal(http.StatusUnauthorized, recorder.Code)
+		stored := reload(database, user)
+		assert.Equal(5, stored.FailedLogins)
+		require.NotNil(stored.LockedUntil)
+		assert.WithinDuration(time.Now().Add(15*time.Second), *stored.LockedUntil, time.Second)
+	})
+
+	test.Run("Should NOT check the password while the login is locked", func(test *testing.T) {
+		// Arrange
+		until := time.Now().Add(10 * time.Second)
+		database, user := seed(test, 5, &until)
+
+		// Act
+		recorder := login(database, "top-secret")
+
+		// Assert
+		assert.Equal(http.StatusTooManyRequests, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"login_locked"`)
+		assert.Equal("10", recorder.Header().Get("Retry-After"))
+		assert.Empty(recorder.Result().Cookies())
+		assert.Equal(5, reload(database, user).FailedLogins)
+	})
+
+	test.Run("Should count every failure of the parallel logins", func(test *testing.T) {
+		// Arrange
+		database, user := seed(test, 0, nil)
+		codes := make(chan int, 4)
+
+		// Act
+		var logins sync.WaitGroup
+		for attempt := 0; attempt < 4; attempt++ {
+			logins.Add(1)
+			go func() {
+				defer logins.Done()
+				codes <- login(database, "wrong-secret").Code
+			}()
+		}
+		logins.Wait()
+		close(codes)
+
+		// Assert
+		// The logins arriving once the first failure is counted are refused
+		// without checking the password, so they don't count
+		failed := 0
+		for code := range codes {
+			if code == http.StatusUnauthorized {
+				failed++
+			} else {
+				assert.Equal(http.StatusTooManyRequests, code)
+			}
+		}
+		assert.GreaterOrEqual(failed, 1)
+		assert.Equal(failed, reload(database, user).FailedLogins)
+	})
+
+	// confirm sends the password of the logged user to change it.
+	confirm := func(database *gorm.DB, user models.User, password string) *httptest.ResponseRecorder {
+		users := &UsersController{Database: database, SecretTokenKey: "secret", Throttle: throttle}
+		server := gin.New()
+		server.POST("/me/password", authorise(&user), users.ChangePassword)
+		body, _ := json.Marshal(ChangePasswordContract{Password: password, NewPassword: "a-new-top-secret"})
+		request, _ := http.NewRequest(http.MethodPost, "/me/password", bytes.NewBuffer(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should count the wrong password confirmations as failed logins", func(test *testing.T) {
+		// Arrange
+		database, user := seed(test, 4, nil)
+
+		// Act
+		recorder := confirm(database, user, "wrong-secret")
+
+		// Assert
+		assert.Equal(http.StatusForbidden, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"password_mismatch"`)
+		stored := reload(database, user)
+		assert.Equal(5, stored.FailedLogins)
+		require.NotNil(stored.LockedUntil)
+		assert.WithinDuration(time.Now().Add(15*time.Second), *stored.LockedUntil, time.Second)
+	})
+
+	test.Run("Should NOT confirm the password while the login is locked", func(test *testing.T) {
+		// Arrange
+		until := time.Now().Add(10 * time.Second)
+		database, user := seed(test, 5, &until)
+
+		// Act
+		recorder := confirm(database, user, "top-secret")
+
+		// Assert
+		assert.Equal(http.StatusTooManyRequests, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"login_locked"`)
+		stored := reload(database, user)
+		assert.Equal(user.Password, stored.Password)
+	})
+
+	test.Run("Should forget the failures after a successful login", func(test *testing.T) {
+		// Arrange
+		until := time.Now().Add(-time.Second)
+		database, user := seed(test, 3, &until)
+
+		// Act
+		recorder := login(database, "top-secret")
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		stored := reload(database, user)
+		assert.Zero(stored.FailedLogins)
+		assert.Nil(stored.LockedUntil)
+	})
+}
+
 func TestAuthorise(test *testing.T) {
 	assert := assert.New(test)
 	gin.SetMode(gin.TestMode)
@@ -422,7 +723,7 @@ func TestNewToken(test *testing.T) {
 
 	test.Run("Should generate the token", func(test *testing.T) {
 		// Arrange
-		user := &models.User{Nickname: "dummy-user"}
+		user := &models.User{ID: 12345, Nickname: "dummy-user"}
 		monkey.Patch(time.Now, FakeNow)
 		expiration, _ := time.Parse(time.DateOnly, "2021-01-08")
 
@@ -433,6 +734,7 @@ func TestNewToken(test *testing.T) {
 		parsed, _ := jwt.Parse(token, users.Decoder)
 		data, _ := parsed.Claims.(jwt.MapClaims)
 		assert.Equal(user.Nickname, data["identifier"].(string))
+		assert.Equal(user.ID, uint(data["user"].(float64)))
 		assert.Equal(expiration.Unix(), int64(data["expiration"].(float64)))
 		assert.NotEmpty(token)
 		assert.Nil(exception)
@@ -460,10 +762,10 @@ func TestValidateToken(test *testing.T) {
 		// Arrange
 		database := new(mocks.MockedDataAccessInterface)
 		users.Database = database
-		token, _ := users.NewToken(&models.User{Nickname: "dummy-user"})
+		token, _ := users.NewToken(&models.User{ID: 12345, Nickname: "dummy-user"})
 		anyUser := mock.AnythingOfType("*models.User")
 		call := database.
-			On("First", anyUser, "nickname = ?", "dummy-user").
+			On("First", anyUser, "id = ? AND nickname = ?", uint(12345), "dummy-user").
 			Return(&gorm.DB{Error: nil})
 		call.RunFn = func(arguments mock.Arguments) {
 			record := arguments.Get(0).(*models.User)
@@ -558,14 +860,45 @@ func TestValidateToken(test *testing.T) {
 		assert.Contains(exception.Error(), "expired session")
 	})
 
+	test.Run("Should return error when the user is disabled", func(test *testing.T) {
+		// Arrange
+		database := new(mocks.MockedDataAccessInterface)
+		users.Database = database
+		token, _ := users.NewToken(&models.User{ID: 12345, Nickname: "dummy-user"})
+		anyUser := mock.AnythingOfType("*models.User")
+		call := database.
+			On("First", anyUser, "id = ? AND nickname = ?", uint(12345), "dummy-user").
+			Return(&gorm.DB{Error: nil})
+		call.RunFn = func(arguments mock.Arguments) {
+			record := arguments.Get(0).(*models.User)
+			disabled := time.Now()
+			record.ID = 12345
+			record.Nickname = "dummy-user"
+			record.DisabledAt = &disabled
+		}
+		request, _ := http.NewRequest("GET", "/", nil)
+		request.AddCookie(&http.Cookie{Name: "Authorisation", Value: token})
+		recorder := httptest.NewRecorder()
+		exception = nil
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		database.AssertExpectations(test)
+		assert.NotNil(exception)
+		assert.Contains(exception.Error(), "user disabled")
+		assert.Nil(userResult)
+	})
+
 	test.Run("Should return error when user doesn't exist", func(test *testing.T) {
 		// Arrange
 		database := new(mocks.MockedDataAccessInterface)
 		users.Database = database
-		token, _ := users.NewToken(&models.User{Nickname: "user-dummy"})
+		token, _ := users.NewToken(&models.User{ID: 12345, Nickname: "user-dummy"})
 		anyUser := mock.AnythingOfType("*models.User")
 		call := database.
-			On("First", anyUser, "nickname = ?", "user-dummy").
+			On("First", anyUser, "id = ? AND nickname = ?", uint(12345), "user-dummy").
 			Return(&gorm.DB{Error: nil})
 		call.RunFn = func(arguments mock.Arguments) {
 			record := arguments.Get(0).(*models.User)
@@ -1,15 +1,22 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/events"
 	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/webhooks"
+	"gorm.io/gorm"
 )
 
 type VideosController struct {
 	Database models.DataAccessInterface
+	Hub      *events.Hub
+	Webhooks *webhooks.Dispatcher
 }
 
 type AddVideoContract struct {
@@ -26,6 +33,15 @@ type EditVideoContract struct {
 	Duration    models.TimeStamp `json:"duration"`
 }
 
+// duplicateLink tells apart the videos already added by the user from any
+// other failure when saving a video.
+func duplicateLink(exception error) error {
+	if errors.Is(exception, gorm.ErrDuplicatedKey) {
+		return problems.DuplicateVideoLink.Wrap(exception)
+	}
+	return exception
+}
+
 func CurrentUser(context *gin.Context) *models.User {
 	value, _ := context.Get("user")
 	return value.(*models.User)
@@ -34,7 +50,7 @@ func CurrentUser(context *gin.Context) *models.User {
 func (videos *VideosController) Index(context *gin.Context) {
 	user := CurrentUser(context)
 	var recordset []models.Video
-	videos.Database.Find(&recordset, "user_id = ?", user.ID)
+	Session(context, videos.Database).Find(&recordset, "user_id = ?", user.ID)
 	context.JSON(http.StatusOK, recordset)
 }
 
@@ -43,10 +59,7 @@ func (videos *VideosController) Add(context *gin.Context) {
 
 	// Trying to bind input from JSON
 	if binding := context.ShouldBindJSON(&input); binding != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to read input",
-			"reason": binding.Error(),
-		})
+		problems.Abort(context, problems.Input(binding))
 		return
 	}
 
@@ -58,12 +71,13 @@ func (videos *VideosController) Add(context *gin.Context) {
 		Link:        input.Link,
 		Duration:    input.Duration,
 	}
-	inserting := videos.Database.Create(&video).Error
+	inserting := notified(context, videos.Webhooks, videos.Database, events.VideoCreated,
+		func(database models.DataAccessInterface) (interface{}, error) {
+			return &video, database.Create(&video).Error
+		},
+	)
 	if inserting != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to save the video",
-			"reason": inserting.Error(),
-		})
+		problems.Abort(context, duplicateLink(inserting))
 		return
 	}
 
@@ -73,14 +87,11 @@ func (videos *VideosController) Add(context *gin.Context) {
 func (videos *VideosController) search(video *models.Video, context *gin.Context) bool {
 	id := context.Param("id")
 	user := CurrentUser(context)
-	searching := videos.Database.
+	searching := Session(context, videos.Database).
 		Preload("Annotations").
 		First(video, "id = ? AND user_id = ?", id, user.ID).Error
 	if searching != nil {
-		context.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-			"error":  "Video not found",
-			"reason": searching.Error(),
-		})
+		problems.Abort(context, notFound(problems.VideoNotFound, searching))
 		return false
 	}
 	return true
@@ -98,10 +109,7 @@ func (videos *VideosController) Edit(context *gin.Context) {
 	// Trying to bind input from JSON
 	var input EditVideoContract
 	if binding := context.ShouldBindJSON(&input); binding != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to read input",
-			"reason": binding.Error(),
-		})
+		problems.Abort(context, problems.Input(binding))
 		return
 	}
 
@@ -113,12 +121,13 @@ func (videos *VideosController) Edit(context *gin.Context) {
 
 	// Try to save in the database
 	video.UpdatedAt = time.Now()
-	saving := videos.Database.Model(&video).Updates(input).Error
-	if saving != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to save the video",
-			"reason": saving.Error(),
-		})
+	updating := notified(context, videos.Webhooks, videos.Database, events.VideoUpdated,
+		func(database models.DataAccessInterface) (interface{}, error) {
+			return &video, database.Model(&video).Updates(input).Error
+		},
+	)
+	if updating != nil {
+		problems.Abort(context, duplicateLink(updating))
 		return
 	}
 
@@ -132,16 +141,17 @@ func (videos *VideosController) Delete(context *gin.Context) {
 		return
 	}
 
-	deleting := videos.Database.Select("Annotations").Delete(&video).Error
+	deleting := notified(context, videos.Webhooks, videos.Database, events.VideoDeleted,
+		func(database models.DataAccessInterface) (interface{}, error) {
+			return &video, database.Select("Annotations").Delete(&video).Error
+		},
+	)
 	if deleting != nil {
-		context.JSON(http.StatusBadRequest, gin.H{
-			"error":  "Failed to delete the video",
-			"reason": deleting.Error(),
-		})
+		problems.Abort(context, deleting)
 		return
 	}
 
-	context.JSON(http.StatusOK, gin.H{
-		"message": "Video successfully deleted",
-	})
+	// The streams of the video end, there is nothing left to follow
+	videos.Hub.Remove(video.ID)
+	context.JSON(http.StatusOK, &Message{Message: "Video successfully deleted"})
 }
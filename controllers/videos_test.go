@@ -171,7 +171,7 @@ func TestVideosView(test *testing.T) {
 			reflect.TypeOf(gormFakeSuccess),
 			"First",
 			func(DB *gorm.DB, value interface{}, conditions ...interface{}) *gorm.DB {
-				return &gorm.DB{Error: errors.New("no results")}
+				return &gorm.DB{Error: gorm.ErrRecordNotFound}
 			},
 		)
 		defer monkey.UnpatchAll()
@@ -186,6 +186,7 @@ func TestVideosView(test *testing.T) {
 		// Assert
 		assert.Equal(http.StatusNotFound, recorder.Code)
 		assert.Contains(recorder.Body.String(), "Video not found")
+		assert.Contains(recorder.Body.String(), `"code":"video_not_found"`)
 		database.AssertExpectations(test)
 	})
 }
@@ -276,7 +277,7 @@ func TestVideosAdd(test *testing.T) {
 		Input    gin.H
 	}{
 		{
-			Expected: "Field validation for 'Title' failed on the 'required' tag",
+			Expected: `{"field":"title","rule":"required","message":"is required"}`,
 			Input: gin.H{
 				"description": "This is a dummy video number three",
 				"duration":    "1:45",
@@ -284,7 +285,7 @@ func TestVideosAdd(test *testing.T) {
 			},
 		},
 		{
-			Expected: "Field validation for 'Title' failed on the 'required' tag",
+			Expected: `{"field":"title","rule":"required","message":"is required"}`,
 			Input: gin.H{
 				"title":       "",
 				"description": "This is a dummy video number three",
@@ -293,7 +294,7 @@ func TestVideosAdd(test *testing.T) {
 			},
 		},
 		{
-			Expected: "Field validation for 'Link' failed on the 'required' tag",
+			Expected: `{"field":"link","rule":"required","message":"is required"}`,
 			Input: gin.H{
 				"title":       "Dummy video 03",
 				"description": "This is a dummy video number three",
@@ -301,7 +302,7 @@ func TestVideosAdd(test *testing.T) {
 			},
 		},
 		{
-			Expected: "Field validation for 'Duration' failed on the 'required' tag",
+			Expected: `{"field":"duration","rule":"required","message":"is required"}`,
 			Input: gin.H{
 				"title":       "Dummy video 03",
 				"description": "This is a dummy video number three",
@@ -309,7 +310,7 @@ func TestVideosAdd(test *testing.T) {
 			},
 		},
 		{
-			Expected: "Field validation for 'Link' failed on the 'url' tag",
+			Expected: `{"field":"link","rule":"url","message":"must be a valid URL"}`,
 			Input: gin.H{
 				"title":       "Dummy video 03",
 				"description": "This is a dummy video number three",
@@ -354,29 +355,52 @@ func TestVideosAdd(test *testing.T) {
 		})
 	}
 
-	test.Run("Should response HTTP 400 when there is a problem with database (e. g. unique index)", func(test *testing.T) {
-		// Arrange
-		server := gin.New()
-		database := new(mocks.MockedDataAccessInterface)
-		videos := &VideosController{Database: database}
-		database.
-			On("Create", mock.AnythingOfType("*models.Video")).
-			Return(&gorm.DB{Error: errors.New("unique index violation")})
-		server.POST("/videos", authorise(&current), videos.Add)
+	databaseFailures := []struct {
+		Description string
+		Exception   error
+		Status      int
+		Code        string
+	}{
+		{
+			Description: "Should response HTTP 409 when the user already added a video with the same link",
+			Exception:   gorm.ErrDuplicatedKey,
+			Status:      http.StatusConflict,
+			Code:        "duplicate_video_link",
+		},
+		{
+			Description: "Should response HTTP 500 without the details when there is any other problem with database",
+			Exception:   errors.New("disk I/O error"),
+			Status:      http.StatusInternalServerError,
+			Code:        "internal_error",
+		},
+	}
 
-		body, _ := json.Marshal(validTestcases[0].Input)
-		request, _ := http.NewRequest(http.MethodPost, "/videos", bytes.NewBuffer([]byte(body)))
-		recorder := httptest.NewRecorder()
+	for _, testcase := range databaseFailures {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			server := gin.New()
+			database := new(mocks.MockedDataAccessInterface)
+			videos := &VideosController{Database: database}
+			database.
+				On("Create", mock.AnythingOfType("*models.Video")).
+				Return(&gorm.DB{Error: testcase.Exception})
+			server.POST("/videos", authorise(&current), videos.Add)
 
-		// Act
-		server.ServeHTTP(recorder, request)
+			body, _ := json.Marshal(validTestcases[0].Input)
+			request, _ := http.NewRequest(http.MethodPost, "/videos", bytes.NewBuffer([]byte(body)))
+			recorder := httptest.NewRecorder()
 
-		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Failed to save the video")
-		assert.Contains(recorder.Body.String(), "unique index violation")
-		database.AssertExpectations(test)
-	})
+			// Act
+			server.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Equal("application/problem+json", recorder.Header().Get("Content-Type"))
+			assert.Contains(recorder.Body.String(), fmt.Sprintf(`"code":"%s"`, testcase.Code))
+			assert.NotContains(recorder.Body.String(), testcase.Exception.Error())
+			database.AssertExpectations(test)
+		})
+	}
 }
 
 func TestVideosEdit(test *testing.T) {
@@ -532,7 +556,7 @@ func TestVideosEdit(test *testing.T) {
 				"duration":    "6:15",
 				"link":        "hello world",
 			},
-			Expected: "Field validation for 'Link' failed on the 'url' tag",
+			Expected: `{"field":"link","rule":"url","message":"must be a valid URL"}`,
 		},
 	}
 
@@ -577,7 +601,7 @@ func TestVideosEdit(test *testing.T) {
 			func(DB *gorm.DB, value interface{}, conditions ...interface{}) *gorm.DB {
 				arguments.ValueType = reflect.TypeOf(value).String()
 				arguments.Conditions = conditions
-				return &gorm.DB{Error: errors.New("no results")}
+				return &gorm.DB{Error: gorm.ErrRecordNotFound}
 			},
 		)
 		defer monkey.UnpatchAll()
@@ -598,6 +622,7 @@ func TestVideosEdit(test *testing.T) {
 		// Assert
 		assert.Equal(http.StatusNotFound, recorder.Code)
 		assert.Contains(recorder.Body.String(), "Video not found")
+		assert.Contains(recorder.Body.String(), `"code":"video_not_found"`)
 		assert.Equal("*models.Video", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
 		assert.Equal("id = ? AND user_id = ?", arguments.Conditions[0])
@@ -606,7 +631,7 @@ func TestVideosEdit(test *testing.T) {
 		database.AssertExpectations(test)
 	})
 
-	test.Run("Should NOT update the video for the current user if there is a problem with database", func(test *testing.T) {
+	test.Run("Should NOT update the video for the current user when the link is already used", func(test *testing.T) {
 		// Arrange
 		server := gin.New()
 		database := new(mocks.MockedDataAccessInterface)
@@ -649,7 +674,7 @@ func TestVideosEdit(test *testing.T) {
 			"Updates",
 			func(DB *gorm.DB, value interface{}) *gorm.DB {
 				input = value.(EditVideoContract)
-				return &gorm.DB{Error: errors.New("unable to update due to unique index violation")}
+				return &gorm.DB{Error: gorm.ErrDuplicatedKey}
 			},
 		)
 		defer monkey.UnpatchAll()
@@ -668,9 +693,8 @@ func TestVideosEdit(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
-		assert.Contains(recorder.Body.String(), "Failed to save the video")
-		assert.Contains(recorder.Body.String(), "unable to update due to unique index violation")
+		assert.Equal(http.StatusConflict, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"duplicate_video_link"`)
 		assert.Equal("*models.Video", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
 		assert.Equal("id = ? AND user_id = ?", arguments.Conditions[0])
@@ -818,10 +842,10 @@ func TestVideosDelete(test *testing.T) {
 		server.ServeHTTP(recorder, request)
 
 		// Assert
-		assert.Equal(http.StatusBadRequest, recorder.Code)
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
 		assert.Equal(&video, triedToBeRemoved)
-		assert.Contains(recorder.Body.String(), "Failed to delete the video")
-		assert.Contains(recorder.Body.String(), "unable to delete record from database")
+		assert.Contains(recorder.Body.String(), `"code":"internal_error"`)
+		assert.NotContains(recorder.Body.String(), "unable to delete record from database")
 		assert.Equal("*models.Video", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
 		assert.Equal("id = ? AND user_id = ?", arguments.Conditions[0])
@@ -848,7 +872,7 @@ func TestVideosDelete(test *testing.T) {
 			func(DB *gorm.DB, value interface{}, conditions ...interface{}) *gorm.DB {
 				arguments.ValueType = reflect.TypeOf(value).String()
 				arguments.Conditions = conditions
-				return &gorm.DB{Error: errors.New("no results")}
+				return &gorm.DB{Error: gorm.ErrRecordNotFound}
 			},
 		)
 		defer monkey.UnpatchAll()
@@ -863,6 +887,7 @@ func TestVideosDelete(test *testing.T) {
 		// Assert
 		assert.Equal(http.StatusNotFound, recorder.Code)
 		assert.Contains(recorder.Body.String(), "Video not found")
+		assert.Contains(recorder.Body.String(), `"code":"video_not_found"`)
 		assert.Equal("*models.Video", arguments.ValueType)
 		assert.Len(arguments.Conditions, 3)
 		assert.Equal("id = ? AND user_id = ?", arguments.Conditions[0])
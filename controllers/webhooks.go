@@ -0,0 +1,265 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/webhooks"
+	"gorm.io/gorm"
+)
+
+// MaximumDeliveries is the number of the latest deliveries listed per webhook.
+const MaximumDeliveries int = 100
+
+type WebhooksController struct {
+	Database models.DataAccessInterface
+	Webhooks *webhooks.Dispatcher
+
+	// Resolver looks up the hosts of the URLs, the default one when it's nil
+	Resolver webhooks.Resolver
+}
+
+type AddWebhookContract struct {
+	URL    string   `json:"url" binding:"required,http_url"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=video.created video.updated video.deleted annotation.created annotation.updated annotation.deleted"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=255"`
+}
+
+type EditWebhookContract struct {
+	URL    string   `json:"url" binding:"omitempty,http_url"`
+	Events []string `json:"events" binding:"omitempty,min=1,dive,oneof=video.created video.updated video.deleted annotation.created annotation.updated annotation.deleted"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=255"`
+	Active *bool    `json:"active"`
+}
+
+// notify enqueues the deliveries of the event for the webhooks of the logged
+// user. It runs in the transaction saving the change, so the deliveries are
+// stored along with it or not at all, and the dispatcher is notified once it's
+// committed.
+func notify(context *gin.Context, dispatcher *webhooks.Dispatcher, transaction models.DataAccessInterface, kind string, data interface{}) error {
+	return dispatcher.Enqueue(transaction, CurrentUser(context).ID, kind, data)
+}
+
+// notified saves a change and notifies the webhooks of its event in the same
+// transaction. The change returns the data of the event once it's saved.
+// Without dispatcher there is nothing to enqueue, so it runs on its own.
+func notified(
+	context *gin.Context,
+	dispatcher *webhooks.Dispatcher,
+	database models.DataAccessInterface,
+	kind string,
+	change func(database models.DataAccessInterface) (interface{}, error),
+) error {
+	if dispatcher == nil {
+		_, exception := change(Session(context, database))
+		return exception
+	}
+	exception := Session(context, database).Transaction(func(transaction *gorm.DB) error {
+		data, exception := change(transaction)
+		if exception != nil {
+			return exception
+		}
+		return notify(context, dispatcher, transaction, kind, data)
+	})
+	if exception == nil {
+		dispatcher.Notify()
+	}
+	return exception
+}
+
+// newSecret returns a random secret to sign the deliveries of a webhook.
+func newSecret() string {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return hex.EncodeToString(secret)
+}
+
+func (hooks *WebhooksController) search(context *gin.Context, webhook *models.Webhook) bool {
+	user := CurrentUser(context)
+	searching := Session(context, hooks.Database).
+		First(webhook, "id = ? AND user_id = ?", context.Param("id"), user.ID).Error
+	if searching != nil {
+		problems.Abort(context, notFound(problems.WebhookNotFound, searching))
+		return false
+	}
+	return true
+}
+
+// public checks the URL only points to public addresses, so the deliveries
+// can't reach the internal services.
+func (hooks *WebhooksController) public(context *gin.Context, address string) bool {
+	if exception := webhooks.CheckURL(context.Request.Context(), hooks.Resolver, address); exception != nil {
+		problems.Abort(context, problems.ForbiddenWebhookURL.Wrap(exception).WithDetail(exception.Error()))
+		return false
+	}
+	return true
+}
+
+func (hooks *WebhooksController) Index(context *gin.Context) {
+	user := CurrentUser(context)
+	recordset := []models.Webhook{}
+	searching := Session(context, hooks.Database).Find(&recordset, "user_id = ?", user.ID).Error
+	if searching != nil {
+		problems.Abort(context, searching)
+		return
+	}
+	for index := range recordset {
+		recordset[index].Secret = ""
+	}
+	context.JSON(http.StatusOK, recordset)
+}
+
+// Add registers a webhook, its secret is generated unless it's given and it's
+// only shown in this response.
+func (hooks *WebhooksController) Add(context *gin.Context) {
+	var input AddWebhookContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+	if !hooks.public(context, input.URL) {
+		return
+	}
+
+	webhook := models.Webhook{
+		UserID: CurrentUser(context).ID,
+		URL:    input.URL,
+		Events: input.Events,
+		Secret: input.Secret,
+		Active: true,
+	}
+	if webhook.Secret == "" {
+		webhook.Secret = newSecret()
+	}
+	inserting := Session(context, hooks.Database).Create(&webhook).Error
+	if inserting != nil {
+		problems.Abort(context, inserting)
+		return
+	}
+
+	context.JSON(http.StatusCreated, &webhook)
+}
+
+func (hooks *WebhooksController) View(context *gin.Context) {
+	var webhook models.Webhook
+	if !hooks.search(context, &webhook) {
+		return
+	}
+	webhook.Secret = ""
+	context.JSON(http.StatusOK, &webhook)
+}
+
+// Edit changes the given fields of a webhook, the secret is only shown when
+// it's changed.
+func (hooks *WebhooksController) Edit(context *gin.Context) {
+	var input EditWebhookContract
+	if binding := context.ShouldBindJSON(&input); binding != nil {
+		problems.Abort(context, problems.Input(binding))
+		return
+	}
+
+	if input.URL != "" && !hooks.public(context, input.URL) {
+		return
+	}
+
+	var webhook models.Webhook
+	if !hooks.search(context, &webhook) {
+		return
+	}
+
+	if input.URL != "" {
+		webhook.URL = input.URL
+	}
+	if len(input.Events) > 0 {
+		webhook.Events = input.Events
+	}
+	if input.Secret != "" {
+		webhook.Secret = input.Secret
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+	webhook.UpdatedAt = time.Now()
+	saving := Session(context, hooks.Database).Select("*").Updates(&webhook).Error
+	if saving != nil {
+		problems.Abort(context, saving)
+		return
+	}
+
+	if input.Secret == "" {
+		webhook.Secret = ""
+	}
+	context.JSON(http.StatusOK, &webhook)
+}
+
+// Delete removes the webhook along with its deliveries, including the pending
+// ones.
+func (hooks *WebhooksController) Delete(context *gin.Context) {
+	var webhook models.Webhook
+	if !hooks.search(context, &webhook) {
+		return
+	}
+
+	deleting := Session(context, hooks.Database).Transaction(func(transaction *gorm.DB) error {
+		if exception := transaction.Delete(&models.WebhookDelivery{}, "webhook_id = ?", webhook.ID).Error; exception != nil {
+			return exception
+		}
+		return transaction.Delete(&webhook).Error
+	})
+	if deleting != nil {
+		problems.Abort(context, deleting)
+		return
+	}
+
+	context.JSON(http.StatusOK, &Message{Message: "Webhook successfully deleted"})
+}
+
+// Deliveries lists the latest deliveries of the webhook, the newest first.
+func (hooks *WebhooksController) Deliveries(context *gin.Context) {
+	var webhook models.Webhook
+	if !hooks.search(context, &webhook) {
+		return
+	}
+
+	recordset := []models.WebhookDelivery{}
+	searching := Session(context, hooks.Database).
+		Where("webhook_id = ?", webhook.ID).
+		Order("id DESC").
+		Limit(MaximumDeliveries).
+		Find(&recordset).Error
+	if searching != nil {
+		problems.Abort(context, searching)
+		return
+	}
+	context.JSON(http.StatusOK, recordset)
+}
+
+// Redeliver sends again the event of a delivery, whatever its result was, as a
+// new pending delivery with the same payload.
+func (hooks *WebhooksController) Redeliver(context *gin.Context) {
+	var webhook models.Webhook
+	if !hooks.search(context, &webhook) {
+		return
+	}
+
+	var delivery models.WebhookDelivery
+	database := Session(context, hooks.Database)
+	searching := database.First(&delivery, "id = ? AND webhook_id = ?", context.Param("delivery"), webhook.ID).Error
+	if searching != nil {
+		problems.Abort(context, notFound(problems.DeliveryNotFound, searching))
+		return
+	}
+
+	redelivery, inserting := hooks.Webhooks.Redeliver(database, webhook.UserID, &delivery)
+	if inserting != nil {
+		problems.Abort(context, inserting)
+		return
+	}
+
+	context.JSON(http.StatusAccepted, redelivery)
+}
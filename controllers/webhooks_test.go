@@ -0,0 +1,454 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"github.com/zatarain/note-vook/webhooks"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// hosts is a fixed DNS for the tests of the webhooks.
+type hosts map[string]string
+
+func (hosts hosts) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	address, found := hosts[host]
+	if !found {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return []net.IPAddr{{IP: net.ParseIP(address)}}, nil
+}
+
+func TestWebhooks(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	// seed registers a webhook with two deliveries for the owner and another
+	// webhook for someone else.
+	seed := func(test *testing.T) (*gorm.DB, *models.User, models.Webhook, models.Webhook) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "webhooks.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.User{}, &models.Video{}, &models.Annotation{}, &models.Webhook{}, &models.WebhookDelivery{}))
+		owner := &models.User{Nickname: "owner"}
+		require.Nil(database.Create(owner).Error)
+		mine := models.Webhook{UserID: owner.ID, URL: "https://ci.io/hook", Events: []string{events.VideoCreated}, Secret: "my-secret", Active: true}
+		require.Nil(database.Create(&mine).Error)
+		others := models.Webhook{UserID: owner.ID + 1, URL: "https://other.io/hook", Events: []string{events.VideoCreated}, Secret: "other-secret", Active: true}
+		require.Nil(database.Create(&others).Error)
+		for _, status := range []string{models.DeliveryFailed, models.DeliveryDelivered} {
+			delivery := models.WebhookDelivery{
+				WebhookID: mine.ID, EventID: "event-" + status, Event: events.VideoCreated,
+				Payload: json.RawMessage(`{"id":"event-` + status + `"}`), Status: status,
+			}
+			require.Nil(database.Create(&delivery).Error)
+		}
+		return database, owner, mine, others
+	}
+
+	perform := func(database *gorm.DB, user *models.User, method string, path string, body string) *httptest.ResponseRecorder {
+		hooks := &WebhooksController{
+			Database: database,
+			Resolver: hosts{"ci.io": "93.184.216.34", "chat.io": "93.184.216.35", "metadata.io": "169.254.169.254"},
+		}
+		server := gin.New()
+		routes := server.Group("/", func(context *gin.Context) { context.Set("user", user) })
+		routes.GET("/webhooks", hooks.Index)
+		routes.POST("/webhooks", hooks.Add)
+		routes.GET("/webhooks/:id", hooks.View)
+		routes.PATCH("/webhooks/:id", hooks.Edit)
+		routes.DELETE("/webhooks/:id", hooks.Delete)
+		routes.GET("/webhooks/:id/deliveries", hooks.Deliveries)
+		routes.POST("/webhooks/:id/deliveries/:delivery/redeliver", hooks.Redeliver)
+		request, _ := http.NewRequest(method, path, strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	test.Run("Should register a webhook showing its generated secret only once", func(test *testing.T) {
+		// Arrange
+		database, owner, _, _ := seed(test)
+		body := `{"url":"https://chat.io/hook","events":["annotation.created","annotation.deleted"]}`
+
+		// Act
+		recorder := perform(database, owner, http.MethodPost, "/webhooks", body)
+
+		// Assert
+		require.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+		created := models.Webhook{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &created))
+		assert.Equal(owner.ID, created.UserID)
+		assert.Equal("https://chat.io/hook", created.URL)
+		assert.Equal([]string{events.AnnotationCreated, events.AnnotationDeleted}, created.Events)
+		assert.True(created.Active)
+		assert.Len(created.Secret, 64)
+		stored := models.Webhook{}
+		require.Nil(database.First(&stored, created.ID).Error)
+		assert.Equal(created.Secret, stored.Secret)
+		assert.Equal(created.Events, stored.Events)
+		viewing := perform(database, owner, http.MethodGet, fmt.Sprintf("/webhooks/%d", created.ID), "")
+		assert.NotContains(viewing.Body.String(), "secret")
+	})
+
+	test.Run("Should register a webhook with the given secret", func(test *testing.T) {
+		// Arrange
+		database, owner, _, _ := seed(test)
+		body := `{"url":"https://ci.io/hooks/notevook","events":["video.updated"],"secret":"a-secret-long-enough"}`
+
+		// Act
+		recorder := perform(database, owner, http.MethodPost, "/webhooks", body)
+
+		// Assert
+		require.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+		assert.Contains(recorder.Body.String(), `"secret":"a-secret-long-enough"`)
+	})
+
+	invalid := []struct {
+		Description string
+		Body        string
+		Field       string
+	}{
+		{"Should fail to register a webhook without URL", `{"events":["video.created"]}`, "url"},
+		{"Should fail to register a webhook with a URL other than HTTP", `{"url":"ftp://ci.io","events":["video.created"]}`, "url"},
+		{"Should fail to register a webhook without events", `{"url":"https://ci.io","events":[]}`, "events"},
+		{"Should fail to register a webhook with unknown events", `{"url":"https://ci.io","events":["video.watched"]}`, "events[0]"},
+		{"Should fail to register a webhook with a short secret", `{"url":"https://ci.io","events":["video.created"],"secret":"short"}`, "secret"},
+	}
+
+	for _, testcase := range invalid {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner, _, _ := seed(test)
+
+			// Act
+			recorder := perform(database, owner, http.MethodPost, "/webhooks", testcase.Body)
+
+			// Assert
+			require.Equal(http.StatusBadRequest, recorder.Code)
+			problem := problems.Problem{}
+			require.Nil(json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(problems.ValidationFailed.Code, problem.Code)
+			require.Len(problem.Errors, 1)
+			assert.Equal(testcase.Field, problem.Errors[0].Field)
+		})
+	}
+
+	forbidden := []struct {
+		Description string
+		URL         string
+	}{
+		{"Should NOT register a webhook for localhost", "http://localhost:9000/hook"},
+		{"Should NOT register a webhook for the metadata service", "http://169.254.169.254/latest/meta-data"},
+		{"Should NOT register a webhook for a private network", "http://10.0.0.7/hook"},
+		{"Should NOT register a webhook for a host resolved to a private address", "https://metadata.io/hook"},
+		{"Should NOT register a webhook for a host which can't be resolved", "https://unknown.io/hook"},
+	}
+
+	for _, testcase := range forbidden {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner, _, _ := seed(test)
+			body := `{"url":"` + testcase.URL + `","events":["video.created"]}`
+
+			// Act
+			recorder := perform(database, owner, http.MethodPost, "/webhooks", body)
+
+			// Assert
+			require.Equal(http.StatusBadRequest, recorder.Code)
+			problem := problems.Problem{}
+			require.Nil(json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(problems.ForbiddenWebhookURL.Code, problem.Code)
+			var count int64
+			database.Model(&models.Webhook{}).Count(&count)
+			assert.Equal(int64(2), count)
+		})
+	}
+
+	test.Run("Should list the webhooks of the user without their secrets", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+
+		// Act
+		recorder := perform(database, owner, http.MethodGet, "/webhooks", "")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		listed := []models.Webhook{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &listed))
+		require.Len(listed, 1)
+		assert.Equal(mine.ID, listed[0].ID)
+		assert.Empty(listed[0].Secret)
+	})
+
+	test.Run("Should edit only the given fields of the webhook", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+		path := fmt.Sprintf("/webhooks/%d", mine.ID)
+
+		// Act
+		recorder := perform(database, owner, http.MethodPatch, path, `{"events":["video.deleted"],"active":false}`)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.NotContains(recorder.Body.String(), "secret")
+		stored := models.Webhook{}
+		require.Nil(database.First(&stored, mine.ID).Error)
+		assert.Equal([]string{events.VideoDeleted}, stored.Events)
+		assert.False(stored.Active)
+		assert.Equal(mine.URL, stored.URL)
+		assert.Equal(mine.Secret, stored.Secret)
+	})
+
+	test.Run("Should NOT change the URL of the webhook to a private address", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+		path := fmt.Sprintf("/webhooks/%d", mine.ID)
+
+		// Act
+		recorder := perform(database, owner, http.MethodPatch, path, `{"url":"http://127.0.0.1:8080/admin"}`)
+
+		// Assert
+		require.Equal(http.StatusBadRequest, recorder.Code)
+		assert.Contains(recorder.Body.String(), problems.ForbiddenWebhookURL.Code)
+		stored := models.Webhook{}
+		require.Nil(database.First(&stored, mine.ID).Error)
+		assert.Equal(mine.URL, stored.URL)
+	})
+
+	test.Run("Should show the secret of the webhook when it's rotated", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+		path := fmt.Sprintf("/webhooks/%d", mine.ID)
+
+		// Act
+		recorder := perform(database, owner, http.MethodPatch, path, `{"secret":"the-rotated-secret"}`)
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code, recorder.Body.String())
+		assert.Contains(recorder.Body.String(), `"secret":"the-rotated-secret"`)
+		assert.Contains(recorder.Body.String(), `"active":true`)
+	})
+
+	test.Run("Should delete the webhook along with its deliveries", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+
+		// Act
+		recorder := perform(database, owner, http.MethodDelete, fmt.Sprintf("/webhooks/%d", mine.ID), "")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		var webhooks, deliveries int64
+		database.Model(&models.Webhook{}).Where("id = ?", mine.ID).Count(&webhooks)
+		database.Model(&models.WebhookDelivery{}).Where("webhook_id = ?", mine.ID).Count(&deliveries)
+		assert.Zero(webhooks)
+		assert.Zero(deliveries)
+	})
+
+	test.Run("Should list the deliveries of the webhook, the newest first", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+
+		// Act
+		recorder := perform(database, owner, http.MethodGet, fmt.Sprintf("/webhooks/%d/deliveries", mine.ID), "")
+
+		// Assert
+		require.Equal(http.StatusOK, recorder.Code)
+		listed := []models.WebhookDelivery{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &listed))
+		require.Len(listed, 2)
+		assert.Equal(models.DeliveryDelivered, listed[0].Status)
+		assert.Equal(models.DeliveryFailed, listed[1].Status)
+		assert.JSONEq(`{"id":"event-failed"}`, string(listed[1].Payload))
+	})
+
+	test.Run("Should redeliver the event of a delivery as a new one", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+		failed := models.WebhookDelivery{}
+		require.Nil(database.First(&failed, "status = ?", models.DeliveryFailed).Error)
+		path := fmt.Sprintf("/webhooks/%d/deliveries/%d/redeliver", mine.ID, failed.ID)
+
+		// Act
+		recorder := perform(database, owner, http.MethodPost, path, "")
+
+		// Assert
+		require.Equal(http.StatusAccepted, recorder.Code, recorder.Body.String())
+		redelivery := models.WebhookDelivery{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &redelivery))
+		assert.NotEqual(failed.ID, redelivery.ID)
+		assert.Equal(failed.ID, redelivery.RedeliveryOf)
+		assert.Equal(failed.EventID, redelivery.EventID)
+		assert.Equal(models.DeliveryPending, redelivery.Status)
+		assert.JSONEq(string(failed.Payload), string(redelivery.Payload))
+	})
+
+	test.Run("Should send the redelivery on its own job without cron schedule", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+		require.Nil(database.AutoMigrate(&models.Job{}))
+		received := make(chan string, 1)
+		receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			received <- request.Header.Get(webhooks.DeliveryHeader)
+			writer.WriteHeader(http.StatusNoContent)
+		}))
+		defer receiver.Close()
+		require.Nil(database.Model(&mine).Update("url", receiver.URL).Error)
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		dispatcher := &webhooks.Dispatcher{Database: database, Client: receiver.Client(), Logger: logger, BatchSize: 10, Workers: 1}
+		queue := jobs.NewQueue(database, logger)
+		queue.Interval = time.Hour
+		queue.Register(webhooks.DeliverKind, dispatcher.Handle)
+		dispatcher.Jobs = queue
+		current, cancel := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+		go func() {
+			queue.Run(current)
+			close(finished)
+		}()
+		defer func() {
+			cancel()
+			<-finished
+		}()
+		failed := models.WebhookDelivery{}
+		require.Nil(database.First(&failed, "status = ?", models.DeliveryFailed).Error)
+		hooks := &WebhooksController{Database: database, Webhooks: dispatcher}
+		server := gin.New()
+		server.POST("/webhooks/:id/deliveries/:delivery/redeliver", func(context *gin.Context) { context.Set("user", owner) }, hooks.Redeliver)
+		path := fmt.Sprintf("/webhooks/%d/deliveries/%d/redeliver", mine.ID, failed.ID)
+		request, _ := http.NewRequest(http.MethodPost, path, nil)
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		require.Equal(http.StatusAccepted, recorder.Code, recorder.Body.String())
+		redelivery := models.WebhookDelivery{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &redelivery))
+		select {
+		case delivery := <-received:
+			assert.Equal(fmt.Sprint(redelivery.ID), delivery)
+		case <-time.After(5 * time.Second):
+			assert.Fail("The redelivery was not sent")
+		}
+	})
+
+	missing := []struct {
+		Description string
+		Method      string
+		Path        func(mine models.Webhook, others models.Webhook) string
+		Expected    *problems.Problem
+	}{
+		{"Should fail to view the webhooks of other users", http.MethodGet, func(mine, others models.Webhook) string {
+			return fmt.Sprintf("/webhooks/%d", others.ID)
+		}, problems.WebhookNotFound},
+		{"Should fail to delete the webhooks of other users", http.MethodDelete, func(mine, others models.Webhook) string {
+			return fmt.Sprintf("/webhooks/%d", others.ID)
+		}, problems.WebhookNotFound},
+		{"Should fail to list the deliveries of a missing webhook", http.MethodGet, func(mine, others models.Webhook) string {
+			return "/webhooks/99/deliveries"
+		}, problems.WebhookNotFound},
+		{"Should fail to redeliver a missing delivery", http.MethodPost, func(mine, others models.Webhook) string {
+			return fmt.Sprintf("/webhooks/%d/deliveries/99/redeliver", mine.ID)
+		}, problems.DeliveryNotFound},
+	}
+
+	for _, testcase := range missing {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			database, owner, mine, others := seed(test)
+
+			// Act
+			recorder := perform(database, owner, testcase.Method, testcase.Path(mine, others), "")
+
+			// Assert
+			assert.Equal(http.StatusNotFound, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Expected.Code)
+		})
+	}
+
+	test.Run("Should enqueue the changes of the videos and annotations for the webhooks", func(test *testing.T) {
+		// Arrange
+		database, owner, mine, _ := seed(test)
+		database.Model(&mine).Update("events", `["video.created","annotation.created"]`)
+		database.Where("1 = 1").Delete(&models.WebhookDelivery{})
+		dispatcher := &webhooks.Dispatcher{}
+		videos := &VideosController{Database: database, Webhooks: dispatcher}
+		annotations := &AnnotationsController{Database: database, Webhooks: dispatcher}
+		server := gin.New()
+		server.Use(func(context *gin.Context) { context.Set("user", owner) })
+		server.POST("/videos", videos.Add)
+		server.POST("/annotations", annotations.Add)
+
+		// Act
+		for _, change := range [][]string{
+			{"/videos", `{"title":"One","link":"https://dummy.io/one","duration":60}`},
+			{"/annotations", `{"video_id":1,"title":"Intro","start":1,"end":10}`},
+		} {
+			request, _ := http.NewRequest(http.MethodPost, change[0], strings.NewReader(change[1]))
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			require.Equal(http.StatusCreated, recorder.Code, recorder.Body.String())
+		}
+
+		// Assert
+		enqueued := []models.WebhookDelivery{}
+		require.Nil(database.Order("event DESC").Find(&enqueued).Error)
+		require.Len(enqueued, 2)
+		assert.Equal(events.VideoCreated, enqueued[0].Event)
+		assert.Contains(string(enqueued[0].Payload), `"link":"https://dummy.io/one"`)
+		assert.Equal(events.AnnotationCreated, enqueued[1].Event)
+		assert.Contains(string(enqueued[1].Payload), `"title":"Intro"`)
+	})
+
+	test.Run("Should NOT save the change when its deliveries can't be enqueued", func(test *testing.T) {
+		// Arrange
+		database, owner, _, _ := seed(test)
+		require.Nil(database.Migrator().DropTable(&models.WebhookDelivery{}))
+		videos := &VideosController{Database: database, Webhooks: &webhooks.Dispatcher{}}
+		server := gin.New()
+		server.Use(func(context *gin.Context) { context.Set("user", owner) })
+		server.POST("/videos", videos.Add)
+		body := `{"title":"One","link":"https://dummy.io/one","duration":60}`
+		request, _ := http.NewRequest(http.MethodPost, "/videos", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		assert.Equal(http.StatusInternalServerError, recorder.Code)
+		var count int64
+		database.Model(&models.Video{}).Count(&count)
+		assert.Zero(count)
+	})
+
+	test.Run("Should accept the same events as the dispatcher", func(test *testing.T) {
+		for _, contract := range []interface{}{AddWebhookContract{}, EditWebhookContract{}} {
+			field, _ := reflect.TypeOf(contract).FieldByName("Events")
+			_, options, _ := strings.Cut(field.Tag.Get("binding"), "oneof=")
+			assert.Equal(webhooks.Events, strings.Fields(options))
+		}
+	})
+}
@@ -0,0 +1,242 @@
+// Package events publishes the changes of the videos to the clients following
+// them, e. g. through Server-Sent Events. The hub keeps the latest events of
+// each video, so the clients can resume after reconnecting.
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const (
+	// Types of the events, the ones of the videos are only sent to webhooks
+	VideoCreated      string = "video.created"
+	VideoUpdated      string = "video.updated"
+	VideoDeleted      string = "video.deleted"
+	AnnotationCreated string = "annotation.created"
+	AnnotationUpdated string = "annotation.updated"
+	AnnotationDeleted string = "annotation.deleted"
+
+	// Resync tells the subscriber some of the events can't be resumed, so it
+	// has to reload the video.
+	Resync string = "resync"
+
+	// buffer is the number of live events a subscriber can fall behind before
+	// it's dropped.
+	buffer int = 64
+
+	// DefaultRetention is the time the events of a video nobody follows are
+	// kept to resume.
+	DefaultRetention time.Duration = 5 * time.Minute
+)
+
+// Event is a change of a video. The IDs increase with each event of the hub
+// and across restarts, as they start from the time the hub was created.
+type Event struct {
+	ID      uint64          `json:"id"`
+	Type    string          `json:"type"`
+	VideoID uint            `json:"video_id"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// topic has the latest events of a video and its subscribers.
+type topic struct {
+	history     []Event
+	dropped     uint64
+	updated     time.Time
+	subscribers map[*Subscription]struct{}
+}
+
+// idle tells whether nobody follows the video and its events are too old to
+// resume, so the topic can be removed.
+func (current *topic) idle(now time.Time, retention time.Duration) bool {
+	return len(current.subscribers) == 0 && (len(current.history) == 0 || now.Sub(current.updated) >= retention)
+}
+
+// Hub is an in-process publisher of the events of the videos. A nil hub
+// discards the events.
+type Hub struct {
+	// History is the number of events kept per video to resume
+	History int
+
+	// Retention is the time the events of a video are kept to resume once
+	// nobody follows it
+	Retention time.Duration
+
+	mutex    sync.Mutex
+	sequence uint64
+	first    uint64
+	closed   bool
+	pruned   time.Time
+	topics   map[uint]*topic
+}
+
+func NewHub(history int) *Hub {
+	start := uint64(time.Now().UnixMicro())
+	return &Hub{
+		History:   history,
+		Retention: DefaultRetention,
+		sequence:  start,
+		first:     start + 1,
+		pruned:    time.Now(),
+		topics:    map[uint]*topic{},
+	}
+}
+
+// Subscription receives the events of a video until it's closed, either by
+// the subscriber, by the hub on shutdown or when the subscriber falls too far
+// behind. In the last case, it's meant to subscribe again from the last event
+// received.
+type Subscription struct {
+	Events <-chan Event
+	events chan Event
+	hub    *Hub
+	video  uint
+}
+
+func (hub *Hub) topic(video uint) *topic {
+	current, exists := hub.topics[video]
+	if !exists {
+		// The events before it may have been removed along with an idle topic
+		current = &topic{dropped: hub.sequence, subscribers: map[*Subscription]struct{}{}}
+		hub.topics[video] = current
+	}
+	return current
+}
+
+// prune removes the idle topics, at most once per retention, so the videos
+// which are no longer followed or changed don't pile up.
+func (hub *Hub) prune(now time.Time) {
+	if now.Sub(hub.pruned) < hub.Retention {
+		return
+	}
+	hub.pruned = now
+	for video, current := range hub.topics {
+		if current.idle(now, hub.Retention) {
+			delete(hub.topics, video)
+		}
+	}
+}
+
+// Publish sends the event with the given data as JSON to the subscribers of
+// the video.
+func (hub *Hub) Publish(video uint, kind string, data interface{}) error {
+	if hub == nil {
+		return nil
+	}
+	encoded, exception := json.Marshal(data)
+	if exception != nil {
+		return exception
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if hub.closed {
+		return nil
+	}
+
+	now := time.Now()
+	hub.prune(now)
+	current := hub.topic(video)
+	hub.sequence++
+	event := Event{ID: hub.sequence, Type: kind, VideoID: video, Data: encoded}
+	current.updated = now
+	current.history = append(current.history, event)
+	if excess := len(current.history) - hub.History; excess > 0 {
+		current.dropped = current.history[excess-1].ID
+		current.history = append(current.history[:0], current.history[excess:]...)
+	}
+
+	for subscription := range current.subscribers {
+		select {
+		case subscription.events <- event:
+		default:
+			// Too slow, it has to resume from its last event
+			hub.unsubscribe(current, subscription)
+		}
+	}
+	return nil
+}
+
+// Remove ends the subscriptions to the video and forgets its events, e. g.
+// once it's deleted.
+func (hub *Hub) Remove(video uint) {
+	if hub == nil {
+		return
+	}
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if current, exists := hub.topics[video]; exists {
+		for subscription := range current.subscribers {
+			delete(current.subscribers, subscription)
+			close(subscription.events)
+		}
+		delete(hub.topics, video)
+	}
+}
+
+// Subscribe follows the events of the video, starting with the ones after the
+// given event ID, if any. When they can't be resumed, the first event is a
+// Resync one.
+func (hub *Hub) Subscribe(video uint, last uint64) *Subscription {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	subscription := &Subscription{events: make(chan Event, hub.History+buffer), hub: hub, video: video}
+	subscription.Events = subscription.events
+	if hub.closed {
+		close(subscription.events)
+		return subscription
+	}
+
+	hub.prune(time.Now())
+	current := hub.topic(video)
+	if last != 0 {
+		if last+1 < hub.first || last < current.dropped || last > hub.sequence {
+			subscription.events <- Event{ID: hub.sequence, Type: Resync, VideoID: video}
+		} else {
+			for _, event := range current.history {
+				if event.ID > last {
+					subscription.events <- event
+				}
+			}
+		}
+	}
+	current.subscribers[subscription] = struct{}{}
+	return subscription
+}
+
+// Close stops receiving the events.
+func (subscription *Subscription) Close() {
+	hub := subscription.hub
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	if current, exists := hub.topics[subscription.video]; exists {
+		hub.unsubscribe(current, subscription)
+	}
+}
+
+// unsubscribe closes the subscription, removing the topic once it's idle.
+func (hub *Hub) unsubscribe(current *topic, subscription *Subscription) {
+	if _, exists := current.subscribers[subscription]; exists {
+		delete(current.subscribers, subscription)
+		close(subscription.events)
+	}
+	if !hub.closed && current.idle(time.Now(), hub.Retention) && hub.topics[subscription.video] == current {
+		delete(hub.topics, subscription.video)
+	}
+}
+
+// Close ends all the subscriptions, e. g. on shutdown, so the streams
+// following them can finish. The events published afterwards are discarded.
+func (hub *Hub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.closed = true
+	for _, current := range hub.topics {
+		for subscription := range current.subscribers {
+			hub.unsubscribe(current, subscription)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// received drains the events already sent to the subscription.
+func received(subscription *Subscription) []Event {
+	events := []Event{}
+	for {
+		select {
+		case event, open := <-subscription.Events:
+			if !open {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func types(events []Event) []string {
+	kinds := []string{}
+	for _, event := range events {
+		kinds = append(kinds, event.Type)
+	}
+	return kinds
+}
+
+func TestHub(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should send the events only to the subscribers of the video", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		first := hub.Subscribe(1, 0)
+		second := hub.Subscribe(1, 0)
+		other := hub.Subscribe(2, 0)
+
+		// Act
+		require.Nil(hub.Publish(1, AnnotationCreated, map[string]int{"id": 7}))
+		require.Nil(hub.Publish(1, AnnotationDeleted, map[string]int{"id": 7}))
+
+		// Assert
+		events := received(first)
+		require.Len(events, 2)
+		assert.Equal(AnnotationCreated, events[0].Type)
+		assert.Equal(uint(1), events[0].VideoID)
+		assert.JSONEq(`{"id":7}`, string(events[0].Data))
+		assert.Equal(events[0].ID+1, events[1].ID)
+		assert.Equal(events, received(second))
+		assert.Empty(received(other))
+	})
+
+	test.Run("Should resume after the last event received", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		hub.Publish(1, AnnotationCreated, 1)
+		hub.Publish(2, AnnotationCreated, 2)
+		hub.Publish(1, AnnotationUpdated, 1)
+		hub.Publish(1, AnnotationDeleted, 1)
+		first := hub.Subscribe(1, 0)
+		hub.Publish(1, AnnotationCreated, 3)
+		events := received(first)
+		require.Len(events, 1)
+
+		// Act
+		resumed := hub.Subscribe(1, events[0].ID-3)
+
+		// Assert
+		assert.Equal([]string{AnnotationUpdated, AnnotationDeleted, AnnotationCreated}, types(received(resumed)))
+	})
+
+	testcases := []struct {
+		Description string
+		Last        func(hub *Hub, published []Event) uint64
+	}{
+		{"Should ask to resync when the events are no longer kept", func(hub *Hub, published []Event) uint64 {
+			return published[0].ID
+		}},
+		{"Should ask to resync when the events are from a previous hub", func(hub *Hub, published []Event) uint64 {
+			return hub.first - 10
+		}},
+		{"Should ask to resync on unknown events", func(hub *Hub, published []Event) uint64 {
+			return hub.sequence + 1
+		}},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			hub := NewHub(2)
+			follower := hub.Subscribe(1, 0)
+			for index := 0; index < 4; index++ {
+				hub.Publish(1, AnnotationCreated, index)
+			}
+			published := received(follower)
+
+			// Act
+			resumed := hub.Subscribe(1, testcase.Last(hub, published))
+
+			// Assert
+			events := received(resumed)
+			require.Len(events, 1)
+			assert.Equal(Resync, events[0].Type)
+			assert.Equal(published[3].ID, events[0].ID)
+		})
+	}
+
+	test.Run("Should drop the subscribers falling behind", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(0)
+		slow := hub.Subscribe(1, 0)
+
+		// Act
+		for index := 0; index <= buffer; index++ {
+			hub.Publish(1, AnnotationCreated, index)
+		}
+
+		// Assert
+		assert.Len(received(slow), buffer)
+		_, open := <-slow.Events
+		assert.False(open)
+	})
+
+	test.Run("Should end all the subscriptions when closed", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		before := hub.Subscribe(1, 0)
+		stopped := hub.Subscribe(2, 0)
+		stopped.Close()
+
+		// Act
+		hub.Close()
+		after := hub.Subscribe(1, 0)
+		publishing := hub.Publish(1, AnnotationCreated, 1)
+
+		// Assert
+		assert.Nil(publishing)
+		for _, subscription := range []*Subscription{before, stopped, after} {
+			_, open := <-subscription.Events
+			assert.False(open)
+		}
+		stopped.Close()
+	})
+
+	test.Run("Should remove the topic when the last subscriber leaves without events", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		first := hub.Subscribe(1, 0)
+		second := hub.Subscribe(1, 0)
+
+		// Act
+		first.Close()
+		kept := len(hub.topics)
+		second.Close()
+
+		// Assert
+		assert.Equal(1, kept)
+		assert.Empty(hub.topics)
+	})
+
+	test.Run("Should keep the events to resume until they age out", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		follower := hub.Subscribe(1, 0)
+		hub.Publish(1, AnnotationCreated, 1)
+		events := received(follower)
+		follower.Close()
+		require.Contains(hub.topics, uint(1))
+
+		// Act
+		resumed := hub.Subscribe(1, events[0].ID-1)
+		hub.topics[1].updated = time.Now().Add(-hub.Retention)
+		resumed.Close()
+
+		// Assert
+		assert.Equal(events, received(resumed))
+		assert.Empty(hub.topics)
+	})
+
+	test.Run("Should prune the topics nobody follows once their events age out", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		hub.Publish(1, AnnotationCreated, 1)
+		hub.Publish(2, AnnotationCreated, 2)
+		hub.topics[1].updated = time.Now().Add(-hub.Retention)
+		hub.pruned = time.Now().Add(-hub.Retention)
+
+		// Act
+		hub.Publish(3, AnnotationCreated, 3)
+
+		// Assert
+		assert.NotContains(hub.topics, uint(1))
+		assert.Contains(hub.topics, uint(2))
+		assert.Contains(hub.topics, uint(3))
+	})
+
+	test.Run("Should ask to resync on the events of a removed topic", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		hub.Publish(1, AnnotationCreated, 1)
+		last := hub.sequence
+		hub.Remove(1)
+
+		// Act
+		resumed := hub.Subscribe(1, last-1)
+
+		// Assert
+		assert.Equal([]string{Resync}, types(received(resumed)))
+	})
+
+	test.Run("Should end the subscriptions to a removed video", func(test *testing.T) {
+		// Arrange
+		hub := NewHub(10)
+		removed := hub.Subscribe(1, 0)
+		other := hub.Subscribe(2, 0)
+		hub.Publish(1, AnnotationCreated, 1)
+
+		// Act
+		hub.Remove(1)
+		removed.Close()
+
+		// Assert
+		assert.Len(received(removed), 1)
+		_, open := <-removed.Events
+		assert.False(open)
+		assert.NotContains(hub.topics, uint(1))
+		assert.Contains(hub.topics, uint(2))
+		other.Close()
+	})
+
+	test.Run("Should discard the events without hub", func(test *testing.T) {
+		var hub *Hub
+		assert.Nil(hub.Publish(1, AnnotationCreated, 1))
+		hub.Remove(1)
+	})
+
+	test.Run("Should fail to publish what can't be encoded", func(test *testing.T) {
+		hub := NewHub(10)
+		assert.Error(hub.Publish(1, AnnotationCreated, func() {}))
+	})
+}
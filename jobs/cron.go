@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// horizon bounds the search of the next time of a schedule, so the schedules
+// which never happen (e. g. on February 30th) are detected.
+const horizon int = 5
+
+// macros are the shortcuts of the usual schedules.
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+type field struct {
+	name    string
+	minimum int
+	maximum int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of the month", 1, 31},
+	{"month", 1, 12},
+	{"day of the week", 0, 7},
+}
+
+// Cron is a schedule given by a cron expression with five fields: minute,
+// hour, day of the month, month and day of the week (from 0 or 7 for Sunday to
+// 6). Each field is either *, a value, a range a-b, a step */n or a-b/n, or a
+// list of them separated by commas. The usual macros like @daily or @hourly
+// are also accepted. As in the standard cron, a day matches when either the
+// day of the month or the day of the week does, unless one of them is *.
+type Cron struct {
+	Expression string
+
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	anyDay   bool
+	anyWeek  bool
+}
+
+// ParseCron reads a cron expression, failing on the ones that never happen.
+func ParseCron(expression string) (*Cron, error) {
+	cron := &Cron{Expression: expression}
+	normalised := strings.TrimSpace(expression)
+	if macro, found := macros[normalised]; found {
+		normalised = macro
+	}
+
+	parts := strings.Fields(normalised)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron expression %q must have %d fields", expression, len(fields))
+	}
+
+	sets := []*uint64{&cron.minutes, &cron.hours, &cron.days, &cron.months, &cron.weekdays}
+	for index, part := range parts {
+		set, exception := parseField(part, fields[index])
+		if exception != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expression, exception)
+		}
+		*sets[index] = set
+	}
+
+	// Sunday is either 0 or 7
+	if cron.weekdays&(1<<7) != 0 {
+		cron.weekdays |= 1
+	}
+	cron.anyDay = strings.HasPrefix(parts[2], "*")
+	cron.anyWeek = strings.HasPrefix(parts[4], "*")
+
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never happens", expression)
+	}
+	return cron, nil
+}
+
+// parseField reads a field of a cron expression as the set of its values.
+func parseField(text string, limits field) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(text, ",") {
+		rangeText, stepText, stepped := strings.Cut(item, "/")
+		step := 1
+		if stepped {
+			number, exception := strconv.Atoi(stepText)
+			if exception != nil || number < 1 {
+				return 0, fmt.Errorf("invalid step %q of the %s", stepText, limits.name)
+			}
+			step = number
+		}
+
+		first, last := limits.minimum, limits.maximum
+		if rangeText != "*" {
+			lowText, highText, ranged := strings.Cut(rangeText, "-")
+			low, exception := strconv.Atoi(lowText)
+			if exception != nil {
+				return 0, fmt.Errorf("invalid value %q of the %s", lowText, limits.name)
+			}
+			first, last = low, low
+			if ranged {
+				if last, exception = strconv.Atoi(highText); exception != nil {
+					return 0, fmt.Errorf("invalid value %q of the %s", highText, limits.name)
+				}
+			} else if stepped {
+				last = limits.maximum
+			}
+		}
+
+		if first < limits.minimum || last > limits.maximum || first > last {
+			return 0, fmt.Errorf("%s out of range %q, it must be from %d to %d", limits.name, rangeText, limits.minimum, limits.maximum)
+		}
+		for value := first; value <= last; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+// day tells whether the schedule happens on the day of the given time.
+func (cron *Cron) day(moment time.Time) bool {
+	inMonth := cron.days&(1<<uint(moment.Day())) != 0
+	inWeek := cron.weekdays&(1<<uint(moment.Weekday())) != 0
+	switch {
+	case cron.anyDay && cron.anyWeek:
+		return true
+	case cron.anyDay:
+		return inWeek
+	case cron.anyWeek:
+		return inMonth
+	default:
+		return inMonth || inWeek
+	}
+}
+
+// Next returns the first time of the schedule after the given one, in its
+// location, or the zero time when it doesn't happen within the next years.
+func (cron *Cron) Next(after time.Time) time.Time {
+	location := after.Location()
+	moment := after.Truncate(time.Minute).Add(time.Minute)
+	limit := moment.AddDate(horizon, 0, 0)
+	for moment.Before(limit) {
+		year, month, day := moment.Date()
+		switch {
+		case cron.months&(1<<uint(month)) == 0:
+			moment = time.Date(year, month+1, 1, 0, 0, 0, 0, location)
+		case !cron.day(moment):
+			moment = time.Date(year, month, day+1, 0, 0, 0, 0, location)
+		case cron.hours&(1<<uint(moment.Hour())) == 0:
+			moment = time.Date(year, month, day, moment.Hour()+1, 0, 0, 0, location)
+		case cron.minutes&(1<<uint(moment.Minute())) == 0:
+			moment = moment.Add(time.Minute)
+		default:
+			return moment
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	// Friday, 13th of October of 2023
+	now := time.Date(2023, time.October, 13, 10, 30, 15, 0, time.UTC)
+
+	testcases := []struct {
+		Description string
+		Expression  string
+		Expected    time.Time
+	}{
+		{"Should run every minute", "* * * * *", time.Date(2023, time.October, 13, 10, 31, 0, 0, time.UTC)},
+		{"Should run every quarter of an hour", "*/15 * * * *", time.Date(2023, time.October, 13, 10, 45, 0, 0, time.UTC)},
+		{"Should run at the given minutes", "5,20,40 * * * *", time.Date(2023, time.October, 13, 10, 40, 0, 0, time.UTC)},
+		{"Should run daily at midnight", "@daily", time.Date(2023, time.October, 14, 0, 0, 0, 0, time.UTC)},
+		{"Should run hourly", "@hourly", time.Date(2023, time.October, 13, 11, 0, 0, 0, time.UTC)},
+		{"Should run on the working days", "0 9 * * 1-5", time.Date(2023, time.October, 16, 9, 0, 0, 0, time.UTC)},
+		{"Should run on Sundays given as 7", "30 8 * * 7", time.Date(2023, time.October, 15, 8, 30, 0, 0, time.UTC)},
+		{"Should run on the given day of the month", "0 0 1 * *", time.Date(2023, time.November, 1, 0, 0, 0, 0, time.UTC)},
+		{"Should run on either the day of the month or of the week", "0 0 20 * 1", time.Date(2023, time.October, 16, 0, 0, 0, 0, time.UTC)},
+		{"Should run on leap days", "0 12 29 2 *", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"Should run on the steps of a range", "10-50/20 14 * * *", time.Date(2023, time.October, 13, 14, 10, 0, 0, time.UTC)},
+		{"Should run on the steps from a value", "30/10 10 * * *", time.Date(2023, time.October, 13, 10, 40, 0, 0, time.UTC)},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			cron, exception := ParseCron(testcase.Expression)
+			require.Nil(exception)
+
+			// Act
+			next := cron.Next(now)
+
+			// Assert
+			assert.Equal(testcase.Expected, next)
+			assert.Equal(testcase.Expression, cron.Expression)
+		})
+	}
+
+	failures := []struct {
+		Description string
+		Expression  string
+		Expected    string
+	}{
+		{"Should NOT parse too few fields", "* * * *", "must have 5 fields"},
+		{"Should NOT parse unknown macros", "@sometimes", "must have 5 fields"},
+		{"Should NOT parse values out of range", "0 24 * * *", "hour out of range"},
+		{"Should NOT parse reversed ranges", "0 0 * * 5-1", "day of the week out of range"},
+		{"Should NOT parse names", "0 0 * JAN *", `invalid value "JAN" of the month`},
+		{"Should NOT parse invalid steps", "*/0 * * * *", `invalid step "0" of the minute`},
+		{"Should NOT parse schedules which never happen", "0 0 30 2 *", "never happens"},
+	}
+
+	for _, testcase := range failures {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			cron, exception := ParseCron(testcase.Expression)
+
+			// Assert
+			assert.Nil(cron)
+			require.NotNil(exception)
+			assert.Contains(exception.Error(), testcase.Expected)
+		})
+	}
+}
@@ -0,0 +1,494 @@
+// Package jobs performs the background work of the API out of the requests.
+// The jobs are stored in the database, so they survive restarts, and they are
+// performed by a pool of workers which retry the failed ones with exponential
+// backoff. Besides the jobs enqueued to run as soon as possible or at a given
+// time, the recurring ones are scheduled with cron expressions.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaximumBackoff bounds the time between the attempts of a job
+	MaximumBackoff time.Duration = 24 * time.Hour
+
+	// PurgeKind is the recurring job removing the finished jobs once they are
+	// older than the retention
+	PurgeKind string = "jobs.purge"
+)
+
+var (
+	ErrUnknownKind    = errors.New("unknown job kind")
+	ErrNotCancellable = errors.New("only the pending jobs can be cancelled")
+	ErrNotRetriable   = errors.New("only the failed or cancelled jobs can be retried")
+)
+
+// Handler performs a job. The job is retried when it fails, unless the error
+// is permanent. The context is cancelled when the server shuts down and the
+// grace time is over, the job runs again on the next start then.
+type Handler func(current context.Context, job *models.Job) error
+
+type permanent struct {
+	error
+}
+
+func (exception *permanent) Unwrap() error {
+	return exception.error
+}
+
+// Permanent marks the error of a job which fails the same on each attempt, so
+// it's not retried.
+func Permanent(exception error) error {
+	return &permanent{exception}
+}
+
+// recurring is a job enqueued again each time it finishes, following the
+// schedule.
+type recurring struct {
+	kind    string
+	cron    *Cron
+	payload json.RawMessage
+}
+
+// Queue keeps the handlers of each kind of job and performs the due jobs.
+type Queue struct {
+	Database models.DataAccessInterface
+	Logger   *slog.Logger
+
+	// Concurrency is the number of jobs performed at the same time
+	Concurrency int
+
+	// Interval is the time between the lookups of the due jobs, they are also
+	// looked up as soon as a job is enqueued, or once the transaction enqueuing
+	// it is committed
+	Interval time.Duration
+
+	// Backoff is the time before the first retry, doubled on each attempt
+	Backoff time.Duration
+
+	// Attempts is the maximum number of attempts of the new jobs
+	Attempts int
+
+	// Grace is the time the running jobs have to finish on shutdown
+	Grace time.Duration
+
+	mutex     sync.RWMutex
+	handlers  map[string]Handler
+	schedules []recurring
+	wake      chan struct{}
+}
+
+// NewQueue creates a queue performing one job at a time, the settings can be
+// changed before running it.
+func NewQueue(database models.DataAccessInterface, logger *slog.Logger) *Queue {
+	return &Queue{
+		Database:    database,
+		Logger:      logger,
+		Concurrency: 1,
+		Interval:    time.Second,
+		Backoff:     10 * time.Second,
+		Attempts:    5,
+		handlers:    map[string]Handler{},
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+type contextual interface {
+	WithContext(context.Context) *gorm.DB
+}
+
+func (queue *Queue) session(current context.Context) models.DataAccessInterface {
+	if scoped, ok := queue.Database.(contextual); ok {
+		return scoped.WithContext(current)
+	}
+	return queue.Database
+}
+
+// Register sets the handler of a kind of job.
+func (queue *Queue) Register(kind string, handler Handler) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.handlers[kind] = handler
+}
+
+// Cron schedules a registered kind of job to run periodically with the given
+// payload. The times of the schedule are in UTC.
+func (queue *Queue) Cron(kind string, expression string, payload interface{}) error {
+	cron, exception := ParseCron(expression)
+	if exception != nil {
+		return exception
+	}
+	encoded, exception := json.Marshal(payload)
+	if exception != nil {
+		return exception
+	}
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if _, found := queue.handlers[kind]; !found {
+		return fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	queue.schedules = append(queue.schedules, recurring{kind: kind, cron: cron, payload: encoded})
+	return nil
+}
+
+// Enqueue stores a job to run as soon as possible.
+func (queue *Queue) Enqueue(database models.DataAccessInterface, kind string, payload interface{}) (*models.Job, error) {
+	return queue.Schedule(database, kind, payload, time.Now())
+}
+
+// Schedule stores a job to run at the given time. The database may be a
+// transaction, so the job is only stored along with the change asking for it,
+// then the caller calls Notify once it's committed.
+func (queue *Queue) Schedule(database models.DataAccessInterface, kind string, payload interface{}, at time.Time) (*models.Job, error) {
+	return queue.ScheduleFor(database, 0, kind, payload, at)
+}
+
+// ScheduleFor stores a job to run at the given time on behalf of the user, so
+// it's deleted along with it.
+func (queue *Queue) ScheduleFor(database models.DataAccessInterface, user uint, kind string, payload interface{}, at time.Time) (*models.Job, error) {
+	queue.mutex.RLock()
+	_, found := queue.handlers[kind]
+	queue.mutex.RUnlock()
+	if !found {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+
+	encoded, exception := json.Marshal(payload)
+	if exception != nil {
+		return nil, exception
+	}
+	job := &models.Job{
+		UserID:      user,
+		Kind:        kind,
+		Payload:     encoded,
+		Status:      models.JobPending,
+		RunAt:       at,
+		MaxAttempts: queue.Attempts,
+	}
+	if exception := database.Create(job).Error; exception != nil {
+		return nil, exception
+	}
+	queue.committed(database)
+	return job, nil
+}
+
+// Cancel stops a pending job from running.
+func (queue *Queue) Cancel(database models.DataAccessInterface, job *models.Job) error {
+	now := time.Now()
+	cancelling := database.Model(job).
+		Where("status = ?", models.JobPending).
+		Updates(map[string]interface{}{"status": models.JobCancelled, "finished_at": now, "updated_at": now})
+	if cancelling.Error != nil {
+		return cancelling.Error
+	}
+	if cancelling.RowsAffected == 0 {
+		return ErrNotCancellable
+	}
+	job.Status, job.FinishedAt, job.UpdatedAt = models.JobCancelled, &now, now
+	return nil
+}
+
+// Retry enqueues again a failed or cancelled job, with all its attempts.
+func (queue *Queue) Retry(database models.DataAccessInterface, job *models.Job) error {
+	if job.Status != models.JobFailed && job.Status != models.JobCancelled {
+		return ErrNotRetriable
+	}
+
+	now := time.Now()
+	retrying := database.Model(job).
+		Where("status = ?", job.Status).
+		Updates(map[string]interface{}{
+			"status":      models.JobPending,
+			"run_at":      now,
+			"attempts":    0,
+			"started_at":  nil,
+			"finished_at": nil,
+			"error":       "",
+			"updated_at":  now,
+		})
+	if retrying.Error != nil {
+		return retrying.Error
+	}
+	if retrying.RowsAffected == 0 {
+		return ErrNotRetriable
+	}
+	job.Status, job.RunAt, job.Attempts = models.JobPending, now, 0
+	job.StartedAt, job.FinishedAt, job.Error, job.UpdatedAt = nil, nil, "", now
+	queue.committed(database)
+	return nil
+}
+
+// committed wakes up the lookup of the due jobs, unless the change is still
+// within a transaction. The lookup wouldn't see it until the commit, so it
+// could sleep until the next interval instead.
+func (queue *Queue) committed(database models.DataAccessInterface) {
+	if transaction, ok := database.(*gorm.DB); ok {
+		if _, open := transaction.Statement.ConnPool.(gorm.TxCommitter); open {
+			return
+		}
+	}
+	queue.Notify()
+}
+
+// Notify wakes up the lookup of the due jobs, unless it's already awake. It's
+// called once the transactions scheduling jobs are committed.
+func (queue *Queue) Notify() {
+	select {
+	case queue.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Purge returns the handler removing the finished jobs older than the given
+// retention.
+func (queue *Queue) Purge(retention time.Duration) Handler {
+	return func(current context.Context, _ *models.Job) error {
+		return queue.session(current).
+			Where("status IN ? AND finished_at <= ?",
+				[]string{models.JobSucceeded, models.JobFailed, models.JobCancelled},
+				time.Now().Add(-retention),
+			).
+			Delete(&models.Job{}).Error
+	}
+}
+
+// Run performs the due jobs until the context is done. Then it waits for the
+// running jobs to finish, cancelling them once the grace time is over.
+func (queue *Queue) Run(current context.Context) {
+	if exception := queue.requeue(current); exception != nil {
+		queue.Logger.Error("Failed to requeue the interrupted jobs", "error", exception)
+	}
+	queue.mutex.RLock()
+	schedules := queue.schedules
+	queue.mutex.RUnlock()
+	for _, schedule := range schedules {
+		if exception := queue.plan(current, schedule); exception != nil {
+			queue.Logger.Error("Failed to schedule the recurring job", "kind", schedule.kind, "error", exception)
+		}
+	}
+
+	// The jobs keep running after the interruption for the grace time
+	performing, cancel := context.WithCancel(context.WithoutCancel(current))
+	defer cancel()
+
+	// The workers take the jobs claimed by the lookup and tell when they are
+	// idle again, so no job is claimed until a worker can perform it
+	claimed := make(chan *models.Job, queue.Concurrency)
+	idle := make(chan struct{}, queue.Concurrency)
+	var group sync.WaitGroup
+	for worker := 0; worker < queue.Concurrency; worker++ {
+		idle <- struct{}{}
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for job := range claimed {
+				queue.perform(performing, job)
+				idle <- struct{}{}
+			}
+		}()
+	}
+
+	queue.poll(current, claimed, idle)
+	close(claimed)
+	timer := time.AfterFunc(queue.Grace, cancel)
+	defer timer.Stop()
+	group.Wait()
+}
+
+// poll claims the due jobs for the idle workers until the context is done.
+func (queue *Queue) poll(current context.Context, claimed chan<- *models.Job, idle chan struct{}) {
+	ticker := time.NewTicker(queue.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-current.Done():
+			return
+		case <-idle:
+		}
+
+		job, exception := queue.claim(current)
+		if job != nil {
+			claimed <- job
+			continue
+		}
+		idle <- struct{}{}
+		if exception != nil && current.Err() == nil {
+			queue.Logger.Error("Failed to claim the due jobs", "error", exception)
+		}
+
+		select {
+		case <-current.Done():
+			return
+		case <-ticker.C:
+		case <-queue.wake:
+		}
+	}
+}
+
+// requeue makes pending again the jobs left running when the server stopped
+// without waiting for them. Their attempts count as failed.
+func (queue *Queue) requeue(current context.Context) error {
+	return queue.session(current).
+		Model(&models.Job{}).
+		Where("status = ?", models.JobRunning).
+		Updates(map[string]interface{}{
+			"status":     models.JobPending,
+			"started_at": nil,
+			"error":      "interrupted",
+			"updated_at": time.Now(),
+		}).Error
+}
+
+// plan enqueues the next job of the schedule, unless there is already one
+// either pending or running.
+func (queue *Queue) plan(current context.Context, schedule recurring) error {
+	return queue.session(current).Transaction(func(transaction *gorm.DB) error {
+		var planned int64
+		counting := transaction.Model(&models.Job{}).
+			Where("kind = ? AND schedule = ? AND status IN ?",
+				schedule.kind, schedule.cron.Expression, []string{models.JobPending, models.JobRunning},
+			).
+			Count(&planned).Error
+		if counting != nil || planned > 0 {
+			return counting
+		}
+		return transaction.Create(&models.Job{
+			Kind:        schedule.kind,
+			Payload:     schedule.payload,
+			Status:      models.JobPending,
+			RunAt:       schedule.cron.Next(time.Now().UTC()),
+			Schedule:    schedule.cron.Expression,
+			MaxAttempts: queue.Attempts,
+		}).Error
+	})
+}
+
+// claim marks the oldest due job as running and returns it, or nothing when
+// there are no due jobs.
+func (queue *Queue) claim(current context.Context) (*models.Job, error) {
+	database := queue.session(current)
+	for {
+		var job models.Job
+		searching := database.
+			Where("status = ? AND run_at <= ?", models.JobPending, time.Now()).
+			Order("run_at, id").
+			Limit(1).
+			Find(&job)
+		if searching.Error != nil || searching.RowsAffected == 0 {
+			return nil, searching.Error
+		}
+
+		now := time.Now()
+		claiming := database.Model(&models.Job{}).
+			Where("id = ? AND status = ?", job.ID, models.JobPending).
+			Updates(map[string]interface{}{
+				"status":     models.JobRunning,
+				"attempts":   job.Attempts + 1,
+				"started_at": now,
+				"updated_at": now,
+			})
+		if claiming.Error != nil {
+			return nil, claiming.Error
+		}
+		// Otherwise it was cancelled meanwhile, look for the next one
+		if claiming.RowsAffected == 1 {
+			job.Status, job.Attempts, job.StartedAt, job.UpdatedAt = models.JobRunning, job.Attempts+1, &now, now
+			return &job, nil
+		}
+	}
+}
+
+// backoff is the time to wait before the next attempt, once the given number
+// of attempts failed.
+func (queue *Queue) backoff(attempts int) time.Duration {
+	delay := queue.Backoff
+	for retry := 1; retry < attempts && delay < MaximumBackoff; retry++ {
+		delay *= 2
+	}
+	return min(delay, MaximumBackoff)
+}
+
+// call runs the handler of the job, turning its panics into errors.
+func (queue *Queue) call(current context.Context, job *models.Job) (exception error) {
+	queue.mutex.RLock()
+	handler, found := queue.handlers[job.Kind]
+	queue.mutex.RUnlock()
+	if !found {
+		return Permanent(fmt.Errorf("%w %q", ErrUnknownKind, job.Kind))
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			exception = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return handler(current, job)
+}
+
+// perform runs the job once and records the result, either succeeded, failed
+// when there are no attempts left or pending until the next attempt.
+func (queue *Queue) perform(current context.Context, job *models.Job) {
+	started := time.Now()
+	exception := queue.call(current, job)
+	now := time.Now()
+	var final *permanent
+	switch {
+	case exception == nil:
+		job.Status, job.Error = models.JobSucceeded, ""
+	case current.Err() != nil:
+		// Interrupted by the shutdown, the attempt doesn't count
+		job.Status, job.Attempts, job.StartedAt = models.JobPending, job.Attempts-1, nil
+		job.Error = exception.Error()
+	case errors.As(exception, &final) || job.Attempts >= job.MaxAttempts:
+		job.Status, job.Error = models.JobFailed, exception.Error()
+	default:
+		job.Status, job.Error = models.JobPending, exception.Error()
+		job.RunAt = now.Add(queue.backoff(job.Attempts))
+	}
+	if job.Finished() {
+		job.FinishedAt = &now
+	}
+
+	queue.Logger.InfoContext(
+		current, "Job performed",
+		"job_id", job.ID,
+		"kind", job.Kind,
+		"status", job.Status,
+		"attempts", job.Attempts,
+		"duration", now.Sub(started),
+		"error", job.Error,
+	)
+
+	// Record the result even when the grace time is over
+	recording := context.WithoutCancel(current)
+	if exception := queue.session(recording).Select("*").Updates(job).Error; exception != nil {
+		queue.Logger.Error("Failed to record the result of the job", "job_id", job.ID, "error", exception)
+		return
+	}
+	if job.Schedule == "" || !job.Finished() {
+		return
+	}
+
+	queue.mutex.RLock()
+	schedules := queue.schedules
+	queue.mutex.RUnlock()
+	for _, schedule := range schedules {
+		if schedule.kind != job.Kind || schedule.cron.Expression != job.Schedule {
+			continue
+		}
+		if exception := queue.plan(recording, schedule); exception != nil {
+			queue.Logger.Error("Failed to schedule the recurring job", "kind", schedule.kind, "error", exception)
+		}
+	}
+}
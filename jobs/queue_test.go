@@ -0,0 +1,432 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQueue(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	setup := func(test *testing.T) (*Queue, *gorm.DB) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "jobs.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.Job{}))
+		queue := NewQueue(database, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		queue.Interval = 10 * time.Millisecond
+		queue.Backoff = time.Minute
+		queue.Attempts = 3
+		queue.Grace = time.Second
+		return queue, database
+	}
+
+	// start runs the queue in the background until the returned function stops
+	// it and waits for it
+	start := func(queue *Queue) func() {
+		current, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			queue.Run(current)
+			close(done)
+		}()
+		return func() {
+			cancel()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				test.Error("Run didn't stop after the context was done")
+			}
+		}
+	}
+
+	find := func(database *gorm.DB, id uint) models.Job {
+		var job models.Job
+		require.Nil(database.First(&job, id).Error)
+		return job
+	}
+
+	status := func(database *gorm.DB, id uint) string {
+		var job models.Job
+		database.First(&job, id)
+		return job.Status
+	}
+
+	test.Run("Should NOT enqueue the jobs of unknown kinds", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+
+		// Act
+		job, exception := queue.Enqueue(database, "unknown", nil)
+
+		// Assert
+		assert.Nil(job)
+		assert.ErrorIs(exception, ErrUnknownKind)
+		assert.ErrorIs(queue.Cron("unknown", "@daily", nil), ErrUnknownKind)
+	})
+
+	test.Run("Should perform the enqueued jobs with their payload", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		performed := make(chan string, 1)
+		queue.Register("greet", func(_ context.Context, job *models.Job) error {
+			performed <- string(job.Payload)
+			return nil
+		})
+		stop := start(queue)
+		defer stop()
+
+		// Act
+		job, exception := queue.Enqueue(database, "greet", map[string]string{"name": "world"})
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal(models.JobPending, job.Status)
+		select {
+		case payload := <-performed:
+			assert.JSONEq(`{"name":"world"}`, payload)
+		case <-time.After(5 * time.Second):
+			test.Fatal("The job wasn't performed")
+		}
+		assert.Eventually(func() bool { return status(database, job.ID) == models.JobSucceeded }, 5*time.Second, 10*time.Millisecond)
+		performedJob := find(database, job.ID)
+		assert.Equal(1, performedJob.Attempts)
+		assert.NotNil(performedJob.StartedAt)
+		assert.NotNil(performedJob.FinishedAt)
+		assert.Empty(performedJob.Error)
+	})
+
+	test.Run("Should wake up for the jobs scheduled within a transaction only once it's committed", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Interval = time.Hour
+		performed := make(chan uint, 1)
+		queue.Register("greet", func(_ context.Context, job *models.Job) error {
+			performed <- job.ID
+			return nil
+		})
+		var job *models.Job
+
+		// Act
+		exception := database.Transaction(func(transaction *gorm.DB) error {
+			var scheduling error
+			job, scheduling = queue.Enqueue(transaction, "greet", nil)
+			return scheduling
+		})
+		// The queue isn't running yet, so nothing takes the wake up meanwhile
+		pending := len(queue.wake)
+		queue.Notify()
+		woken := len(queue.wake)
+		stop := start(queue)
+		defer stop()
+
+		// Assert
+		require.Nil(exception)
+		assert.Zero(pending)
+		assert.Equal(1, woken)
+		select {
+		case id := <-performed:
+			assert.Equal(job.ID, id)
+		case <-time.After(5 * time.Second):
+			test.Fatal("The job wasn't performed")
+		}
+	})
+
+	test.Run("Should NOT perform the jobs scheduled later on", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		var performed atomic.Int32
+		queue.Register("later", func(context.Context, *models.Job) error {
+			performed.Add(1)
+			return nil
+		})
+		job, exception := queue.Schedule(database, "later", nil, time.Now().Add(time.Hour))
+		require.Nil(exception)
+
+		// Act
+		claimed, exception := queue.claim(context.Background())
+
+		// Assert
+		require.Nil(exception)
+		assert.Nil(claimed)
+		assert.Equal(models.JobPending, status(database, job.ID))
+		assert.Zero(performed.Load())
+	})
+
+	test.Run("Should retry the failed jobs with backoff until there are no attempts left", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Register("flaky", func(context.Context, *models.Job) error {
+			return errors.New("service unavailable")
+		})
+		job, exception := queue.Enqueue(database, "flaky", nil)
+		require.Nil(exception)
+		delays := []time.Duration{}
+
+		for attempt := 1; attempt <= 3; attempt++ {
+			// Act
+			claimed, exception := queue.claim(context.Background())
+			require.Nil(exception)
+			require.NotNil(claimed)
+			started := time.Now()
+			queue.perform(context.Background(), claimed)
+
+			// Assert
+			performed := find(database, job.ID)
+			assert.Equal(attempt, performed.Attempts)
+			assert.Equal("service unavailable", performed.Error)
+			if attempt < 3 {
+				assert.Equal(models.JobPending, performed.Status)
+				assert.Nil(performed.FinishedAt)
+				delays = append(delays, performed.RunAt.Sub(started).Round(time.Minute))
+				require.Nil(database.Model(&performed).Update("run_at", time.Now()).Error)
+			} else {
+				assert.Equal(models.JobFailed, performed.Status)
+				assert.NotNil(performed.FinishedAt)
+			}
+		}
+		assert.Equal([]time.Duration{time.Minute, 2 * time.Minute}, delays)
+	})
+
+	test.Run("Should fail the jobs at once on permanent errors and panics", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Register("invalid", func(context.Context, *models.Job) error {
+			return Permanent(errors.New("invalid payload"))
+		})
+		queue.Register("panic", func(context.Context, *models.Job) error {
+			panic("unexpected")
+		})
+		invalid, _ := queue.Enqueue(database, "invalid", nil)
+		panicked, _ := queue.Enqueue(database, "panic", nil)
+		require.Nil(database.Model(panicked).Update("max_attempts", 1).Error)
+		unknown := models.Job{Kind: "removed", Status: models.JobPending, RunAt: time.Now(), MaxAttempts: 3}
+		require.Nil(database.Create(&unknown).Error)
+
+		// Act
+		for index := 0; index < 3; index++ {
+			claimed, exception := queue.claim(context.Background())
+			require.Nil(exception)
+			require.NotNil(claimed)
+			queue.perform(context.Background(), claimed)
+		}
+
+		// Assert
+		assert.Equal(models.JobFailed, status(database, invalid.ID))
+		assert.Equal("invalid payload", find(database, invalid.ID).Error)
+		assert.Equal(models.JobFailed, status(database, panicked.ID))
+		assert.Equal("job panicked: unexpected", find(database, panicked.ID).Error)
+		assert.Equal(models.JobFailed, status(database, unknown.ID))
+		assert.Equal(`unknown job kind "removed"`, find(database, unknown.ID).Error)
+	})
+
+	test.Run("Should perform as many jobs at the same time as the concurrency", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Concurrency = 3
+		var running, peak atomic.Int32
+		release := make(chan struct{})
+		queue.Register("slow", func(context.Context, *models.Job) error {
+			current := running.Add(1)
+			defer running.Add(-1)
+			for {
+				previous := peak.Load()
+				if current <= previous || peak.CompareAndSwap(previous, current) {
+					break
+				}
+			}
+			<-release
+			return nil
+		})
+		for index := 0; index < 6; index++ {
+			_, exception := queue.Enqueue(database, "slow", index)
+			require.Nil(exception)
+		}
+
+		// Act
+		stop := start(queue)
+		defer stop()
+
+		// Assert
+		assert.Eventually(func() bool { return running.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+		var claimed int64
+		database.Model(&models.Job{}).Where("status = ?", models.JobRunning).Count(&claimed)
+		assert.Equal(int64(3), claimed)
+		close(release)
+		assert.Eventually(func() bool {
+			var succeeded int64
+			database.Model(&models.Job{}).Where("status = ?", models.JobSucceeded).Count(&succeeded)
+			return succeeded == 6
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(int32(3), peak.Load())
+	})
+
+	test.Run("Should let the running jobs finish on shutdown within the grace time", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		started := make(chan struct{})
+		queue.Register("short", func(context.Context, *models.Job) error {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		})
+		job, _ := queue.Enqueue(database, "short", nil)
+		stop := start(queue)
+		<-started
+
+		// Act
+		stop()
+
+		// Assert
+		assert.Equal(models.JobSucceeded, status(database, job.ID))
+	})
+
+	test.Run("Should enqueue again the jobs interrupted after the grace time", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Grace = 10 * time.Millisecond
+		started := make(chan struct{})
+		queue.Register("long", func(current context.Context, _ *models.Job) error {
+			close(started)
+			<-current.Done()
+			return current.Err()
+		})
+		job, _ := queue.Enqueue(database, "long", nil)
+		stop := start(queue)
+		<-started
+
+		// Act
+		stop()
+
+		// Assert
+		interrupted := find(database, job.ID)
+		assert.Equal(models.JobPending, interrupted.Status)
+		assert.Equal(0, interrupted.Attempts)
+		assert.Nil(interrupted.StartedAt)
+	})
+
+	test.Run("Should enqueue again the jobs left running by a crash", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		performed := make(chan struct{})
+		queue.Register("crashed", func(context.Context, *models.Job) error {
+			close(performed)
+			return nil
+		})
+		now := time.Now()
+		job := models.Job{Kind: "crashed", Status: models.JobRunning, RunAt: now, StartedAt: &now, Attempts: 1, MaxAttempts: 3}
+		require.Nil(database.Create(&job).Error)
+
+		// Act
+		stop := start(queue)
+		defer stop()
+
+		// Assert
+		select {
+		case <-performed:
+		case <-time.After(5 * time.Second):
+			test.Fatal("The job wasn't performed")
+		}
+		assert.Eventually(func() bool { return status(database, job.ID) == models.JobSucceeded }, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(2, find(database, job.ID).Attempts)
+	})
+
+	test.Run("Should schedule the recurring jobs once and again after each run", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Register("report", func(context.Context, *models.Job) error { return nil })
+		require.Nil(queue.Cron("report", "0 6 * * *", map[string]string{"format": "csv"}))
+		require.Nil(queue.plan(context.Background(), queue.schedules[0]))
+
+		// Act
+		require.Nil(queue.plan(context.Background(), queue.schedules[0]))
+
+		// Assert
+		planned := []models.Job{}
+		require.Nil(database.Find(&planned).Error)
+		require.Len(planned, 1)
+		assert.Equal("0 6 * * *", planned[0].Schedule)
+		assert.JSONEq(`{"format":"csv"}`, string(planned[0].Payload))
+		assert.Equal(6, planned[0].RunAt.UTC().Hour())
+		assert.True(planned[0].RunAt.After(time.Now()))
+		assert.True(planned[0].RunAt.Before(time.Now().Add(24 * time.Hour)))
+
+		// Act
+		require.Nil(database.Model(&planned[0]).Update("run_at", time.Now()).Error)
+		claimed, exception := queue.claim(context.Background())
+		require.Nil(exception)
+		require.NotNil(claimed)
+		queue.perform(context.Background(), claimed)
+
+		// Assert
+		require.Nil(database.Order("id").Find(&planned).Error)
+		require.Len(planned, 2)
+		assert.Equal(models.JobSucceeded, planned[0].Status)
+		assert.Equal(models.JobPending, planned[1].Status)
+		assert.Equal("0 6 * * *", planned[1].Schedule)
+		assert.True(planned[1].RunAt.After(time.Now()))
+	})
+
+	test.Run("Should cancel only the pending jobs and retry only the finished ones", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		queue.Register("export", func(context.Context, *models.Job) error { return nil })
+		job, _ := queue.Schedule(database, "export", nil, time.Now().Add(time.Hour))
+
+		// Act & Assert
+		assert.ErrorIs(queue.Retry(database, job), ErrNotRetriable)
+		require.Nil(queue.Cancel(database, job))
+		assert.Equal(models.JobCancelled, status(database, job.ID))
+		assert.ErrorIs(queue.Cancel(database, job), ErrNotCancellable)
+		require.Nil(queue.Retry(database, job))
+		retried := find(database, job.ID)
+		assert.Equal(models.JobPending, retried.Status)
+		assert.Nil(retried.FinishedAt)
+		assert.WithinDuration(time.Now(), retried.RunAt, time.Second)
+	})
+
+	test.Run("Should purge the finished jobs older than the retention", func(test *testing.T) {
+		// Arrange
+		queue, database := setup(test)
+		old := time.Now().Add(-48 * time.Hour)
+		recent := time.Now().Add(-time.Hour)
+		seeds := []models.Job{
+			{Kind: "old", Status: models.JobSucceeded, FinishedAt: &old},
+			{Kind: "old", Status: models.JobFailed, FinishedAt: &old},
+			{Kind: "old", Status: models.JobCancelled, FinishedAt: &old},
+			{Kind: "recent", Status: models.JobSucceeded, FinishedAt: &recent},
+			{Kind: "pending", Status: models.JobPending},
+		}
+		require.Nil(database.Create(&seeds).Error)
+
+		// Act
+		exception := queue.Purge(24*time.Hour)(context.Background(), nil)
+
+		// Assert
+		require.Nil(exception)
+		kept := []models.Job{}
+		require.Nil(database.Order("id").Find(&kept).Error)
+		require.Len(kept, 2)
+		assert.Equal("recent", kept[0].Kind)
+		assert.Equal("pending", kept[1].Kind)
+	})
+
+	test.Run("Should cap the backoff between the attempts", func(test *testing.T) {
+		queue, _ := setup(test)
+		assert.Equal(time.Minute, queue.backoff(1))
+		assert.Equal(4*time.Minute, queue.backoff(3))
+		assert.Equal(MaximumBackoff, queue.backoff(100))
+	})
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormLogger bridges the GORM logger into a structured logger. The statements
+// are logged without the values of their parameters, so sensitive data like
+// password hashes don't end up in the logs.
+type GormLogger struct {
+	Logger        *slog.Logger
+	SlowThreshold time.Duration
+}
+
+func (bridge *GormLogger) LogMode(logger.LogLevel) logger.Interface {
+	// The level is given by the component logger
+	return bridge
+}
+
+func (bridge *GormLogger) Info(current context.Context, message string, data ...interface{}) {
+	bridge.Logger.InfoContext(current, fmt.Sprintf(message, data...))
+}
+
+func (bridge *GormLogger) Warn(current context.Context, message string, data ...interface{}) {
+	bridge.Logger.WarnContext(current, fmt.Sprintf(message, data...))
+}
+
+func (bridge *GormLogger) Error(current context.Context, message string, data ...interface{}) {
+	bridge.Logger.ErrorContext(current, fmt.Sprintf(message, data...))
+}
+
+func (bridge *GormLogger) Trace(current context.Context, begin time.Time, query func() (string, int64), exception error) {
+	elapsed := time.Since(begin)
+	level := slog.LevelDebug
+	message := "Database statement"
+	switch {
+	case exception != nil && !errors.Is(exception, gorm.ErrRecordNotFound):
+		level, message = slog.LevelError, "Database statement failed"
+	case bridge.SlowThreshold > 0 && elapsed > bridge.SlowThreshold:
+		level, message = slog.LevelWarn, "Slow database statement"
+	}
+
+	if !bridge.Logger.Enabled(current, level) {
+		return
+	}
+
+	statement, rows := query()
+	attributes := []slog.Attr{
+		slog.String("statement", statement),
+		slog.Int64("rows", rows),
+		slog.Duration("latency", elapsed),
+	}
+	if exception != nil {
+		attributes = append(attributes, slog.String("error", exception.Error()))
+	}
+	bridge.Logger.LogAttrs(current, level, message, attributes...)
+}
+
+// ParamsFilter makes GORM keep the placeholders of the statements instead of
+// replacing them with the actual values.
+func (bridge *GormLogger) ParamsFilter(current context.Context, statement string, parameters ...interface{}) (string, []interface{}) {
+	return statement, nil
+}
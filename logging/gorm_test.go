@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestGormLogger(test *testing.T) {
+	assert := assert.New(test)
+	query := func() (string, int64) {
+		return "SELECT * FROM `users` WHERE nickname = ?", 1
+	}
+
+	testcases := []struct {
+		Name      string
+		Level     slog.Level
+		Elapsed   time.Duration
+		Exception error
+		Expected  string
+	}{
+		{Name: "Should log statements as debug", Level: slog.LevelDebug, Expected: `"level":"DEBUG","msg":"Database statement"`},
+		{Name: "Should log slow statements as warning", Level: slog.LevelWarn, Elapsed: time.Second, Expected: `"level":"WARN","msg":"Slow database statement"`},
+		{Name: "Should log failed statements as error", Level: slog.LevelError, Exception: errors.New("disk I/O error"), Expected: `"level":"ERROR","msg":"Database statement failed"`},
+		{Name: "Should not log missing records as error", Level: slog.LevelDebug, Exception: gorm.ErrRecordNotFound, Expected: `"level":"DEBUG","msg":"Database statement"`},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Name, func(test *testing.T) {
+			// Arrange
+			var buffer bytes.Buffer
+			bridge := &GormLogger{
+				Logger:        New(&buffer, FormatJSON, slog.LevelDebug, nil).Logger("database"),
+				SlowThreshold: 100 * time.Millisecond,
+			}
+
+			// Act
+			bridge.Trace(context.Background(), time.Now().Add(-testcase.Elapsed), query, testcase.Exception)
+
+			// Assert
+			assert.Contains(buffer.String(), testcase.Expected)
+			assert.Contains(buffer.String(), "nickname = ?")
+		})
+	}
+
+	test.Run("Should skip the statement when the level is disabled", func(test *testing.T) {
+		// Arrange
+		var buffer bytes.Buffer
+		bridge := &GormLogger{Logger: New(&buffer, FormatJSON, slog.LevelWarn, nil).Logger("database")}
+		called := false
+
+		// Act
+		bridge.Trace(context.Background(), time.Now(), func() (string, int64) {
+			called = true
+			return query()
+		}, nil)
+
+		// Assert
+		assert.False(called)
+		assert.Empty(buffer.String())
+	})
+
+	test.Run("Should keep the placeholders instead of the values", func(test *testing.T) {
+		// Act
+		statement, parameters := (&GormLogger{}).ParamsFilter(context.Background(), "password = ?", "secret")
+
+		// Assert
+		assert.Equal("password = ?", statement)
+		assert.Nil(parameters)
+	})
+}
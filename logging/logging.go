@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+const (
+	FormatJSON    string = "json"
+	FormatText    string = "text"
+	RedactedValue string = "[REDACTED]"
+)
+
+// SensitiveKeys are the attribute keys (or part of them) whose values must
+// never reach the logs.
+var SensitiveKeys = []string{"password", "token", "secret", "authorization", "cookie", "otp", "recovery"}
+
+type requestKey struct{}
+
+// Factory creates the loggers for the components of the API, all of them
+// writing to the same sink but each one with its own minimum level.
+type Factory struct {
+	handler slog.Handler
+	level   slog.Level
+	levels  map[string]slog.Level
+}
+
+func New(writer io.Writer, format string, level slog.Level, levels map[string]slog.Level) *Factory {
+	options := &slog.HandlerOptions{
+		// The handler lets everything pass, the level is checked per component
+		Level:       slog.LevelDebug,
+		ReplaceAttr: Redact,
+	}
+
+	var handler slog.Handler = slog.NewJSONHandler(writer, options)
+	if format == FormatText {
+		handler = slog.NewTextHandler(writer, options)
+	}
+
+	return &Factory{
+		handler: &contextHandler{Handler: handler},
+		level:   level,
+		levels:  levels,
+	}
+}
+
+// Logger returns the logger for the given component, tagging its records
+// with the component name.
+func (factory *Factory) Logger(component string) *slog.Logger {
+	level, found := factory.levels[component]
+	if !found {
+		level = factory.level
+	}
+	handler := &levelHandler{Handler: factory.handler, level: level}
+	return slog.New(handler).With(slog.String("component", component))
+}
+
+// Redact hides the values of the attributes with a sensitive key.
+func Redact(groups []string, attribute slog.Attr) slog.Attr {
+	key := strings.ToLower(attribute.Key)
+	for _, sensitive := range SensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attribute.Key, RedactedValue)
+		}
+	}
+	return attribute
+}
+
+// ParseLevel reads a level by its name: debug, info, warn or error.
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	exception := level.UnmarshalText([]byte(name))
+	return level, exception
+}
+
+// ParseLevels reads the levels per component from a comma separated list of
+// component=level pairs, e. g. "http=info,database=warn".
+func ParseLevels(text string) (map[string]slog.Level, error) {
+	levels := map[string]slog.Level{}
+	for _, pair := range strings.Split(text, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		component, name, found := strings.Cut(pair, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid component level %q", pair)
+		}
+
+		level, exception := ParseLevel(strings.TrimSpace(name))
+		if exception != nil {
+			return nil, exception
+		}
+		levels[strings.TrimSpace(component)] = level
+	}
+	return levels, nil
+}
+
+func WithRequestID(parent context.Context, identifier string) context.Context {
+	return context.WithValue(parent, requestKey{}, identifier)
+}
+
+func RequestID(current context.Context) string {
+	identifier, _ := current.Value(requestKey{}).(string)
+	return identifier
+}
+
+// contextHandler adds the request identifier found in the context (if any),
+// so the records logged while serving a request can be correlated.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (handler *contextHandler) Handle(current context.Context, record slog.Record) error {
+	if identifier := RequestID(current); identifier != "" {
+		record.AddAttrs(slog.String("request_id", identifier))
+	}
+	return handler.Handler.Handle(current, record)
+}
+
+func (handler *contextHandler) WithAttrs(attributes []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithAttrs(attributes)}
+}
+
+func (handler *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: handler.Handler.WithGroup(name)}
+}
+
+type levelHandler struct {
+	slog.Handler
+	level slog.Level
+}
+
+func (handler *levelHandler) Enabled(current context.Context, level slog.Level) bool {
+	return level >= handler.level && handler.Handler.Enabled(current, level)
+}
+
+func (handler *levelHandler) WithAttrs(attributes []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: handler.Handler.WithAttrs(attributes), level: handler.level}
+}
+
+func (handler *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: handler.Handler.WithGroup(name), level: handler.level}
+}
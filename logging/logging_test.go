@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(test *testing.T, buffer *bytes.Buffer) map[string]interface{} {
+	record := map[string]interface{}{}
+	require.Nil(test, json.Unmarshal(buffer.Bytes(), &record))
+	return record
+}
+
+func TestLogger(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should tag the records with the component and the request identifier", func(test *testing.T) {
+		// Arrange
+		var buffer bytes.Buffer
+		logger := New(&buffer, FormatJSON, slog.LevelInfo, nil).Logger("http")
+		current := WithRequestID(context.Background(), "abc-123")
+
+		// Act
+		logger.InfoContext(current, "Request served", "status", 200)
+
+		// Assert
+		record := decode(test, &buffer)
+		assert.Equal("Request served", record["msg"])
+		assert.Equal("http", record["component"])
+		assert.Equal("abc-123", record["request_id"])
+		assert.Equal(200.0, record["status"])
+	})
+
+	test.Run("Should redact the values of sensitive attributes", func(test *testing.T) {
+		// Arrange
+		var buffer bytes.Buffer
+		logger := New(&buffer, FormatJSON, slog.LevelInfo, nil).Logger("users")
+
+		// Act
+		logger.Info("Signing up", "nickname", "dummy", "password", "secret", "Authorization", "Bearer abc")
+
+		// Assert
+		record := decode(test, &buffer)
+		assert.Equal("dummy", record["nickname"])
+		assert.Equal(RedactedValue, record["password"])
+		assert.Equal(RedactedValue, record["Authorization"])
+		assert.NotContains(buffer.String(), "Bearer abc")
+	})
+
+	test.Run("Should use the level of the component when it's given", func(test *testing.T) {
+		// Arrange
+		var buffer bytes.Buffer
+		loggers := New(&buffer, FormatText, slog.LevelInfo, map[string]slog.Level{"database": slog.LevelWarn})
+
+		// Act
+		loggers.Logger("database").Info("Database statement")
+		loggers.Logger("http").Debug("Debugging")
+		loggers.Logger("http").Info("Request served")
+
+		// Assert
+		assert.NotContains(buffer.String(), "Database statement")
+		assert.NotContains(buffer.String(), "Debugging")
+		assert.Contains(buffer.String(), "component=http")
+		assert.Contains(buffer.String(), `msg="Request served"`)
+	})
+}
+
+func TestParseLevels(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should read the level per component", func(test *testing.T) {
+		// Act
+		levels, exception := ParseLevels("http=info, database=warn")
+
+		// Assert
+		assert.Nil(exception)
+		assert.Equal(map[string]slog.Level{"http": slog.LevelInfo, "database": slog.LevelWarn}, levels)
+	})
+
+	test.Run("Should accept an empty list", func(test *testing.T) {
+		// Act
+		levels, exception := ParseLevels("")
+
+		// Assert
+		assert.Nil(exception)
+		assert.Empty(levels)
+	})
+
+	test.Run("Should fail on malformed pairs or unknown levels", func(test *testing.T) {
+		for _, text := range []string{"http", "http=loud"} {
+			_, exception := ParseLevels(text)
+			assert.NotNil(exception, text)
+		}
+	})
+}
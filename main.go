@@ -1,24 +1,106 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
 	"github.com/zatarain/note-vook/configuration"
 )
 
+func fail(logger *slog.Logger, message string, exception error) {
+	logger.Error(message, "error", exception)
+	os.Exit(1)
+}
+
 func main() {
+	// Load and validate the configuration
+	config, exception := configuration.Load(os.Args[1:])
+	if exception != nil {
+		fail(slog.Default(), "Invalid configuration", exception)
+		return
+	}
+	gin.SetMode(config.Mode)
+
+	// Initialise the structured logging
+	loggers, exception := configuration.NewLoggers(config.Logging)
+	if exception != nil {
+		fail(slog.Default(), "Failed to setup logging", exception)
+		return
+	}
+	logger := loggers.Logger("main")
+
 	// Connect to Database
-	connection := configuration.ConnectToDatabase()
+	database, connection, exception := configuration.ConnectToDatabase(config.Database, loggers.Logger("database"))
+	if exception != nil {
+		fail(logger, "Failed to connect to the database", exception)
+		return
+	}
 	defer connection.Close()
 
 	// Initialise Database
-	configuration.MigrateDatabase(configuration.Database)
+	configuration.MigrateDatabase(database)
 
 	// Initialise the API Server
-	server := gin.Default()
-	configuration.Setup(server)
-	if exception := server.Run(); exception != nil {
-		log.Panic(exception.Error())
+	engine := gin.New()
+	if exception := engine.SetTrustedProxies(config.Server.Proxies()); exception != nil {
+		fail(logger, "Invalid trusted proxies", exception)
+		return
+	}
+	configuration.SetupLogging(engine, loggers)
+	configuration.SetupProblems(engine)
+	shutdown, exception := configuration.SetupTracing(engine, config, database, loggers.Logger("tracing"))
+	if exception != nil {
+		fail(logger, "Failed to setup tracing", exception)
+		return
+	}
+	defer shutdown(context.Background())
+	metrics := configuration.SetupMetrics(engine, config, database, loggers.Logger("metrics"))
+	services := configuration.Setup(engine, config, database, loggers)
+	configuration.SetupBackups(engine, config, services.Backups, services.Administrator)
+	configuration.SetupJobs(engine, config, database, services.Jobs, services.Administrator)
+	configuration.SetupDocs(engine)
+	server := configuration.NewServer(engine, config.Server, loggers.Logger("server"))
+
+	// End the event streams on shutdown, otherwise they would be waited for
+	server.RegisterOnShutdown(services.Hub.Close)
+
+	// Serve until we receive an interruption or termination signal
+	interruption, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Serve the metrics on their own port when it's configured
+	var group sync.WaitGroup
+	if metrics != nil {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if exception := metrics.Serve(interruption); exception != nil {
+				logger.Error("Failed to serve the metrics", "error", exception)
+			}
+		}()
+	}
+
+	// Perform the background jobs, e. g. the deliveries of the webhooks and the
+	// backups, the running ones have the grace time to finish on shutdown and
+	// the interrupted ones run again on the next start
+	group.Add(1)
+	go func() {
+		defer group.Done()
+		services.Jobs.Run(interruption)
+	}()
+
+	if exception := server.Serve(interruption); exception != nil {
+		stop()
+		group.Wait()
+		fail(logger, "Failed to serve the API", exception)
+		return
 	}
+	stop()
+	group.Wait()
+	logger.Info("Server stopped")
 }
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -12,28 +15,50 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"github.com/zatarain/note-vook/configuration"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/webhooks"
 )
 
 func TestMain(test *testing.T) {
 	assert := assert.New(test)
 	gin.SetMode(gin.TestMode)
-	monkey.Patch(log.Panic, log.Print)
+	monkey.Patch(os.Exit, func(int) {})
 
 	// Teardown test suite
 	defer monkey.UnpatchAll()
 	defer log.SetOutput(os.Stderr)
+	defer slog.SetDefault(slog.Default())
+
+	// Ignore the flags of the test binary
+	arguments := os.Args
+	os.Args = []string{"note-vook"}
+	defer func() { os.Args = arguments }()
 
 	test.Run("Should run the service", func(test *testing.T) {
 		// Arrange
 		serverHasBeenSetup := false
 		serverIsRunning := false
-		monkey.Patch(configuration.Setup, func(server gin.IRouter) {
+		monkey.Patch(configuration.Setup, func(_ gin.IRouter, config *configuration.Config, database models.DataAccessInterface, loggers *logging.Factory) *configuration.Services {
 			serverHasBeenSetup = true
-			monkey.PatchInstanceMethod(reflect.TypeOf(server), "Run", func(*gin.Engine, ...string) error {
+			dispatcher := &webhooks.Dispatcher{}
+			backups := configuration.NewBackupManager(config, database, loggers.Logger("backup"))
+			return &configuration.Services{
+				Hub:      events.NewHub(0),
+				Webhooks: dispatcher,
+				Backups:  backups,
+				Jobs:     configuration.NewJobQueue(config, database, dispatcher, backups, loggers.Logger("jobs")),
+			}
+		})
+		monkey.PatchInstanceMethod(
+			reflect.TypeOf(&configuration.Server{}),
+			"Serve",
+			func(*configuration.Server, context.Context) error {
 				serverIsRunning = true
 				return nil
-			})
-		})
+			},
+		)
 
 		// Act
 		main()
@@ -43,20 +68,39 @@ func TestMain(test *testing.T) {
 		assert.True(serverIsRunning)
 	})
 
-	test.Run("Should log panic when failed to run server", func(test *testing.T) {
+	test.Run("Should log an error when failed to run server", func(test *testing.T) {
 		// Arrange
-		var capture bytes.Buffer
-		log.SetOutput(&capture)
-		monkey.Patch(configuration.Setup, func(server gin.IRouter) {
-			monkey.PatchInstanceMethod(reflect.TypeOf(server), "Run", func(*gin.Engine, ...string) error {
+		filename := filepath.Join(test.TempDir(), "note-vook.log")
+		test.Setenv("LOG_OUTPUT", filename)
+		monkey.PatchInstanceMethod(
+			reflect.TypeOf(&configuration.Server{}),
+			"Serve",
+			func(*configuration.Server, context.Context) error {
 				return errors.New("Failed to start the server")
-			})
-		})
+			},
+		)
+
+		// Act
+		main()
+
+		// Assert
+		content, exception := os.ReadFile(filename)
+		assert.Nil(exception)
+		assert.Contains(string(content), "Failed to serve the API")
+		assert.Contains(string(content), "Failed to start the server")
+	})
+
+	test.Run("Should log an error when the configuration is invalid", func(test *testing.T) {
+		// Arrange
+		var capture bytes.Buffer
+		slog.SetDefault(slog.New(slog.NewTextHandler(&capture, nil)))
+		test.Setenv("LOG_LEVEL", "verbose")
 
 		// Act
 		main()
 
 		// Assert
-		assert.Contains(capture.String(), "Failed to start the server")
+		assert.Contains(capture.String(), "Invalid configuration")
+		assert.Contains(capture.String(), "verbose")
 	})
 }
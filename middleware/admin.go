@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/problems"
+)
+
+const BearerPrefix string = "Bearer "
+
+// Admin only lets through the requests bearing the given token on their
+// Authorization header or the ones the administrator function tells are made
+// by an administrator, e. g. from the session of a user with the admin role.
+// The token is not accepted when it's empty, so the administration end-points
+// are disabled unless a token or an administrator function is configured.
+func Admin(token string, administrator func(context *gin.Context) bool) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		if token == "" && administrator == nil {
+			exception := errors.New("administration end-points are disabled")
+			problems.Abort(context, problems.Unauthorised.Wrap(exception).WithDetail(exception.Error()))
+			return
+		}
+
+		header := context.GetHeader("Authorization")
+		given, found := strings.CutPrefix(header, BearerPrefix)
+		if token != "" && found && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			context.Next()
+			return
+		}
+		if administrator != nil && administrator(context) {
+			context.Next()
+			return
+		}
+
+		exception := errors.New("invalid admin token")
+		if administrator != nil {
+			exception = errors.New("invalid admin token or the user is not an administrator")
+		}
+		problems.Abort(context, problems.Unauthorised.Wrap(exception).WithDetail(exception.Error()))
+	}
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdmin(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	const token string = "0123456789abcdef0123456789abcdef"
+	administrator := func(context *gin.Context) bool {
+		return context.GetHeader("X-Role") == "admin"
+	}
+	testcases := []struct {
+		Description   string
+		Token         string
+		Administrator func(*gin.Context) bool
+		Authorization string
+		Role          string
+		Status        int
+		Body          string
+	}{
+		{
+			Description:   "Should allow the requests bearing the token",
+			Token:         token,
+			Authorization: "Bearer " + token,
+			Status:        http.StatusOK,
+			Body:          "OK",
+		},
+		{
+			Description:   "Should reject a different token",
+			Token:         token,
+			Authorization: "Bearer " + token[1:],
+			Status:        http.StatusUnauthorized,
+			Body:          "invalid admin token",
+		},
+		{
+			Description:   "Should reject the requests without bearer token",
+			Token:         token,
+			Authorization: "Basic " + token,
+			Status:        http.StatusUnauthorized,
+			Body:          "invalid admin token",
+		},
+		{
+			Description:   "Should reject everything when there is no token",
+			Token:         "",
+			Authorization: "Bearer ",
+			Status:        http.StatusUnauthorized,
+			Body:          "administration end-points are disabled",
+		},
+		{
+			Description:   "Should allow the administrators",
+			Token:         token,
+			Administrator: administrator,
+			Role:          "admin",
+			Status:        http.StatusOK,
+			Body:          "OK",
+		},
+		{
+			Description:   "Should allow the administrators when there is no token",
+			Token:         "",
+			Administrator: administrator,
+			Authorization: "Bearer ",
+			Role:          "admin",
+			Status:        http.StatusOK,
+			Body:          "OK",
+		},
+		{
+			Description:   "Should still allow the token with administrators",
+			Token:         token,
+			Administrator: administrator,
+			Authorization: "Bearer " + token,
+			Status:        http.StatusOK,
+			Body:          "OK",
+		},
+		{
+			Description:   "Should reject the users who are not administrators",
+			Token:         token,
+			Administrator: administrator,
+			Role:          "user",
+			Status:        http.StatusUnauthorized,
+			Body:          "the user is not an administrator",
+		},
+		{
+			Description:   "Should NOT take the empty token when there is no token",
+			Token:         "",
+			Administrator: administrator,
+			Authorization: "Bearer ",
+			Status:        http.StatusUnauthorized,
+			Body:          "the user is not an administrator",
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			server := gin.New()
+			server.GET("/", Admin(testcase.Token, testcase.Administrator), func(context *gin.Context) {
+				context.String(http.StatusOK, "OK")
+			})
+			request, _ := http.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", testcase.Authorization)
+			request.Header.Set("X-Role", testcase.Role)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			server.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Body)
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+	"gorm.io/gorm"
+)
+
+const (
+	IdempotencyKeyHeader string = "Idempotency-Key"
+
+	// ReplayedHeader tells the clients the response is the one kept for the key
+	ReplayedHeader string = "Idempotent-Replayed"
+
+	MaximumIdempotencyKeyLength int = 255
+
+	// purgeInterval is the minimum time between the removals of the expired keys
+	purgeInterval time.Duration = time.Minute
+)
+
+// recorder keeps a copy of the response body while it's written.
+type recorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (writer *recorder) Write(data []byte) (int, error) {
+	writer.body.Write(data)
+	return writer.ResponseWriter.Write(data)
+}
+
+func (writer *recorder) WriteString(data string) (int, error) {
+	writer.body.WriteString(data)
+	return writer.ResponseWriter.WriteString(data)
+}
+
+// fingerprint identifies the request by its method, address and body, so a
+// key can't be reused for a different request.
+func fingerprint(request *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", request.Method, request.URL.RequestURI())
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Idempotency keeps the responses of the requests sent with an
+// Idempotency-Key header for the given time, so their retries get the same
+// response instead of repeating the request. The key can't be reused for a
+// different request meanwhile. The failures of the server, the responses
+// setting cookies (e. g. the login) and the ones that must not be stored (e. g.
+// the secrets) are not kept, so their retries are served again. The body is
+// read to identify the request, so it can't be larger than the maximum. It's
+// disabled when the time is not positive.
+func Idempotency(database models.DataAccessInterface, ttl time.Duration, maximum int64) gin.HandlerFunc {
+	var purged atomic.Int64
+	return func(context *gin.Context) {
+		key := context.GetHeader(IdempotencyKeyHeader)
+		if key == "" || ttl <= 0 {
+			context.Next()
+			return
+		}
+		if len(key) > MaximumIdempotencyKeyLength {
+			problems.Abort(context, problems.InvalidInput.WithDetail(fmt.Sprintf(
+				"%s must have at most %d characters", IdempotencyKeyHeader, MaximumIdempotencyKeyLength,
+			)))
+			return
+		}
+
+		var body []byte
+		if context.Request.Body != nil {
+			read, exception := io.ReadAll(http.MaxBytesReader(context.Writer, context.Request.Body, maximum))
+			var large *http.MaxBytesError
+			if errors.As(exception, &large) {
+				problems.Abort(context, problems.RequestTooLarge.Wrap(exception).WithDetail(fmt.Sprintf(
+					"the body of the requests with %s must have at most %d bytes", IdempotencyKeyHeader, large.Limit,
+				)))
+				return
+			}
+			if exception != nil {
+				problems.Abort(context, problems.Input(exception))
+				return
+			}
+			body = read
+			context.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		now := time.Now()
+		if last := purged.Load(); now.Sub(time.Unix(0, last)) >= purgeInterval && purged.CompareAndSwap(last, now.UnixNano()) {
+			if exception := database.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{}).Error; exception != nil {
+				context.Error(exception)
+			}
+		}
+
+		record := &models.IdempotencyKey{
+			Key:         key,
+			Fingerprint: fingerprint(context.Request, body),
+			ExpiresAt:   now.Add(ttl),
+		}
+		if user, exists := context.Get("user"); exists {
+			record.UserID = user.(*models.User).ID
+		}
+		if !reserve(context, database, record, now) {
+			return
+		}
+
+		// The key is released when the response is not kept, even on panics
+		kept := false
+		defer func() {
+			if !kept {
+				database.Delete(record)
+			}
+		}()
+
+		writer := &recorder{ResponseWriter: context.Writer}
+		context.Writer = writer
+		context.Next()
+
+		status := writer.Status()
+		if status >= http.StatusInternalServerError || !keepable(writer.Header()) {
+			return
+		}
+		saving := database.Model(record).Updates(map[string]interface{}{
+			"status":       status,
+			"content_type": writer.Header().Get("Content-Type"),
+			"body":         writer.body.Bytes(),
+		}).Error
+		if saving != nil {
+			context.Error(saving)
+			return
+		}
+		kept = true
+	}
+}
+
+// keepable tells whether the response can be kept by its headers.
+func keepable(header http.Header) bool {
+	if len(header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return false
+		}
+	}
+	return true
+}
+
+// reserve saves the key for the request, unless there is already one. In that
+// case the kept response is sent again when the key was given for the same
+// request, otherwise the request is rejected.
+func reserve(context *gin.Context, database models.DataAccessInterface, record *models.IdempotencyKey, now time.Time) bool {
+	creating := database.Create(record).Error
+	if creating == nil {
+		return true
+	}
+	if !errors.Is(creating, gorm.ErrDuplicatedKey) {
+		problems.Abort(context, creating)
+		return false
+	}
+
+	existing := &models.IdempotencyKey{}
+	searching := database.Where(map[string]interface{}{"user_id": record.UserID, "key": record.Key}).First(existing).Error
+	if errors.Is(searching, gorm.ErrRecordNotFound) || (searching == nil && existing.Expired(now)) {
+		// The previous request was released or expired meanwhile
+		if searching == nil {
+			database.Delete(existing)
+		}
+		creating = database.Create(record).Error
+		if errors.Is(creating, gorm.ErrDuplicatedKey) {
+			creating = problems.RequestInProgress.Wrap(creating)
+		}
+		if creating != nil {
+			problems.Abort(context, creating)
+			return false
+		}
+		return true
+	}
+
+	switch {
+	case searching != nil:
+		problems.Abort(context, searching)
+	case existing.Fingerprint != record.Fingerprint:
+		problems.Abort(context, problems.IdempotencyReused)
+	case !existing.Completed():
+		problems.Abort(context, problems.RequestInProgress)
+	default:
+		context.Header(ReplayedHeader, "true")
+		context.Data(existing.Status, existing.ContentType, existing.Body)
+		context.Abort()
+	}
+	return false
+}
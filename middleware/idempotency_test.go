@@ -0,0 +1,214 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIdempotency(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+	const maximum int64 = 64
+
+	type request struct {
+		User uint
+		Key  string
+		Body string
+	}
+
+	// serve sends the requests to an end-point counting its calls, which
+	// responds with the given status and sets a cookie or forbids storing the
+	// response when asked to.
+	serve := func(test *testing.T, ttl time.Duration, status int, requests ...request) (*gorm.DB, []*httptest.ResponseRecorder, int) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "idempotency.db")), &gorm.Config{
+			TranslateError: true,
+		})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.IdempotencyKey{}))
+
+		calls := 0
+		server := gin.New()
+		server.POST("/things", func(context *gin.Context) {
+			if user := context.GetHeader("X-User"); user != "" {
+				context.Set("user", &models.User{ID: uint(len(user))})
+			}
+		}, Idempotency(database, ttl, maximum), func(context *gin.Context) {
+			calls++
+			if context.Query("cookie") != "" {
+				context.SetCookie("session", "secret", 60, "/", "", false, true)
+			}
+			if context.Query("secret") != "" {
+				context.Header("Cache-Control", "private, no-store")
+			}
+			body, _ := context.GetRawData()
+			context.JSON(status, gin.H{"call": calls, "body": string(body)})
+		})
+
+		recorders := []*httptest.ResponseRecorder{}
+		for _, sending := range requests {
+			path := "/things"
+			if strings.HasPrefix(sending.Body, "cookie") {
+				path += "?cookie=yes"
+			}
+			if strings.HasPrefix(sending.Body, "secret") {
+				path += "?secret=yes"
+			}
+			request, _ := http.NewRequest(http.MethodPost, path, strings.NewReader(sending.Body))
+			if sending.Key != "" {
+				request.Header.Set(IdempotencyKeyHeader, sending.Key)
+			}
+			if sending.User != 0 {
+				request.Header.Set("X-User", strings.Repeat("u", int(sending.User)))
+			}
+			recorder := httptest.NewRecorder()
+			server.ServeHTTP(recorder, request)
+			recorders = append(recorders, recorder)
+		}
+		return database, recorders, calls
+	}
+
+	test.Run("Should replay the response on the retries", func(test *testing.T) {
+		// Act
+		_, recorders, calls := serve(test, time.Hour, http.StatusCreated,
+			request{User: 1, Key: "one", Body: "first"},
+			request{User: 1, Key: "one", Body: "first"},
+		)
+
+		// Assert
+		assert.Equal(1, calls)
+		assert.Equal(http.StatusCreated, recorders[1].Code)
+		assert.Equal(recorders[0].Body.String(), recorders[1].Body.String())
+		assert.Equal("application/json; charset=utf-8", recorders[1].Header().Get("Content-Type"))
+		assert.Empty(recorders[0].Header().Get(ReplayedHeader))
+		assert.Equal("true", recorders[1].Header().Get(ReplayedHeader))
+	})
+
+	test.Run("Should reject the key when it's reused for another request", func(test *testing.T) {
+		// Act
+		_, recorders, calls := serve(test, time.Hour, http.StatusCreated,
+			request{User: 1, Key: "one", Body: "first"},
+			request{User: 1, Key: "one", Body: "second"},
+		)
+
+		// Assert
+		assert.Equal(1, calls)
+		assert.Equal(http.StatusUnprocessableEntity, recorders[1].Code)
+		assert.Contains(recorders[1].Body.String(), `"code":"idempotency_key_reused"`)
+	})
+
+	testcases := []struct {
+		Description string
+		TTL         time.Duration
+		Status      int
+		Requests    []request
+	}{
+		{"Should serve the requests without key", time.Hour, http.StatusOK, []request{{Body: "same"}, {Body: "same"}}},
+		{"Should scope the keys by user", time.Hour, http.StatusOK, []request{{User: 1, Key: "one"}, {User: 2, Key: "one"}, {Key: "one"}}},
+		{"Should not keep the failures of the server", time.Hour, http.StatusInternalServerError, []request{{Key: "one"}, {Key: "one"}}},
+		{"Should not keep the responses setting cookies", time.Hour, http.StatusOK, []request{{Key: "one", Body: "cookie"}, {Key: "one", Body: "cookie"}}},
+		{"Should not keep the responses that must not be stored", time.Hour, http.StatusOK, []request{{Key: "one", Body: "secret"}, {Key: "one", Body: "secret"}}},
+		{"Should serve again once the key expires", time.Nanosecond, http.StatusOK, []request{{Key: "one"}, {Key: "one"}}},
+		{"Should be disabled without time to keep the keys", 0, http.StatusOK, []request{{Key: "one"}, {Key: "one"}}},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			_, recorders, calls := serve(test, testcase.TTL, testcase.Status, testcase.Requests...)
+
+			// Assert
+			assert.Equal(len(testcase.Requests), calls)
+			for _, recorder := range recorders {
+				assert.Equal(testcase.Status, recorder.Code)
+				assert.Empty(recorder.Header().Get(ReplayedHeader))
+			}
+		})
+	}
+
+	test.Run("Should reject the retries while the request is in progress", func(test *testing.T) {
+		// Arrange
+		database, _, _ := serve(test, time.Hour, http.StatusOK)
+		request, _ := http.NewRequest(http.MethodPost, "/things", strings.NewReader("body"))
+		pending := &models.IdempotencyKey{
+			Key:         "one",
+			Fingerprint: fingerprint(request, []byte("body")),
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}
+		require.Nil(database.Create(pending).Error)
+		server := gin.New()
+		server.POST("/things", Idempotency(database, time.Hour, maximum), func(context *gin.Context) {
+			context.Status(http.StatusOK)
+		})
+		request.Header.Set(IdempotencyKeyHeader, "one")
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		assert.Equal(http.StatusConflict, recorder.Code)
+		assert.Contains(recorder.Body.String(), `"code":"request_in_progress"`)
+	})
+
+	test.Run("Should reject too long keys", func(test *testing.T) {
+		// Act
+		_, recorders, calls := serve(test, time.Hour, http.StatusOK,
+			request{Key: strings.Repeat("k", MaximumIdempotencyKeyLength+1)},
+		)
+
+		// Assert
+		assert.Zero(calls)
+		assert.Equal(http.StatusBadRequest, recorders[0].Code)
+	})
+
+	test.Run("Should reject too large bodies without keeping the key", func(test *testing.T) {
+		// Act
+		database, recorders, calls := serve(test, time.Hour, http.StatusOK,
+			request{Key: "one", Body: strings.Repeat("b", int(maximum)+1)},
+			request{Key: "one", Body: strings.Repeat("b", int(maximum))},
+		)
+
+		// Assert
+		assert.Equal(1, calls)
+		assert.Equal(http.StatusRequestEntityTooLarge, recorders[0].Code)
+		assert.Contains(recorders[0].Body.String(), `"code":"request_too_large"`)
+		assert.Equal(http.StatusOK, recorders[1].Code)
+		var total int64
+		database.Model(&models.IdempotencyKey{}).Count(&total)
+		assert.Equal(int64(1), total)
+	})
+
+	test.Run("Should purge the expired keys", func(test *testing.T) {
+		// Arrange
+		database, _, _ := serve(test, time.Hour, http.StatusOK)
+		expired := &models.IdempotencyKey{Key: "old", ExpiresAt: time.Now().Add(-time.Minute)}
+		require.Nil(database.Create(expired).Error)
+		server := gin.New()
+		server.POST("/things", Idempotency(database, time.Hour, maximum), func(context *gin.Context) {
+			context.Status(http.StatusOK)
+		})
+		request, _ := http.NewRequest(http.MethodPost, "/things", nil)
+		request.Header.Set(IdempotencyKeyHeader, "new")
+
+		// Act
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		// Assert
+		keys := []models.IdempotencyKey{}
+		database.Find(&keys)
+		require.Len(keys, 1)
+		assert.Equal("new", keys[0].Key)
+	})
+}
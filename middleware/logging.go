@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/models"
+)
+
+const RequestIDHeader string = "X-Request-ID"
+
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+func newRequestID() string {
+	identifier := make([]byte, 16)
+	rand.Read(identifier)
+	return hex.EncodeToString(identifier)
+}
+
+// RequestID propagates the request identifier given by the client (or a proxy)
+// or generates a new one, then stores it within the request context and sends
+// it back within the response headers.
+func RequestID(context *gin.Context) {
+	identifier := context.GetHeader(RequestIDHeader)
+	if !validRequestID.MatchString(identifier) {
+		identifier = newRequestID()
+	}
+
+	context.Set("request_id", identifier)
+	context.Request = context.Request.WithContext(logging.WithRequestID(context.Request.Context(), identifier))
+	context.Header(RequestIDHeader, identifier)
+	context.Next()
+}
+
+// AccessLog logs a record for each request once it has been served.
+func AccessLog(logger *slog.Logger) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		start := time.Now()
+		context.Next()
+
+		status := context.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		route := context.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+
+		attributes := []slog.Attr{
+			slog.String("method", context.Request.Method),
+			slog.String("route", route),
+			slog.String("path", context.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", context.ClientIP()),
+			slog.Int("bytes", context.Writer.Size()),
+		}
+		if value, exists := context.Get("user"); exists {
+			if user, ok := value.(*models.User); ok && user != nil {
+				attributes = append(attributes, slog.Uint64("user_id", uint64(user.ID)))
+			}
+		}
+		if len(context.Errors) > 0 {
+			attributes = append(attributes, slog.String("error", context.Errors.String()))
+		}
+
+		logger.LogAttrs(context.Request.Context(), level, "Request served", attributes...)
+	}
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zatarain/note-vook/logging"
+	"github.com/zatarain/note-vook/models"
+)
+
+func TestRequestID(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	testcases := []struct {
+		Name     string
+		Header   string
+		Expected func(string) bool
+	}{
+		{
+			Name:     "Should propagate a valid identifier given by the client",
+			Header:   "client-id.42",
+			Expected: func(identifier string) bool { return identifier == "client-id.42" },
+		},
+		{
+			Name:     "Should generate an identifier when it's missing",
+			Expected: func(identifier string) bool { return len(identifier) == 32 },
+		},
+		{
+			Name:     "Should replace an invalid identifier",
+			Header:   "bad id\nwith new line",
+			Expected: func(identifier string) bool { return len(identifier) == 32 },
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Name, func(test *testing.T) {
+			// Arrange
+			server := gin.New()
+			server.Use(RequestID)
+			var propagated string
+			server.GET("/", func(context *gin.Context) {
+				propagated = logging.RequestID(context.Request.Context())
+			})
+			request, _ := http.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set(RequestIDHeader, testcase.Header)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			server.ServeHTTP(recorder, request)
+
+			// Assert
+			identifier := recorder.Header().Get(RequestIDHeader)
+			assert.True(testcase.Expected(identifier), identifier)
+			assert.Equal(identifier, propagated)
+		})
+	}
+}
+
+func TestAccessLog(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should log the request with its route, status and user", func(test *testing.T) {
+		// Arrange
+		var buffer bytes.Buffer
+		logger := logging.New(&buffer, logging.FormatJSON, slog.LevelInfo, nil).Logger("http")
+		server := gin.New()
+		server.Use(RequestID, AccessLog(logger))
+		server.GET("/videos/:id", func(context *gin.Context) {
+			context.Set("user", &models.User{ID: 7})
+			context.JSON(http.StatusNotFound, gin.H{"summary": "Video not found"})
+		})
+		request, _ := http.NewRequest(http.MethodGet, "/videos/5", nil)
+		request.Header.Set(RequestIDHeader, "request-1")
+
+		// Act
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		// Assert
+		output := buffer.String()
+		assert.Contains(output, `"level":"WARN"`)
+		assert.Contains(output, `"msg":"Request served"`)
+		assert.Contains(output, `"route":"/videos/:id"`)
+		assert.Contains(output, `"path":"/videos/5"`)
+		assert.Contains(output, `"status":404`)
+		assert.Contains(output, `"user_id":7`)
+		assert.Contains(output, `"request_id":"request-1"`)
+	})
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const UnmatchedRoute string = "unmatched"
+
+type Metrics struct {
+	Requests *prometheus.CounterVec
+	Latency  *prometheus.HistogramVec
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	metrics := &Metrics{
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "notevook",
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status code.",
+		}, []string{"method", "route", "status"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "notevook",
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of the HTTP requests by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+	}
+	registerer.MustRegister(metrics.Requests, metrics.Latency)
+	return metrics
+}
+
+// Handler records the count and latency of each request labelled by the
+// route template (e. g. /videos/:id) rather than the actual path, so the
+// cardinality of the metrics doesn't grow with the number of records.
+func (metrics *Metrics) Handler(context *gin.Context) {
+	start := time.Now()
+	context.Next()
+
+	route := context.FullPath()
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	method := context.Request.Method
+	status := strconv.Itoa(context.Writer.Status())
+	metrics.Requests.WithLabelValues(method, route, status).Inc()
+	metrics.Latency.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+}
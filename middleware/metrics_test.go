@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should count requests and observe latency by route template", func(test *testing.T) {
+		// Arrange
+		registry := prometheus.NewRegistry()
+		metrics := NewMetrics(registry)
+		server := gin.New()
+		server.Use(metrics.Handler)
+		server.GET("/videos/:id", func(context *gin.Context) {
+			context.Status(http.StatusNoContent)
+		})
+
+		// Act
+		for _, path := range []string{"/videos/1", "/videos/2", "/missing"} {
+			request, _ := http.NewRequest(http.MethodGet, path, nil)
+			server.ServeHTTP(httptest.NewRecorder(), request)
+		}
+
+		// Assert
+		assert.Equal(2.0, testutil.ToFloat64(metrics.Requests.WithLabelValues("GET", "/videos/:id", "204")))
+		assert.Equal(1.0, testutil.ToFloat64(metrics.Requests.WithLabelValues("GET", UnmatchedRoute, "404")))
+		assert.Equal(2, testutil.CollectAndCount(metrics.Latency))
+	})
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/problems"
+)
+
+// Problems responds with the last error attached to the context by the
+// handlers when none of them has written a response.
+func Problems(context *gin.Context) {
+	context.Next()
+
+	if context.Writer.Written() || len(context.Errors) == 0 {
+		return
+	}
+	problems.Abort(context, context.Errors.Last().Err)
+}
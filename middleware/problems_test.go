@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zatarain/note-vook/problems"
+)
+
+func TestProblems(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	testcases := []struct {
+		Description string
+		Handler     gin.HandlerFunc
+		Status      int
+		Code        string
+	}{
+		{
+			Description: "Should respond with the problem attached by the handler",
+			Handler: func(context *gin.Context) {
+				context.Error(problems.AnnotationNotFound)
+			},
+			Status: http.StatusNotFound,
+			Code:   `"code":"annotation_not_found"`,
+		},
+		{
+			Description: "Should respond internal error for unknown errors",
+			Handler: func(context *gin.Context) {
+				context.Error(errors.New("database is locked"))
+			},
+			Status: http.StatusInternalServerError,
+			Code:   `"code":"internal_error"`,
+		},
+		{
+			Description: "Should keep the response written by the handler",
+			Handler: func(context *gin.Context) {
+				context.Error(errors.New("ignored"))
+				context.String(http.StatusAccepted, "accepted")
+			},
+			Status: http.StatusAccepted,
+			Code:   "accepted",
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			server := gin.New()
+			server.Use(Problems)
+			server.GET("/", testcase.Handler)
+			request, _ := http.NewRequest(http.MethodGet, "/", nil)
+			recorder := httptest.NewRecorder()
+
+			// Act
+			server.ServeHTTP(recorder, request)
+
+			// Assert
+			assert.Equal(testcase.Status, recorder.Code)
+			assert.Contains(recorder.Body.String(), testcase.Code)
+			assert.NotContains(recorder.Body.String(), "database is locked")
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zatarain/note-vook/models"
+	"github.com/zatarain/note-vook/problems"
+)
+
+const (
+	RateLimitHeader          string = "RateLimit-Limit"
+	RateLimitRemainingHeader string = "RateLimit-Remaining"
+	RateLimitResetHeader     string = "RateLimit-Reset"
+	RateLimitPolicyHeader    string = "RateLimit-Policy"
+	RetryAfterHeader         string = "Retry-After"
+)
+
+// Decision tells whether a request is within the limit and how the limit is
+// going for its key.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset is the time until the limit is fully available again
+	Reset time.Duration
+
+	// RetryAfter is the time until the next request is allowed, if it's not
+	RetryAfter time.Duration
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter is a token bucket per key (e. g. the client address), each of them
+// holds up to the given number of requests and refills them along the period,
+// so the bursts are allowed as long as the rate keeps within the limit.
+type Limiter struct {
+	Requests int
+	Period   time.Duration
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// NewLimiter allows the given number of requests per period for each key.
+func NewLimiter(requests int, period time.Duration) *Limiter {
+	return &Limiter{
+		Requests: requests,
+		Period:   period,
+		buckets:  map[string]*bucket{},
+	}
+}
+
+// Enabled tells whether the limiter allows a finite number of requests.
+func (limiter *Limiter) Enabled() bool {
+	return limiter != nil && limiter.Requests > 0 && limiter.Period > 0
+}
+
+// rate is the number of requests refilled per second.
+func (limiter *Limiter) rate() float64 {
+	return float64(limiter.Requests) / limiter.Period.Seconds()
+}
+
+// Take spends a request of the bucket of the key, if there is any left.
+func (limiter *Limiter) Take(key string, now time.Time) Decision {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.sweep(now)
+
+	capacity, rate := float64(limiter.Requests), limiter.rate()
+	current, found := limiter.buckets[key]
+	if !found {
+		current = &bucket{tokens: capacity, updated: now}
+		limiter.buckets[key] = current
+	}
+	current.tokens = math.Min(capacity, current.tokens+now.Sub(current.updated).Seconds()*rate)
+	current.updated = now
+
+	decision := Decision{Limit: limiter.Requests}
+	if current.tokens >= 1 {
+		current.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = seconds((1 - current.tokens) / rate)
+	}
+	decision.Remaining = int(current.tokens)
+	decision.Reset = seconds((capacity - current.tokens) / rate)
+	return decision
+}
+
+// sweep forgets the buckets refilled since their last request, as they are
+// the same as new ones, once per period.
+func (limiter *Limiter) sweep(now time.Time) {
+	if now.Sub(limiter.swept) < limiter.Period {
+		return
+	}
+	limiter.swept = now
+	capacity, rate := float64(limiter.Requests), limiter.rate()
+	for key, current := range limiter.buckets {
+		if current.tokens+now.Sub(current.updated).Seconds()*rate >= capacity {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
+
+// Delta formats a duration as the whole number of seconds of the Retry-After
+// and RateLimit-Reset headers, rounding it up.
+func Delta(duration time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(duration.Seconds())), 10)
+}
+
+// ClientAddress keys the requests by the IP address of the client.
+func ClientAddress(context *gin.Context) string {
+	return context.ClientIP()
+}
+
+// LoggedUser keys the requests by the logged user, the anonymous ones by the
+// IP address of the client.
+func LoggedUser(context *gin.Context) string {
+	if user, exists := context.Get("user"); exists {
+		return fmt.Sprintf("user:%d", user.(*models.User).ID)
+	}
+	return "address:" + ClientAddress(context)
+}
+
+// RateLimit lets through the requests within the limit of their key and
+// rejects the others until their bucket refills, telling the clients when to
+// retry. The RateLimit-* headers describe the most restrictive of the limits
+// applied to a request. It lets through all the requests when the limiter is
+// disabled.
+func RateLimit(limiter *Limiter, key func(*gin.Context) string) gin.HandlerFunc {
+	if !limiter.Enabled() {
+		return func(context *gin.Context) {
+			context.Next()
+		}
+	}
+
+	policy := fmt.Sprintf("%d;w=%d", limiter.Requests, int64(limiter.Period.Seconds()))
+	return func(context *gin.Context) {
+		decision := limiter.Take(key(context), time.Now())
+		previous, exception := strconv.Atoi(context.Writer.Header().Get(RateLimitRemainingHeader))
+		if !decision.Allowed || exception != nil || decision.Remaining < previous {
+			context.Header(RateLimitHeader, strconv.Itoa(decision.Limit))
+			context.Header(RateLimitRemainingHeader, strconv.Itoa(decision.Remaining))
+			context.Header(RateLimitResetHeader, Delta(decision.Reset))
+			context.Header(RateLimitPolicyHeader, policy)
+		}
+
+		if !decision.Allowed {
+			context.Header(RetryAfterHeader, Delta(decision.RetryAfter))
+			problems.Abort(context, problems.RateLimited.WithDetail(fmt.Sprintf(
+				"Too many requests, try again in %s seconds", Delta(decision.RetryAfter),
+			)))
+			return
+		}
+		context.Next()
+	}
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/zatarain/note-vook/models"
+)
+
+func TestLimiter(test *testing.T) {
+	assert := assert.New(test)
+	now := time.Date(2023, time.October, 13, 10, 30, 0, 0, time.UTC)
+
+	test.Run("Should allow a burst up to the limit and reject the next request", func(test *testing.T) {
+		// Arrange
+		limiter := NewLimiter(3, time.Minute)
+
+		// Act
+		decisions := []Decision{}
+		for index := 0; index < 4; index++ {
+			decisions = append(decisions, limiter.Take("client", now))
+		}
+
+		// Assert
+		assert.True(decisions[0].Allowed)
+		assert.Equal(2, decisions[0].Remaining)
+		assert.Equal(20*time.Second, decisions[0].Reset)
+		assert.True(decisions[2].Allowed)
+		assert.Zero(decisions[2].Remaining)
+		assert.False(decisions[3].Allowed)
+		assert.Equal(3, decisions[3].Limit)
+		assert.Equal(20*time.Second, decisions[3].RetryAfter)
+		assert.Equal(time.Minute, decisions[3].Reset)
+	})
+
+	test.Run("Should refill the requests along the period", func(test *testing.T) {
+		// Arrange
+		limiter := NewLimiter(3, time.Minute)
+		for index := 0; index < 3; index++ {
+			limiter.Take("client", now)
+		}
+
+		// Act
+		early := limiter.Take("client", now.Add(10*time.Second))
+		refilled := limiter.Take("client", now.Add(30*time.Second))
+
+		// Assert
+		assert.False(early.Allowed)
+		assert.Equal(10*time.Second, early.RetryAfter)
+		assert.True(refilled.Allowed)
+	})
+
+	test.Run("Should keep a bucket for each key", func(test *testing.T) {
+		// Arrange
+		limiter := NewLimiter(1, time.Minute)
+		limiter.Take("client", now)
+
+		// Act
+		same := limiter.Take("client", now)
+		other := limiter.Take("other", now)
+
+		// Assert
+		assert.False(same.Allowed)
+		assert.True(other.Allowed)
+	})
+
+	test.Run("Should forget the buckets already refilled", func(test *testing.T) {
+		// Arrange
+		limiter := NewLimiter(2, time.Minute)
+		limiter.Take("client", now)
+		limiter.Take("other", now.Add(time.Minute))
+
+		// Act
+		limiter.Take("another", now.Add(2*time.Minute))
+
+		// Assert
+		assert.NotContains(limiter.buckets, "client")
+		assert.Contains(limiter.buckets, "another")
+	})
+
+	test.Run("Should tell whether the limit is enabled", func(test *testing.T) {
+		assert.True(NewLimiter(1, time.Second).Enabled())
+		assert.False(NewLimiter(0, time.Second).Enabled())
+		assert.False(NewLimiter(1, 0).Enabled())
+		assert.False((*Limiter)(nil).Enabled())
+	})
+}
+
+func TestRateLimit(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	serve := func(server *gin.Engine, address string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodGet, "/", nil)
+		request.RemoteAddr = address + ":12345"
+		recorder := httptest.NewRecorder()
+		server.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	respond := func(context *gin.Context) {
+		context.String(http.StatusOK, "OK")
+	}
+
+	test.Run("Should describe the limit on the allowed requests", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		server.GET("/", RateLimit(NewLimiter(10, time.Minute), ClientAddress), respond)
+
+		// Act
+		recorder := serve(server, "10.0.0.1")
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal("10", recorder.Header().Get(RateLimitHeader))
+		assert.Equal("9", recorder.Header().Get(RateLimitRemainingHeader))
+		assert.Equal("6", recorder.Header().Get(RateLimitResetHeader))
+		assert.Equal("10;w=60", recorder.Header().Get(RateLimitPolicyHeader))
+		assert.Empty(recorder.Header().Get(RetryAfterHeader))
+	})
+
+	test.Run("Should reject the requests beyond the limit of the client address", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		server.GET("/", RateLimit(NewLimiter(1, time.Minute), ClientAddress), respond)
+		serve(server, "10.0.0.1")
+
+		// Act
+		rejected := serve(server, "10.0.0.1")
+		other := serve(server, "10.0.0.2")
+
+		// Assert
+		assert.Equal(http.StatusTooManyRequests, rejected.Code)
+		assert.Contains(rejected.Body.String(), `"code":"rate_limited"`)
+		assert.Contains(rejected.Body.String(), "try again in 60 seconds")
+		assert.Equal("60", rejected.Header().Get(RetryAfterHeader))
+		assert.Equal("0", rejected.Header().Get(RateLimitRemainingHeader))
+		assert.Equal(http.StatusOK, other.Code)
+	})
+
+	test.Run("Should report the most restrictive of the limits", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		server.GET("/",
+			RateLimit(NewLimiter(100, time.Minute), ClientAddress),
+			RateLimit(NewLimiter(5, time.Minute), ClientAddress),
+			RateLimit(NewLimiter(50, time.Minute), ClientAddress),
+			respond,
+		)
+
+		// Act
+		recorder := serve(server, "10.0.0.1")
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal("5", recorder.Header().Get(RateLimitHeader))
+		assert.Equal("4", recorder.Header().Get(RateLimitRemainingHeader))
+		assert.Equal("5;w=60", recorder.Header().Get(RateLimitPolicyHeader))
+	})
+
+	test.Run("Should limit the logged users regardless of their address", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		server.GET("/", func(context *gin.Context) {
+			context.Set("user", &models.User{ID: 12345})
+		}, RateLimit(NewLimiter(1, time.Minute), LoggedUser), respond)
+		serve(server, "10.0.0.1")
+
+		// Act
+		recorder := serve(server, "10.0.0.2")
+
+		// Assert
+		assert.Equal(http.StatusTooManyRequests, recorder.Code)
+	})
+
+	test.Run("Should NOT limit the requests when the limiter is disabled", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		server.GET("/", RateLimit(NewLimiter(0, time.Minute), ClientAddress), respond)
+		serve(server, "10.0.0.1")
+
+		// Act
+		recorder := serve(server, "10.0.0.1")
+
+		// Assert
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Empty(recorder.Header().Get(RateLimitHeader))
+	})
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TracerName string = "github.com/zatarain/note-vook"
+
+// Tracing starts a span for each request, continuing the trace given by the
+// W3C traceparent header of the client when it's present. The span is stored
+// within the request context so the database calls become its children.
+func Tracing(provider trace.TracerProvider, propagator propagation.TextMapPropagator) gin.HandlerFunc {
+	tracer := provider.Tracer(TracerName)
+	return func(context *gin.Context) {
+		request := context.Request
+		parent := propagator.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+		route := context.FullPath()
+		if route == "" {
+			route = UnmatchedRoute
+		}
+
+		current, span := tracer.Start(
+			parent,
+			fmt.Sprintf("%s %s", request.Method, route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(request.Method),
+				semconv.HTTPRoute(route),
+				// The query is left out, as it may carry secrets (e. g. tokens)
+				semconv.HTTPTarget(request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		context.Request = request.WithContext(current)
+		propagator.Inject(current, propagation.HeaderCarrier(context.Writer.Header()))
+		context.Next()
+
+		status := context.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+		if len(context.Errors) > 0 {
+			span.RecordError(context.Errors.Last())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	tracing "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	setup := func() (*gin.Engine, *tracetest.SpanRecorder) {
+		recorder := tracetest.NewSpanRecorder()
+		provider := tracing.NewTracerProvider(tracing.WithSpanProcessor(recorder))
+		server := gin.New()
+		server.Use(Tracing(provider, propagation.TraceContext{}))
+		return server, recorder
+	}
+
+	test.Run("Should continue the trace given by the traceparent header without the query", func(test *testing.T) {
+		// Arrange
+		server, spans := setup()
+		var current trace.SpanContext
+		server.GET("/videos/:id", func(context *gin.Context) {
+			current = trace.SpanContextFromContext(context.Request.Context())
+			context.Status(http.StatusOK)
+		})
+		request, _ := http.NewRequest(http.MethodGet, "/videos/7?token=secret", nil)
+		request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		recorder := httptest.NewRecorder()
+
+		// Act
+		server.ServeHTTP(recorder, request)
+
+		// Assert
+		ended := spans.Ended()
+		require.Len(ended, 1)
+		span := ended[0]
+		assert.Equal("GET /videos/:id", span.Name())
+		assert.Equal(trace.SpanKindServer, span.SpanKind())
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+		assert.Equal("00f067aa0ba902b7", span.Parent().SpanID().String())
+		assert.Equal(span.SpanContext().SpanID(), current.SpanID())
+		assert.Contains(span.Attributes(), attribute.Int("http.status_code", http.StatusOK))
+		assert.Contains(span.Attributes(), attribute.String("http.route", "/videos/:id"))
+		assert.Contains(span.Attributes(), attribute.String("http.target", "/videos/7"))
+		assert.Contains(recorder.Header().Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	})
+
+	test.Run("Should start a new trace and flag server errors", func(test *testing.T) {
+		// Arrange
+		server, spans := setup()
+		server.GET("/failure", func(context *gin.Context) {
+			context.Status(http.StatusInternalServerError)
+		})
+		request, _ := http.NewRequest(http.MethodGet, "/failure", nil)
+
+		// Act
+		server.ServeHTTP(httptest.NewRecorder(), request)
+
+		// Assert
+		ended := spans.Ended()
+		require.Len(ended, 1)
+		assert.False(ended[0].Parent().IsValid())
+		assert.Equal(codes.Error, ended[0].Status().Code)
+	})
+}
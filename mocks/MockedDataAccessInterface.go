@@ -3,6 +3,8 @@
 package mocks
 
 import (
+	sql "database/sql"
+
 	mock "github.com/stretchr/testify/mock"
 	gorm "gorm.io/gorm"
 )
@@ -60,6 +62,32 @@ func (_m *MockedDataAccessInterface) Create(_a0 interface{}) *gorm.DB {
 	return r0
 }
 
+// DB provides a mock function with given fields:
+func (_m *MockedDataAccessInterface) DB() (*sql.DB, error) {
+	ret := _m.Called()
+
+	var r0 *sql.DB
+	var r1 error
+	if rf, ok := ret.Get(0).(func() (*sql.DB, error)); ok {
+		return rf()
+	}
+	if rf, ok := ret.Get(0).(func() *sql.DB); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*sql.DB)
+		}
+	}
+
+	if rf, ok := ret.Get(1).(func() error); ok {
+		r1 = rf()
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: _a0, _a1
 func (_m *MockedDataAccessInterface) Delete(_a0 interface{}, _a1 ...interface{}) *gorm.DB {
 	var _ca []interface{}
@@ -136,6 +164,22 @@ func (_m *MockedDataAccessInterface) Joins(_a0 string, _a1 ...interface{}) *gorm
 	return r0
 }
 
+// Migrator provides a mock function with given fields:
+func (_m *MockedDataAccessInterface) Migrator() gorm.Migrator {
+	ret := _m.Called()
+
+	var r0 gorm.Migrator
+	if rf, ok := ret.Get(0).(func() gorm.Migrator); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(gorm.Migrator)
+		}
+	}
+
+	return r0
+}
+
 // Model provides a mock function with given fields: _a0
 func (_m *MockedDataAccessInterface) Model(_a0 interface{}) *gorm.DB {
 	ret := _m.Called(_a0)
@@ -206,6 +250,27 @@ func (_m *MockedDataAccessInterface) Select(_a0 interface{}, _a1 ...interface{})
 	return r0
 }
 
+// Transaction provides a mock function with given fields: _a0, _a1
+func (_m *MockedDataAccessInterface) Transaction(_a0 func(*gorm.DB) error, _a1 ...*sql.TxOptions) error {
+	_va := make([]interface{}, len(_a1))
+	for _i := range _a1 {
+		_va[_i] = _a1[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, _a0)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(func(*gorm.DB) error, ...*sql.TxOptions) error); ok {
+		r0 = rf(_a0, _a1...)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Updates provides a mock function with given fields: _a0
 func (_m *MockedDataAccessInterface) Updates(_a0 interface{}) *gorm.DB {
 	ret := _m.Called(_a0)
@@ -1,19 +1,26 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"database/sql"
+
+	"gorm.io/gorm"
+)
 
 type DataAccessInterface interface {
 	Association(string) *gorm.Association
 	AutoMigrate(...interface{}) error
 	Create(interface{}) *gorm.DB
+	DB() (*sql.DB, error)
 	Delete(interface{}, ...interface{}) *gorm.DB
 	First(interface{}, ...interface{}) *gorm.DB
 	Find(interface{}, ...interface{}) *gorm.DB
 	Joins(string, ...interface{}) *gorm.DB
+	Migrator() gorm.Migrator
 	Model(interface{}) *gorm.DB
 	Preload(string, ...interface{}) *gorm.DB
 	Scan(interface{}) *gorm.DB
 	Select(interface{}, ...interface{}) *gorm.DB
+	Transaction(func(*gorm.DB) error, ...*sql.TxOptions) error
 	Updates(interface{}) *gorm.DB
 	Where(interface{}, ...interface{}) *gorm.DB
 }
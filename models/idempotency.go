@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey keeps the response of a request sent with an idempotency key
+// until it expires, so the retries of the request get the same response
+// instead of repeating its effects. The keys are scoped by user, the ones of
+// anonymous requests have no user.
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primary_key"`
+	UserID      uint      `json:"user_id" gorm:"index:unq_user_key,unique"`
+	Key         string    `json:"key" gorm:"index:unq_user_key,unique"`
+	Fingerprint string    `json:"fingerprint"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index:idx_expiration"`
+}
+
+// Completed tells whether the response of the request is already kept, it's
+// not while the request is in progress.
+func (key *IdempotencyKey) Completed() bool {
+	return key.Status != 0
+}
+
+// Expired tells whether the key can be used again for another request.
+func (key *IdempotencyKey) Expired(now time.Time) bool {
+	return !now.Before(key.ExpiresAt)
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	JobPending   string = "pending"
+	JobRunning   string = "running"
+	JobSucceeded string = "succeeded"
+	JobFailed    string = "failed"
+	JobCancelled string = "cancelled"
+)
+
+// JobStatuses are all the statuses a job goes through.
+var JobStatuses = []string{JobPending, JobRunning, JobSucceeded, JobFailed, JobCancelled}
+
+// Job is a piece of background work. The pending ones run when they are due,
+// the failed attempts are retried later until there are no attempts left. The
+// recurring jobs keep their cron schedule, so the next one is enqueued once
+// they finish. The jobs queued on behalf of a user are deleted along with it,
+// the ones of the system have no user.
+type Job struct {
+	ID          uint            `json:"id" gorm:"primary_key"`
+	UserID      uint            `json:"user_id,omitempty" gorm:"index:idx_job_user"`
+	Kind        string          `json:"kind" gorm:"index:idx_job_kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status" gorm:"index:idx_job_due"`
+	RunAt       time.Time       `json:"run_at" gorm:"index:idx_job_due"`
+	Schedule    string          `json:"schedule,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	StartedAt   *time.Time      `json:"started_at"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Finished tells whether the job won't run again unless it's retried.
+func (job *Job) Finished() bool {
+	return job.Status == JobSucceeded || job.Status == JobFailed || job.Status == JobCancelled
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// RecoveryCode lets a user with two-factor authentication log in once without
+// the authenticator app, e. g. after losing the phone. Only the hash of the
+// code is kept, the user gets the code when it's generated.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primary_key"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	Hash      string     `json:"-" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// HashRecoveryCode is the hash kept for the code, regardless of its case and
+// separators. The codes are random enough to not need a slow hash.
+func HashRecoveryCode(code string) string {
+	normalised := strings.Map(func(character rune) rune {
+		if character == '-' || character == ' ' {
+			return -1
+		}
+		return character
+	}, strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalised))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// CheckSchema tells whether the database has all the tables and columns of
+// the given models, failing on the first one missing.
+func CheckSchema(migrator gorm.Migrator, entities []interface{}) error {
+	for _, model := range entities {
+		parsed, exception := schema.Parse(model, &sync.Map{}, schema.NamingStrategy{})
+		if exception != nil {
+			return exception
+		}
+
+		if !migrator.HasTable(model) {
+			return fmt.Errorf("missing table %s", parsed.Table)
+		}
+
+		for _, name := range parsed.DBNames {
+			if !migrator.HasColumn(model, name) {
+				return fmt.Errorf("missing column %s.%s", parsed.Table, name)
+			}
+		}
+	}
+	return nil
+}
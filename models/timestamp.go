@@ -28,19 +28,11 @@ func (timestamp *TimeStamp) UnmarshalJSON(bytes []byte) error {
 	case float64:
 		*timestamp = TimeStamp(value)
 	case string:
-		number, cannotConvert := strconv.ParseFloat(value, 64)
-		if cannotConvert == nil {
-			*timestamp = TimeStamp(number)
-			break
-		}
-
-		pattern := regexp.MustCompile(PATTERN)
-		output := pattern.ReplaceAllString(value, REPLACEMENT)
-		duration, exception := time.ParseDuration(output)
+		parsed, exception := ParseTimeStamp(value)
 		if exception != nil {
 			return exception
 		}
-		*timestamp = TimeStamp(duration / time.Second)
+		*timestamp = parsed
 	default:
 		return fmt.Errorf("invalid time stamp: %#v", unmarshalledJson)
 	}
@@ -49,7 +41,29 @@ func (timestamp *TimeStamp) UnmarshalJSON(bytes []byte) error {
 }
 
 func (timestamp *TimeStamp) MarshalJSON() ([]byte, error) {
-	value := int64(*timestamp)
+	return []byte(fmt.Sprintf(`"%v"`, timestamp.Clock())), nil
+}
+
+// ParseTimeStamp reads a time stamp written as a number of seconds, as a
+// clock (e. g. 01:30:00 or 90:00) or as a Go duration (e. g. 1h30m).
+func ParseTimeStamp(value string) (TimeStamp, error) {
+	number, cannotConvert := strconv.ParseFloat(value, 64)
+	if cannotConvert == nil {
+		return TimeStamp(number), nil
+	}
+
+	pattern := regexp.MustCompile(PATTERN)
+	output := pattern.ReplaceAllString(value, REPLACEMENT)
+	duration, exception := time.ParseDuration(output)
+	if exception != nil {
+		return 0, exception
+	}
+	return TimeStamp(duration / time.Second), nil
+}
+
+// Clock writes the time stamp as hours, minutes and seconds, e. g. 01:30:00.
+func (timestamp TimeStamp) Clock() string {
+	value := int64(timestamp)
 	duration := time.Duration(value) * time.Second
 	zero, _ := time.Parse(time.TimeOnly, ZERO)
 	output := zero.Add(duration).Format(time.TimeOnly)
@@ -57,5 +71,5 @@ func (timestamp *TimeStamp) MarshalJSON() ([]byte, error) {
 		hours := int64(duration / time.Hour)
 		output = regexp.MustCompile("^([0-9]{2})").ReplaceAllString(output, fmt.Sprintf("%d", hours))
 	}
-	return []byte(fmt.Sprintf(`"%v"`, output)), nil
+	return output
 }
@@ -150,3 +150,35 @@ func TestMarshalJSON(test *testing.T) {
 		})
 	}
 }
+
+func TestParseTimeStamp(test *testing.T) {
+	assert := assert.New(test)
+	testcases := []struct {
+		Input    string
+		Expected TimeStamp
+	}{
+		{Input: "90", Expected: 90},
+		{Input: "01:30", Expected: 90},
+		{Input: "00:01:30", Expected: 90},
+		{Input: "1m30s", Expected: 90},
+	}
+	for _, testcase := range testcases {
+		test.Run(fmt.Sprintf("Should parse '%s' as %d seconds", testcase.Input, testcase.Expected), func(test *testing.T) {
+			// Act
+			actual, exception := ParseTimeStamp(testcase.Input)
+
+			// Assert
+			assert.Nil(exception)
+			assert.Equal(testcase.Expected, actual)
+			assert.Equal("00:01:30", actual.Clock())
+		})
+	}
+
+	test.Run("Should fail to parse an unknown format", func(test *testing.T) {
+		// Act
+		_, exception := ParseTimeStamp("a minute")
+
+		// Assert
+		assert.NotNil(exception)
+	})
+}
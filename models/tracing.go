@@ -0,0 +1,79 @@
+package models
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// TracingPlugin is a GORM plugin that wraps each database operation within a
+// span, child of the span found in the statement context (if any).
+type TracingPlugin struct {
+	Provider trace.TracerProvider
+	tracer   trace.Tracer
+}
+
+func (plugin *TracingPlugin) Name() string {
+	return "tracing"
+}
+
+func (plugin *TracingPlugin) Initialize(database *gorm.DB) error {
+	plugin.tracer = plugin.Provider.Tracer("gorm.io/gorm")
+	callbacks := database.Callback()
+	operations := []struct {
+		Name   string
+		Before func(string, func(*gorm.DB)) error
+		After  func(string, func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{"query", callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{"update", callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{"delete", callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{"row", callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{"raw", callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+
+	for _, operation := range operations {
+		if exception := operation.Before("tracing:before_"+operation.Name, plugin.start(operation.Name)); exception != nil {
+			return exception
+		}
+		if exception := operation.After("tracing:after_"+operation.Name, plugin.end); exception != nil {
+			return exception
+		}
+	}
+	return nil
+}
+
+func (plugin *TracingPlugin) start(operation string) func(*gorm.DB) {
+	return func(database *gorm.DB) {
+		context, _ := plugin.tracer.Start(
+			database.Statement.Context,
+			"gorm."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemSqlite),
+		)
+		database.InstanceSet("tracing:parent", database.Statement.Context)
+		database.Statement.Context = context
+	}
+}
+
+func (plugin *TracingPlugin) end(database *gorm.DB) {
+	span := trace.SpanFromContext(database.Statement.Context)
+	defer span.End()
+	if parent, ok := database.InstanceGet("tracing:parent"); ok {
+		database.Statement.Context = parent.(context.Context)
+	}
+
+	span.SetAttributes(
+		semconv.DBStatement(database.Statement.SQL.String()),
+		semconv.DBSQLTable(database.Statement.Table),
+	)
+	if database.Error != nil && !errors.Is(database.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(database.Error)
+		span.SetStatus(codes.Error, database.Error.Error())
+	}
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	tracing "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTracingPlugin(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	// Arrange
+	spans := tracetest.NewSpanRecorder()
+	provider := tracing.NewTracerProvider(tracing.WithSpanProcessor(spans))
+	database, exception := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.Nil(exception)
+	require.Nil(database.AutoMigrate(&User{}))
+	require.Nil(database.Use(&TracingPlugin{Provider: provider}))
+
+	test.Run("Should trace database operations as children of the request span", func(test *testing.T) {
+		// Arrange
+		request, parent := provider.Tracer("test").Start(context.Background(), "request")
+
+		// Act
+		database.WithContext(request).Create(&User{Nickname: "traced"})
+		database.WithContext(request).First(&User{}, "nickname = ?", "traced")
+		parent.End()
+
+		// Assert
+		ended := spans.Ended()
+		require.Len(ended, 3)
+		assert.Equal("gorm.create", ended[0].Name())
+		assert.Equal("gorm.query", ended[1].Name())
+		for _, span := range ended[:2] {
+			assert.Equal(parent.SpanContext().SpanID(), span.Parent().SpanID())
+			assert.Contains(span.Attributes(), attribute.String("db.system", "sqlite"))
+			assert.Contains(span.Attributes(), attribute.String("db.sql.table", "users"))
+		}
+		assert.Contains(ended[1].Attributes(), attribute.String(
+			"db.statement",
+			"SELECT * FROM `users` WHERE nickname = ? ORDER BY `users`.`id` LIMIT 1",
+		))
+	})
+
+	test.Run("Should record the errors of the database operations", func(test *testing.T) {
+		// Act
+		database.Exec("SELECT * FROM missing")
+
+		// Assert
+		ended := spans.Ended()
+		span := ended[len(ended)-1]
+		assert.Equal("gorm.raw", span.Name())
+		assert.Equal(codes.Error, span.Status().Code)
+		assert.Contains(span.Status().Description, "no such table")
+	})
+}
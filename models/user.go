@@ -3,14 +3,83 @@ package models
 import (
 	"fmt"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// The roles of the users, the single sign-on maps the claims of the identity
+// provider to them.
+const (
+	RoleUser  string = "user"
+	RoleAdmin string = "admin"
 )
 
+// Roles lists the known roles from the least to the most privileged.
+var Roles = []string{RoleUser, RoleAdmin}
+
 type User struct {
 	ID        uint      `json:"id" gorm:"primary_key"`
 	Nickname  string    `json:"nickname" gorm:"unique"`
 	Password  string    `json:"password"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// DisabledAt is set by the administrators to stop the user from logging in
+	DisabledAt *time.Time `json:"disabled_at"`
+
+	// FailedLogins counts the failed logins in a row, each of them locks the
+	// login for longer until LockedUntil
+	FailedLogins int        `json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+
+	// TokenVersion is increased to reject all the tokens issued before, e. g.
+	// when the password changes
+	TokenVersion uint `json:"-"`
+
+	// TOTPSecret is the secret of the authenticator app of the user, whose codes
+	// are asked on login since TwoFactorEnabledAt. TOTPStep is the step of the
+	// last code used, so each code is accepted only once
+	TOTPSecret         string     `json:"-"`
+	TOTPStep           int64      `json:"-"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+
+	// Role is what the user is allowed to do, updated from the claims of the
+	// identity provider on each single sign-on
+	Role string `json:"role" gorm:"not null;default:user"`
+
+	// OIDCIssuer and OIDCSubject identify the user on the identity provider
+	// since the first single sign-on or since the account was linked
+	OIDCIssuer  string  `json:"-" gorm:"column:oidc_issuer;uniqueIndex:idx_users_oidc"`
+	OIDCSubject *string `json:"-" gorm:"column:oidc_subject;uniqueIndex:idx_users_oidc"`
+
+	// ReauthenticatedAt is when the user logged in again with the identity
+	// provider to confirm an operation, as the provisioned users have no
+	// password to confirm it with. It's used up by the operation
+	ReauthenticatedAt *time.Time `json:"-"`
+
+	// Associations
+	Videos []Video `json:"videos,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+func (user *User) Disabled() bool {
+	return user.DisabledAt != nil
+}
+
+// TwoFactor tells whether the user has to send a code of the authenticator
+// app to log in.
+func (user *User) TwoFactor() bool {
+	return user.TwoFactorEnabledAt != nil && user.TOTPSecret != ""
+}
+
+// Linked tells whether the user logs in with the identity provider.
+func (user *User) Linked() bool {
+	return user.OIDCSubject != nil
+}
+
+// Locked tells whether the user has to wait to log in again after too many
+// failed logins.
+func (user *User) Locked(now time.Time) bool {
+	return user.LockedUntil != nil && now.Before(*user.LockedUntil)
 }
 
 func (user *User) String() string {
@@ -22,3 +91,56 @@ func (user *User) String() string {
 		user.UpdatedAt.Format(time.RFC1123),
 	)
 }
+
+// Delete removes the user along with its videos, their annotations, its
+// webhooks with their deliveries, its recovery codes, the responses kept for
+// its idempotency keys and its jobs, telling how many videos and annotations
+// were deleted. It's meant to run within a transaction, so nothing is deleted
+// on failure.
+func (user *User) Delete(transaction *gorm.DB) (videos int64, annotations int64, exception error) {
+	owned := transaction.Model(&Video{}).Select("id").Where("user_id = ?", user.ID)
+	deleting := transaction.Where("video_id IN (?)", owned).Delete(&Annotation{})
+	if deleting.Error != nil {
+		return 0, 0, deleting.Error
+	}
+	annotations = deleting.RowsAffected
+
+	deleting = transaction.Where("user_id = ?", user.ID).Delete(&Video{})
+	if deleting.Error != nil {
+		return 0, 0, deleting.Error
+	}
+	videos = deleting.RowsAffected
+
+	hooks := transaction.Model(&Webhook{}).Select("id").Where("user_id = ?", user.ID)
+	if exception := transaction.Where("webhook_id IN (?)", hooks).Delete(&WebhookDelivery{}).Error; exception != nil {
+		return 0, 0, exception
+	}
+	if exception := transaction.Where("user_id = ?", user.ID).Delete(&Webhook{}).Error; exception != nil {
+		return 0, 0, exception
+	}
+
+	if exception := transaction.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error; exception != nil {
+		return 0, 0, exception
+	}
+	if exception := transaction.Where("user_id = ?", user.ID).Delete(&IdempotencyKey{}).Error; exception != nil {
+		return 0, 0, exception
+	}
+	// The running jobs finish on their own
+	if exception := transaction.Where("user_id = ? AND status <> ?", user.ID, JobRunning).Delete(&Job{}).Error; exception != nil {
+		return 0, 0, exception
+	}
+
+	return videos, annotations, transaction.Delete(user).Error
+}
+
+// DisableTwoFactor forgets the secret and the recovery codes of the user, so
+// only the password is asked on login. It's meant to run within a transaction.
+func (user *User) DisableTwoFactor(transaction *gorm.DB) error {
+	disabling := transaction.Model(&User{}).
+		Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"totp_secret": "", "totp_step": 0, "two_factor_enabled_at": nil}).Error
+	if disabling != nil {
+		return disabling
+	}
+	return transaction.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+}
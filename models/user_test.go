@@ -32,3 +32,58 @@ func TestString(test *testing.T) {
 	// Assert
 	assert.Equal(expected, actual)
 }
+
+func TestDisabled(test *testing.T) {
+	assert := assert.New(test)
+	now := time.Now()
+
+	test.Run("Should tell a user is disabled when it has a disabling date", func(test *testing.T) {
+		assert.True((&User{DisabledAt: &now}).Disabled())
+	})
+
+	test.Run("Should tell a user is enabled without a disabling date", func(test *testing.T) {
+		assert.False((&User{}).Disabled())
+	})
+}
+
+func TestLocked(test *testing.T) {
+	assert := assert.New(test)
+	now := time.Now()
+	later := now.Add(time.Minute)
+
+	test.Run("Should tell a user is locked until the locking date", func(test *testing.T) {
+		assert.True((&User{LockedUntil: &later}).Locked(now))
+	})
+
+	test.Run("Should tell a user is unlocked after the locking date or without one", func(test *testing.T) {
+		assert.False((&User{LockedUntil: &now}).Locked(later))
+		assert.False((&User{}).Locked(now))
+	})
+}
+
+func TestTwoFactor(test *testing.T) {
+	assert := assert.New(test)
+	now := time.Now()
+
+	test.Run("Should tell the two-factor authentication is enabled once confirmed", func(test *testing.T) {
+		assert.True((&User{TOTPSecret: "SECRET", TwoFactorEnabledAt: &now}).TwoFactor())
+	})
+
+	test.Run("Should tell the two-factor authentication is disabled while not confirmed", func(test *testing.T) {
+		assert.False((&User{TOTPSecret: "SECRET"}).TwoFactor())
+		assert.False((&User{}).TwoFactor())
+	})
+}
+
+func TestLinked(test *testing.T) {
+	assert := assert.New(test)
+	subject := "subject"
+
+	test.Run("Should tell the user is linked to the identity provider", func(test *testing.T) {
+		assert.True((&User{OIDCIssuer: "https://sso.io", OIDCSubject: &subject}).Linked())
+	})
+
+	test.Run("Should tell the user is NOT linked without subject", func(test *testing.T) {
+		assert.False((&User{}).Linked())
+	})
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	DeliveryPending   string = "pending"
+	DeliveryDelivered string = "delivered"
+	DeliveryFailed    string = "failed"
+)
+
+// Webhook is a URL of a user notified of the chosen events. The secret signs
+// the deliveries, so it's only shown when the webhook is created or changes.
+type Webhook struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	UserID    uint      `json:"user_id" gorm:"index:idx_webhook_user"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events" gorm:"serializer:json"`
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Subscribed tells whether the webhook is notified of the given event type.
+func (webhook *Webhook) Subscribed(kind string) bool {
+	for _, event := range webhook.Events {
+		if event == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is an event to send to a webhook. The pending ones are the
+// outbox of the dispatcher, which retries them until they are delivered or
+// fail too many times, then they are kept as the delivery log.
+type WebhookDelivery struct {
+	ID             uint            `json:"id" gorm:"primary_key"`
+	WebhookID      uint            `json:"webhook_id" gorm:"index:idx_delivery_webhook"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status" gorm:"index:idx_delivery_due"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" gorm:"index:idx_delivery_due"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	RedeliveryOf   uint            `json:"redelivery_of,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+
+	// Associations
+	Webhook *Webhook `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
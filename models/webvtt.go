@@ -0,0 +1,50 @@
+package models
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const WebVTTContentType string = "text/vtt"
+
+// Cue writes the time stamp as a WebVTT cue timing, e. g. 01:30:00.000.
+func (timestamp TimeStamp) Cue() string {
+	return timestamp.Clock() + ".000"
+}
+
+// cueText keeps the text from ending the cue early, which happens on blank
+// lines, or from being read as a timing.
+func cueText(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, strings.ReplaceAll(line, "-->", "->"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// WriteWebVTT writes the annotations of the video as WebVTT cues sorted by
+// their start, identified by the annotation ID and with the title followed
+// by the notes as text.
+func (video *Video) WriteWebVTT(writer io.Writer) error {
+	annotations := append([]Annotation{}, video.Annotations...)
+	sort.SliceStable(annotations, func(i, j int) bool {
+		return annotations[i].Start < annotations[j].Start
+	})
+
+	buffer := bufio.NewWriter(writer)
+	header := "WEBVTT"
+	if title := cueText(strings.ReplaceAll(video.Title, "\n", " ")); title != "" {
+		header += " " + title
+	}
+	fmt.Fprintln(buffer, header)
+	for _, annotation := range annotations {
+		text := cueText(annotation.Title + "\n" + annotation.Notes)
+		fmt.Fprintf(buffer, "\n%d\n%s --> %s\n%s\n", annotation.ID, annotation.Start.Cue(), annotation.End.Cue(), text)
+	}
+	return buffer.Flush()
+}
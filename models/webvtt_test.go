@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteWebVTT(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should write the annotations as cues sorted by their start", func(test *testing.T) {
+		// Arrange
+		video := &Video{
+			Title: "Dummy video",
+			Annotations: []Annotation{
+				{ID: 7, Title: "Chorus", Start: 90, End: 3725},
+				{ID: 3, Title: "Intro", Notes: "First line\n\nSecond --> line\n", Start: 0, End: 15},
+			},
+		}
+		var output strings.Builder
+
+		// Act
+		exception := video.WriteWebVTT(&output)
+
+		// Assert
+		assert.Nil(exception)
+		assert.Equal(
+			"WEBVTT Dummy video\n"+
+				"\n3\n00:00:00.000 --> 00:00:15.000\nIntro\nFirst line\nSecond -> line\n"+
+				"\n7\n00:01:30.000 --> 01:02:05.000\nChorus\n",
+			output.String(),
+		)
+		assert.Equal(TimeStamp(90), video.Annotations[0].Start)
+	})
+
+	test.Run("Should write only the header when there are no annotations", func(test *testing.T) {
+		// Arrange
+		video := &Video{}
+		var output strings.Builder
+
+		// Act
+		exception := video.WriteWebVTT(&output)
+
+		// Assert
+		assert.Nil(exception)
+		assert.Equal("WEBVTT\n", output.String())
+	})
+}
@@ -0,0 +1,377 @@
+// Package oidc implements the OpenID Connect authorization code flow with PKCE
+// (RFC 7636) against an external identity provider. The provider is discovered
+// from its issuer and the ID tokens are verified with the keys it publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DiscoveryPath is where the providers describe themselves, under the issuer
+	DiscoveryPath string = "/.well-known/openid-configuration"
+
+	// ChallengeMethod is the only PKCE method used, the plain one is not secure
+	ChallengeMethod string = "S256"
+
+	// maximumResponse is the largest response read from the provider
+	maximumResponse int64 = 1 << 20
+)
+
+var (
+	// ErrNotConfigured tells the single sign-on is not configured
+	ErrNotConfigured = errors.New("the identity provider is not configured")
+
+	// ErrDenied tells the provider rejected the code or the ID token is not
+	// valid, unlike the failures to reach the provider
+	ErrDenied = errors.New("the identity provider denied the login")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery is the part of the provider metadata used by the flow.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the claims of a verified ID token.
+type Claims map[string]interface{}
+
+// String is the value of a string claim, empty when it's missing or it's not
+// a string.
+func (claims Claims) String(name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// Strings is the value of a claim that is either a string or a list of them,
+// e. g. the groups of the user.
+func (claims Claims) Strings(name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time is the value of a claim with a Unix time, e. g. auth_time, which is
+// false when it's missing or it's not a number.
+func (claims Claims) Time(name string) (time.Time, bool) {
+	value, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(value), 0), true
+}
+
+// Provider talks to the identity provider. The metadata and the keys are
+// fetched on first use and the keys again when a token is signed with an
+// unknown one, so the provider can rotate them. It's safe to use it from
+// several goroutines.
+type Provider struct {
+	Config     Config
+	HTTPClient *http.Client
+
+	mutex     sync.Mutex
+	discovery *Discovery
+	keys      map[string]*rsa.PublicKey
+}
+
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &Provider{Config: config, HTTPClient: client}
+}
+
+// Enabled tells whether the provider is configured.
+func (provider *Provider) Enabled() bool {
+	return provider != nil && provider.Config.Issuer != "" && provider.Config.ClientID != ""
+}
+
+// Discover fetches the metadata of the provider, unless it's already known.
+func (provider *Provider) Discover(current context.Context) (*Discovery, error) {
+	if !provider.Enabled() {
+		return nil, ErrNotConfigured
+	}
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	discovery := &Discovery{}
+	if exception := provider.get(current, provider.Config.Issuer+DiscoveryPath, discovery); exception != nil {
+		return nil, fmt.Errorf("failed to discover the provider: %w", exception)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != provider.Config.Issuer {
+		return nil, fmt.Errorf("the provider claims to be the issuer %q instead of %q", discovery.Issuer, provider.Config.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("the provider metadata lacks some end-points")
+	}
+	provider.discovery = discovery
+	return discovery, nil
+}
+
+// AuthCodeURL is the address of the provider where the user logs in, which
+// redirects back with a code along with the given state. The nonce is
+// included in the ID token and the verifier proves who started the flow. The
+// extra parameters are sent as well, e. g. prompt=login to log in again.
+func (provider *Provider) AuthCodeURL(current context.Context, state string, nonce string, verifier string, parameters url.Values) (string, error) {
+	discovery, exception := provider.Discover(current)
+	if exception != nil {
+		return "", exception
+	}
+
+	scopes := provider.Config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	query := url.Values{}
+	for name, values := range parameters {
+		query[name] = values
+	}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.Config.ClientID)
+	query.Set("redirect_uri", provider.Config.RedirectURL)
+	query.Set("scope", strings.Join(scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", Challenge(verifier))
+	query.Set("code_challenge_method", ChallengeMethod)
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the code given by the provider for the ID token, proving
+// with the verifier that the flow was started by the same client.
+func (provider *Provider) Exchange(current context.Context, code string, verifier string) (string, error) {
+	discovery, exception := provider.Discover(current)
+	if exception != nil {
+		return "", exception
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.Config.RedirectURL)
+	form.Set("client_id", provider.Config.ClientID)
+	form.Set("code_verifier", verifier)
+	request, exception := http.NewRequestWithContext(current, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if exception != nil {
+		return "", exception
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if provider.Config.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(provider.Config.ClientID), url.QueryEscape(provider.Config.ClientSecret))
+	}
+
+	response, exception := provider.HTTPClient.Do(request)
+	if exception != nil {
+		return "", fmt.Errorf("failed to exchange the code: %w", exception)
+	}
+	defer response.Body.Close()
+
+	var token struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	decoding := json.NewDecoder(io.LimitReader(response.Body, maximumResponse)).Decode(&token)
+	if response.StatusCode != http.StatusOK {
+		if token.Error != "" {
+			return "", fmt.Errorf("%w: %s %s", ErrDenied, token.Error, token.ErrorDescription)
+		}
+		if response.StatusCode < http.StatusInternalServerError {
+			return "", fmt.Errorf("%w: status %d", ErrDenied, response.StatusCode)
+		}
+		return "", fmt.Errorf("the provider failed to exchange the code with status %d", response.StatusCode)
+	}
+	if decoding != nil {
+		return "", fmt.Errorf("failed to decode the token response: %w", decoding)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("the provider didn't send an ID token")
+	}
+	return token.IDToken, nil
+}
+
+// Verify checks the ID token was signed by the provider for this client, it's
+// not expired and it has the nonce of the flow, returning its claims.
+func (provider *Provider) Verify(current context.Context, raw string, nonce string, now time.Time) (Claims, error) {
+	discovery, exception := provider.Discover(current)
+	if exception != nil {
+		return nil, exception
+	}
+
+	claims := jwt.MapClaims{}
+	var unavailable error
+	_, exception = jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		identifier, _ := token.Header["kid"].(string)
+		key, exception := provider.key(current, identifier)
+		if exception != nil && !errors.Is(exception, ErrDenied) {
+			unavailable = exception
+		}
+		return key, exception
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(provider.Config.ClientID),
+		jwt.WithTimeFunc(func() time.Time { return now }),
+		jwt.WithLeeway(time.Minute),
+	)
+	if unavailable != nil {
+		return nil, unavailable
+	}
+	if exception != nil {
+		return nil, fmt.Errorf("%w: invalid ID token: %w", ErrDenied, exception)
+	}
+
+	// The expiration is optional for the JWT, but not for the ID tokens
+	if expiration, _ := claims.GetExpirationTime(); expiration == nil {
+		return nil, fmt.Errorf("%w: invalid ID token: it doesn't expire", ErrDenied)
+	}
+	if value, _ := claims["nonce"].(string); value != nonce {
+		return nil, fmt.Errorf("%w: invalid ID token: the nonce doesn't match", ErrDenied)
+	}
+	if subject, _ := claims.GetSubject(); subject == "" {
+		return nil, fmt.Errorf("%w: invalid ID token: there is no subject", ErrDenied)
+	}
+	return Claims(claims), nil
+}
+
+// key finds the public key with the given identifier, fetching the keys again
+// when it's unknown.
+func (provider *Provider) key(current context.Context, identifier string) (*rsa.PublicKey, error) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if key, found := provider.lookup(identifier); found {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Type       string `json:"kty"`
+			Identifier string `json:"kid"`
+			Use        string `json:"use"`
+			Modulus    string `json:"n"`
+			Exponent   string `json:"e"`
+		} `json:"keys"`
+	}
+	if exception := provider.get(current, provider.discovery.JWKSURI, &set); exception != nil {
+		return nil, fmt.Errorf("failed to fetch the keys of the provider: %w", exception)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, item := range set.Keys {
+		if item.Type != "RSA" || (item.Use != "" && item.Use != "sig") {
+			continue
+		}
+		modulus, exception := base64.RawURLEncoding.DecodeString(item.Modulus)
+		if exception != nil {
+			continue
+		}
+		exponent, exception := base64.RawURLEncoding.DecodeString(item.Exponent)
+		if exception != nil {
+			continue
+		}
+		keys[item.Identifier] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(modulus),
+			E: int(new(big.Int).SetBytes(exponent).Int64()),
+		}
+	}
+	provider.keys = keys
+
+	if key, found := provider.lookup(identifier); found {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrDenied, identifier)
+}
+
+// lookup finds the key among the known ones, any of them is taken when the
+// token doesn't tell which one and the provider has only one.
+func (provider *Provider) lookup(identifier string) (*rsa.PublicKey, bool) {
+	if key, found := provider.keys[identifier]; found {
+		return key, true
+	}
+	if identifier == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// get decodes the JSON document at the given address.
+func (provider *Provider) get(current context.Context, address string, output interface{}) error {
+	request, exception := http.NewRequestWithContext(current, http.MethodGet, address, nil)
+	if exception != nil {
+		return exception
+	}
+	request.Header.Set("Accept", "application/json")
+	response, exception := provider.HTTPClient.Do(request)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", response.StatusCode, address)
+	}
+	return json.NewDecoder(io.LimitReader(response.Body, maximumResponse)).Decode(output)
+}
+
+// NewVerifier generates a random PKCE code verifier, the same way as the
+// states and nonces.
+func NewVerifier() (string, error) {
+	random := make([]byte, 32)
+	if _, exception := rand.Read(random); exception != nil {
+		return "", fmt.Errorf("unable to generate a random value: %w", exception)
+	}
+	return base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// Challenge is the PKCE code challenge of the verifier with the S256 method.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
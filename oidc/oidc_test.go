@@ -0,0 +1,96 @@
+package oidc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChallenge(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should match the example of the RFC 7636", func(test *testing.T) {
+		// Act
+		challenge := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+
+		// Assert
+		assert.Equal("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", challenge)
+	})
+
+	test.Run("Should generate different verifiers long enough", func(test *testing.T) {
+		// Act
+		first, exception := NewVerifier()
+		second, _ := NewVerifier()
+
+		// Assert
+		assert.Nil(exception)
+		assert.Len(first, 43)
+		assert.NotEqual(first, second)
+	})
+}
+
+func TestClaims(test *testing.T) {
+	assert := assert.New(test)
+	claims := Claims{
+		"preferred_username": "jane",
+		"groups":             []interface{}{"staff", 7, "admins"},
+		"role":               "admin",
+		"age":                42.0,
+	}
+
+	testcases := []struct {
+		Description string
+		Name        string
+		String      string
+		Strings     []string
+	}{
+		{"Should read a string claim", "preferred_username", "jane", []string{"jane"}},
+		{"Should read the strings of a list claim", "groups", "", []string{"staff", "admins"}},
+		{"Should read a single string as a list", "role", "admin", []string{"admin"}},
+		{"Should NOT read claims of other types", "age", "", nil},
+		{"Should NOT read missing claims", "email", "", nil},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			text := claims.String(testcase.Name)
+			values := claims.Strings(testcase.Name)
+
+			// Assert
+			assert.Equal(testcase.String, text)
+			assert.Equal(testcase.Strings, values)
+		})
+	}
+
+	test.Run("Should read a Unix time claim", func(test *testing.T) {
+		// Act
+		age, found := claims.Time("age")
+		_, missing := claims.Time("role")
+
+		// Assert
+		assert.True(found)
+		assert.Equal(time.Unix(42, 0), age)
+		assert.False(missing)
+	})
+}
+
+func TestProvider(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should NOT be enabled without issuer or client", func(test *testing.T) {
+		// Arrange
+		var missing *Provider
+		provider := NewProvider(Config{Issuer: "https://sso.io"}, nil)
+
+		// Act
+		_, exception := provider.Discover(context.Background())
+
+		// Assert
+		assert.False(missing.Enabled())
+		assert.False(provider.Enabled())
+		assert.ErrorIs(exception, ErrNotConfigured)
+	})
+}
@@ -0,0 +1,267 @@
+// Package oidctest implements a local identity provider to test the OpenID
+// Connect logins without a real one. It follows the authorization code flow
+// with PKCE, logging in right away whoever is set as the subject.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zatarain/note-vook/oidc"
+)
+
+// KeyID is the identifier of the signing key of the provider.
+const KeyID string = "oidctest"
+
+// grant is what the provider remembers of each code until it's exchanged.
+type grant struct {
+	ClientID    string
+	RedirectURI string
+	Challenge   string
+	Nonce       string
+	Subject     string
+	Claims      map[string]interface{}
+	AuthTime    time.Time
+}
+
+// Provider is the local identity provider, the subject and claims set when
+// the user goes through the authorization end-point are the ones included in
+// the ID token.
+type Provider struct {
+	Server       *httptest.Server
+	ClientID     string
+	ClientSecret string
+	Key          *rsa.PrivateKey
+
+	// IgnorePrompt keeps the session of the user even when the client asks
+	// to log in again, as some providers do
+	IgnorePrompt bool
+
+	mutex         sync.Mutex
+	subject       string
+	claims        map[string]interface{}
+	authenticated time.Time
+	codes         map[string]grant
+}
+
+// New starts a provider with a single client, which has to be closed.
+func New(clientID string, clientSecret string) *Provider {
+	key, exception := rsa.GenerateKey(rand.Reader, 2048)
+	if exception != nil {
+		panic(fmt.Sprintf("oidctest: unable to generate the signing key: %v", exception))
+	}
+
+	provider := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		codes:        map[string]grant{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(oidc.DiscoveryPath, provider.discovery)
+	mux.HandleFunc("/authorize", provider.authorize)
+	mux.HandleFunc("/token", provider.token)
+	mux.HandleFunc("/jwks", provider.jwks)
+	provider.Server = httptest.NewServer(mux)
+	return provider
+}
+
+// Issuer is the address identifying the provider.
+func (provider *Provider) Issuer() string {
+	return provider.Server.URL
+}
+
+func (provider *Provider) Close() {
+	provider.Server.Close()
+}
+
+// SetUser chooses who logs in next, along with the extra claims of its ID
+// token, e. g. preferred_username or groups. The session of the user on the
+// provider starts now, it's the auth_time of the tokens unless the client
+// asks with prompt=login to log in again.
+func (provider *Provider) SetUser(subject string, claims map[string]interface{}) {
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	provider.subject = subject
+	provider.claims = claims
+	provider.authenticated = time.Now()
+}
+
+// Authorize goes through the authorization end-point at the given address
+// like a browser would do and returns where the provider redirects back.
+func (provider *Provider) Authorize(address string) (string, error) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, exception := client.Get(address)
+	if exception != nil {
+		return "", exception
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusFound {
+		return "", fmt.Errorf("oidctest: the authorization failed with status %d", response.StatusCode)
+	}
+	return response.Header.Get("Location"), nil
+}
+
+// Sign creates an ID token signed by the provider with the given claims, so
+// the tests can craft invalid ones.
+func (provider *Provider) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+	return token.SignedString(provider.Key)
+}
+
+func (provider *Provider) discovery(writer http.ResponseWriter, request *http.Request) {
+	issuer := provider.Issuer()
+	respond(writer, http.StatusOK, oidc.Discovery{
+		Issuer:                issuer,
+		AuthorizationEndpoint: issuer + "/authorize",
+		TokenEndpoint:         issuer + "/token",
+		JWKSURI:               issuer + "/jwks",
+	})
+}
+
+func (provider *Provider) authorize(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+	redirect, exception := url.Parse(query.Get("redirect_uri"))
+	switch {
+	case exception != nil || !redirect.IsAbs():
+		http.Error(writer, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	case query.Get("client_id") != provider.ClientID:
+		http.Error(writer, "unknown client_id", http.StatusBadRequest)
+		return
+	case query.Get("response_type") != "code":
+		http.Error(writer, "unsupported response_type", http.StatusBadRequest)
+		return
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != oidc.ChallengeMethod:
+		http.Error(writer, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	provider.mutex.Lock()
+	if query.Get("prompt") == "login" && !provider.IgnorePrompt {
+		provider.authenticated = time.Now()
+	}
+	code := random()
+	provider.codes[code] = grant{
+		ClientID:    provider.ClientID,
+		RedirectURI: redirect.String(),
+		Challenge:   query.Get("code_challenge"),
+		Nonce:       query.Get("nonce"),
+		Subject:     provider.subject,
+		Claims:      provider.claims,
+		AuthTime:    provider.authenticated,
+	}
+	provider.mutex.Unlock()
+
+	parameters := redirect.Query()
+	parameters.Set("code", code)
+	parameters.Set("state", query.Get("state"))
+	redirect.RawQuery = parameters.Encode()
+	http.Redirect(writer, request, redirect.String(), http.StatusFound)
+}
+
+func (provider *Provider) token(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	client, secret, _ := request.BasicAuth()
+	client, _ = url.QueryUnescape(client)
+	secret, _ = url.QueryUnescape(secret)
+	if client != provider.ClientID || secret != provider.ClientSecret {
+		refuse(writer, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if request.PostFormValue("grant_type") != "authorization_code" {
+		refuse(writer, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// The codes are single use, even when the exchange fails
+	provider.mutex.Lock()
+	code := request.PostFormValue("code")
+	grant, found := provider.codes[code]
+	delete(provider.codes, code)
+	provider.mutex.Unlock()
+	if !found || grant.RedirectURI != request.PostFormValue("redirect_uri") {
+		refuse(writer, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+	if oidc.Challenge(request.PostFormValue("code_verifier")) != grant.Challenge {
+		refuse(writer, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range grant.Claims {
+		claims[name] = value
+	}
+	claims["iss"] = provider.Issuer()
+	claims["sub"] = grant.Subject
+	claims["aud"] = grant.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Hour).Unix()
+	claims["nonce"] = grant.Nonce
+	claims["auth_time"] = grant.AuthTime.Unix()
+	token, exception := provider.Sign(claims)
+	if exception != nil {
+		refuse(writer, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writer.Header().Set("Cache-Control", "no-store")
+	respond(writer, http.StatusOK, map[string]interface{}{
+		"access_token": random(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     token,
+	})
+}
+
+func (provider *Provider) jwks(writer http.ResponseWriter, request *http.Request) {
+	public := provider.Key.PublicKey
+	respond(writer, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": KeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}},
+	})
+}
+
+func respond(writer http.ResponseWriter, status int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	json.NewEncoder(writer).Encode(body)
+}
+
+func refuse(writer http.ResponseWriter, status int, code string) {
+	respond(writer, status, map[string]string{"error": code})
+}
+
+func random() string {
+	value := make([]byte, 16)
+	if _, exception := rand.Read(value); exception != nil {
+		panic(errors.Join(errors.New("oidctest: unable to generate a random value"), exception))
+	}
+	return hex.EncodeToString(value)
+}
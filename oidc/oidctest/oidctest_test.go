@@ -0,0 +1,232 @@
+package oidctest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/oidc"
+)
+
+const callback string = "https://notevook.io/v1/login/oidc/callback"
+
+func TestProvider(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	identity := New("notevook", "client-secret")
+	defer identity.Close()
+	identity.SetUser("subject-1", map[string]interface{}{"preferred_username": "jane", "groups": []string{"staff"}})
+
+	// login goes through the flow as the API does, returning the redirection
+	// back with the code
+	login := func(provider *oidc.Provider, state string, nonce string, verifier string, parameters url.Values) url.Values {
+		address, exception := provider.AuthCodeURL(context.Background(), state, nonce, verifier, parameters)
+		require.Nil(exception)
+		location, exception := identity.Authorize(address)
+		require.Nil(exception)
+		redirect, exception := url.Parse(location)
+		require.Nil(exception)
+		return redirect.Query()
+	}
+
+	config := oidc.Config{
+		Issuer:       identity.Issuer(),
+		ClientID:     "notevook",
+		ClientSecret: "client-secret",
+		RedirectURL:  callback,
+		Scopes:       []string{"openid", "profile"},
+	}
+
+	test.Run("Should log in with the authorization code and PKCE", func(test *testing.T) {
+		// Arrange
+		provider := oidc.NewProvider(config, nil)
+		verifier, _ := oidc.NewVerifier()
+		query := login(provider, "state", "nonce", verifier, nil)
+
+		// Act
+		raw, exception := provider.Exchange(context.Background(), query.Get("code"), verifier)
+		require.Nil(exception)
+		claims, exception := provider.Verify(context.Background(), raw, "nonce", time.Now())
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal("state", query.Get("state"))
+		assert.Equal("subject-1", claims.String("sub"))
+		assert.Equal("jane", claims.String("preferred_username"))
+		assert.Equal([]string{"staff"}, claims.Strings("groups"))
+	})
+
+	reauthentication := []struct {
+		Description string
+		Parameters  url.Values
+		Ignore      bool
+		Fresh       bool
+	}{
+		{"Should keep the session of the user", nil, false, false},
+		{"Should log in again when the client asks for it", url.Values{"prompt": {"login"}}, false, true},
+		{"Should keep the session when ignoring the prompt", url.Values{"prompt": {"login"}}, true, false},
+	}
+
+	for _, testcase := range reauthentication {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			identity.SetUser("subject-1", nil)
+			identity.mutex.Lock()
+			identity.authenticated = time.Now().Add(-time.Hour)
+			identity.mutex.Unlock()
+			identity.IgnorePrompt = testcase.Ignore
+			defer func() { identity.IgnorePrompt = false }()
+			provider := oidc.NewProvider(config, nil)
+			verifier, _ := oidc.NewVerifier()
+			query := login(provider, "state", "nonce", verifier, testcase.Parameters)
+
+			// Act
+			raw, exception := provider.Exchange(context.Background(), query.Get("code"), verifier)
+			require.Nil(exception)
+			claims, exception := provider.Verify(context.Background(), raw, "nonce", time.Now())
+
+			// Assert
+			require.Nil(exception)
+			authenticated, found := claims.Time("auth_time")
+			require.True(found)
+			assert.Equal(testcase.Fresh, time.Since(authenticated) < time.Minute)
+		})
+	}
+
+	test.Run("Should NOT exchange the code without the right verifier", func(test *testing.T) {
+		// Arrange
+		provider := oidc.NewProvider(config, nil)
+		verifier, _ := oidc.NewVerifier()
+		query := login(provider, "state", "nonce", verifier, nil)
+
+		// Act
+		_, exception := provider.Exchange(context.Background(), query.Get("code"), "another-verifier")
+
+		// Assert
+		assert.ErrorIs(exception, oidc.ErrDenied)
+		assert.ErrorContains(exception, "invalid_grant")
+	})
+
+	test.Run("Should NOT exchange the same code twice", func(test *testing.T) {
+		// Arrange
+		provider := oidc.NewProvider(config, nil)
+		verifier, _ := oidc.NewVerifier()
+		query := login(provider, "state", "nonce", verifier, nil)
+		_, exception := provider.Exchange(context.Background(), query.Get("code"), verifier)
+		require.Nil(exception)
+
+		// Act
+		_, exception = provider.Exchange(context.Background(), query.Get("code"), verifier)
+
+		// Assert
+		assert.ErrorIs(exception, oidc.ErrDenied)
+		assert.ErrorContains(exception, "invalid_grant")
+	})
+
+	test.Run("Should NOT exchange the code with a wrong client secret", func(test *testing.T) {
+		// Arrange
+		wrong := config
+		wrong.ClientSecret = "guess"
+		provider := oidc.NewProvider(wrong, nil)
+		verifier, _ := oidc.NewVerifier()
+		query := login(provider, "state", "nonce", verifier, nil)
+
+		// Act
+		_, exception := provider.Exchange(context.Background(), query.Get("code"), verifier)
+
+		// Assert
+		assert.ErrorContains(exception, "invalid_client")
+	})
+
+	now := time.Now()
+	testcases := []struct {
+		Description string
+		Claims      jwt.MapClaims
+		Nonce       string
+		Expected    string
+	}{
+		{
+			"Should NOT verify a token with another nonce",
+			jwt.MapClaims{"iss": identity.Issuer(), "aud": "notevook", "sub": "subject-1", "exp": now.Add(time.Hour).Unix(), "nonce": "other"},
+			"nonce", "the nonce doesn't match",
+		},
+		{
+			"Should NOT verify a token for another client",
+			jwt.MapClaims{"iss": identity.Issuer(), "aud": "other", "sub": "subject-1", "exp": now.Add(time.Hour).Unix(), "nonce": "nonce"},
+			"nonce", "invalid ID token",
+		},
+		{
+			"Should NOT verify a token of another issuer",
+			jwt.MapClaims{"iss": "https://evil.io", "aud": "notevook", "sub": "subject-1", "exp": now.Add(time.Hour).Unix(), "nonce": "nonce"},
+			"nonce", "invalid ID token",
+		},
+		{
+			"Should NOT verify an expired token",
+			jwt.MapClaims{"iss": identity.Issuer(), "aud": "notevook", "sub": "subject-1", "exp": now.Add(-time.Hour).Unix(), "nonce": "nonce"},
+			"nonce", "token is expired",
+		},
+		{
+			"Should NOT verify a token without expiration",
+			jwt.MapClaims{"iss": identity.Issuer(), "aud": "notevook", "sub": "subject-1", "nonce": "nonce"},
+			"nonce", "it doesn't expire",
+		},
+		{
+			"Should NOT verify a token without subject",
+			jwt.MapClaims{"iss": identity.Issuer(), "aud": "notevook", "exp": now.Add(time.Hour).Unix(), "nonce": "nonce"},
+			"nonce", "there is no subject",
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			provider := oidc.NewProvider(config, nil)
+			raw, exception := identity.Sign(testcase.Claims)
+			require.Nil(exception)
+
+			// Act
+			_, exception = provider.Verify(context.Background(), raw, testcase.Nonce, now)
+
+			// Assert
+			assert.ErrorIs(exception, oidc.ErrDenied)
+			assert.ErrorContains(exception, testcase.Expected)
+		})
+	}
+
+	test.Run("Should NOT verify a token signed with another algorithm", func(test *testing.T) {
+		// Arrange
+		provider := oidc.NewProvider(config, nil)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": identity.Issuer(), "aud": "notevook", "sub": "subject-1", "exp": now.Add(time.Hour).Unix(), "nonce": "nonce",
+		})
+		raw, _ := token.SignedString([]byte("client-secret"))
+
+		// Act
+		_, exception := provider.Verify(context.Background(), raw, "nonce", now)
+
+		// Assert
+		assert.ErrorContains(exception, "signing method HS256 is invalid")
+	})
+
+	test.Run("Should NOT discover a provider claiming another issuer", func(test *testing.T) {
+		// Arrange
+		impostor := httptest.NewServer(http.HandlerFunc(identity.discovery))
+		defer impostor.Close()
+		wrong := config
+		wrong.Issuer = impostor.URL
+		provider := oidc.NewProvider(wrong, nil)
+
+		// Act
+		_, exception := provider.Discover(context.Background())
+
+		// Assert
+		assert.NotErrorIs(exception, oidc.ErrDenied)
+		assert.ErrorContains(exception, "claims to be the issuer")
+	})
+}
@@ -0,0 +1,36 @@
+package openapi
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+//go:embed initializer.js
+var initializer string
+
+var initializerTemplate = template.Must(template.New("initializer").Parse(initializer))
+
+// Specification serves the document as JSON.
+func (document *Document) Specification(context *gin.Context) {
+	context.JSON(http.StatusOK, document.T)
+}
+
+// Docs serves the Swagger UI embedded in the binary, loading the specification
+// from the given address. It must be routed with a wildcard named filepath,
+// e. g. /docs/*filepath.
+func Docs(specification string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		filepath := context.Param("filepath")
+		if strings.TrimPrefix(filepath, "/") == "swagger-initializer.js" {
+			context.Header("Content-Type", "application/javascript")
+			initializerTemplate.Execute(context.Writer, gin.H{"URL": specification})
+			return
+		}
+		context.FileFromFS(filepath, http.FS(swaggerFiles.FS))
+	}
+}
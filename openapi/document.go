@@ -0,0 +1,207 @@
+// Package openapi generates the OpenAPI 3 specification of the API from the
+// contracts of the controllers and serves it along with its documentation.
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/zatarain/note-vook/problems"
+)
+
+const (
+	Version           string = "3.0.3"
+	CookieAuthScheme  string = "cookieAuth"
+	BearerAuthScheme  string = "bearerAuth"
+	AuthorisationName string = "Authorisation"
+
+	// IdempotencyKeyName is the header of the idempotent operations
+	IdempotencyKeyName string = "Idempotency-Key"
+)
+
+var parameterPattern = regexp.MustCompile(`[:*](\w+)`)
+
+// Operation describes an end-point of the API, paths are in the Gin format
+// (e. g. /videos/:id) and the bodies are given by prototypes of their types.
+// The requests are JSON unless other content types are given by Consumes, the
+// query parameters are given by a prototype of the struct Gin binds them to and
+// the authorised operations require the cookie scheme unless another Scheme is
+// given. The idempotent operations accept the IdempotencyKeyName header.
+type Operation struct {
+	Method      string
+	Path        string
+	Tag         string
+	Summary     string
+	Description string
+	Query       interface{}
+	Request     interface{}
+	Consumes    []string
+	Status      int
+	Response    interface{}
+	ContentType string
+	Failures    []int
+
+	// Alternatives are the other successful JSON responses by their status
+	Alternatives map[int]interface{}
+	Authorised   bool
+	Scheme       string
+	Deprecated   bool
+	Idempotent   bool
+}
+
+// Document is the OpenAPI specification being built.
+type Document struct {
+	*openapi3.T
+	Schemas *Schemas
+}
+
+func NewDocument(title string, version string) *Document {
+	schemas := NewSchemas()
+	document := &Document{
+		T: &openapi3.T{
+			OpenAPI: Version,
+			Info:    &openapi3.Info{Title: title, Version: version},
+			Paths:   openapi3.Paths{},
+			Components: &openapi3.Components{
+				Schemas: schemas.Components,
+				SecuritySchemes: openapi3.SecuritySchemes{
+					CookieAuthScheme: &openapi3.SecuritySchemeRef{
+						Value: openapi3.NewSecurityScheme().
+							WithType("apiKey").
+							WithIn(openapi3.ParameterInCookie).
+							WithName(AuthorisationName).
+							WithDescription("JWT token set by the login end-point"),
+					},
+					BearerAuthScheme: &openapi3.SecuritySchemeRef{
+						Value: openapi3.NewSecurityScheme().
+							WithType("http").
+							WithScheme("bearer").
+							WithDescription("Admin token of the administration end-points"),
+					},
+				},
+			},
+		},
+		Schemas: schemas,
+	}
+	return document
+}
+
+// Path turns a Gin path into an OpenAPI one, e. g. /videos/:id into
+// /videos/{id}.
+func Path(path string) string {
+	return parameterPattern.ReplaceAllString(path, "{$1}")
+}
+
+// Add documents the operations, the failures are described as problem details.
+func (document *Document) Add(operations ...Operation) {
+	problem := document.Schemas.Of(problems.Problem{})
+	for _, operation := range operations {
+		specification := openapi3.NewOperation()
+		specification.Tags = []string{operation.Tag}
+		specification.Summary = operation.Summary
+		specification.Description = operation.Description
+		specification.OperationID = operationID(operation)
+		specification.Responses = openapi3.Responses{}
+		specification.Deprecated = operation.Deprecated
+
+		for _, match := range parameterPattern.FindAllStringSubmatch(operation.Path, -1) {
+			schema := openapi3.NewStringSchema()
+			if strings.HasSuffix(match[1], "id") {
+				schema = openapi3.NewIntegerSchema().WithMin(1)
+			}
+			specification.AddParameter(openapi3.NewPathParameter(match[1]).WithSchema(schema))
+		}
+
+		failures := append([]int{}, operation.Failures...)
+		if operation.Idempotent {
+			header := openapi3.NewHeaderParameter(IdempotencyKeyName).
+				WithDescription("Unique key of the request, its retries with the same key get the first response").
+				WithSchema(openapi3.NewStringSchema().WithMinLength(1).WithMaxLength(255))
+			specification.AddParameter(header)
+			failures = append(failures, http.StatusConflict, http.StatusUnprocessableEntity)
+		}
+
+		if operation.Query != nil {
+			for _, parameter := range document.Schemas.Query(operation.Query) {
+				specification.AddParameter(parameter)
+			}
+		}
+
+		if operation.Request != nil {
+			consumes := operation.Consumes
+			if len(consumes) == 0 {
+				consumes = []string{"application/json"}
+			}
+			specification.RequestBody = &openapi3.RequestBodyRef{
+				Value: openapi3.NewRequestBody().
+					WithRequired(true).
+					WithContent(openapi3.NewContentWithSchemaRef(document.Schemas.Of(operation.Request), consumes)),
+			}
+		}
+
+		success := openapi3.NewResponse().WithDescription(http.StatusText(operation.Status))
+		if operation.Response != nil {
+			contentType := operation.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			success.WithContent(openapi3.NewContentWithSchemaRef(
+				document.Schemas.Of(operation.Response),
+				[]string{contentType},
+			))
+		}
+		specification.AddResponse(operation.Status, success)
+		for status, response := range operation.Alternatives {
+			alternative := openapi3.NewResponse().
+				WithDescription(http.StatusText(status)).
+				WithContent(openapi3.NewContentWithJSONSchemaRef(document.Schemas.Of(response)))
+			specification.AddResponse(status, alternative)
+		}
+
+		if operation.Authorised {
+			failures = append(failures, http.StatusUnauthorized)
+			scheme := operation.Scheme
+			if scheme == "" {
+				scheme = CookieAuthScheme
+			}
+			requirement := openapi3.NewSecurityRequirement().Authenticate(scheme)
+			specification.Security = openapi3.NewSecurityRequirements().With(requirement)
+		}
+		failures = append(failures, http.StatusInternalServerError)
+		for _, status := range failures {
+			failure := openapi3.NewResponse().
+				WithDescription(http.StatusText(status)).
+				WithContent(openapi3.NewContentWithSchemaRef(problem, []string{problems.ContentType}))
+			specification.AddResponse(status, failure)
+		}
+
+		document.AddOperation(Path(operation.Path), operation.Method, specification)
+	}
+}
+
+// Operations lists the method and path of all the documented operations, e. g.
+// "GET /videos/{id}".
+func (document *Document) Operations() []string {
+	operations := []string{}
+	for path, item := range document.Paths {
+		for method := range item.Operations() {
+			operations = append(operations, method+" "+path)
+		}
+	}
+	sort.Strings(operations)
+	return operations
+}
+
+func operationID(operation Operation) string {
+	words := strings.FieldsFunc(Path(operation.Path), func(character rune) bool {
+		return character == '/' || character == '{' || character == '}'
+	})
+	identifier := strings.ToLower(operation.Method)
+	for _, word := range words {
+		identifier += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return identifier
+}
@@ -0,0 +1,149 @@
+package openapi
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zatarain/note-vook/problems"
+)
+
+type contract struct {
+	Title string `json:"title" binding:"required"`
+}
+
+func TestPath(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should turn the Gin parameters into OpenAPI ones", func(test *testing.T) {
+		assert.Equal("/videos/{id}/annotations/{annotation}", Path("/videos/:id/annotations/:annotation"))
+		assert.Equal("/docs/{filepath}", Path("/docs/*filepath"))
+		assert.Equal("/videos", Path("/videos"))
+	})
+}
+
+func TestDocumentAdd(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should document the operation with its parameters, bodies, problems and security", func(test *testing.T) {
+		// Arrange
+		document := NewDocument("Dummy", "0.0.1")
+
+		// Act
+		document.Add(Operation{
+			Method:     http.MethodPatch,
+			Path:       "/things/:id",
+			Tag:        "things",
+			Summary:    "Edit a thing",
+			Request:    contract{},
+			Status:     http.StatusOK,
+			Response:   contract{},
+			Failures:   []int{http.StatusNotFound},
+			Authorised: true,
+		})
+
+		// Assert
+		assert.Nil(document.Validate(context.Background()))
+		assert.Equal([]string{"PATCH /things/{id}"}, document.Operations())
+		operation := document.Paths.Find("/things/{id}").Patch
+		assert.Equal("patchThingsId", operation.OperationID)
+		assert.Equal("integer", operation.Parameters.GetByInAndName("path", "id").Schema.Value.Type)
+		assert.Equal(ComponentsPrefix+"contract", operation.RequestBody.Value.Content.Get("application/json").Schema.Ref)
+		assert.Equal(ComponentsPrefix+"contract", operation.Responses.Get(http.StatusOK).Value.Content.Get("application/json").Schema.Ref)
+		for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized, http.StatusInternalServerError} {
+			content := operation.Responses.Get(status).Value.Content
+			assert.Equal(ComponentsPrefix+"Problem", content.Get(problems.ContentType).Schema.Ref, status)
+		}
+		assert.Contains((*operation.Security)[0], CookieAuthScheme)
+	})
+
+	test.Run("Should accept the given content types for the request", func(test *testing.T) {
+		// Arrange
+		document := NewDocument("Dummy", "0.0.1")
+
+		// Act
+		document.Add(Operation{
+			Method:   http.MethodPost,
+			Path:     "/things",
+			Tag:      "things",
+			Request:  contract{},
+			Consumes: []string{"application/jsonl", "text/csv"},
+			Status:   http.StatusOK,
+		})
+
+		// Assert
+		assert.Nil(document.Validate(context.Background()))
+		content := document.Paths.Find("/things").Post.RequestBody.Value.Content
+		assert.Len(content, 2)
+		assert.Equal(ComponentsPrefix+"contract", content.Get("text/csv").Schema.Ref)
+		assert.Nil(content.Get("application/json"))
+	})
+
+	test.Run("Should require the given security scheme", func(test *testing.T) {
+		// Arrange
+		document := NewDocument("Dummy", "0.0.1")
+
+		// Act
+		document.Add(Operation{
+			Method:     http.MethodPost,
+			Path:       "/admin/things",
+			Tag:        "admin",
+			Status:     http.StatusNoContent,
+			Authorised: true,
+			Scheme:     BearerAuthScheme,
+		})
+
+		// Assert
+		assert.Nil(document.Validate(context.Background()))
+		operation := document.Paths.Find("/admin/things").Post
+		assert.Contains((*operation.Security)[0], BearerAuthScheme)
+		assert.NotContains((*operation.Security)[0], CookieAuthScheme)
+	})
+
+	test.Run("Should accept an idempotency key on the idempotent operations", func(test *testing.T) {
+		// Arrange
+		document := NewDocument("Dummy", "0.0.1")
+
+		// Act
+		document.Add(Operation{
+			Method:     http.MethodPost,
+			Path:       "/things",
+			Tag:        "things",
+			Status:     http.StatusCreated,
+			Failures:   []int{http.StatusConflict},
+			Idempotent: true,
+		})
+
+		// Assert
+		assert.Nil(document.Validate(context.Background()))
+		operation := document.Paths.Find("/things").Post
+		header := operation.Parameters.GetByInAndName("header", IdempotencyKeyName)
+		if assert.NotNil(header) {
+			assert.Equal(uint64(255), *header.Schema.Value.MaxLength)
+		}
+		assert.NotNil(operation.Responses.Get(http.StatusConflict))
+		assert.NotNil(operation.Responses.Get(http.StatusUnprocessableEntity))
+	})
+
+	test.Run("Should document the alternative successful responses", func(test *testing.T) {
+		// Arrange
+		document := NewDocument("Dummy", "0.0.1")
+
+		// Act
+		document.Add(Operation{
+			Method:       http.MethodPost,
+			Path:         "/things",
+			Tag:          "things",
+			Status:       http.StatusOK,
+			Response:     contract{},
+			Alternatives: map[int]interface{}{http.StatusAccepted: contract{}},
+		})
+
+		// Assert
+		assert.Nil(document.Validate(context.Background()))
+		responses := document.Paths.Find("/things").Post.Responses
+		assert.Equal(ComponentsPrefix+"contract", responses.Get(http.StatusOK).Value.Content.Get("application/json").Schema.Ref)
+		assert.Equal(ComponentsPrefix+"contract", responses.Get(http.StatusAccepted).Value.Content.Get("application/json").Schema.Ref)
+	})
+}
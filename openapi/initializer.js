@@ -0,0 +1,16 @@
+window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "{{.URL}}",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    withCredentials: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
@@ -0,0 +1,171 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+const ComponentsPrefix string = "#/components/schemas/"
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	binaryType = reflect.TypeOf(Binary{})
+)
+
+// Binary is the prototype of the responses that are files instead of JSON,
+// e. g. a ZIP archive.
+type Binary []byte
+
+// Schemas generates the JSON schemas of the Go types following the same rules
+// as encoding/json and the binding tags of the validator. The named structs
+// are kept as components and referenced, so recursive types are supported.
+type Schemas struct {
+	Components openapi3.Schemas
+
+	// Custom schemas for the types with their own JSON (un)marshalling
+	Custom map[reflect.Type]*openapi3.Schema
+}
+
+func NewSchemas() *Schemas {
+	return &Schemas{
+		Components: openapi3.Schemas{},
+		Custom:     map[reflect.Type]*openapi3.Schema{},
+	}
+}
+
+// Of returns the schema for the type of the given value.
+func (schemas *Schemas) Of(value interface{}) *openapi3.SchemaRef {
+	return schemas.generate(reflect.TypeOf(value))
+}
+
+func (schemas *Schemas) reference(name string, generate func() *openapi3.Schema) *openapi3.SchemaRef {
+	component, exists := schemas.Components[name]
+	if !exists {
+		// Register the component before generating it, in case the type refers
+		// itself, then fill it in place so all the references share it
+		component = openapi3.NewSchemaRef("", &openapi3.Schema{})
+		schemas.Components[name] = component
+		*component.Value = *generate()
+	}
+	return openapi3.NewSchemaRef(ComponentsPrefix+name, component.Value)
+}
+
+func (schemas *Schemas) generate(kind reflect.Type) *openapi3.SchemaRef {
+	for kind.Kind() == reflect.Pointer {
+		kind = kind.Elem()
+	}
+
+	if kind == binaryType {
+		return openapi3.NewStringSchema().WithFormat("binary").NewRef()
+	}
+
+	if custom, exists := schemas.Custom[kind]; exists {
+		return schemas.reference(kind.Name(), func() *openapi3.Schema { return custom })
+	}
+
+	switch kind.Kind() {
+	case reflect.Bool:
+		return openapi3.NewBoolSchema().NewRef()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return openapi3.NewIntegerSchema().NewRef()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return openapi3.NewIntegerSchema().WithMin(0).NewRef()
+	case reflect.Float32, reflect.Float64:
+		return openapi3.NewFloat64Schema().NewRef()
+	case reflect.String:
+		return openapi3.NewStringSchema().NewRef()
+	case reflect.Slice, reflect.Array:
+		schema := openapi3.NewArraySchema()
+		schema.Items = schemas.generate(kind.Elem())
+		return schema.NewRef()
+	case reflect.Map:
+		schema := openapi3.NewObjectSchema()
+		schema.AdditionalProperties = openapi3.AdditionalProperties{Schema: schemas.generate(kind.Elem())}
+		return schema.NewRef()
+	case reflect.Struct:
+		if kind == timeType {
+			return openapi3.NewDateTimeSchema().NewRef()
+		}
+		if kind.Name() == "" {
+			return schemas.object(kind).NewRef()
+		}
+		return schemas.reference(kind.Name(), func() *openapi3.Schema { return schemas.object(kind) })
+	}
+
+	// Interfaces can hold any value
+	return openapi3.NewSchema().NewRef()
+}
+
+func (schemas *Schemas) object(kind reflect.Type) *openapi3.Schema {
+	schema := openapi3.NewObjectSchema()
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		// Embedded structs without name are flattened, as encoding/json does
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := schemas.object(field.Type)
+			schema.Required = append(schema.Required, embedded.Required...)
+			for property, reference := range embedded.Properties {
+				schema.WithPropertyRef(property, reference)
+			}
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := schemas.generate(field.Type)
+		rules := strings.Split(field.Tag.Get("binding"), ",")
+		for _, rule := range rules {
+			switch rule {
+			case "required":
+				schema.Required = append(schema.Required, name)
+			case "url", "http_url":
+				if property.Value != nil {
+					property.Value.Format = "uri"
+				}
+			}
+		}
+		schema.WithPropertyRef(name, property)
+	}
+	return schema
+}
+
+// Query returns the query parameters bound by Gin to the fields of the given
+// struct, which are named by their form tags.
+func (schemas *Schemas) Query(value interface{}) []*openapi3.Parameter {
+	kind := reflect.TypeOf(value)
+	parameters := []*openapi3.Parameter{}
+	for index := 0; index < kind.NumField(); index++ {
+		field := kind.Field(index)
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+
+		schema := schemas.generate(field.Type).Value
+		if field.Type == timeType && field.Tag.Get("time_format") == time.DateOnly {
+			schema = openapi3.NewStringSchema().WithFormat("date")
+		}
+		parameter := openapi3.NewQueryParameter(name).WithSchema(schema)
+		for _, rule := range strings.Split(field.Tag.Get("binding"), ",") {
+			rule, argument, _ := strings.Cut(rule, "=")
+			switch rule {
+			case "required":
+				parameter.Required = true
+			case "oneof":
+				for _, option := range strings.Fields(argument) {
+					schema.Enum = append(schema.Enum, option)
+				}
+			}
+		}
+		parameters = append(parameters, parameter)
+	}
+	return parameters
+}
@@ -0,0 +1,124 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+)
+
+type duration int64
+
+type node struct {
+	Name     string            `json:"name" binding:"required"`
+	Link     string            `json:"link" binding:"omitempty,url"`
+	Parent   *node             `json:"parent"`
+	Children []node            `json:"children"`
+	Labels   map[string]string `json:"labels"`
+	Length   duration          `json:"length"`
+	Created  time.Time         `json:"created_at"`
+	Hidden   string            `json:"-"`
+	Plain    uint
+	private  bool
+}
+
+func TestSchemas(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should generate named structs as components following the JSON tags", func(test *testing.T) {
+		// Arrange
+		schemas := NewSchemas()
+		schemas.Custom[reflect.TypeOf(duration(0))] = openapi3.NewStringSchema()
+
+		// Act
+		reference := schemas.Of(&node{})
+
+		// Assert
+		assert.Equal(ComponentsPrefix+"node", reference.Ref)
+		component := schemas.Components["node"].Value
+		assert.Equal([]string{"name"}, component.Required)
+		assert.Equal("uri", component.Properties["link"].Value.Format)
+		assert.Equal(ComponentsPrefix+"node", component.Properties["parent"].Ref)
+		assert.Equal(ComponentsPrefix+"node", component.Properties["children"].Value.Items.Ref)
+		assert.Equal("string", component.Properties["labels"].Value.AdditionalProperties.Schema.Value.Type)
+		assert.Equal(ComponentsPrefix+"duration", component.Properties["length"].Ref)
+		assert.Equal("date-time", component.Properties["created_at"].Value.Format)
+		assert.Equal("integer", component.Properties["Plain"].Value.Type)
+		assert.NotContains(component.Properties, "Hidden")
+		assert.NotContains(component.Properties, "private")
+		assert.Equal("string", schemas.Components["duration"].Value.Type)
+	})
+
+	test.Run("Should generate anonymous and basic types in place", func(test *testing.T) {
+		// Arrange
+		schemas := NewSchemas()
+
+		// Act
+		list := schemas.Of([]struct {
+			Count int `json:"count"`
+		}{})
+
+		// Assert
+		assert.Empty(list.Ref)
+		assert.Equal("array", list.Value.Type)
+		assert.Equal("integer", list.Value.Items.Value.Properties["count"].Value.Type)
+		assert.Empty(schemas.Components)
+	})
+
+	test.Run("Should flatten the embedded structs", func(test *testing.T) {
+		// Arrange
+		schemas := NewSchemas()
+
+		// Act
+		reference := schemas.Of(struct {
+			node
+			Extra string `json:"extra" binding:"required"`
+		}{})
+
+		// Assert
+		assert.ElementsMatch([]string{"name", "extra"}, reference.Value.Required)
+		assert.Contains(reference.Value.Properties, "link")
+		assert.Contains(reference.Value.Properties, "extra")
+		assert.NotContains(reference.Value.Properties, "node")
+	})
+
+	test.Run("Should describe the files as binary strings", func(test *testing.T) {
+		// Arrange
+		schemas := NewSchemas()
+
+		// Act
+		file := schemas.Of(Binary{})
+
+		// Assert
+		assert.Empty(file.Ref)
+		assert.Equal("string", file.Value.Type)
+		assert.Equal("binary", file.Value.Format)
+	})
+
+	test.Run("Should describe the query parameters by their form tags", func(test *testing.T) {
+		// Arrange
+		schemas := NewSchemas()
+		query := struct {
+			Format string    `form:"format" binding:"omitempty,oneof=csv jsonl"`
+			IDs    []uint    `form:"id"`
+			Since  time.Time `form:"since" time_format:"2006-01-02"`
+			Page   int       `form:"page" binding:"required"`
+			Plain  string
+		}{}
+
+		// Act
+		parameters := schemas.Query(query)
+
+		// Assert
+		assert.Len(parameters, 4)
+		assert.Equal("query", parameters[0].In)
+		assert.Equal([]interface{}{"csv", "jsonl"}, parameters[0].Schema.Value.Enum)
+		assert.Equal("array", parameters[1].Schema.Value.Type)
+		assert.Equal("integer", parameters[1].Schema.Value.Items.Value.Type)
+		assert.Equal("date", parameters[2].Schema.Value.Format)
+		assert.True(parameters[3].Required)
+		assert.False(parameters[0].Required)
+	})
+}
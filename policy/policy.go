@@ -0,0 +1,178 @@
+// Package policy checks the nicknames and passwords chosen by the users
+// against the configured rules, telling apart each of the rules they break.
+package policy
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaximumPasswordBytes is the length of the passwords hashed by bcrypt, the
+// rest of them would be ignored.
+const MaximumPasswordBytes int = 72
+
+// The rules the nicknames and passwords may break.
+const (
+	RuleMinLength string = "min_length"
+	RuleMaxLength string = "max_length"
+	RuleCharset   string = "charset"
+	RuleReserved  string = "reserved"
+	RuleClasses   string = "character_classes"
+	RuleBreached  string = "breached"
+)
+
+//go:embed breached.txt
+var common string
+
+// Violation is a rule broken by a nickname or password.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Violations are all the rules broken by a nickname or password.
+type Violations []Violation
+
+func (violations Violations) Error() string {
+	messages := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// List is a set of words compared regardless of their case.
+type List map[string]struct{}
+
+// NewList creates a list with the given words.
+func NewList(words ...string) List {
+	list := List{}
+	for _, word := range words {
+		list.Add(word)
+	}
+	return list
+}
+
+// ReadList reads a word per line, skipping the empty ones and the comments
+// starting with #.
+func ReadList(reader io.Reader) (List, error) {
+	list := List{}
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			list.Add(line)
+		}
+	}
+	return list, scanner.Err()
+}
+
+// Common lists the most common passwords found on breaches.
+func Common() List {
+	list, _ := ReadList(strings.NewReader(common))
+	return list
+}
+
+func (list List) Add(word string) {
+	list[strings.ToLower(word)] = struct{}{}
+}
+
+func (list List) Contains(word string) bool {
+	_, found := list[strings.ToLower(word)]
+	return found
+}
+
+// Nickname are the rules of the nicknames, the zero value allows any of them.
+type Nickname struct {
+	MinLength int
+	MaxLength int
+
+	// Pattern matches the nicknames with the allowed characters
+	Pattern *regexp.Regexp
+
+	// Reserved are the nicknames nobody can take, e. g. admin
+	Reserved List
+}
+
+// Check tells all the rules broken by the nickname, if any.
+func (policy *Nickname) Check(nickname string) error {
+	var violations Violations
+	length := utf8.RuneCountInString(nickname)
+	if length < policy.MinLength {
+		violations = append(violations, Violation{RuleMinLength, fmt.Sprintf("must have at least %d characters", policy.MinLength)})
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		violations = append(violations, Violation{RuleMaxLength, fmt.Sprintf("must have at most %d characters", policy.MaxLength)})
+	}
+	if policy.Pattern != nil && !policy.Pattern.MatchString(nickname) {
+		violations = append(violations, Violation{RuleCharset, fmt.Sprintf("must match %s", policy.Pattern)})
+	}
+	if policy.Reserved.Contains(nickname) {
+		violations = append(violations, Violation{RuleReserved, "is reserved"})
+	}
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// Password are the rules of the passwords, the zero value only limits them to
+// the length bcrypt hashes.
+type Password struct {
+	MinLength int
+
+	// MinClasses is the number of classes among lowercase and uppercase
+	// letters, digits and symbols the passwords must have characters of
+	MinClasses int
+
+	// Breached are the passwords known by the attackers
+	Breached List
+}
+
+// Check tells all the rules broken by the password, if any.
+func (policy *Password) Check(password string) error {
+	var violations Violations
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		violations = append(violations, Violation{RuleMinLength, fmt.Sprintf("must have at least %d characters", policy.MinLength)})
+	}
+	if len(password) > MaximumPasswordBytes {
+		violations = append(violations, Violation{RuleMaxLength, fmt.Sprintf("must have at most %d bytes", MaximumPasswordBytes)})
+	}
+	if Classes(password) < policy.MinClasses {
+		violations = append(violations, Violation{RuleClasses, fmt.Sprintf(
+			"must have characters of at least %d classes among lowercase, uppercase, digits and symbols", policy.MinClasses,
+		)})
+	}
+	if policy.Breached.Contains(password) {
+		violations = append(violations, Violation{RuleBreached, "is too common, it's known from breaches"})
+	}
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+// Classes counts the classes of characters of the password among lowercase
+// and uppercase letters, digits and symbols (anything else).
+func Classes(password string) int {
+	var lower, upper, digit, symbol int
+	for _, character := range password {
+		switch {
+		case unicode.IsLower(character):
+			lower = 1
+		case unicode.IsUpper(character):
+			upper = 1
+		case unicode.IsDigit(character):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rules lists the rules broken as told by the check.
+func rules(exception error) []string {
+	var violations Violations
+	if !errors.As(exception, &violations) {
+		return nil
+	}
+	broken := []string{}
+	for _, violation := range violations {
+		broken = append(broken, violation.Rule)
+	}
+	return broken
+}
+
+func TestNickname(test *testing.T) {
+	assert := assert.New(test)
+	policy := Nickname{
+		MinLength: 3,
+		MaxLength: 12,
+		Pattern:   regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`),
+		Reserved:  NewList("admin", "root"),
+	}
+
+	testcases := []struct {
+		Description string
+		Nickname    string
+		Rules       []string
+	}{
+		{"Should accept a nickname following all the rules", "andres.z_1", nil},
+		{"Should NOT accept a short nickname", "ab", []string{RuleMinLength}},
+		{"Should NOT accept a long nickname", "a-very-long-nickname", []string{RuleMaxLength}},
+		{"Should NOT accept characters outside the charset", "andrés", []string{RuleCharset}},
+		{"Should NOT accept nicknames starting with a symbol", "-andres", []string{RuleCharset}},
+		{"Should NOT accept reserved nicknames regardless of their case", "Admin", []string{RuleReserved}},
+		{"Should tell all the rules broken", "#", []string{RuleMinLength, RuleCharset}},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			exception := policy.Check(testcase.Nickname)
+
+			// Assert
+			assert.Equal(testcase.Rules, rules(exception))
+		})
+	}
+
+	test.Run("Should accept any nickname with the zero value", func(test *testing.T) {
+		assert.Nil((&Nickname{}).Check("#"))
+	})
+}
+
+func TestPassword(test *testing.T) {
+	assert := assert.New(test)
+	policy := Password{MinLength: 10, MinClasses: 3, Breached: NewList("Password123!")}
+
+	testcases := []struct {
+		Description string
+		Password    string
+		Rules       []string
+	}{
+		{"Should accept a password following all the rules", "Sunset-Drive-1986", nil},
+		{"Should accept the characters of any language", "Contraseña-Ñandú", nil},
+		{"Should NOT accept a short password", "Sun-set-1", []string{RuleMinLength}},
+		{"Should NOT accept a password longer than bcrypt hashes", "Aa1-" + strings.Repeat("a", 69), []string{RuleMaxLength}},
+		{"Should NOT accept a password with too few classes of characters", "sunset-drive", []string{RuleClasses}},
+		{"Should NOT accept a breached password regardless of its case", "PASSWORD123!", []string{RuleBreached}},
+		{"Should tell all the rules broken", "sunset", []string{RuleMinLength, RuleClasses}},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			exception := policy.Check(testcase.Password)
+
+			// Assert
+			assert.Equal(testcase.Rules, rules(exception))
+		})
+	}
+
+	test.Run("Should describe the rules broken", func(test *testing.T) {
+		// Act
+		exception := policy.Check("sunset")
+
+		// Assert
+		assert.EqualError(exception, "must have at least 10 characters, "+
+			"must have characters of at least 3 classes among lowercase, uppercase, digits and symbols")
+	})
+}
+
+func TestClasses(test *testing.T) {
+	assert := assert.New(test)
+	assert.Equal(0, Classes(""))
+	assert.Equal(1, Classes("sunset"))
+	assert.Equal(2, Classes("Sunset"))
+	assert.Equal(3, Classes("Sunset1986"))
+	assert.Equal(4, Classes("Sunset 1986"))
+}
+
+func TestList(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should read a word per line skipping the comments and empty lines", func(test *testing.T) {
+		// Act
+		list, exception := ReadList(strings.NewReader("# Comment\nHunter2\n\n  letmein  \n"))
+
+		// Assert
+		require.Nil(exception)
+		assert.Len(list, 2)
+		assert.True(list.Contains("hunter2"))
+		assert.True(list.Contains("LetMeIn"))
+		assert.False(list.Contains("# Comment"))
+	})
+
+	test.Run("Should list the most common passwords", func(test *testing.T) {
+		// Act
+		list := Common()
+
+		// Assert
+		assert.True(list.Contains("123456"))
+		assert.True(list.Contains("P@ssw0rd"))
+		assert.False(list.Contains("Sunset-Drive-1986"))
+	})
+}
@@ -0,0 +1,213 @@
+// Package problems implements the error responses of the API as "problem
+// details" (RFC 7807), each of them identified by a stable code that clients
+// can rely on instead of parsing messages.
+package problems
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	ContentType string = "application/problem+json"
+	TypePrefix  string = "urn:note-vook:problem:"
+)
+
+// FieldError describes why a field of the input didn't pass the validation.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Problem is the central error type of the API. It's both returned to the
+// clients as JSON and kept on the context errors (along with its cause) so
+// the access log records what actually happened.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	// Report is the outcome of each item of the input, e. g. the operations of
+	// a batch, when some of them are not valid
+	Report interface{} `json:"report,omitempty"`
+
+	cause error
+}
+
+func New(status int, code string, title string) *Problem {
+	return &Problem{
+		Type:   TypePrefix + code,
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+func (problem *Problem) Error() string {
+	if problem.cause != nil {
+		return fmt.Sprintf("%s: %v", problem.Code, problem.cause)
+	}
+	return problem.Code
+}
+
+func (problem *Problem) Unwrap() error {
+	return problem.cause
+}
+
+// Is makes errors.Is match any problem with the same code.
+func (problem *Problem) Is(target error) bool {
+	other, ok := target.(*Problem)
+	return ok && other.Code == problem.Code
+}
+
+// Wrap returns a copy of the problem caused by the given error. The cause is
+// never sent to the client.
+func (problem *Problem) Wrap(cause error) *Problem {
+	clone := *problem
+	clone.cause = cause
+	return &clone
+}
+
+// WithDetail returns a copy of the problem with a human readable explanation
+// specific to this occurrence.
+func (problem *Problem) WithDetail(detail string) *Problem {
+	clone := *problem
+	clone.Detail = detail
+	return &clone
+}
+
+// Items returns a copy of the problem with the problems of the items of the
+// input, e. g. the operations of a batch, as its errors. The items without
+// problem are skipped and the fields failing the validation are prefixed by
+// their item, e. g. operations[2].end.
+func (problem *Problem) Items(name string, items []*Problem) *Problem {
+	clone := *problem
+	clone.Errors = nil
+	for index, item := range items {
+		if item == nil {
+			continue
+		}
+		prefix := fmt.Sprintf("%s[%d]", name, index)
+		for _, failure := range item.Errors {
+			failure.Field = prefix + "." + failure.Field
+			clone.Errors = append(clone.Errors, failure)
+		}
+		if len(item.Errors) == 0 {
+			message := item.Detail
+			if message == "" {
+				message = item.Title
+			}
+			clone.Errors = append(clone.Errors, FieldError{Field: prefix, Rule: item.Code, Message: message})
+		}
+	}
+	return &clone
+}
+
+// WithReport returns a copy of the problem along with the outcome of each
+// item of the input.
+func (problem *Problem) WithReport(report interface{}) *Problem {
+	clone := *problem
+	clone.Report = report
+	return &clone
+}
+
+// The catalogue of problems with their stable codes.
+var (
+	InvalidInput        = New(http.StatusBadRequest, "invalid_input", "Failed to read input")
+	ValidationFailed    = New(http.StatusBadRequest, "validation_failed", "Failed to read input")
+	InvalidInterval     = New(http.StatusBadRequest, "invalid_interval", "Invalid time interval")
+	InvalidNickname     = New(http.StatusBadRequest, "invalid_nickname", "The nickname doesn't follow the rules")
+	WeakPassword        = New(http.StatusBadRequest, "weak_password", "The password doesn't follow the rules")
+	InvalidSSOState     = New(http.StatusBadRequest, "invalid_sso_state", "The single sign-on state is invalid or expired")
+	ForbiddenWebhookURL = New(http.StatusBadRequest, "forbidden_webhook_url", "The webhook URL doesn't point to a public address")
+	InvalidCredentials  = New(http.StatusUnauthorized, "invalid_credentials", "Invalid nickname or password")
+	InvalidChallenge    = New(http.StatusUnauthorized, "invalid_challenge", "The two-factor challenge is invalid or expired")
+	InvalidCode         = New(http.StatusUnauthorized, "invalid_two_factor_code", "Invalid two-factor authentication code")
+	SSODenied           = New(http.StatusUnauthorized, "sso_denied", "The identity provider didn't authenticate the user")
+	Unauthorised        = New(http.StatusUnauthorized, "unauthorised", "Unauthorised")
+	AccountDisabled     = New(http.StatusForbidden, "account_disabled", "The account is disabled")
+	PasswordMismatch    = New(http.StatusForbidden, "password_mismatch", "The password doesn't match")
+	SSONotLinked        = New(http.StatusForbidden, "sso_not_linked", "No account is linked to the identity provider user")
+	Reauthentication    = New(http.StatusForbidden, "reauthentication_required", "Log in again with the identity provider to confirm the operation")
+	SSONotConfigured    = New(http.StatusNotFound, "sso_not_configured", "The single sign-on is not configured")
+	VideoNotFound       = New(http.StatusNotFound, "video_not_found", "Video not found")
+	AnnotationNotFound  = New(http.StatusNotFound, "annotation_not_found", "Annotation not found")
+	WebhookNotFound     = New(http.StatusNotFound, "webhook_not_found", "Webhook not found")
+	DeliveryNotFound    = New(http.StatusNotFound, "delivery_not_found", "Webhook delivery not found")
+	JobNotFound         = New(http.StatusNotFound, "job_not_found", "Job not found")
+	RouteNotFound       = New(http.StatusNotFound, "route_not_found", "Route not found")
+	MethodNotAllowed    = New(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	UnsupportedMedia    = New(http.StatusUnsupportedMediaType, "unsupported_media_type", "Unsupported media type")
+	DuplicateVideoLink  = New(http.StatusConflict, "duplicate_video_link", "Video link already exists")
+	DuplicateNickname   = New(http.StatusConflict, "duplicate_nickname", "Nickname already exists")
+	RequestInProgress   = New(http.StatusConflict, "request_in_progress", "A request with the same idempotency key is in progress")
+	JobStatusConflict   = New(http.StatusConflict, "job_status_conflict", "The job can't be changed on its current status")
+	TwoFactorConflict   = New(http.StatusConflict, "two_factor_conflict", "The two-factor authentication can't be changed on its current status")
+	SSOAlreadyLinked    = New(http.StatusConflict, "sso_already_linked", "The identity provider user is linked to another account")
+	RequestTooLarge     = New(http.StatusRequestEntityTooLarge, "request_too_large", "The request body is too large")
+	IdempotencyReused   = New(http.StatusUnprocessableEntity, "idempotency_key_reused", "The idempotency key was used for another request")
+	BatchRejected       = New(http.StatusUnprocessableEntity, "batch_rejected", "Some operations of the batch are not valid, none was applied")
+	ImportRolledBack    = New(http.StatusUnprocessableEntity, "import_rolled_back", "Some rows of the import are not valid, none was saved")
+	RateLimited         = New(http.StatusTooManyRequests, "rate_limited", "Too many requests")
+	LoginLocked         = New(http.StatusTooManyRequests, "login_locked", "Too many failed logins")
+	InternalError       = New(http.StatusInternalServerError, "internal_error", "Internal server error")
+	SSOUnavailable      = New(http.StatusBadGateway, "sso_unavailable", "The identity provider is unavailable")
+)
+
+// Input turns the error returned by the binding of the input into a problem,
+// listing the fields that didn't pass the validation if that's the case.
+func Input(exception error) *Problem {
+	var failures validator.ValidationErrors
+	if errors.As(exception, &failures) {
+		problem := ValidationFailed.Wrap(exception)
+		for _, failure := range failures {
+			problem.Errors = append(problem.Errors, FieldError{
+				Field:   failure.Field(),
+				Rule:    failure.Tag(),
+				Message: message(failure),
+			})
+		}
+		return problem
+	}
+
+	// Decoding errors don't come from the database, they are safe to show
+	return InvalidInput.Wrap(exception).WithDetail(exception.Error())
+}
+
+// From gets the problem behind an error, unknown errors are internal ones.
+func From(exception error) *Problem {
+	var problem *Problem
+	if errors.As(exception, &problem) {
+		return problem
+	}
+	return InternalError.Wrap(exception)
+}
+
+// Abort stops the chain of handlers and responds with the problem behind the
+// error, which is also attached to the context.
+func Abort(context *gin.Context, exception error) {
+	problem := *From(exception)
+	if problem.Instance == "" && context.Request != nil {
+		problem.Instance = context.Request.URL.Path
+	}
+
+	context.Error(exception)
+	context.Header("Content-Type", ContentType)
+	context.AbortWithStatusJSON(problem.Status, &problem)
+}
+
+// Handler responds always with the given problem, e. g. for unknown routes.
+func Handler(problem *Problem) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		Abort(context, problem)
+	}
+}
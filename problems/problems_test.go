@@ -0,0 +1,161 @@
+package problems
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type contract struct {
+	Title string `json:"title" binding:"required"`
+	Link  string `json:"link" binding:"omitempty,url"`
+	Start int    `json:"start" binding:"ltefield=End"`
+	End   int    `json:"end"`
+}
+
+func bind(body string) error {
+	context, _ := gin.CreateTestContext(httptest.NewRecorder())
+	context.Request, _ = http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	var input contract
+	return context.ShouldBindJSON(&input)
+}
+
+func TestInput(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should list the fields by their JSON names when the validation fails", func(test *testing.T) {
+		// Act
+		problem := Input(bind(`{"link": "not a link", "start": 5, "end": 3}`))
+
+		// Assert
+		assert.Equal(http.StatusBadRequest, problem.Status)
+		assert.Equal("validation_failed", problem.Code)
+		assert.Equal([]FieldError{
+			{Field: "title", Rule: "required", Message: "is required"},
+			{Field: "link", Rule: "url", Message: "must be a valid URL"},
+			{Field: "start", Rule: "ltefield", Message: "must be less than or equal to end"},
+		}, problem.Errors)
+	})
+
+	test.Run("Should list the query parameters by their names", func(test *testing.T) {
+		// Arrange
+		context, _ := gin.CreateTestContext(httptest.NewRecorder())
+		context.Request, _ = http.NewRequest(http.MethodGet, "/?page_size=0", nil)
+		var input struct {
+			PageSize int `form:"page_size" binding:"min=1"`
+		}
+
+		// Act
+		problem := Input(context.ShouldBindQuery(&input))
+
+		// Assert
+		assert.Equal([]FieldError{{Field: "page_size", Rule: "min", Message: "must be at least 1"}}, problem.Errors)
+	})
+
+	test.Run("Should explain why the body can't be decoded", func(test *testing.T) {
+		// Act
+		problem := Input(bind(`{"title": 5}`))
+
+		// Assert
+		assert.Equal("invalid_input", problem.Code)
+		assert.Contains(problem.Detail, "cannot unmarshal number")
+		assert.Empty(problem.Errors)
+	})
+}
+
+func TestItems(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should list the problems of the items prefixed by their index", func(test *testing.T) {
+		// Arrange
+		items := []*Problem{
+			nil,
+			Input(bind(`{"title": "Title", "start": 5, "end": 3}`)),
+			VideoNotFound,
+			InvalidInterval.WithDetail("the end is after the video"),
+		}
+
+		// Act
+		problem := BatchRejected.Items("operations", items).WithReport([]string{"ok", "failed"})
+
+		// Assert
+		assert.Equal(http.StatusUnprocessableEntity, problem.Status)
+		assert.Equal([]FieldError{
+			{Field: "operations[1].start", Rule: "ltefield", Message: "must be less than or equal to end"},
+			{Field: "operations[2]", Rule: "video_not_found", Message: "Video not found"},
+			{Field: "operations[3]", Rule: "invalid_interval", Message: "the end is after the video"},
+		}, problem.Errors)
+		assert.Equal([]string{"ok", "failed"}, problem.Report)
+		assert.Empty(BatchRejected.Errors)
+		assert.Nil(BatchRejected.Report)
+	})
+}
+
+func TestFrom(test *testing.T) {
+	assert := assert.New(test)
+
+	test.Run("Should find the problem within the wrapped errors", func(test *testing.T) {
+		// Arrange
+		cause := errors.New("UNIQUE constraint failed: videos.link")
+		exception := DuplicateVideoLink.Wrap(cause)
+
+		// Act
+		problem := From(exception)
+
+		// Assert
+		assert.Equal(http.StatusConflict, problem.Status)
+		assert.True(errors.Is(exception, DuplicateVideoLink))
+		assert.True(errors.Is(exception, cause))
+		assert.False(errors.Is(exception, VideoNotFound))
+	})
+
+	test.Run("Should hide unknown errors as internal ones", func(test *testing.T) {
+		// Act
+		problem := From(errors.New("no such table: videos"))
+
+		// Assert
+		assert.Equal(http.StatusInternalServerError, problem.Status)
+		assert.Equal("internal_error", problem.Code)
+		assert.Empty(problem.Detail)
+	})
+}
+
+func TestAbort(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should respond problem+json and keep the cause on the context", func(test *testing.T) {
+		// Arrange
+		recorder := httptest.NewRecorder()
+		context, _ := gin.CreateTestContext(recorder)
+		context.Request, _ = http.NewRequest(http.MethodGet, "/videos/7", nil)
+		cause := errors.New("record not found")
+
+		// Act
+		Abort(context, VideoNotFound.Wrap(cause))
+
+		// Assert
+		assert.True(context.IsAborted())
+		assert.Equal(http.StatusNotFound, recorder.Code)
+		assert.Equal(ContentType, recorder.Header().Get("Content-Type"))
+		assert.ErrorIs(context.Errors.Last(), cause)
+
+		var body map[string]interface{}
+		require.Nil(json.Unmarshal(recorder.Body.Bytes(), &body))
+		assert.Equal(map[string]interface{}{
+			"type":     "urn:note-vook:problem:video_not_found",
+			"title":    "Video not found",
+			"status":   404.0,
+			"code":     "video_not_found",
+			"instance": "/videos/7",
+		}, body)
+	})
+}
@@ -0,0 +1,54 @@
+package problems
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// Report the fields by their JSON (or query) names, as the clients know them
+	if engine, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		engine.RegisterTagNameFunc(jsonName)
+	}
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		name, _, _ = strings.Cut(field.Tag.Get("form"), ",")
+	}
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+func message(failure validator.FieldError) string {
+	parameter := strings.ToLower(failure.Param())
+	switch failure.Tag() {
+	case "required":
+		return "is required"
+	case "url":
+		return "must be a valid URL"
+	case "http_url":
+		return "must be a valid HTTP or HTTPS URL"
+	case "ltefield":
+		return fmt.Sprintf("must be less than or equal to %s", parameter)
+	case "gtefield":
+		return fmt.Sprintf("must be greater than or equal to %s", parameter)
+	case "min":
+		return fmt.Sprintf("must be at least %s", parameter)
+	case "max":
+		return fmt.Sprintf("must be at most %s", parameter)
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", failure.Param())
+	}
+	return fmt.Sprintf("must satisfy the rule %q", failure.Tag())
+}
@@ -0,0 +1,166 @@
+// Package spreadsheet writes Office Open XML workbooks (.xlsx) with a single
+// sheet of text cells. The rows are streamed to the output as they are
+// written, so large sheets don't have to be kept in memory.
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ContentType string = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	Extension   string = ".xlsx"
+
+	// MaximumCellLength is the number of characters a cell can hold, the
+	// longer texts are truncated.
+	MaximumCellLength int = 32767
+
+	// MaximumSheetNameLength is the number of characters of a sheet name.
+	MaximumSheetNameLength int = 31
+
+	header string = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+)
+
+// ErrClosed is returned when writing on a closed workbook.
+var ErrClosed = errors.New("spreadsheet: the workbook is closed")
+
+// parts are the fixed files of the package, written before the sheet.
+var parts = []struct {
+	Name    string
+	Content string
+}{
+	{"[Content_Types].xml", header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// Writer writes the rows of the sheet of a workbook. Close must be called to
+// finish the workbook.
+type Writer struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	rows    int
+	closed  bool
+}
+
+// NewWriter starts a workbook on the output with a single sheet with the
+// given name.
+func NewWriter(output io.Writer, name string) (*Writer, error) {
+	archive := zip.NewWriter(output)
+	for _, part := range parts {
+		if exception := create(archive, part.Name, part.Content); exception != nil {
+			return nil, exception
+		}
+	}
+
+	workbook := header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="` + escape(truncate(name, MaximumSheetNameLength)) + `" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+	if exception := create(archive, "xl/workbook.xml", workbook); exception != nil {
+		return nil, exception
+	}
+
+	file, exception := archive.Create("xl/worksheets/sheet1.xml")
+	if exception != nil {
+		return nil, exception
+	}
+	writer := &Writer{archive: archive, sheet: bufio.NewWriter(file)}
+	_, exception = writer.sheet.WriteString(header +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return writer, exception
+}
+
+// Write adds a row with the given cells, the empty ones are skipped.
+func (writer *Writer) Write(record []string) error {
+	if writer.closed {
+		return ErrClosed
+	}
+
+	writer.rows++
+	fmt.Fprintf(writer.sheet, `<row r="%d">`, writer.rows)
+	for index, value := range record {
+		if value == "" {
+			continue
+		}
+		fmt.Fprintf(writer.sheet, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+			Column(index), writer.rows, escape(truncate(value, MaximumCellLength)))
+	}
+	_, exception := writer.sheet.WriteString(`</row>`)
+	return exception
+}
+
+// Flush sends the rows written so far to the output.
+func (writer *Writer) Flush() error {
+	if writer.closed {
+		return ErrClosed
+	}
+	if exception := writer.sheet.Flush(); exception != nil {
+		return exception
+	}
+	return writer.archive.Flush()
+}
+
+// Close finishes the sheet and the workbook, it doesn't close the output.
+func (writer *Writer) Close() error {
+	if writer.closed {
+		return ErrClosed
+	}
+	writer.closed = true
+	if _, exception := writer.sheet.WriteString(`</sheetData></worksheet>`); exception != nil {
+		return exception
+	}
+	if exception := writer.sheet.Flush(); exception != nil {
+		return exception
+	}
+	return writer.archive.Close()
+}
+
+// Column names the column by its index as spreadsheets do, e. g. 0 is A, 25
+// is Z and 26 is AA.
+func Column(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+func create(archive *zip.Writer, name string, content string) error {
+	file, exception := archive.Create(name)
+	if exception != nil {
+		return exception
+	}
+	_, exception = io.WriteString(file, content)
+	return exception
+}
+
+// escape writes the text for XML, replacing the characters XML can't hold.
+func escape(value string) string {
+	builder := &strings.Builder{}
+	xml.EscapeText(builder, []byte(value))
+	return builder.String()
+}
+
+func truncate(value string, length int) string {
+	if utf8.RuneCountInString(value) <= length {
+		return value
+	}
+	return string([]rune(value)[:length])
+}
@@ -0,0 +1,116 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sheet struct {
+	Rows []struct {
+		Reference string `xml:"r,attr"`
+		Cells     []struct {
+			Reference string `xml:"r,attr"`
+			Type      string `xml:"t,attr"`
+			Text      string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func read(test *testing.T, content []byte) map[string]string {
+	archive, exception := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.Nil(test, exception)
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, exception := file.Open()
+		require.Nil(test, exception)
+		data, exception := io.ReadAll(reader)
+		require.Nil(test, exception)
+		files[file.Name] = string(data)
+	}
+	return files
+}
+
+func TestWriter(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	test.Run("Should write a workbook with the rows on a single sheet", func(test *testing.T) {
+		// Arrange
+		output := &bytes.Buffer{}
+		writer, exception := NewWriter(output, "Notes & more")
+		require.Nil(exception)
+
+		// Act
+		require.Nil(writer.Write([]string{"title", "notes"}))
+		require.Nil(writer.Flush())
+		require.Nil(writer.Write([]string{"<Intro>", "", "line\nbreak\x00"}))
+		require.Nil(writer.Close())
+
+		// Assert
+		files := read(test, output.Bytes())
+		assert.Contains(files, "[Content_Types].xml")
+		assert.Contains(files, "_rels/.rels")
+		assert.Contains(files, "xl/_rels/workbook.xml.rels")
+		assert.Contains(files["xl/workbook.xml"], `<sheet name="Notes &amp; more"`)
+
+		parsed := sheet{}
+		require.Nil(xml.Unmarshal([]byte(files["xl/worksheets/sheet1.xml"]), &parsed))
+		require.Len(parsed.Rows, 2)
+		assert.Equal("1", parsed.Rows[0].Reference)
+		assert.Equal("B1", parsed.Rows[0].Cells[1].Reference)
+		assert.Equal("notes", parsed.Rows[0].Cells[1].Text)
+		cells := parsed.Rows[1].Cells
+		require.Len(cells, 2)
+		assert.Equal("inlineStr", cells[0].Type)
+		assert.Equal("<Intro>", cells[0].Text)
+		assert.Equal("C2", cells[1].Reference)
+		assert.Equal("line\nbreak�", cells[1].Text)
+	})
+
+	test.Run("Should truncate the long texts", func(test *testing.T) {
+		// Arrange
+		output := &bytes.Buffer{}
+		writer, _ := NewWriter(output, strings.Repeat("s", 40))
+
+		// Act
+		writer.Write([]string{strings.Repeat("é", MaximumCellLength+10)})
+		writer.Close()
+
+		// Assert
+		files := read(test, output.Bytes())
+		assert.Contains(files["xl/workbook.xml"], `name="`+strings.Repeat("s", MaximumSheetNameLength)+`"`)
+		parsed := sheet{}
+		require.Nil(xml.Unmarshal([]byte(files["xl/worksheets/sheet1.xml"]), &parsed))
+		assert.Equal(strings.Repeat("é", MaximumCellLength), parsed.Rows[0].Cells[0].Text)
+	})
+
+	test.Run("Should fail to write on a closed workbook", func(test *testing.T) {
+		// Arrange
+		writer, _ := NewWriter(io.Discard, "Sheet")
+		writer.Close()
+
+		// Act
+		writing := writer.Write([]string{"late"})
+		flushing := writer.Flush()
+		closing := writer.Close()
+
+		// Assert
+		assert.ErrorIs(writing, ErrClosed)
+		assert.ErrorIs(flushing, ErrClosed)
+		assert.ErrorIs(closing, ErrClosed)
+	})
+}
+
+func TestColumn(test *testing.T) {
+	assert := assert.New(test)
+	for index, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(expected, Column(index))
+	}
+}
@@ -0,0 +1,111 @@
+// Package totp implements the time-based one-time passwords (RFC 6238) shown
+// by the authenticator apps, with the settings all of them support: HMAC-SHA1,
+// 6 digits and a new code every 30 seconds.
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	Digits int           = 6
+	Period time.Duration = 30 * time.Second
+
+	// Skew is how many periods before and after the current one are accepted,
+	// as the clocks of the phones drift and the users take a while to type
+	Skew int64 = 1
+
+	// SecretSize is the number of random bytes of the secrets (160 bits, as
+	// recommended by RFC 4226)
+	SecretSize int = 20
+)
+
+// encoding is the base32 without padding of the otpauth URIs.
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewSecret generates a random secret encoded in base32.
+func NewSecret() (string, error) {
+	secret := make([]byte, SecretSize)
+	if _, exception := rand.Read(secret); exception != nil {
+		return "", fmt.Errorf("unable to generate the secret: %w", exception)
+	}
+	return encoding.EncodeToString(secret), nil
+}
+
+// Step is the number of periods since the Unix epoch at the given moment.
+func Step(moment time.Time) int64 {
+	return moment.Unix() / int64(Period.Seconds())
+}
+
+// Code is the one-time password for the given step of the secret.
+func Code(secret string, step int64) (string, error) {
+	key, exception := encoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if exception != nil {
+		return "", fmt.Errorf("invalid secret: %w", exception)
+	}
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation (RFC 4226 section 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for digit := 0; digit < Digits; digit++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", Digits, value%modulo), nil
+}
+
+// Verify looks for the step within the skew around the given moment whose
+// code is the given one, skipping the steps up to the last one used, so each
+// code is accepted only once. It tells the step matched, if any.
+func Verify(secret string, code string, moment time.Time, last int64) (int64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	current := Step(moment)
+	for step := current - Skew; step <= current+Skew; step++ {
+		if step <= last {
+			continue
+		}
+		expected, exception := Code(secret, step)
+		if exception != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// URI is the otpauth URI of the secret for the given account, which the
+// authenticator apps read from a QR code.
+func URI(issuer string, account string, secret string) string {
+	label := url.PathEscape(account)
+	if issuer != "" {
+		label = url.PathEscape(issuer) + ":" + label
+	}
+	query := url.Values{}
+	query.Set("secret", secret)
+	if issuer != "" {
+		query.Set("issuer", issuer)
+	}
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(Digits))
+	query.Set("period", fmt.Sprint(int64(Period.Seconds())))
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
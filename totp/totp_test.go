@@ -0,0 +1,120 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// secret is the one of the test vectors of RFC 6238 ("12345678901234567890")
+const secret string = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(test *testing.T) {
+	assert := assert.New(test)
+
+	testcases := []struct {
+		Description string
+		Moment      int64
+		Code        string
+	}{
+		{"Should match the first test vector of the RFC", 59, "287082"},
+		{"Should match the second test vector of the RFC", 1111111109, "081804"},
+		{"Should match the third test vector of the RFC", 1111111111, "050471"},
+		{"Should match the fourth test vector of the RFC", 1234567890, "005924"},
+		{"Should match the fifth test vector of the RFC", 2000000000, "279037"},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			code, exception := Code(secret, Step(time.Unix(testcase.Moment, 0)))
+
+			// Assert
+			assert.Nil(exception)
+			assert.Equal(testcase.Code, code)
+		})
+	}
+
+	test.Run("Should NOT accept secrets out of base32", func(test *testing.T) {
+		// Act
+		_, exception := Code("not base32!", 1)
+
+		// Assert
+		assert.ErrorContains(exception, "invalid secret")
+	})
+}
+
+func TestVerify(test *testing.T) {
+	assert := assert.New(test)
+	moment := time.Unix(1111111109, 0)
+	current := Step(moment)
+	code := func(step int64) string {
+		generated, _ := Code(secret, step)
+		return generated
+	}
+
+	testcases := []struct {
+		Description string
+		Code        string
+		Last        int64
+		Step        int64
+		Valid       bool
+	}{
+		{"Should accept the code of the current step", code(current), 0, current, true},
+		{"Should accept the code of the previous step", code(current - 1), 0, current - 1, true},
+		{"Should accept the code of the next step", code(current + 1), 0, current + 1, true},
+		{"Should NOT accept the codes beyond the skew", code(current - 2), 0, 0, false},
+		{"Should NOT accept a code already used", code(current), current, 0, false},
+		{"Should NOT accept a wrong code", "000000", 0, 0, false},
+		{"Should NOT accept a code with the wrong length", "0818", 0, 0, false},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			step, valid := Verify(secret, testcase.Code, moment, testcase.Last)
+
+			// Assert
+			assert.Equal(testcase.Valid, valid)
+			assert.Equal(testcase.Step, step)
+		})
+	}
+}
+
+func TestNewSecret(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	// Act
+	first, exception := NewSecret()
+	require.Nil(exception)
+	second, _ := NewSecret()
+
+	// Assert
+	assert.Len(first, 32)
+	assert.NotEqual(first, second)
+	_, exception = Code(first, 1)
+	assert.Nil(exception)
+}
+
+func TestURI(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	// Act
+	uri := URI("NoteVook", "andres", secret)
+
+	// Assert
+	parsed, exception := url.Parse(uri)
+	require.Nil(exception)
+	assert.Equal("otpauth", parsed.Scheme)
+	assert.Equal("totp", parsed.Host)
+	assert.Equal("/NoteVook:andres", parsed.Path)
+	assert.Equal(secret, parsed.Query().Get("secret"))
+	assert.Equal("NoteVook", parsed.Query().Get("issuer"))
+	assert.Equal("6", parsed.Query().Get("digits"))
+	assert.Equal("30", parsed.Query().Get("period"))
+}
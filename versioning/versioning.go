@@ -0,0 +1,136 @@
+// Package versioning registers the routes of the API under a prefix for each
+// version (e. g. /v1), so their contracts can change without breaking the
+// clients of the previous versions.
+package versioning
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	DeprecationHeader string = "Deprecation"
+	SunsetHeader      string = "Sunset"
+	LinkHeader        string = "Link"
+)
+
+// Route is an end-point registered on a version, relative to its prefix.
+type Route struct {
+	Method   string
+	Path     string
+	Handlers []gin.HandlerFunc
+}
+
+// Version is a set of routes served under its name as prefix. A version
+// created from another one inherits all its routes, so it only needs to
+// register the end-points whose contracts changed.
+type Version struct {
+	Name       string
+	routes     []Route
+	middleware []gin.HandlerFunc
+}
+
+// New creates the first version of the API, without routes.
+func New(name string) *Version {
+	return &Version{Name: name}
+}
+
+// Prefix is the path where the routes of the version are served, e. g. /v1.
+func (version *Version) Prefix() string {
+	return "/" + version.Name
+}
+
+// Next creates the following version of the API with the same routes.
+func (version *Version) Next(name string) *Version {
+	return &Version{
+		Name:       name,
+		routes:     append([]Route{}, version.routes...),
+		middleware: append([]gin.HandlerFunc{}, version.middleware...),
+	}
+}
+
+// Use runs the given middleware before the handlers of the routes registered
+// afterwards on this version and the following ones.
+func (version *Version) Use(middleware ...gin.HandlerFunc) {
+	version.middleware = append(version.middleware, middleware...)
+}
+
+// Handle registers a route on this version, replacing the inherited one with
+// the same method and path if any.
+func (version *Version) Handle(method string, path string, handlers ...gin.HandlerFunc) {
+	handlers = append(append([]gin.HandlerFunc{}, version.middleware...), handlers...)
+	route := Route{Method: method, Path: path, Handlers: handlers}
+	for index, existing := range version.routes {
+		if existing.Method == method && existing.Path == path {
+			version.routes[index] = route
+			return
+		}
+	}
+	version.routes = append(version.routes, route)
+}
+
+func (version *Version) GET(path string, handlers ...gin.HandlerFunc) {
+	version.Handle(http.MethodGet, path, handlers...)
+}
+
+func (version *Version) POST(path string, handlers ...gin.HandlerFunc) {
+	version.Handle(http.MethodPost, path, handlers...)
+}
+
+func (version *Version) PATCH(path string, handlers ...gin.HandlerFunc) {
+	version.Handle(http.MethodPatch, path, handlers...)
+}
+
+func (version *Version) DELETE(path string, handlers ...gin.HandlerFunc) {
+	version.Handle(http.MethodDelete, path, handlers...)
+}
+
+// Routes lists the end-points of the version in registration order.
+func (version *Version) Routes() []Route {
+	return version.routes
+}
+
+// Mount serves the routes of the version under its prefix.
+func (version *Version) Mount(server gin.IRouter) {
+	for _, route := range version.routes {
+		server.Handle(route.Method, version.Prefix()+route.Path, route.Handlers...)
+	}
+}
+
+// Alias serves the routes of the version also without prefix, announcing
+// they are deprecated in favour of the prefixed ones.
+func (version *Version) Alias(server gin.IRouter, deprecation Deprecation) {
+	announce := deprecation.Handler(version.Prefix())
+	for _, route := range version.routes {
+		handlers := append([]gin.HandlerFunc{announce}, route.Handlers...)
+		server.Handle(route.Method, route.Path, handlers...)
+	}
+}
+
+// Deprecation tells since when some routes are deprecated and when they will
+// be removed.
+type Deprecation struct {
+	Since  time.Time
+	Sunset time.Time
+}
+
+// Handler sends the Deprecation (RFC 9745) and Sunset (RFC 8594) headers,
+// along with a link to the same resource under the successor prefix.
+func (deprecation Deprecation) Handler(successor string) gin.HandlerFunc {
+	since := fmt.Sprintf("@%d", deprecation.Since.Unix())
+	sunset := deprecation.Sunset.UTC().Format(http.TimeFormat)
+	return func(context *gin.Context) {
+		link := successor + context.Request.URL.EscapedPath()
+		if query := context.Request.URL.RawQuery; query != "" {
+			link += "?" + query
+		}
+
+		context.Header(DeprecationHeader, since)
+		context.Header(SunsetHeader, sunset)
+		context.Header(LinkHeader, fmt.Sprintf(`<%s>; rel="successor-version"`, link))
+		context.Next()
+	}
+}
@@ -0,0 +1,170 @@
+package versioning
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func respond(name string) gin.HandlerFunc {
+	return func(context *gin.Context) {
+		context.String(http.StatusOK, name)
+	}
+}
+
+func serve(server *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	request, _ := http.NewRequest(method, path, nil)
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestMount(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	test.Run("Should serve the routes under the prefix of the version", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		v1 := New("v1")
+		v1.GET("/videos", respond("index"))
+		v1.POST("/videos", respond("add"))
+		v1.PATCH("/videos/:id", respond("edit"))
+		v1.DELETE("/videos/:id", respond("delete"))
+
+		// Act
+		v1.Mount(server)
+
+		// Assert
+		assert.Equal("/v1", v1.Prefix())
+		assert.Len(v1.Routes(), 4)
+		assert.Equal("index", serve(server, http.MethodGet, "/v1/videos").Body.String())
+		assert.Equal("add", serve(server, http.MethodPost, "/v1/videos").Body.String())
+		assert.Equal("edit", serve(server, http.MethodPatch, "/v1/videos/1").Body.String())
+		assert.Equal("delete", serve(server, http.MethodDelete, "/v1/videos/1").Body.String())
+		assert.Equal(http.StatusNotFound, serve(server, http.MethodGet, "/videos").Code)
+	})
+
+	test.Run("Should inherit the routes and override the ones registered again", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		v1 := New("v1")
+		v1.GET("/videos", respond("index v1"))
+		v1.GET("/videos/:id", respond("view v1"))
+		v2 := v1.Next("v2")
+		v2.GET("/videos/:id", respond("view v2"))
+
+		// Act
+		v1.Mount(server)
+		v2.Mount(server)
+
+		// Assert
+		assert.Len(v2.Routes(), 2)
+		assert.Equal("index v1", serve(server, http.MethodGet, "/v2/videos").Body.String())
+		assert.Equal("view v2", serve(server, http.MethodGet, "/v2/videos/1").Body.String())
+		assert.Equal("view v1", serve(server, http.MethodGet, "/v1/videos/1").Body.String())
+	})
+}
+
+func TestUse(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+
+	mark := func(name string) gin.HandlerFunc {
+		return func(context *gin.Context) {
+			context.Header("X-Middleware", name)
+			context.Next()
+		}
+	}
+
+	test.Run("Should run the middleware only on the routes registered afterwards", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		v1 := New("v1")
+		v1.GET("/health", respond("health"))
+		v1.Use(mark("limited"))
+		v1.GET("/videos", respond("index"))
+		v2 := v1.Next("v2")
+		v2.GET("/videos/:id", respond("view"))
+
+		// Act
+		v1.Mount(server)
+		v2.Mount(server)
+
+		// Assert
+		assert.Empty(serve(server, http.MethodGet, "/v1/health").Header().Get("X-Middleware"))
+		assert.Equal("limited", serve(server, http.MethodGet, "/v1/videos").Header().Get("X-Middleware"))
+		assert.Equal("limited", serve(server, http.MethodGet, "/v2/videos").Header().Get("X-Middleware"))
+		recorder := serve(server, http.MethodGet, "/v2/videos/1")
+		assert.Equal("view", recorder.Body.String())
+		assert.Equal("limited", recorder.Header().Get("X-Middleware"))
+	})
+}
+
+func TestAlias(test *testing.T) {
+	assert := assert.New(test)
+	gin.SetMode(gin.TestMode)
+	deprecation := Deprecation{
+		Since:  time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		Sunset: time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+	}
+
+	testcases := []struct {
+		Name string
+		Path string
+		Link string
+	}{
+		{
+			Name: "Should link to the successor of the route",
+			Path: "/videos/1",
+			Link: `</v1/videos/1>; rel="successor-version"`,
+		},
+		{
+			Name: "Should keep the query string in the link to the successor",
+			Path: "/videos/1?format=json",
+			Link: `</v1/videos/1?format=json>; rel="successor-version"`,
+		},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Name, func(test *testing.T) {
+			// Arrange
+			server := gin.New()
+			v1 := New("v1")
+			v1.GET("/videos/:id", respond("view"))
+			v1.Mount(server)
+			v1.Alias(server, deprecation)
+
+			// Act
+			recorder := serve(server, http.MethodGet, testcase.Path)
+
+			// Assert
+			assert.Equal("view", recorder.Body.String())
+			assert.Equal("@1792368000", recorder.Header().Get(DeprecationHeader))
+			assert.Equal("Mon, 19 Apr 2027 00:00:00 GMT", recorder.Header().Get(SunsetHeader))
+			assert.Equal(testcase.Link, recorder.Header().Get(LinkHeader))
+		})
+	}
+
+	test.Run("Should not announce the deprecation on the versioned routes", func(test *testing.T) {
+		// Arrange
+		server := gin.New()
+		v1 := New("v1")
+		v1.GET("/videos/:id", respond("view"))
+		v1.Mount(server)
+		v1.Alias(server, deprecation)
+
+		// Act
+		recorder := serve(server, http.MethodGet, "/v1/videos/1")
+
+		// Assert
+		assert.Equal("view", recorder.Body.String())
+		assert.Empty(recorder.Header().Get(DeprecationHeader))
+		assert.Empty(recorder.Header().Get(SunsetHeader))
+		assert.Empty(recorder.Header().Get(LinkHeader))
+	})
+}
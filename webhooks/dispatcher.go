@@ -0,0 +1,339 @@
+// Package webhooks notifies the URLs registered by the users of the changes of
+// their videos and annotations. The deliveries are stored in an outbox table
+// first, so they survive restarts, and then sent by the jobs of the queue
+// with signed requests, retrying them with exponential backoff.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/gorm"
+)
+
+const (
+	UserAgent string = "NoteVook-Webhooks/1.0"
+
+	// MaximumBackoff bounds the time between the attempts of a delivery
+	MaximumBackoff time.Duration = 6 * time.Hour
+
+	// DeliverKind is the job sending the due deliveries
+	DeliverKind string = "webhooks.deliver"
+)
+
+// Events are the types of the events the webhooks can be notified of.
+var Events = []string{
+	events.VideoCreated,
+	events.VideoUpdated,
+	events.VideoDeleted,
+	events.AnnotationCreated,
+	events.AnnotationUpdated,
+	events.AnnotationDeleted,
+}
+
+// Payload is the body of the deliveries, the data is the video or annotation
+// as it's returned by the API.
+type Payload struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher enqueues the events for the webhooks subscribed to them and
+// delivers them. A nil dispatcher discards the events.
+type Dispatcher struct {
+	Database models.DataAccessInterface
+	Client   *http.Client
+	Logger   *slog.Logger
+
+	// Backoff is the time before the first retry, doubled on each attempt
+	Backoff time.Duration
+
+	// Attempts is the maximum number of attempts of each delivery
+	Attempts int
+
+	// BatchSize is the maximum number of deliveries sent on each round
+	BatchSize int
+
+	// Workers is the maximum number of deliveries sent at the same time
+	Workers int
+
+	// Jobs runs the rounds of deliveries, enqueued along with the deliveries
+	// and scheduled for their retries, none are enqueued when it's nil
+	Jobs *jobs.Queue
+
+	// rounds keeps the concurrent jobs from sending the same deliveries
+	rounds sync.Mutex
+}
+
+type contextual interface {
+	WithContext(context.Context) *gorm.DB
+}
+
+func (dispatcher *Dispatcher) session(current context.Context) models.DataAccessInterface {
+	if scoped, ok := dispatcher.Database.(contextual); ok {
+		return scoped.WithContext(current)
+	}
+	return dispatcher.Database
+}
+
+// NewEventID returns a random identifier for an event, shared by all its
+// deliveries, so the receivers can tell apart the redeliveries.
+func NewEventID() string {
+	identifier := make([]byte, 16)
+	rand.Read(identifier)
+	return hex.EncodeToString(identifier)
+}
+
+// Enqueue stores a pending delivery of the event for each active webhook of
+// the user subscribed to it, along with the job sending them. The database may
+// be a transaction, so the deliveries are only stored along with the change,
+// then the caller calls Notify once it's committed.
+func (dispatcher *Dispatcher) Enqueue(database models.DataAccessInterface, user uint, kind string, data interface{}) error {
+	if dispatcher == nil {
+		return nil
+	}
+
+	var hooks []models.Webhook
+	if exception := database.Find(&hooks, "user_id = ? AND active = ?", user, true).Error; exception != nil {
+		return exception
+	}
+
+	event := Payload{ID: NewEventID(), Type: kind, CreatedAt: time.Now(), Data: data}
+	deliveries := []models.WebhookDelivery{}
+	var payload []byte
+	for _, hook := range hooks {
+		if !hook.Subscribed(kind) {
+			continue
+		}
+		if payload == nil {
+			var exception error
+			if payload, exception = json.Marshal(event); exception != nil {
+				return exception
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			Event:         kind,
+			Payload:       payload,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: event.CreatedAt,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if exception := database.Create(&deliveries).Error; exception != nil {
+		return exception
+	}
+	return dispatcher.schedule(database, user, event.CreatedAt)
+}
+
+// Redeliver stores a new pending delivery with the event of the given one of
+// the user, along with the job sending it.
+func (dispatcher *Dispatcher) Redeliver(database models.DataAccessInterface, user uint, delivery *models.WebhookDelivery) (*models.WebhookDelivery, error) {
+	redelivery := &models.WebhookDelivery{
+		WebhookID:     delivery.WebhookID,
+		EventID:       delivery.EventID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        models.DeliveryPending,
+		NextAttemptAt: time.Now(),
+		RedeliveryOf:  delivery.ID,
+	}
+	exception := database.Transaction(func(transaction *gorm.DB) error {
+		if exception := transaction.Create(redelivery).Error; exception != nil {
+			return exception
+		}
+		return dispatcher.schedule(transaction, user, redelivery.NextAttemptAt)
+	})
+	if exception == nil {
+		dispatcher.Notify()
+	}
+	return redelivery, exception
+}
+
+// Notify wakes up the jobs sending the deliveries enqueued within a
+// transaction, once it's committed.
+func (dispatcher *Dispatcher) Notify() {
+	if dispatcher == nil || dispatcher.Jobs == nil {
+		return
+	}
+	dispatcher.Jobs.Notify()
+}
+
+// schedule enqueues a round of deliveries to run at the given time on behalf
+// of the user.
+func (dispatcher *Dispatcher) schedule(database models.DataAccessInterface, user uint, at time.Time) error {
+	if dispatcher == nil || dispatcher.Jobs == nil {
+		return nil
+	}
+	_, exception := dispatcher.Jobs.ScheduleFor(database, user, DeliverKind, nil, at)
+	return exception
+}
+
+// Deliver sends the pending deliveries that are due, the oldest first, and
+// tells how many of them were attempted. They are sent concurrently by a
+// bounded pool of workers, so a slow receiver doesn't hold back the others.
+func (dispatcher *Dispatcher) Deliver(current context.Context) (int, error) {
+	var due []models.WebhookDelivery
+	searching := dispatcher.session(current).
+		Preload("Webhook").
+		Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(dispatcher.BatchSize).
+		Find(&due).Error
+	if searching != nil {
+		return 0, searching
+	}
+
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	pending := make(chan *models.WebhookDelivery)
+	var attempted atomic.Int64
+	var failure error
+	var once sync.Once
+	var workers sync.WaitGroup
+	for worker := max(1, min(dispatcher.Workers, len(due))); worker > 0; worker-- {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for delivery := range pending {
+				if exception := dispatcher.attempt(current, delivery); exception != nil {
+					once.Do(func() { failure = exception })
+					continue
+				}
+				attempted.Add(1)
+			}
+		}()
+	}
+	for index := range due {
+		pending <- &due[index]
+	}
+	close(pending)
+	workers.Wait()
+	return int(attempted.Load()), failure
+}
+
+// Handle is the handler of the DeliverKind jobs. It sends the due deliveries
+// while there are more of them than fit in a round, one job at a time.
+func (dispatcher *Dispatcher) Handle(current context.Context, _ *models.Job) error {
+	dispatcher.rounds.Lock()
+	defer dispatcher.rounds.Unlock()
+	for {
+		delivered, exception := dispatcher.Deliver(current)
+		if exception != nil || delivered < dispatcher.BatchSize {
+			return exception
+		}
+	}
+}
+
+// backoff is the time to wait before the next attempt, once the given number
+// of attempts failed.
+func (dispatcher *Dispatcher) backoff(attempts int) time.Duration {
+	delay := dispatcher.Backoff
+	for retry := 1; retry < attempts && delay < MaximumBackoff; retry++ {
+		delay *= 2
+	}
+	return min(delay, MaximumBackoff)
+}
+
+// attempt sends the delivery once and records the result, either delivered,
+// failed when there are no attempts left or pending until the next attempt.
+func (dispatcher *Dispatcher) attempt(current context.Context, delivery *models.WebhookDelivery) error {
+	now := time.Now()
+	if delivery.Webhook == nil || !delivery.Webhook.Active {
+		delivery.Status = models.DeliveryFailed
+		delivery.Error = "the webhook is disabled"
+	} else {
+		delivery.Attempts++
+		delivery.LastAttemptAt = &now
+		exception := dispatcher.send(current, delivery)
+		if current.Err() != nil {
+			// Shutting down, the delivery is attempted again on the next start
+			return current.Err()
+		}
+		switch {
+		case exception == nil:
+			delivery.Status = models.DeliveryDelivered
+			delivery.DeliveredAt = &now
+			delivery.Error = ""
+		case delivery.Attempts >= dispatcher.Attempts:
+			delivery.Status = models.DeliveryFailed
+			delivery.Error = exception.Error()
+		default:
+			delivery.NextAttemptAt = now.Add(dispatcher.backoff(delivery.Attempts))
+			delivery.Error = exception.Error()
+		}
+	}
+
+	dispatcher.Logger.InfoContext(
+		current, "Webhook delivery attempted",
+		"delivery_id", delivery.ID,
+		"webhook_id", delivery.WebhookID,
+		"event", delivery.Event,
+		"status", delivery.Status,
+		"attempts", delivery.Attempts,
+		"response_status", delivery.ResponseStatus,
+	)
+	return dispatcher.session(current).Transaction(func(transaction *gorm.DB) error {
+		if exception := transaction.Select("*").Omit("Webhook").Updates(delivery).Error; exception != nil {
+			return exception
+		}
+		if delivery.Status != models.DeliveryPending {
+			return nil
+		}
+		// The retry gets its own round once it's due
+		return dispatcher.schedule(transaction, delivery.Webhook.UserID, delivery.NextAttemptAt)
+	})
+}
+
+// send posts the payload to the URL of the webhook, signed with its secret.
+// Only the 2xx responses count as delivered and only their status is kept, as
+// the body is not meant to be read back by the user.
+func (dispatcher *Dispatcher) send(current context.Context, delivery *models.WebhookDelivery) error {
+	delivery.ResponseStatus = 0
+	request, exception := http.NewRequestWithContext(
+		current, http.MethodPost, delivery.Webhook.URL, bytes.NewReader(delivery.Payload),
+	)
+	if exception != nil {
+		return exception
+	}
+
+	timestamp := time.Now().Unix()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", UserAgent)
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+	request.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	request.Header.Set(SignatureHeader, Sign(delivery.Webhook.Secret, timestamp, delivery.Payload))
+
+	response, exception := dispatcher.Client.Do(request)
+	if exception != nil {
+		return exception
+	}
+	defer response.Body.Close()
+
+	delivery.ResponseStatus = response.StatusCode
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+	return nil
+}
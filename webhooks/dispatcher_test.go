@@ -0,0 +1,315 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zatarain/note-vook/events"
+	"github.com/zatarain/note-vook/jobs"
+	"github.com/zatarain/note-vook/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// receiver is a local endpoint of the webhooks recording the requests.
+type receiver struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(test *testing.T, status int) *receiver {
+	receiver := &receiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		receiver.mutex.Lock()
+		defer receiver.mutex.Unlock()
+		receiver.requests = append(receiver.requests, request)
+		receiver.bodies = append(receiver.bodies, body)
+		writer.WriteHeader(receiver.status)
+		writer.Write([]byte("thanks"))
+	}))
+	test.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (receiver *receiver) received() int {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+	return len(receiver.requests)
+}
+
+func TestDispatcher(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+
+	setup := func(test *testing.T) (*Dispatcher, *gorm.DB) {
+		database, exception := gorm.Open(sqlite.Open(filepath.Join(test.TempDir(), "webhooks.db")), &gorm.Config{})
+		require.Nil(exception)
+		require.Nil(database.AutoMigrate(&models.Webhook{}, &models.WebhookDelivery{}))
+		dispatcher := &Dispatcher{
+			Database:  database,
+			Client:    &http.Client{Timeout: time.Second},
+			Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			Backoff:   time.Minute,
+			Attempts:  3,
+			BatchSize: 10,
+		}
+		return dispatcher, database
+	}
+
+	register := func(database *gorm.DB, user uint, url string, active bool, kinds ...string) models.Webhook {
+		webhook := models.Webhook{UserID: user, URL: url, Events: kinds, Secret: "secret-of-the-webhook", Active: active}
+		require.Nil(database.Create(&webhook).Error)
+		return webhook
+	}
+
+	deliveries := func(database *gorm.DB) []models.WebhookDelivery {
+		recordset := []models.WebhookDelivery{}
+		require.Nil(database.Order("id").Find(&recordset).Error)
+		return recordset
+	}
+
+	test.Run("Should enqueue the event for the active webhooks of the user subscribed to it", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		first := register(database, 1, "https://first.io", true, events.VideoCreated, events.AnnotationCreated)
+		second := register(database, 1, "https://second.io", true, events.AnnotationCreated)
+		register(database, 1, "https://videos.io", true, events.VideoCreated)
+		register(database, 1, "https://disabled.io", false, events.AnnotationCreated)
+		register(database, 2, "https://other.io", true, events.AnnotationCreated)
+
+		// Act
+		exception := dispatcher.Enqueue(database, 1, events.AnnotationCreated, map[string]int{"id": 7})
+
+		// Assert
+		require.Nil(exception)
+		enqueued := deliveries(database)
+		require.Len(enqueued, 2)
+		assert.Equal(first.ID, enqueued[0].WebhookID)
+		assert.Equal(second.ID, enqueued[1].WebhookID)
+		assert.Equal(enqueued[0].EventID, enqueued[1].EventID)
+		for _, delivery := range enqueued {
+			assert.Equal(models.DeliveryPending, delivery.Status)
+			assert.Equal(events.AnnotationCreated, delivery.Event)
+			payload := Payload{}
+			require.Nil(json.Unmarshal(delivery.Payload, &payload))
+			assert.Equal(delivery.EventID, payload.ID)
+			assert.Equal(events.AnnotationCreated, payload.Type)
+			assert.Equal(map[string]interface{}{"id": 7.0}, payload.Data)
+		}
+	})
+
+	test.Run("Should discard the events without dispatcher", func(test *testing.T) {
+		var dispatcher *Dispatcher
+		assert.Nil(dispatcher.Enqueue(nil, 1, events.VideoCreated, nil))
+	})
+
+	test.Run("Should deliver the pending events signed with the secret of the webhook", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		receiver := newReceiver(test, http.StatusOK)
+		register(database, 1, receiver.URL, true, events.VideoDeleted)
+		require.Nil(dispatcher.Enqueue(database, 1, events.VideoDeleted, map[string]int{"id": 3}))
+
+		// Act
+		delivered, exception := dispatcher.Deliver(context.Background())
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal(1, delivered)
+		require.Equal(1, receiver.received())
+		request, body := receiver.requests[0], receiver.bodies[0]
+		delivery := deliveries(database)[0]
+		assert.Equal(http.MethodPost, request.Method)
+		assert.Equal("application/json", request.Header.Get("Content-Type"))
+		assert.Equal(events.VideoDeleted, request.Header.Get(EventHeader))
+		assert.Equal("1", request.Header.Get(DeliveryHeader))
+		assert.JSONEq(string(delivery.Payload), string(body))
+		assert.Nil(Verify(
+			"secret-of-the-webhook",
+			request.Header.Get(SignatureHeader),
+			request.Header.Get(TimestampHeader),
+			body,
+			time.Minute,
+		))
+		assert.Equal(models.DeliveryDelivered, delivery.Status)
+		assert.Equal(1, delivery.Attempts)
+		assert.Equal(http.StatusOK, delivery.ResponseStatus)
+		assert.NotNil(delivery.DeliveredAt)
+		assert.Empty(delivery.Error)
+	})
+
+	test.Run("Should retry the failed deliveries with exponential backoff until the last attempt", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		receiver := newReceiver(test, http.StatusServiceUnavailable)
+		register(database, 1, receiver.URL, true, events.VideoCreated)
+		require.Nil(dispatcher.Enqueue(database, 1, events.VideoCreated, nil))
+		delays := []time.Duration{}
+
+		// Act
+		for attempt := 0; attempt < 3; attempt++ {
+			before := time.Now()
+			_, exception := dispatcher.Deliver(context.Background())
+			require.Nil(exception)
+			delivery := deliveries(database)[0]
+			delays = append(delays, delivery.NextAttemptAt.Sub(before).Round(time.Minute))
+			// Make the next attempt due
+			database.Model(&delivery).Update("next_attempt_at", time.Now().Add(-time.Second))
+		}
+
+		// Assert
+		assert.Equal(3, receiver.received())
+		delivery := deliveries(database)[0]
+		assert.Equal(models.DeliveryFailed, delivery.Status)
+		assert.Equal(3, delivery.Attempts)
+		assert.Equal(http.StatusServiceUnavailable, delivery.ResponseStatus)
+		assert.Equal("unexpected response status 503", delivery.Error)
+		assert.Nil(delivery.DeliveredAt)
+		assert.Equal(time.Minute, delays[0])
+		assert.Equal(2*time.Minute, delays[1])
+		delivered, _ := dispatcher.Deliver(context.Background())
+		assert.Zero(delivered)
+	})
+
+	test.Run("Should not deliver the events to the disabled webhooks", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		receiver := newReceiver(test, http.StatusOK)
+		webhook := register(database, 1, receiver.URL, true, events.VideoCreated)
+		require.Nil(dispatcher.Enqueue(database, 1, events.VideoCreated, nil))
+		require.Nil(database.Model(&webhook).Update("active", false).Error)
+
+		// Act
+		_, exception := dispatcher.Deliver(context.Background())
+
+		// Assert
+		require.Nil(exception)
+		assert.Zero(receiver.received())
+		delivery := deliveries(database)[0]
+		assert.Equal(models.DeliveryFailed, delivery.Status)
+		assert.Zero(delivery.Attempts)
+		assert.Equal("the webhook is disabled", delivery.Error)
+	})
+
+	test.Run("Should deliver on the jobs enqueued along with the deliveries", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		require.Nil(database.AutoMigrate(&models.Job{}))
+		queue := jobs.NewQueue(database, dispatcher.Logger)
+		queue.Concurrency = 2
+		queue.Interval = 10 * time.Millisecond
+		queue.Register(DeliverKind, dispatcher.Handle)
+		dispatcher.Jobs = queue
+		receiver := newReceiver(test, http.StatusNoContent)
+		register(database, 1, receiver.URL, true, events.VideoCreated)
+		for index := 0; index < 25; index++ {
+			require.Nil(dispatcher.Enqueue(database, 1, events.VideoCreated, index))
+		}
+		current, cancel := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+
+		// Act
+		go func() {
+			queue.Run(current)
+			close(finished)
+		}()
+
+		// Assert
+		// The deliveries are saved after the receiver gets them, so it waits for both
+		assert.Eventually(func() bool {
+			for _, delivery := range deliveries(database) {
+				if delivery.Status != models.DeliveryDelivered {
+					return false
+				}
+			}
+			return true
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+		<-finished
+		assert.Equal(25, receiver.received())
+	})
+
+	test.Run("Should schedule a round for the retry of a failed delivery", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		require.Nil(database.AutoMigrate(&models.Job{}))
+		queue := jobs.NewQueue(database, dispatcher.Logger)
+		queue.Register(DeliverKind, dispatcher.Handle)
+		dispatcher.Jobs = queue
+		receiver := newReceiver(test, http.StatusServiceUnavailable)
+		register(database, 1, receiver.URL, true, events.VideoCreated)
+		require.Nil(dispatcher.Enqueue(database, 1, events.VideoCreated, nil))
+
+		// Act
+		exception := dispatcher.Handle(context.Background(), &models.Job{Kind: DeliverKind})
+
+		// Assert
+		require.Nil(exception)
+		delivery := deliveries(database)[0]
+		assert.Equal(models.DeliveryPending, delivery.Status)
+		scheduled := []models.Job{}
+		require.Nil(database.Order("id").Find(&scheduled, "kind = ?", DeliverKind).Error)
+		require.Len(scheduled, 2)
+		assert.WithinDuration(delivery.NextAttemptAt, scheduled[1].RunAt, time.Second)
+		for _, job := range scheduled {
+			assert.Equal(uint(1), job.UserID)
+		}
+	})
+
+	test.Run("Should send the deliveries concurrently up to the number of workers", func(test *testing.T) {
+		// Arrange
+		dispatcher, database := setup(test)
+		dispatcher.Workers = 3
+		var mutex sync.Mutex
+		running, peak := 0, 0
+		receiver := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			mutex.Lock()
+			running++
+			peak = max(peak, running)
+			mutex.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			writer.WriteHeader(http.StatusOK)
+		}))
+		defer receiver.Close()
+		register(database, 1, receiver.URL, true, events.VideoCreated)
+		for index := 0; index < 9; index++ {
+			require.Nil(dispatcher.Enqueue(database, 1, events.VideoCreated, index))
+		}
+
+		// Act
+		delivered, exception := dispatcher.Deliver(context.Background())
+
+		// Assert
+		require.Nil(exception)
+		assert.Equal(9, delivered)
+		assert.Greater(peak, 1)
+		assert.LessOrEqual(peak, 3)
+		for _, delivery := range deliveries(database) {
+			assert.Equal(models.DeliveryDelivered, delivery.Status)
+		}
+	})
+
+	test.Run("Should double the backoff up to the maximum", func(test *testing.T) {
+		dispatcher := &Dispatcher{Backoff: time.Hour}
+		assert.Equal(time.Hour, dispatcher.backoff(1))
+		assert.Equal(4*time.Hour, dispatcher.backoff(3))
+		assert.Equal(MaximumBackoff, dispatcher.backoff(100))
+	})
+}
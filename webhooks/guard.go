@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is the error of the webhooks pointing to an address
+// which is not public, e. g. the loopback, a private network or the metadata
+// service of the cloud provider.
+var ErrForbiddenAddress = errors.New("the address is not public")
+
+// reserved are the networks which are not routable on the internet besides the
+// ones the net package already tells apart.
+var reserved = []*net.IPNet{
+	network("0.0.0.0/8"),
+	network("100.64.0.0/10"),
+	network("192.0.0.0/24"),
+	network("192.0.2.0/24"),
+	network("198.18.0.0/15"),
+	network("198.51.100.0/24"),
+	network("203.0.113.0/24"),
+	network("240.0.0.0/4"),
+	network("64:ff9b::/96"),
+	network("2001:db8::/32"),
+}
+
+func network(cidr string) *net.IPNet {
+	_, parsed, _ := net.ParseCIDR(cidr)
+	return parsed
+}
+
+// Resolver looks up the addresses of a host, e. g. net.DefaultResolver.
+type Resolver interface {
+	LookupIPAddr(current context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Public tells whether the address is routable on the internet.
+func Public(address net.IP) bool {
+	if address == nil || address.IsUnspecified() || address.IsLoopback() || address.IsPrivate() ||
+		address.IsLinkLocalUnicast() || address.IsLinkLocalMulticast() ||
+		address.IsInterfaceLocalMulticast() || address.IsMulticast() {
+		return false
+	}
+	for _, network := range reserved {
+		if network.Contains(address) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckURL resolves the host of the URL and fails unless all its addresses are
+// public. It's checked again when the deliveries connect, as the host may be
+// resolved to another address by then.
+func CheckURL(current context.Context, resolver Resolver, raw string) error {
+	address, exception := url.Parse(raw)
+	if exception != nil {
+		return exception
+	}
+	host := strings.TrimSuffix(strings.ToLower(address.Hostname()), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%s: %w", host, ErrForbiddenAddress)
+	}
+	if literal := net.ParseIP(host); literal != nil {
+		if !Public(literal) {
+			return fmt.Errorf("%s: %w", host, ErrForbiddenAddress)
+		}
+		return nil
+	}
+
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addresses, exception := resolver.LookupIPAddr(current, host)
+	if exception != nil {
+		return exception
+	}
+	for _, resolved := range addresses {
+		if !Public(resolved.IP) {
+			return fmt.Errorf("%s resolves to %s: %w", host, resolved.IP, ErrForbiddenAddress)
+		}
+	}
+	return nil
+}
+
+// Control refuses the connections to addresses which are not public. It runs
+// once the host is resolved, right before connecting, so the checked address
+// is the one actually dialled.
+func Control(network string, address string, _ syscall.RawConn) error {
+	host, _, exception := net.SplitHostPort(address)
+	if exception != nil {
+		return exception
+	}
+	if !Public(net.ParseIP(host)) {
+		return fmt.Errorf("%s: %w", host, ErrForbiddenAddress)
+	}
+	return nil
+}
+
+// NewClient returns the HTTP client of the deliveries, which only connects to
+// public addresses, without proxies, and doesn't follow the redirections.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: Control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
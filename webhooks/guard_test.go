@@ -0,0 +1,122 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resolver is a fixed DNS for the tests.
+type resolver map[string][]string
+
+func (hosts resolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addresses, found := hosts[host]
+	if !found {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	resolved := []net.IPAddr{}
+	for _, address := range addresses {
+		resolved = append(resolved, net.IPAddr{IP: net.ParseIP(address)})
+	}
+	return resolved, nil
+}
+
+func TestGuard(test *testing.T) {
+	assert := assert.New(test)
+	require := require.New(test)
+	hosts := resolver{
+		"ci.io":       {"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"},
+		"internal.io": {"93.184.216.34", "10.0.0.7"},
+		"rebound.io":  {"127.0.0.1"},
+	}
+
+	testcases := []struct {
+		Description string
+		URL         string
+		Expected    error
+	}{
+		{"Should accept a host with public addresses", "https://ci.io/hook", nil},
+		{"Should accept a public IP address", "http://93.184.216.34:8080/hook", nil},
+		{"Should reject localhost", "http://localhost:8080/hook", ErrForbiddenAddress},
+		{"Should reject the subdomains of localhost", "http://api.localhost/hook", ErrForbiddenAddress},
+		{"Should reject the loopback", "http://127.0.0.1/hook", ErrForbiddenAddress},
+		{"Should reject the IPv6 loopback", "http://[::1]/hook", ErrForbiddenAddress},
+		{"Should reject the unspecified address", "http://0.0.0.0/hook", ErrForbiddenAddress},
+		{"Should reject a private network", "http://192.168.1.10/hook", ErrForbiddenAddress},
+		{"Should reject the metadata service", "http://169.254.169.254/latest/meta-data", ErrForbiddenAddress},
+		{"Should reject the shared address space", "http://100.64.0.1/hook", ErrForbiddenAddress},
+		{"Should reject an IPv4-mapped private address", "http://[::ffff:10.0.0.1]/hook", ErrForbiddenAddress},
+		{"Should reject a unique local IPv6 address", "http://[fd00::1]/hook", ErrForbiddenAddress},
+		{"Should reject a host with any private address", "https://internal.io/hook", ErrForbiddenAddress},
+		{"Should reject a host resolved to the loopback", "https://rebound.io/hook", ErrForbiddenAddress},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Act
+			exception := CheckURL(context.Background(), hosts, testcase.URL)
+
+			// Assert
+			if testcase.Expected == nil {
+				assert.Nil(exception)
+			} else {
+				assert.ErrorIs(exception, testcase.Expected)
+			}
+		})
+	}
+
+	test.Run("Should fail when the host can't be resolved", func(test *testing.T) {
+		// Act
+		exception := CheckURL(context.Background(), hosts, "https://unknown.io/hook")
+
+		// Assert
+		var failure *net.DNSError
+		assert.True(errors.As(exception, &failure))
+	})
+
+	test.Run("Should NOT connect to an address which is not public", func(test *testing.T) {
+		// Arrange
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.WriteHeader(http.StatusOK)
+		}))
+		defer server.Close()
+		client := NewClient(time.Second)
+
+		// Act
+		_, exception := client.Post(server.URL, "application/json", nil)
+
+		// Assert
+		assert.ErrorIs(exception, ErrForbiddenAddress)
+	})
+
+	test.Run("Should NOT follow the redirections", func(test *testing.T) {
+		// Arrange
+		followed := false
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if request.URL.Path == "/metadata" {
+				followed = true
+			}
+			http.Redirect(writer, request, "/metadata", http.StatusFound)
+		}))
+		defer server.Close()
+		client := NewClient(time.Second)
+		// The local server is only reachable with the default transport
+		client.Transport = http.DefaultTransport
+
+		// Act
+		response, exception := client.Post(server.URL+"/hook", "application/json", nil)
+
+		// Assert
+		require.Nil(exception)
+		defer response.Body.Close()
+		assert.Equal(http.StatusFound, response.StatusCode)
+		assert.False(followed)
+	})
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	SignatureHeader string = "X-NoteVook-Signature"
+	TimestampHeader string = "X-NoteVook-Timestamp"
+	EventHeader     string = "X-NoteVook-Event"
+	DeliveryHeader  string = "X-NoteVook-Delivery"
+	SignaturePrefix string = "sha256="
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredSignature = errors.New("expired webhook signature")
+)
+
+// Sign returns the signature of the body sent at the given time, which is the
+// hex HMAC-SHA256 of "<timestamp>.<body>" with the secret of the webhook. The
+// timestamp is signed along with the body so the deliveries can't be replayed
+// later on.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return SignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and timestamp headers of a delivery, the
+// receivers should reject the deliveries signed longer than the tolerance ago.
+func Verify(secret string, signature string, timestamp string, body []byte, tolerance time.Duration) error {
+	seconds, exception := strconv.ParseInt(timestamp, 10, 64)
+	if exception != nil {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, seconds, body))) {
+		return ErrInvalidSignature
+	}
+	if elapsed := time.Since(time.Unix(seconds, 0)); tolerance > 0 && (elapsed > tolerance || elapsed < -tolerance) {
+		return ErrExpiredSignature
+	}
+	return nil
+}
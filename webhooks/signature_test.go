@@ -0,0 +1,53 @@
+package webhooks
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignature(test *testing.T) {
+	assert := assert.New(test)
+	body := []byte(`{"id":"1","type":"video.created"}`)
+	now := time.Now().Unix()
+
+	test.Run("Should sign the timestamp along with the body", func(test *testing.T) {
+		// Act
+		signature := Sign("secret", 1700000000, body)
+
+		// Assert
+		assert.Equal("sha256=4af2b3504180da52ba82fd6671b0d71ea348a216c0d41f8fff754dd36c9500c9", signature)
+		assert.NotEqual(signature, Sign("secret", 1700000001, body))
+		assert.NotEqual(signature, Sign("other", 1700000000, body))
+	})
+
+	testcases := []struct {
+		Description string
+		Secret      string
+		Timestamp   string
+		Body        []byte
+		Expected    error
+	}{
+		{"Should accept the signature of the delivery", "secret", strconv.FormatInt(now, 10), body, nil},
+		{"Should reject a different secret", "other", strconv.FormatInt(now, 10), body, ErrInvalidSignature},
+		{"Should reject a different body", "secret", strconv.FormatInt(now, 10), []byte(`{}`), ErrInvalidSignature},
+		{"Should reject an invalid timestamp", "secret", "yesterday", body, ErrInvalidSignature},
+		{"Should reject an old delivery", "secret", strconv.FormatInt(now-3600, 10), body, ErrExpiredSignature},
+	}
+
+	for _, testcase := range testcases {
+		test.Run(testcase.Description, func(test *testing.T) {
+			// Arrange
+			seconds, _ := strconv.ParseInt(testcase.Timestamp, 10, 64)
+			signature := Sign("secret", seconds, body)
+
+			// Act
+			exception := Verify(testcase.Secret, signature, testcase.Timestamp, testcase.Body, 5*time.Minute)
+
+			// Assert
+			assert.Equal(testcase.Expected, exception)
+		})
+	}
+}